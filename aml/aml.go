@@ -0,0 +1,163 @@
+// Package aml monitors transaction history for money-laundering patterns that single
+// transactions do not reveal, and opens suspicious activity cases for compliance staff.
+package aml
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"banking-app/audit"
+	"banking-app/db"
+)
+
+// Case statuses stored in aml_cases.status
+const (
+	StatusOpen          = "open"
+	StatusInvestigating = "investigating"
+	StatusEscalated     = "escalated"
+	StatusFiled         = "filed"  // Suspicious activity report filed with the authorities
+	StatusClosed        = "closed" // No further action
+)
+
+// CanTransition reports whether a case may move from one status to another.
+// Filed and closed cases are final.
+func CanTransition(from, to string) bool {
+	switch from {
+	case StatusOpen:
+		return to == StatusInvestigating || to == StatusClosed
+	case StatusInvestigating:
+		return to == StatusEscalated || to == StatusClosed
+	case StatusEscalated:
+		return to == StatusFiled || to == StatusClosed || to == StatusInvestigating
+	}
+	return false
+}
+
+// EvidenceTransaction is a transaction supporting a finding
+type EvidenceTransaction struct {
+	TransactionID int       `json:"transaction_id"`
+	AccountID     int       `json:"account_id"`
+	Type          string    `json:"type"`
+	Amount        float64   `json:"amount"`
+	Date          time.Time `json:"date"`
+}
+
+// Evidence is stored with a case
+type Evidence struct {
+	Summary      string                `json:"summary"`
+	Transactions []EvidenceTransaction `json:"transactions"`
+}
+
+// Finding is a pattern detected on one account
+type Finding struct {
+	Scenario   string
+	AccountID  int
+	CustomerID int
+	Amount     float64 // Total amount involved
+	Evidence   Evidence
+}
+
+// Detector looks for one pattern in the history up to the end of the business day asOf
+type Detector interface {
+	Scenario() string
+	Window() time.Duration // How far back the pattern reaches; also suppresses duplicate cases
+	Detect(asOf time.Time) ([]Finding, error)
+}
+
+// Detectors are run by Scan
+var Detectors = []Detector{
+	Structuring{Threshold: 10000, Band: 0.1, MinCount: 3, Days: 7},
+	RapidMovement{MinInflow: 5000, OutflowRatio: 0.8, Hours: 48},
+	DormantReactivation{DormantDays: 180, MinAmount: 1000},
+}
+
+// process is recorded as the request ID of audit entries written by the scanner
+const process = "aml-scan"
+
+// Scan runs every detector for the business date asOf and opens a case for each new
+// finding. A finding is skipped if a case for the same scenario and account was opened
+// within the detector's window, so scans can be repeated and windows may overlap.
+// It returns the number of cases opened.
+func Scan(asOf time.Time) (int, error) {
+	asOf = time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+	opened, failed := 0, 0
+	for _, d := range Detectors {
+		findings, err := d.Detect(asOf)
+		if err != nil {
+			log.Printf("Error running AML detector %s: %v", d.Scenario(), err)
+			failed++
+			continue
+		}
+		for _, f := range findings {
+			ok, err := openCase(f, asOf, d.Window())
+			if err != nil {
+				log.Printf("Error opening AML case for account %d: %v", f.AccountID, err)
+				failed++
+				continue
+			}
+			if ok {
+				opened++
+			}
+		}
+	}
+	if failed > 0 {
+		return opened, fmt.Errorf("AML scan had %d failures", failed)
+	}
+	return opened, nil
+}
+
+func openCase(f Finding, asOf time.Time, window time.Duration) (bool, error) {
+	evidence, err := json.Marshal(f.Evidence)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	// Locking the account serializes concurrent scans of the same account
+	if _, err := tx.Exec("SELECT account_id FROM accounts WHERE account_id = ? FOR UPDATE", f.AccountID); err != nil {
+		return false, err
+	}
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM aml_cases WHERE scenario = ? AND account_id = ? AND detected_for > ?)",
+		f.Scenario, f.AccountID, asOf.Add(-window)).Scan(&exists)
+	if err != nil || exists {
+		return false, err
+	}
+
+	result, err := tx.Exec(`INSERT INTO aml_cases (scenario, account_id, customer_id, amount, evidence, detected_for) VALUES (?, ?, ?, ?, ?, ?)`,
+		f.Scenario, f.AccountID, f.CustomerID, f.Amount, string(evidence), asOf)
+	if err != nil {
+		return false, err
+	}
+	caseID, err := result.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+	if err := AddEvent(tx, caseID, "", StatusOpen, nil, f.Evidence.Summary); err != nil {
+		return false, err
+	}
+	err = audit.RecordSystemTx(tx, process, audit.Entry{Action: "aml_case.open", EntityType: "aml_case", EntityID: fmt.Sprint(caseID),
+		After: map[string]interface{}{"scenario": f.Scenario, "account_id": f.AccountID, "amount": f.Amount}})
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// AddEvent appends to a case's history
+func AddEvent(tx *sql.Tx, caseID int64, from, to string, actorUserID *int, note string) error {
+	_, err := tx.Exec("INSERT INTO aml_case_events (case_id, from_status, to_status, actor_user_id, note) VALUES (?, ?, ?, ?, ?)",
+		caseID, from, to, actorUserID, note)
+	if err != nil {
+		return fmt.Errorf("recording event of AML case %d: %w", caseID, err)
+	}
+	return nil
+}
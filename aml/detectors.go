@@ -0,0 +1,199 @@
+package aml
+
+import (
+	"fmt"
+	"time"
+
+	"banking-app/db"
+)
+
+// Customer-initiated movements; fees and interest posted by the bank are ignored
+const (
+	inflowTypes  = "'deposit', 'transfer_in'"
+	outflowTypes = "'withdrawal', 'transfer_out'"
+)
+
+// loadEvidence returns the transactions of an account matching a type list in [from, to)
+func loadEvidence(accountID int, types string, from, to time.Time, minAmount, maxAmount float64) ([]EvidenceTransaction, error) {
+	rows, err := db.DB.Query(`SELECT transaction_id, account_id, type, amount, transaction_date FROM transactions
+		WHERE account_id = ? AND type IN (`+types+`) AND transaction_date >= ? AND transaction_date < ? AND amount >= ? AND amount < ?
+		ORDER BY transaction_date, transaction_id`, accountID, from, to, minAmount, maxAmount)
+	if err != nil {
+		return nil, fmt.Errorf("loading evidence for account %d: %w", accountID, err)
+	}
+	defer rows.Close()
+
+	var txns []EvidenceTransaction
+	for rows.Next() {
+		var t EvidenceTransaction
+		if err := rows.Scan(&t.TransactionID, &t.AccountID, &t.Type, &t.Amount, &t.Date); err != nil {
+			return nil, fmt.Errorf("scanning evidence for account %d: %w", accountID, err)
+		}
+		txns = append(txns, t)
+	}
+	return txns, rows.Err()
+}
+
+type candidateAccount struct {
+	accountID, customerID int
+	total                 float64
+	count                 int
+}
+
+func loadCandidates(query string, args ...interface{}) ([]candidateAccount, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []candidateAccount
+	for rows.Next() {
+		var c candidateAccount
+		if err := rows.Scan(&c.accountID, &c.customerID, &c.total, &c.count); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// Structuring detects several cash deposits just below the reporting threshold,
+// e.g. three or more deposits of 9,000-9,999.99 within a week
+type Structuring struct {
+	Threshold float64
+	Band      float64 // Fraction below Threshold counted as "just below"
+	MinCount  int
+	Days      int
+}
+
+func (Structuring) Scenario() string { return "structuring" }
+
+func (s Structuring) Window() time.Duration { return time.Duration(s.Days) * 24 * time.Hour }
+
+func (s Structuring) Detect(asOf time.Time) ([]Finding, error) {
+	from, to := asOf.AddDate(0, 0, 1-s.Days), asOf.AddDate(0, 0, 1)
+	low := s.Threshold * (1 - s.Band)
+	candidates, err := loadCandidates(`SELECT t.account_id, a.customer_id, SUM(t.amount), COUNT(*)
+		FROM transactions t JOIN accounts a ON a.account_id = t.account_id
+		WHERE t.type = 'deposit' AND t.amount >= ? AND t.amount < ? AND t.transaction_date >= ? AND t.transaction_date < ?
+		GROUP BY t.account_id, a.customer_id HAVING COUNT(*) >= ?`, low, s.Threshold, from, to, s.MinCount)
+	if err != nil {
+		return nil, fmt.Errorf("finding structured deposits: %w", err)
+	}
+
+	var findings []Finding
+	for _, c := range candidates {
+		txns, err := loadEvidence(c.accountID, "'deposit'", from, to, low, s.Threshold)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, Finding{Scenario: s.Scenario(), AccountID: c.accountID, CustomerID: c.customerID, Amount: c.total,
+			Evidence: Evidence{
+				Summary:      fmt.Sprintf("%d deposits totalling %.2f between %.2f and %.2f within %d days", c.count, c.total, low, s.Threshold, s.Days),
+				Transactions: txns,
+			}})
+	}
+	return findings, nil
+}
+
+// RapidMovement detects money that leaves an account shortly after arriving: inflows of
+// at least MinInflow with outflows of at least OutflowRatio of them within the window
+type RapidMovement struct {
+	MinInflow    float64
+	OutflowRatio float64
+	Hours        int
+}
+
+func (RapidMovement) Scenario() string { return "rapid_movement" }
+
+func (m RapidMovement) Window() time.Duration { return time.Duration(m.Hours) * time.Hour }
+
+func (m RapidMovement) Detect(asOf time.Time) ([]Finding, error) {
+	to := asOf.AddDate(0, 0, 1)
+	from := to.Add(-m.Window())
+	rows, err := db.DB.Query(`SELECT t.account_id, a.customer_id,
+			SUM(CASE WHEN t.type IN (`+inflowTypes+`) THEN t.amount ELSE 0 END),
+			SUM(CASE WHEN t.type IN (`+outflowTypes+`) THEN t.amount ELSE 0 END)
+		FROM transactions t JOIN accounts a ON a.account_id = t.account_id
+		WHERE t.transaction_date >= ? AND t.transaction_date < ?
+		GROUP BY t.account_id, a.customer_id`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("summing account flows: %w", err)
+	}
+	type flow struct {
+		accountID, customerID int
+		in, out               float64
+	}
+	var flows []flow
+	for rows.Next() {
+		var f flow
+		if err := rows.Scan(&f.accountID, &f.customerID, &f.in, &f.out); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning account flows: %w", err)
+		}
+		if f.in >= m.MinInflow && f.out >= m.OutflowRatio*f.in {
+			flows = append(flows, f)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("summing account flows: %w", err)
+	}
+
+	var findings []Finding
+	for _, f := range flows {
+		txns, err := loadEvidence(f.accountID, inflowTypes+", "+outflowTypes, from, to, 0, 1e15)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, Finding{Scenario: m.Scenario(), AccountID: f.accountID, CustomerID: f.customerID, Amount: f.in + f.out,
+			Evidence: Evidence{
+				Summary:      fmt.Sprintf("%.2f in and %.2f out within %d hours", f.in, f.out, m.Hours),
+				Transactions: txns,
+			}})
+	}
+	return findings, nil
+}
+
+// DormantReactivation detects accounts with no customer activity for DormantDays that
+// suddenly move at least MinAmount on the business date
+type DormantReactivation struct {
+	DormantDays int
+	MinAmount   float64
+}
+
+func (DormantReactivation) Scenario() string { return "dormant_reactivation" }
+
+func (d DormantReactivation) Window() time.Duration {
+	return time.Duration(d.DormantDays) * 24 * time.Hour
+}
+
+func (d DormantReactivation) Detect(asOf time.Time) ([]Finding, error) {
+	from, to := asOf, asOf.AddDate(0, 0, 1)
+	dormantSince := asOf.AddDate(0, 0, -d.DormantDays)
+	// The account must be older than the dormancy period and have no activity in it before today
+	candidates, err := loadCandidates(`SELECT t.account_id, a.customer_id, SUM(t.amount), COUNT(*)
+		FROM transactions t JOIN accounts a ON a.account_id = t.account_id
+		WHERE t.type IN (`+inflowTypes+`, `+outflowTypes+`) AND t.transaction_date >= ? AND t.transaction_date < ? AND a.opened_date < ?
+		AND NOT EXISTS (SELECT 1 FROM transactions p WHERE p.account_id = t.account_id
+			AND p.type IN (`+inflowTypes+`, `+outflowTypes+`) AND p.transaction_date >= ? AND p.transaction_date < ?)
+		GROUP BY t.account_id, a.customer_id HAVING SUM(t.amount) >= ?`, from, to, dormantSince, dormantSince, from, d.MinAmount)
+	if err != nil {
+		return nil, fmt.Errorf("finding reactivated dormant accounts: %w", err)
+	}
+
+	var findings []Finding
+	for _, c := range candidates {
+		txns, err := loadEvidence(c.accountID, inflowTypes+", "+outflowTypes, from, to, 0, 1e15)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, Finding{Scenario: d.Scenario(), AccountID: c.accountID, CustomerID: c.customerID, Amount: c.total,
+			Evidence: Evidence{
+				Summary:      fmt.Sprintf("%d movements totalling %.2f after more than %d days without activity", c.count, c.total, d.DormantDays),
+				Transactions: txns,
+			}})
+	}
+	return findings, nil
+}
@@ -0,0 +1,174 @@
+// Package approvals implements maker-checker control of high-value staff operations.
+// A handler asks Required whether an operation needs a second person; if so it stores
+// the request with Submit instead of executing it. Once another employee approves, the
+// stored request is executed by the same operation as its maker, so the operation's own
+// checks run again against the state at execution time. The execution claims the request
+// in the operation's transaction, so a request whose execution was interrupted shows
+// whether the operation took effect and cannot take effect twice.
+package approvals
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"banking-app/auth"
+	"banking-app/db"
+)
+
+// Operations that can require approval, keyed in approval_thresholds
+const (
+	OpTransfer       = "transfer"
+	OpOverdraft      = "overdraft"
+	OpAccountClosure = "account_closure"
+	OpReversal       = "reversal"
+	OpDisputeCredit  = "dispute_credit"
+)
+
+// IsOperation reports whether op is a known operation
+func IsOperation(op string) bool {
+	return op == OpTransfer || op == OpOverdraft || op == OpAccountClosure || op == OpReversal || op == OpDisputeCredit
+}
+
+// Request statuses stored in approval_requests.status
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved" // Approved and being executed
+	StatusRejected = "rejected"
+	StatusExecuted = "executed"
+	StatusAccepted = "accepted" // Executed, but the operation was held or scheduled (HTTP 202) and has not finished
+	StatusFailed   = "failed"   // Approved but the operation refused it on execution
+)
+
+// ErrAlreadyExecuted is returned by Claim when another execution of the request took effect
+var ErrAlreadyExecuted = errors.New("approval request has already been executed")
+
+// Threshold is the approval rule of one operation
+type Threshold struct {
+	Threshold   *float64 // Amounts at or above it need approval; nil never does
+	CheckerRole string   // auth.RoleEmployee or auth.RoleAdmin
+}
+
+// GetThreshold loads the rule of an operation. An unconfigured operation needs no approval.
+func GetThreshold(q db.Querier, op string) (Threshold, error) {
+	t := Threshold{CheckerRole: auth.RoleEmployee}
+	err := q.QueryRow("SELECT threshold, checker_role FROM approval_thresholds WHERE operation = ?", op).Scan(&t.Threshold, &t.CheckerRole)
+	if err != nil && err != sql.ErrNoRows {
+		return t, fmt.Errorf("loading approval threshold of %s: %w", op, err)
+	}
+	return t, nil
+}
+
+// Execution is one attempt at executing an approved request
+type Execution struct {
+	RequestID int64  // approval_requests.approval_request_id
+	Token     string // Stored on the request by the attempt that takes effect
+}
+
+// NewExecution starts an attempt at executing an approved request
+func NewExecution(id int64) Execution {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return Execution{RequestID: id, Token: hex.EncodeToString(b)}
+}
+
+// Claim records in tx, the transaction the operation runs in, that execution e has taken
+// effect, so that the claim commits or rolls back with the operation itself. It fails with
+// ErrAlreadyExecuted if another execution of the request claimed it first or the request
+// has already been given up as failed.
+func Claim(tx *sql.Tx, e Execution) error {
+	status, claimedBy, err := Lock(tx, e.RequestID)
+	if err != nil {
+		return err
+	}
+	if claimedBy == e.Token {
+		return nil
+	}
+	if claimedBy != "" || status != StatusApproved {
+		return ErrAlreadyExecuted
+	}
+	_, err = tx.Exec("UPDATE approval_requests SET execution_id = ?, executed_at = NOW() WHERE approval_request_id = ?", e.Token, e.RequestID)
+	if err != nil {
+		return fmt.Errorf("claiming approval request %d: %w", e.RequestID, err)
+	}
+	return nil
+}
+
+// Lock locks a request and returns its status and the token of the execution that took
+// effect, "" if none has
+func Lock(tx *sql.Tx, id int64) (string, string, error) {
+	var status string
+	var token sql.NullString
+	if err := tx.QueryRow("SELECT status, execution_id FROM approval_requests WHERE approval_request_id = ? FOR UPDATE", id).Scan(&status, &token); err != nil {
+		return "", "", fmt.Errorf("locking approval request %d: %w", id, err)
+	}
+	return status, token.String, nil
+}
+
+// Required reports whether an operation of amount by actor must wait for a checker.
+// Customers are not subject to maker-checker.
+func Required(q db.Querier, actor auth.Actor, op string, amount float64) (bool, error) {
+	if !actor.IsEmployee() {
+		return false, nil
+	}
+	t, err := GetThreshold(q, op)
+	if err != nil {
+		return false, err
+	}
+	return t.Threshold != nil && amount >= *t.Threshold, nil
+}
+
+// Pending describes an operation to store for approval
+type Pending struct {
+	Operation  string
+	EntityType string
+	EntityID   string
+	BranchID   int
+	Amount     float64
+	RouteVars  map[string]string
+	Body       interface{} // The decoded request body, stored as JSON for the execution
+}
+
+// Submit stores a pending request made by maker and returns its ID
+func Submit(tx *sql.Tx, p Pending, maker int) (int64, error) {
+	vars, err := json.Marshal(p.RouteVars)
+	if err != nil {
+		return 0, fmt.Errorf("encoding route variables: %w", err)
+	}
+	body, err := json.Marshal(p.Body)
+	if err != nil {
+		return 0, fmt.Errorf("encoding request body: %w", err)
+	}
+	result, err := tx.Exec(`INSERT INTO approval_requests (operation, entity_type, entity_id, branch_id, amount, route_vars, body, maker_user_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, p.Operation, p.EntityType, p.EntityID, p.BranchID, p.Amount, vars, body, maker)
+	if err != nil {
+		return 0, fmt.Errorf("storing %s approval request: %w", p.Operation, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, AddEvent(tx, id, "", StatusPending, &maker, "")
+}
+
+// CanCheck reports whether actor may decide a request with the given maker and branch
+// under the operation's rule: another member of staff of the branch, with the required role
+func CanCheck(actor auth.Actor, t Threshold, maker, branchID int) bool {
+	if actor.UserID == maker || !actor.IsStaffOf(branchID) {
+		return false
+	}
+	return t.CheckerRole != auth.RoleAdmin || actor.IsAdmin()
+}
+
+// AddEvent records a status change of a request
+func AddEvent(tx *sql.Tx, id int64, from, to string, actorUserID *int, note string) error {
+	_, err := tx.Exec("INSERT INTO approval_request_events (approval_request_id, from_status, to_status, actor_user_id, note) VALUES (?, ?, ?, ?, ?)",
+		id, from, to, actorUserID, note)
+	if err != nil {
+		return fmt.Errorf("recording event of approval request %d: %w", id, err)
+	}
+	return nil
+}
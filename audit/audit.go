@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"banking-app/auth"
+	"banking-app/db"
+)
+
+// RoleAnonymous is recorded when a request carries no known user
+const RoleAnonymous = "anonymous"
+
+// RoleSystem is recorded for changes made by batch jobs and the card network
+const RoleSystem = "system"
+
+// Entry describes one state change
+type Entry struct {
+	Action     string      // What happened, e.g. "account.deposit"
+	EntityType string      // Kind of entity changed, e.g. "account"
+	EntityID   string      // Identifier of the entity changed
+	Before     interface{} // State before the change, nil for creations
+	After      interface{} // State after the change, nil for deletions
+}
+
+// Row is a stored audit log row
+type Row struct {
+	Seq         int64
+	CreatedAt   time.Time
+	ActorUserID *int
+	ActorRole   string
+	Action      string
+	EntityType  string
+	EntityID    string
+	Before      *string
+	After       *string
+	RequestID   string
+	PrevHash    string
+	Hash        string
+}
+
+// genesisHash is the previous hash of the first row
+var genesisHash = strings.Repeat("0", 64)
+
+// RecordTx appends an entry inside the caller's SQL transaction, so the audit row
+// is committed if and only if the change itself is
+func RecordTx(tx *sql.Tx, r *http.Request, e Entry) error {
+	row := Row{ActorRole: RoleAnonymous, RequestID: RequestID(r)}
+	if actor, err := auth.FromRequest(r); err == nil {
+		row.ActorUserID = &actor.UserID
+		row.ActorRole = actor.Role
+	} else if err != auth.ErrUnauthenticated {
+		return err
+	}
+	return write(tx, row, e)
+}
+
+// Record appends an entry in its own SQL transaction. Use it for reads that must be
+// audited; changes are recorded with RecordTx in their own transaction.
+func Record(r *http.Request, e Entry) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("starting audit transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	if err := RecordTx(tx, r, e); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordSystemTx appends an entry made by a non-HTTP process such as a batch job
+func RecordSystemTx(tx *sql.Tx, process string, e Entry) error {
+	return write(tx, Row{ActorRole: RoleSystem, RequestID: process}, e)
+}
+
+func write(tx *sql.Tx, row Row, e Entry) error {
+	var err error
+	row.Action, row.EntityType, row.EntityID = e.Action, e.EntityType, e.EntityID
+	if row.Before, err = encode(e.Before); err != nil {
+		return err
+	}
+	if row.After, err = encode(e.After); err != nil {
+		return err
+	}
+
+	// Locking the head serializes writers, so seq has no gaps and every row links to its predecessor
+	var headSeq int64
+	var headHash string
+	if err := tx.QueryRow("SELECT seq, hash FROM audit_chain_head WHERE id = 1 FOR UPDATE").Scan(&headSeq, &headHash); err != nil {
+		return fmt.Errorf("locking audit chain head: %w", err)
+	}
+
+	row.Seq = headSeq + 1
+	row.PrevHash = headHash
+	row.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	row.Hash = Hash(row)
+
+	_, err = tx.Exec(`INSERT INTO audit_log (seq, created_at, actor_user_id, actor_role, action, entity_type, entity_id,
+		before_value, after_value, request_id, prev_hash, hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		row.Seq, row.CreatedAt, row.ActorUserID, row.ActorRole, row.Action, row.EntityType, row.EntityID,
+		row.Before, row.After, row.RequestID, row.PrevHash, row.Hash)
+	if err != nil {
+		return fmt.Errorf("inserting audit row: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE audit_chain_head SET seq = ?, hash = ? WHERE id = 1", row.Seq, row.Hash); err != nil {
+		return fmt.Errorf("advancing audit chain head: %w", err)
+	}
+	return nil
+}
+
+func encode(v interface{}) (*string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("encoding audit value: %w", err)
+	}
+	s := string(b)
+	return &s, nil
+}
+
+// Hash computes the chained hash of a row from its contents and PrevHash.
+// Fields are length-prefixed so no two different rows serialize the same way.
+func Hash(row Row) string {
+	h := sha256.New()
+	field := func(s string) {
+		fmt.Fprintf(h, "%d:%s|", len(s), s)
+	}
+	optional := func(s *string) {
+		if s == nil {
+			field("\x00null")
+			return
+		}
+		field(*s)
+	}
+
+	field(strconv.FormatInt(row.Seq, 10))
+	field(row.PrevHash)
+	field(row.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z"))
+	if row.ActorUserID != nil {
+		field(strconv.Itoa(*row.ActorUserID))
+	} else {
+		field("\x00null")
+	}
+	field(row.ActorRole)
+	field(row.Action)
+	field(row.EntityType)
+	field(row.EntityID)
+	optional(row.Before)
+	optional(row.After)
+	field(row.RequestID)
+	return hex.EncodeToString(h.Sum(nil))
+}
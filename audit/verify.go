@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"fmt"
+
+	"banking-app/db"
+)
+
+// Problem is an inconsistency found in the audit chain
+type Problem struct {
+	Seq     int64
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("seq %d: %s", p.Seq, p.Message)
+}
+
+// Verify walks the whole audit log and reports missing rows, rows whose contents
+// no longer match their hash, broken links between rows and a chain head that
+// does not point at the last row.
+func Verify() ([]Problem, int64, error) {
+	rows, err := db.DB.Query(`SELECT seq, created_at, actor_user_id, actor_role, action, entity_type, entity_id,
+		before_value, after_value, request_id, prev_hash, hash FROM audit_log ORDER BY seq`)
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading audit log: %w", err)
+	}
+	defer rows.Close()
+
+	c := newChain()
+	for rows.Next() {
+		var row Row
+		if err := rows.Scan(&row.Seq, &row.CreatedAt, &row.ActorUserID, &row.ActorRole, &row.Action, &row.EntityType, &row.EntityID,
+			&row.Before, &row.After, &row.RequestID, &row.PrevHash, &row.Hash); err != nil {
+			return nil, c.count, fmt.Errorf("scanning audit row: %w", err)
+		}
+		c.add(row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, c.count, fmt.Errorf("reading audit log: %w", err)
+	}
+
+	var headSeq int64
+	var headHash string
+	if err := db.DB.QueryRow("SELECT seq, hash FROM audit_chain_head WHERE id = 1").Scan(&headSeq, &headHash); err != nil {
+		return nil, c.count, fmt.Errorf("reading audit chain head: %w", err)
+	}
+	c.head(headSeq, headHash)
+	return c.problems, c.count, nil
+}
+
+// chain checks audit rows read in seq order against each other and the chain head
+type chain struct {
+	problems     []Problem
+	count        int64
+	expectedSeq  int64
+	expectedPrev string
+}
+
+func newChain() *chain {
+	return &chain{expectedSeq: 1, expectedPrev: genesisHash}
+}
+
+// add checks the next row read
+func (c *chain) add(row Row) {
+	c.count++
+	if row.Seq != c.expectedSeq {
+		c.problems = append(c.problems, Problem{row.Seq, fmt.Sprintf("gap: rows %d to %d are missing", c.expectedSeq, row.Seq-1)})
+	} else if row.PrevHash != c.expectedPrev {
+		c.problems = append(c.problems, Problem{row.Seq, "previous hash does not match the preceding row"})
+	}
+	if Hash(row) != row.Hash {
+		c.problems = append(c.problems, Problem{row.Seq, "contents do not match the stored hash"})
+	}
+	c.expectedSeq, c.expectedPrev = row.Seq+1, row.Hash
+}
+
+// head checks the chain head once every row has been read
+func (c *chain) head(seq int64, hash string) {
+	if seq != c.expectedSeq-1 || hash != c.expectedPrev {
+		c.problems = append(c.problems, Problem{seq, fmt.Sprintf("chain head points at seq %d but the log ends at seq %d", seq, c.expectedSeq-1)})
+	}
+}
@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func strPtr(s string) *string { return &s }
+
+// testChain returns n correctly chained rows
+func testChain(n int) []Row {
+	user := 7
+	rows := make([]Row, n)
+	prev := genesisHash
+	for i := range rows {
+		rows[i] = Row{
+			Seq:         int64(i + 1),
+			CreatedAt:   time.Date(2026, 3, 1, 9, 30, i, 123456000, time.UTC),
+			ActorUserID: &user,
+			ActorRole:   "teller",
+			Action:      "account.deposit",
+			EntityType:  "account",
+			EntityID:    "1000000001",
+			Before:      strPtr(`{"balance":100}`),
+			After:       strPtr(`{"balance":150}`),
+			RequestID:   "req-1",
+			PrevHash:    prev,
+		}
+		rows[i].Hash = Hash(rows[i])
+		prev = rows[i].Hash
+	}
+	return rows
+}
+
+func TestHash(t *testing.T) {
+	base := testChain(1)[0]
+	want := Hash(base)
+	if len(want) != 64 {
+		t.Fatalf("Hash = %q, want 64 hex digits", want)
+	}
+	if got := Hash(base); got != want {
+		t.Errorf("Hash is not deterministic: %q and %q", want, got)
+	}
+
+	local := base
+	local.CreatedAt = base.CreatedAt.In(time.FixedZone("UTC+2", 2*60*60))
+	if got := Hash(local); got != want {
+		t.Errorf("Hash depends on the time zone of CreatedAt: %q, want %q", got, want)
+	}
+
+	changes := []struct {
+		name   string
+		change func(r *Row)
+	}{
+		{"seq", func(r *Row) { r.Seq++ }},
+		{"previous hash", func(r *Row) { r.PrevHash = strings.Repeat("1", 64) }},
+		{"created at", func(r *Row) { r.CreatedAt = r.CreatedAt.Add(time.Microsecond) }},
+		{"actor", func(r *Row) { other := 8; r.ActorUserID = &other }},
+		{"no actor", func(r *Row) { r.ActorUserID = nil }},
+		{"role", func(r *Row) { r.ActorRole = "admin" }},
+		{"action", func(r *Row) { r.Action = "account.withdraw" }},
+		{"entity type", func(r *Row) { r.EntityType = "user" }},
+		{"entity id", func(r *Row) { r.EntityID = "1000000002" }},
+		{"before", func(r *Row) { r.Before = strPtr(`{"balance":101}`) }},
+		{"no before", func(r *Row) { r.Before = nil }},
+		{"empty before", func(r *Row) { r.Before = strPtr("") }},
+		{"after", func(r *Row) { r.After = strPtr(`{"balance":151}`) }},
+		{"request id", func(r *Row) { r.RequestID = "req-2" }},
+		// Without length prefixes these two would serialize the same way
+		{"text moved between fields", func(r *Row) { r.EntityType, r.EntityID = "account1", "000000001" }},
+	}
+	for _, c := range changes {
+		t.Run(c.name, func(t *testing.T) {
+			row := base
+			c.change(&row)
+			if got := Hash(row); got == want {
+				t.Errorf("changing the %s does not change the hash", c.name)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(rows []Row) []Row
+		want   []Problem
+	}{
+		{
+			name:   "intact",
+			tamper: func(rows []Row) []Row { return rows },
+		},
+		{
+			name: "edited row",
+			tamper: func(rows []Row) []Row {
+				rows[1].After = strPtr(`{"balance":1000000}`)
+				return rows
+			},
+			want: []Problem{{2, "contents do not match the stored hash"}},
+		},
+		{
+			name: "edited and rehashed row",
+			tamper: func(rows []Row) []Row {
+				rows[1].After = strPtr(`{"balance":1000000}`)
+				rows[1].Hash = Hash(rows[1])
+				return rows
+			},
+			want: []Problem{{3, "previous hash does not match the preceding row"}},
+		},
+		{
+			name:   "deleted row",
+			tamper: func(rows []Row) []Row { return append(rows[:1], rows[2:]...) },
+			want:   []Problem{{3, "gap: rows 2 to 2 are missing"}},
+		},
+		{
+			name:   "deleted last row",
+			tamper: func(rows []Row) []Row { return rows[:2] },
+			want:   []Problem{{3, "chain head points at seq 3 but the log ends at seq 2"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := testChain(3)
+			headSeq, headHash := rows[2].Seq, rows[2].Hash
+
+			c := newChain()
+			for _, row := range tt.tamper(rows) {
+				c.add(row)
+			}
+			c.head(headSeq, headHash)
+			if len(c.problems) != len(tt.want) {
+				t.Fatalf("problems = %v, want %v", c.problems, tt.want)
+			}
+			for i := range tt.want {
+				if c.problems[i] != tt.want[i] {
+					t.Errorf("problem %d = %v, want %v", i, c.problems[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
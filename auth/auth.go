@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"banking-app/db"
+)
+
+// User roles stored in users.role
+const (
+	RoleAdmin    = "admin"
+	RoleEmployee = "employee"
+	RoleCustomer = "customer"
+)
+
+// UserHeader carries the ID of the user a request is made for. Any client can set it to
+// any ID, so it is not authentication: it is a stand-in for development until real
+// session or token authentication exists, and is only read when TrustUserHeader is set.
+const UserHeader = "X-User-ID"
+
+// TrustUserHeader makes FromRequest take the actor from UserHeader. It must only be
+// set in development; while it is false every request is unauthenticated.
+var TrustUserHeader bool
+
+// ErrUnauthenticated is returned when the request does not identify a known user
+var ErrUnauthenticated = errors.New("missing or unknown user")
+
+// Actor is the user on whose behalf a request is made
+type Actor struct {
+	UserID     int
+	Username   string
+	Role       string
+	CustomerID *int
+	EmployeeID *int
+	BranchID   *int // Branch of the employee, if the user is an employee
+}
+
+// IsAdmin reports whether the actor is an administrator
+func (a Actor) IsAdmin() bool {
+	return a.Role == RoleAdmin
+}
+
+// IsEmployee reports whether the actor is bank staff (employees and administrators)
+func (a Actor) IsEmployee() bool {
+	return a.Role == RoleAdmin || (a.Role == RoleEmployee && a.EmployeeID != nil)
+}
+
+// IsStaffOf reports whether the actor may act on data of the given branch:
+// administrators everywhere, employees only at their own branch
+func (a Actor) IsStaffOf(branchID int) bool {
+	if a.IsAdmin() {
+		return true
+	}
+	return a.Role == RoleEmployee && a.BranchID != nil && *a.BranchID == branchID
+}
+
+type actorKey struct{}
+
+// WithActor makes requests with the returned context act for actor, whatever their
+// headers. It is used to execute an approved request as the employee who made it.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// FromRequest identifies the actor from the request context or headers
+func FromRequest(r *http.Request) (Actor, error) {
+	if a, ok := r.Context().Value(actorKey{}).(Actor); ok {
+		return a, nil
+	}
+	if !TrustUserHeader {
+		return Actor{}, ErrUnauthenticated
+	}
+	id, err := strconv.Atoi(r.Header.Get(UserHeader))
+	if err != nil {
+		return Actor{}, ErrUnauthenticated
+	}
+	return Lookup(id)
+}
+
+// Lookup loads the user with the given ID, returning ErrUnauthenticated if there is none
+func Lookup(id int) (Actor, error) {
+	var a Actor
+	err := db.DB.QueryRow(`SELECT u.user_id, u.username, u.role, u.customer_id, u.employee_id, e.branch_id
+		FROM users u LEFT JOIN employees e ON e.employee_id = u.employee_id
+		WHERE u.user_id = ?`, id).Scan(&a.UserID, &a.Username, &a.Role, &a.CustomerID, &a.EmployeeID, &a.BranchID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Actor{}, ErrUnauthenticated
+		}
+		return Actor{}, fmt.Errorf("loading user %d: %w", id, err)
+	}
+	return a, nil
+}
@@ -0,0 +1,36 @@
+// Package blobstore stores opaque binary objects, such as uploaded documents, under
+// string keys. Store implementations can be swapped without touching their callers.
+package blobstore
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrNotFound is returned when no object is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// Store is a key-value store for binary objects
+type Store interface {
+	// Put stores the contents of r under key, replacing any existing object
+	Put(key string, r io.Reader) error
+	// Get opens the object stored under key; the caller must close it
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key; deleting a missing object is not an error
+	Delete(key string) error
+}
+
+// validKey reports whether key is a relative slash-separated path without empty,
+// "." or ".." segments, so that no implementation can be made to escape its root
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.ContainsRune(segment, '\\') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+// Package calendar decides which days are business days and which business day a payment
+// is value-dated to. Saturdays and Sundays are never business days; bank holidays are
+// loaded per country from files. A payment requested at or after the cut-off time of
+// its type, or on a business date that is not a business day, is value-dated to the next
+// business day.
+package calendar
+
+import (
+	"fmt"
+	"time"
+
+	"banking-app/db"
+)
+
+// Country is the calendar that applies to payments; main replaces it from the configuration
+var Country = "GB"
+
+// Payment types with their own cut-off, stored in cut_off_times.payment_type
+const (
+	PaymentTransfer = "transfer" // To an account number
+	PaymentPayee    = "payee"    // To a saved payee
+)
+
+// IsPaymentType reports whether s is a known payment type
+func IsPaymentType(s string) bool {
+	return s == PaymentTransfer || s == PaymentPayee
+}
+
+// maxClosedDays bounds the search for the next business day
+const maxClosedDays = 31
+
+// IsBusinessDay reports whether d is a business day in a country's calendar
+func IsBusinessDay(q db.Querier, country string, d time.Time) (bool, error) {
+	if wd := d.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false, nil
+	}
+	var holidays int
+	err := q.QueryRow("SELECT COUNT(*) FROM holidays WHERE country = ? AND holiday_date = ?", country, d.Format("2006-01-02")).Scan(&holidays)
+	if err != nil {
+		return false, fmt.Errorf("checking %s calendar for %s: %w", country, d.Format("2006-01-02"), err)
+	}
+	return holidays == 0, nil
+}
+
+// NextBusinessDay returns the first business day after d in a country's calendar
+func NextBusinessDay(q db.Querier, country string, d time.Time) (time.Time, error) {
+	for i := 0; i < maxClosedDays; i++ {
+		d = d.AddDate(0, 0, 1)
+		open, err := IsBusinessDay(q, country, d)
+		if err != nil || open {
+			return d, err
+		}
+	}
+	return time.Time{}, fmt.Errorf("no business day in the %s calendar within %d days of %s", country, maxClosedDays, d.Format("2006-01-02"))
+}
+
+// CutOff returns the cut-off of a payment type as the time since midnight
+func CutOff(q db.Querier, paymentType string) (time.Duration, error) {
+	var s string
+	if err := q.QueryRow("SELECT cut_off FROM cut_off_times WHERE payment_type = ?", paymentType).Scan(&s); err != nil {
+		return 0, fmt.Errorf("loading cut-off for %s: %w", paymentType, err)
+	}
+	return ParseTime(s)
+}
+
+// ParseTime parses a time of day, HH:MM or HH:MM:SS, as the time since midnight
+func ParseTime(s string) (time.Duration, error) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time of day %q", s)
+}
+
+// ValueDate returns the business date a payment of the given type requested at now
+// is value-dated to, given the current business date. Cut-offs are in the server's
+// local time zone; once the wall clock has passed the business date, as when the
+// end-of-day run is late, the cut-off has passed too.
+func ValueDate(q db.Querier, paymentType string, businessDate, now time.Time) (time.Time, error) {
+	cutOff, err := CutOff(q, paymentType)
+	if err != nil {
+		return time.Time{}, err
+	}
+	open, err := IsBusinessDay(q, Country, businessDate)
+	if err != nil {
+		return time.Time{}, err
+	}
+	deadline := time.Date(businessDate.Year(), businessDate.Month(), businessDate.Day(), 0, 0, 0, 0, time.Local).Add(cutOff)
+	if open && now.Before(deadline) {
+		return businessDate, nil
+	}
+	return NextBusinessDay(q, Country, businessDate)
+}
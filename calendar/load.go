@@ -0,0 +1,79 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"banking-app/db"
+)
+
+// Holiday is one bank holiday of a calendar
+type Holiday struct {
+	Date time.Time
+	Name string
+}
+
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// IsCountry reports whether s is an ISO 3166 alpha-2 style country code
+func IsCountry(s string) bool {
+	return countryCode.MatchString(s)
+}
+
+// Parse reads a calendar file: one holiday per line, its date as YYYY-MM-DD followed by
+// its name. Blank lines and lines starting with # are ignored.
+//
+//	# England and Wales
+//	2026-12-25 Christmas Day
+func Parse(r io.Reader) ([]Holiday, error) {
+	var holidays []Holiday
+	seen := map[string]bool{}
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		date, name, _ := strings.Cut(text, " ")
+		d, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q", line, date)
+		}
+		name = strings.TrimSpace(name)
+		if name == "" || len(name) > 100 {
+			return nil, fmt.Errorf("line %d: holiday name must be 1 to 100 characters", line)
+		}
+		if seen[date] {
+			return nil, fmt.Errorf("line %d: %s is listed twice", line, date)
+		}
+		seen[date] = true
+		holidays = append(holidays, Holiday{Date: d, Name: name})
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading calendar: %w", err)
+	}
+	return holidays, nil
+}
+
+// Replace makes holidays the whole calendar of a country
+func Replace(country string, holidays []Holiday) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("starting calendar load transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	if _, err := tx.Exec("DELETE FROM holidays WHERE country = ?", country); err != nil {
+		return fmt.Errorf("clearing %s calendar: %w", country, err)
+	}
+	for _, h := range holidays {
+		if _, err := tx.Exec("INSERT INTO holidays (country, holiday_date, name) VALUES (?, ?, ?)", country, h.Date.Format("2006-01-02"), h.Name); err != nil {
+			return fmt.Errorf("inserting %s holiday %s: %w", country, h.Date.Format("2006-01-02"), err)
+		}
+	}
+	return tx.Commit()
+}
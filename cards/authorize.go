@@ -0,0 +1,236 @@
+package cards
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"banking-app/credit"
+	"banking-app/db"
+	"banking-app/fees"
+	"banking-app/iso8583"
+	"banking-app/models"
+)
+
+// Response codes returned to the card network (field 39)
+const (
+	RespApproved           = "00"
+	RespDoNotHonor         = "05"
+	RespInvalidTransaction = "12"
+	RespInvalidAmount      = "13"
+	RespInvalidCard        = "14"
+	RespOriginalNotFound   = "25"
+	RespFormatError        = "30"
+	RespInsufficientFunds  = "51"
+	RespExpiredCard        = "54"
+	RespSystemError        = "96"
+)
+
+// Request is a card authorization or financial request received from the network
+type Request struct {
+	MTI        string
+	PAN        string
+	Expiry     string // YYMM as printed on the card, optional
+	Amount     float64
+	MCC        string
+	STAN       string
+	RRN        string
+	MerchantID string
+	Currency   string // ISO 4217 numeric code of the transaction, optional
+}
+
+// HomeCurrency is the ISO 4217 numeric code accounts are kept in. Purchases charged to an
+// account in any other currency incur the FX fee.
+var HomeCurrency = "840"
+
+// Result is the outcome of processing a Request
+type Result struct {
+	ResponseCode     string
+	DeclineReason    string
+	AuthCode         string
+	AvailableBalance float64
+}
+
+// Approved reports whether the request was approved
+func (r Result) Approved() bool {
+	return r.ResponseCode == RespApproved
+}
+
+// Authorize places a hold on the card's account for req.Amount (0100).
+// The hold reduces the available balance until it is captured or reversed.
+func Authorize(req Request) (Result, error) {
+	return process(req, false)
+}
+
+// Purchase debits the card's account (or charges its credit line) for req.Amount (0200). If an earlier
+// authorization with the same RRN is still held, that hold is consumed.
+func Purchase(req Request) (Result, error) {
+	return process(req, true)
+}
+
+func process(req Request, capture bool) (Result, error) {
+	if req.Amount <= 0 {
+		return Result{ResponseCode: RespInvalidAmount}, nil
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Result{}, fmt.Errorf("starting card transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var card models.Card
+	err = tx.QueryRow("SELECT card_id, account_id, card_type, expiry_date, status, per_transaction_limit, daily_limit FROM cards WHERE card_number = ? FOR UPDATE", req.PAN).Scan(
+		&card.CardID, &card.AccountID, &card.CardType, &card.ExpiryDate, &card.Status, &card.PerTransactionLimit, &card.DailyLimit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Result{ResponseCode: RespInvalidCard}, nil
+		}
+		return Result{}, fmt.Errorf("looking up card: %w", err)
+	}
+
+	f, err := lockFunds(tx, card)
+	if err == credit.ErrNoCreditAccount {
+		return Result{ResponseCode: RespDoNotHonor, DeclineReason: ReasonNoCreditLine}, nil
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	held, err := f.held(tx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// A completion consumes the hold placed by its authorization
+	var holdID int
+	var holdAmount float64
+	if capture && req.RRN != "" {
+		err = tx.QueryRow("SELECT authorization_id, amount FROM card_authorizations WHERE card_id = ? AND rrn = ? AND status = 'held' ORDER BY authorization_id DESC LIMIT 1 FOR UPDATE",
+			card.CardID, req.RRN).Scan(&holdID, &holdAmount)
+		if err != nil && err != sql.ErrNoRows {
+			return Result{}, fmt.Errorf("looking up hold: %w", err)
+		}
+	}
+
+	available := f.balance - held + holdAmount
+	result := Result{ResponseCode: RespApproved, AvailableBalance: available}
+	decline := checkCard(card, req, time.Now())
+	if decline == nil && !f.active {
+		decline = &Decline{RespDoNotHonor, ReasonAccountInactive}
+	}
+	if decline == nil {
+		decline, err = checkControls(tx, card, req, holdAmount)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	if decline == nil && req.Amount > available {
+		decline = &Decline{RespInsufficientFunds, ReasonInsufficientFunds}
+	}
+	if decline != nil {
+		result.ResponseCode, result.DeclineReason = decline.Code, decline.Reason
+	}
+
+	status := "declined"
+	if result.Approved() {
+		result.AuthCode = fmt.Sprintf("%06d", rand.Intn(1000000))
+		status = "held"
+		if capture {
+			status = "captured"
+			if err := f.debit(tx, req.Amount, "Card purchase "+req.MerchantID); err != nil {
+				return Result{}, err
+			}
+			if holdID != 0 {
+				if _, err := tx.Exec("UPDATE card_authorizations SET status = 'captured' WHERE authorization_id = ?", holdID); err != nil {
+					return Result{}, fmt.Errorf("consuming hold %d: %w", holdID, err)
+				}
+			}
+		}
+		result.AvailableBalance = available - req.Amount
+	}
+
+	inserted, err := tx.Exec("INSERT INTO card_authorizations (card_id, account_id, mti, stan, rrn, amount, mcc, merchant_id, response_code, decline_reason, auth_code, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		card.CardID, card.AccountID, req.MTI, req.STAN, req.RRN, req.Amount, req.MCC, req.MerchantID, result.ResponseCode, result.DeclineReason, result.AuthCode, status)
+	if err != nil {
+		return Result{}, fmt.Errorf("recording card authorization: %w", err)
+	}
+
+	// Credit lines carry their own charges; only account-funded purchases pay the FX fee
+	if status == "captured" && f.creditID == 0 && req.Currency != "" && req.Currency != HomeCurrency {
+		authorizationID, err := inserted.LastInsertId()
+		if err != nil {
+			return Result{}, err
+		}
+		fee, err := fees.Apply(tx, card.AccountID, fees.TypeFX, req.Amount, feeReference(authorizationID))
+		if err != nil {
+			return Result{}, fmt.Errorf("charging FX fee: %w", err)
+		}
+		result.AvailableBalance -= fee
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Result{}, fmt.Errorf("committing card transaction: %w", err)
+	}
+	return result, nil
+}
+
+// Reverse undoes an earlier 0100 or 0200 identified by its MTI and STAN (0400).
+// Reversals are idempotent: repeating one for an already reversed request is approved.
+func Reverse(req Request, originalMTI, originalSTAN string) (Result, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Result{}, fmt.Errorf("starting reversal transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var auth models.CardAuthorization
+	var card models.Card
+	err = tx.QueryRow(`SELECT ca.authorization_id, ca.amount, ca.status, c.card_id, c.account_id, c.card_type FROM card_authorizations ca
+		JOIN cards c ON c.card_id = ca.card_id
+		WHERE c.card_number = ? AND ca.mti = ? AND ca.stan = ?
+		ORDER BY ca.authorization_id DESC LIMIT 1 FOR UPDATE`, req.PAN, originalMTI, originalSTAN).Scan(
+		&auth.AuthorizationID, &auth.Amount, &auth.Status, &card.CardID, &card.AccountID, &card.CardType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Result{ResponseCode: RespOriginalNotFound}, nil
+		}
+		return Result{}, fmt.Errorf("looking up original request: %w", err)
+	}
+
+	switch auth.Status {
+	case "reversed", "declined":
+		// Nothing left to undo
+		return Result{ResponseCode: RespApproved}, nil
+	case "captured":
+		if originalMTI != iso8583.MTIFinancialRequest {
+			// The hold was already turned into a debit; the completion must be reversed instead
+			return Result{ResponseCode: RespInvalidTransaction}, nil
+		}
+		f, err := lockFunds(tx, card)
+		if err != nil {
+			return Result{}, err
+		}
+		if err := f.refund(tx, auth.Amount, "Card purchase reversal "+req.MerchantID); err != nil {
+			return Result{}, err
+		}
+		if f.creditID == 0 {
+			if _, err := fees.Refund(tx, card.AccountID, feeReference(int64(auth.AuthorizationID))); err != nil {
+				return Result{}, fmt.Errorf("refunding fees of authorization %d: %w", auth.AuthorizationID, err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE card_authorizations SET status = 'reversed' WHERE authorization_id = ?", auth.AuthorizationID); err != nil {
+		return Result{}, fmt.Errorf("reversing authorization %d: %w", auth.AuthorizationID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Result{}, fmt.Errorf("committing reversal: %w", err)
+	}
+	return Result{ResponseCode: RespApproved}, nil
+}
+
+// feeReference identifies a card purchase in the fees charged for it
+func feeReference(authorizationID int64) string {
+	return fmt.Sprintf("card_authorization:%d", authorizationID)
+}
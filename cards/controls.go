@@ -0,0 +1,116 @@
+package cards
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"banking-app/models"
+)
+
+// Card statuses
+const (
+	StatusActive  = "active"
+	StatusFrozen  = "frozen"
+	StatusBlocked = "blocked"
+	StatusExpired = "expired"
+)
+
+// Additional response codes used by card controls
+const (
+	RespLostCard           = "41"
+	RespNotPermitted       = "57"
+	RespExceedsAmountLimit = "61"
+	RespRestrictedCard     = "62"
+)
+
+// Decline reasons recorded alongside the response code
+const (
+	ReasonCardFrozen          = "card_frozen"
+	ReasonCardBlocked         = "card_blocked"
+	ReasonCardExpired         = "card_expired"
+	ReasonExpiryMismatch      = "expiry_mismatch"
+	ReasonMCCBlocked          = "mcc_blocked"
+	ReasonPerTransactionLimit = "per_transaction_limit"
+	ReasonDailyLimit          = "daily_limit"
+	ReasonInsufficientFunds   = "insufficient_funds"
+	ReasonNoCreditLine        = "no_credit_line"
+	ReasonAccountInactive     = "account_inactive"
+)
+
+// Decline is the response code and reason for a declined request
+type Decline struct {
+	Code   string
+	Reason string
+}
+
+// CanTransition reports whether a card may move from one status to another.
+// Customers can freeze and unfreeze a card; blocked and expired cards are final.
+func CanTransition(from, to string) bool {
+	switch from {
+	case StatusActive:
+		return to == StatusFrozen || to == StatusBlocked || to == StatusExpired
+	case StatusFrozen:
+		return to == StatusActive || to == StatusBlocked || to == StatusExpired
+	}
+	return false
+}
+
+// checkCard validates the card itself, independent of the account balance
+func checkCard(card models.Card, req Request, now time.Time) *Decline {
+	switch card.Status {
+	case StatusFrozen:
+		return &Decline{RespRestrictedCard, ReasonCardFrozen}
+	case StatusBlocked:
+		return &Decline{RespLostCard, ReasonCardBlocked}
+	case StatusExpired:
+		return &Decline{RespExpiredCard, ReasonCardExpired}
+	}
+
+	// Cards are valid until the end of their expiry month
+	expiry := card.ExpiryDate
+	endOfMonth := time.Date(expiry.Year(), expiry.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	if !now.Before(endOfMonth) {
+		return &Decline{RespExpiredCard, ReasonCardExpired}
+	}
+	if req.Expiry != "" && req.Expiry != expiry.Format("0601") {
+		return &Decline{RespDoNotHonor, ReasonExpiryMismatch}
+	}
+	return nil
+}
+
+// checkControls enforces the customer's merchant category blocks and spending limits.
+// pending is the amount of a hold being consumed by this request, which is already
+// counted in today's spend.
+func checkControls(tx *sql.Tx, card models.Card, req Request, pending float64) (*Decline, error) {
+	if req.MCC != "" {
+		var blocked bool
+		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM card_mcc_blocks WHERE card_id = ? AND mcc = ?)", card.CardID, req.MCC).Scan(&blocked)
+		if err != nil {
+			return nil, fmt.Errorf("checking MCC blocks for card %d: %w", card.CardID, err)
+		}
+		if blocked {
+			return &Decline{RespNotPermitted, ReasonMCCBlocked}, nil
+		}
+	}
+
+	if card.PerTransactionLimit != nil && req.Amount > *card.PerTransactionLimit {
+		return &Decline{RespExceedsAmountLimit, ReasonPerTransactionLimit}, nil
+	}
+
+	if card.DailyLimit != nil {
+		// Held authorizations and completed purchases count; a hold that was later
+		// completed is counted once through its completion.
+		var spent float64
+		err := tx.QueryRow(`SELECT COALESCE(SUM(amount), 0) FROM card_authorizations
+			WHERE card_id = ? AND created_at >= CURDATE()
+			AND (status = 'held' OR (status = 'captured' AND mti = '0200'))`, card.CardID).Scan(&spent)
+		if err != nil {
+			return nil, fmt.Errorf("summing daily spend for card %d: %w", card.CardID, err)
+		}
+		if spent-pending+req.Amount > *card.DailyLimit {
+			return &Decline{RespExceedsAmountLimit, ReasonDailyLimit}, nil
+		}
+	}
+	return nil, nil
+}
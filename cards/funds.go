@@ -0,0 +1,84 @@
+package cards
+
+import (
+	"database/sql"
+	"fmt"
+
+	"banking-app/credit"
+	"banking-app/ledger"
+	"banking-app/models"
+)
+
+// funds is what a card draws on: the linked account for debit cards,
+// the credit line for credit cards
+type funds struct {
+	card     models.Card
+	creditID int     // Set for credit cards
+	balance  float64 // Available account balance, or unused part of the credit line
+	active   bool    // Whether the account may be debited; always true for credit cards
+}
+
+// lockFunds locks the funding source of a card so concurrent card requests see a consistent balance
+func lockFunds(tx *sql.Tx, card models.Card) (*funds, error) {
+	f := &funds{card: card}
+	if card.CardType == "credit" {
+		ca, err := credit.LockByCard(tx, card.CardID)
+		if err != nil {
+			return nil, err
+		}
+		f.creditID = ca.CreditAccountID
+		f.balance = credit.Available(ca)
+		f.active = true
+		return f, nil
+	}
+
+	// Debit cards can use the arranged overdraft of their account
+	var status string
+	err := tx.QueryRow("SELECT balance + overdraft_limit, status FROM accounts WHERE account_id = ? FOR UPDATE", card.AccountID).Scan(&f.balance, &status)
+	if err != nil {
+		return nil, fmt.Errorf("locking account %d: %w", card.AccountID, err)
+	}
+	f.active = status == ledger.StatusActive
+	return f, nil
+}
+
+// held sums the outstanding holds against the funding source
+func (f *funds) held(tx *sql.Tx) (float64, error) {
+	var held float64
+	var err error
+	if f.creditID != 0 {
+		err = tx.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM card_authorizations WHERE card_id = ? AND status = 'held'", f.card.CardID).Scan(&held)
+	} else {
+		// A credit card may share the linked account but its holds are against the credit line
+		err = tx.QueryRow(`SELECT COALESCE(SUM(ca.amount), 0) FROM card_authorizations ca JOIN cards c ON c.card_id = ca.card_id
+			WHERE ca.account_id = ? AND ca.status = 'held' AND c.card_type <> 'credit'`, f.card.AccountID).Scan(&held)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("summing holds for card %d: %w", f.card.CardID, err)
+	}
+	return held, nil
+}
+
+// debit charges a completed purchase
+func (f *funds) debit(tx *sql.Tx, amount float64, description string) error {
+	if f.creditID != 0 {
+		return credit.Post(tx, f.creditID, credit.TypePurchase, amount, description)
+	}
+	if _, err := tx.Exec("UPDATE accounts SET balance = balance - ? WHERE account_id = ?", amount, f.card.AccountID); err != nil {
+		return fmt.Errorf("debiting account %d: %w", f.card.AccountID, err)
+	}
+	_, err := ledger.Post(tx, f.card.AccountID, ledger.TypeWithdrawal, amount, description)
+	return err
+}
+
+// refund gives back a reversed purchase
+func (f *funds) refund(tx *sql.Tx, amount float64, description string) error {
+	if f.creditID != 0 {
+		return credit.Post(tx, f.creditID, credit.TypeRefund, amount, description)
+	}
+	if _, err := tx.Exec("UPDATE accounts SET balance = balance + ? WHERE account_id = ?", amount, f.card.AccountID); err != nil {
+		return fmt.Errorf("crediting account %d: %w", f.card.AccountID, err)
+	}
+	_, err := ledger.Post(tx, f.card.AccountID, ledger.TypeDeposit, amount, description)
+	return err
+}
@@ -0,0 +1,95 @@
+package cards
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"banking-app/iso8583"
+)
+
+// ISOHandler routes ISO 8583 requests from the card network simulator into card authorization
+var ISOHandler = iso8583.HandlerFunc(handleISO)
+
+func handleISO(msg *iso8583.Message) *iso8583.Message {
+	resp := msg.Response()
+
+	req, err := requestFromMessage(msg)
+	if err != nil {
+		log.Printf("ISO 8583: rejecting malformed %s: %v", msg.MTI, err)
+		resp.Set(iso8583.FieldResponseCode, RespFormatError)
+		return resp
+	}
+
+	var result Result
+	switch msg.MTI {
+	case iso8583.MTIAuthorizationRequest:
+		result, err = Authorize(req)
+	case iso8583.MTIFinancialRequest:
+		result, err = Purchase(req)
+	case iso8583.MTIReversalRequest, iso8583.MTIReversalRepeat:
+		mti, stan, perr := iso8583.ParseOriginalData(msg.Field(iso8583.FieldOriginalData))
+		if perr != nil {
+			log.Printf("ISO 8583: rejecting reversal without original data: %v", perr)
+			resp.Set(iso8583.FieldResponseCode, RespFormatError)
+			return resp
+		}
+		result, err = Reverse(req, mti, stan)
+	default:
+		resp.Set(iso8583.FieldResponseCode, RespInvalidTransaction)
+		return resp
+	}
+	if err != nil {
+		log.Printf("ISO 8583: error processing %s STAN %s: %v", msg.MTI, req.STAN, err)
+		resp.Set(iso8583.FieldResponseCode, RespSystemError)
+		return resp
+	}
+
+	resp.Set(iso8583.FieldResponseCode, result.ResponseCode)
+	if result.AuthCode != "" {
+		resp.Set(iso8583.FieldAuthCode, result.AuthCode)
+	}
+	if result.Approved() && msg.MTI != iso8583.MTIReversalRequest && msg.MTI != iso8583.MTIReversalRepeat {
+		resp.Set(iso8583.FieldAdditionalAmounts, availableBalanceAmount(result.AvailableBalance, msg.Field(iso8583.FieldCurrencyCode)))
+	}
+	return resp
+}
+
+func requestFromMessage(msg *iso8583.Message) (Request, error) {
+	pan := msg.Field(iso8583.FieldPAN)
+	if pan == "" {
+		return Request{}, fmt.Errorf("field %d is missing", iso8583.FieldPAN)
+	}
+	minor, err := msg.Amount()
+	if err != nil {
+		return Request{}, err
+	}
+	// Only purchases (00) and cash withdrawals (01) are simulated
+	if code := msg.Field(iso8583.FieldProcessingCode); len(code) == 6 && code[:2] != "00" && code[:2] != "01" {
+		return Request{}, fmt.Errorf("unsupported processing code %s", code)
+	}
+	return Request{
+		MTI:        msg.MTI,
+		PAN:        pan,
+		Expiry:     msg.Field(iso8583.FieldExpiry),
+		Amount:     float64(minor) / 100,
+		MCC:        msg.Field(iso8583.FieldMCC),
+		STAN:       msg.Field(iso8583.FieldSTAN),
+		RRN:        msg.Field(iso8583.FieldRRN),
+		MerchantID: msg.Field(iso8583.FieldMerchantID),
+		Currency:   msg.Field(iso8583.FieldCurrencyCode),
+	}, nil
+}
+
+// availableBalanceAmount formats field 54: account type, amount type 02 (available),
+// currency, sign and 12-digit amount in minor units
+func availableBalanceAmount(balance float64, currency string) string {
+	if currency == "" {
+		currency = HomeCurrency
+	}
+	sign := "C"
+	if balance < 0 {
+		sign = "D"
+	}
+	return fmt.Sprintf("0002%s%s%012d", currency, sign, int64(math.Round(math.Abs(balance)*100)))
+}
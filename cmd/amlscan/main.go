@@ -0,0 +1,37 @@
+// Command amlscan scans transaction history for money-laundering patterns and opens
+// suspicious activity cases. Schedule it once per day, after the day's postings.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"banking-app/aml"
+	"banking-app/db"
+)
+
+func main() {
+	date := flag.String("date", time.Now().Format("2006-01-02"), "business date to scan (YYYY-MM-DD)")
+	flag.Parse()
+
+	asOf, err := time.Parse("2006-01-02", *date)
+	if err != nil {
+		log.Fatalf("Invalid -date %q: %v", *date, err)
+	}
+
+	dataSourceName := os.Getenv("MYSQL_DSN")
+	if dataSourceName == "" {
+		log.Fatal("MYSQL_DSN environment variable not set. Please set it to your MySQL connection string.")
+	}
+	db.InitDB(dataSourceName)
+	defer db.CloseDB()
+
+	opened, err := aml.Scan(asOf)
+	if err != nil {
+		log.Fatalf("AML scan for %s failed after opening %d cases: %v", *date, opened, err)
+	}
+	fmt.Printf("AML scan for %s completed: %d cases opened.\n", *date, opened)
+}
@@ -0,0 +1,35 @@
+// Command auditverify checks the hash chain of the audit log and exits
+// non-zero if any row is missing, altered or out of place.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"banking-app/audit"
+	"banking-app/db"
+)
+
+func main() {
+	dataSourceName := os.Getenv("MYSQL_DSN")
+	if dataSourceName == "" {
+		log.Fatal("MYSQL_DSN environment variable not set. Please set it to your MySQL connection string.")
+	}
+	db.InitDB(dataSourceName)
+	defer db.CloseDB()
+
+	problems, count, err := audit.Verify()
+	if err != nil {
+		log.Fatalf("Audit verification failed: %v", err)
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("Audit log is NOT intact: %d problem(s) in %d rows.\n", len(problems), count)
+		db.CloseDB()
+		os.Exit(1)
+	}
+	fmt.Printf("Audit log intact: %d rows verified.\n", count)
+}
@@ -0,0 +1,60 @@
+// Command calendarload loads a country's bank holiday calendar from a file, replacing
+// the holidays previously loaded for that country. The country defaults to the file
+// name without its extension.
+//
+//	calendarload -file calendars/GB.txt
+//	calendarload -country IE -file holidays-ie.txt
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"banking-app/calendar"
+	"banking-app/db"
+)
+
+func main() {
+	file := flag.String("file", "", "calendar file")
+	country := flag.String("country", "", "country code of the calendar, e.g. GB")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *country == "" {
+		*country = strings.TrimSuffix(filepath.Base(*file), filepath.Ext(*file))
+	}
+	*country = strings.ToUpper(*country)
+	if !calendar.IsCountry(*country) {
+		log.Fatalf("Invalid country %q; give -country", *country)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("Opening %s: %v", *file, err)
+	}
+	defer f.Close()
+
+	holidays, err := calendar.Parse(f)
+	if err != nil {
+		log.Fatalf("Reading %s: %v", *file, err)
+	}
+
+	dataSourceName := os.Getenv("MYSQL_DSN")
+	if dataSourceName == "" {
+		log.Fatal("MYSQL_DSN environment variable not set. Please set it to your MySQL connection string.")
+	}
+	db.InitDB(dataSourceName)
+	defer db.CloseDB()
+
+	if err := calendar.Replace(*country, holidays); err != nil {
+		log.Fatalf("Loading %s calendar failed: %v", *country, err)
+	}
+	fmt.Printf("Loaded %d holidays into the %s calendar.\n", len(holidays), *country)
+}
@@ -0,0 +1,36 @@
+// Command creditbatch runs the daily credit card cycle: statement generation,
+// purchase interest accrual and late fees. Schedule it once per day.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"banking-app/credit"
+	"banking-app/db"
+)
+
+func main() {
+	date := flag.String("date", time.Now().Format("2006-01-02"), "business date to run the cycle for (YYYY-MM-DD)")
+	flag.Parse()
+
+	asOf, err := time.Parse("2006-01-02", *date)
+	if err != nil {
+		log.Fatalf("Invalid -date %q: %v", *date, err)
+	}
+
+	dataSourceName := os.Getenv("MYSQL_DSN")
+	if dataSourceName == "" {
+		log.Fatal("MYSQL_DSN environment variable not set. Please set it to your MySQL connection string.")
+	}
+	db.InitDB(dataSourceName)
+	defer db.CloseDB()
+
+	if err := credit.RunDaily(asOf); err != nil {
+		log.Fatalf("Credit cycle for %s failed: %v", *date, err)
+	}
+	fmt.Printf("Credit cycle for %s completed.\n", *date)
+}
@@ -0,0 +1,84 @@
+// Command eod runs the end-of-day cycle for the current business date, or resumes it
+// from the first step that has not completed, and prints the outcome of each step.
+// With -status it only prints the run of a business date.
+//
+//	eod
+//	eod -status -date 2024-03-28
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"banking-app/db"
+	"banking-app/eod"
+	"banking-app/models"
+)
+
+func main() {
+	status := flag.Bool("status", false, "print the run of -date instead of running")
+	date := flag.String("date", "", "business date to print with -status (YYYY-MM-DD); defaults to the current business date")
+	flag.Parse()
+
+	dataSourceName := os.Getenv("MYSQL_DSN")
+	if dataSourceName == "" {
+		log.Fatal("MYSQL_DSN environment variable not set. Please set it to your MySQL connection string.")
+	}
+	db.InitDB(dataSourceName)
+	defer db.CloseDB()
+
+	if *status {
+		asOf, err := eod.BusinessDate(db.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *date != "" {
+			if asOf, err = time.Parse("2006-01-02", *date); err != nil {
+				log.Fatalf("Invalid -date %q: %v", *date, err)
+			}
+		}
+		run, err := eod.GetRun(asOf)
+		if err == sql.ErrNoRows {
+			fmt.Printf("No end-of-day run for %s.\n", asOf.Format("2006-01-02"))
+			return
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		printRun(run)
+		return
+	}
+
+	job, err := eod.Begin(nil)
+	if err != nil {
+		log.Fatalf("Starting end-of-day run failed: %v", err)
+	}
+	runErr := job.Run()
+	if run, err := eod.GetRun(job.Date); err == nil {
+		printRun(run)
+	}
+	if runErr != nil {
+		db.CloseDB()
+		log.Fatalf("End-of-day run for %s failed: %v", job.Date.Format("2006-01-02"), runErr)
+	}
+	next, err := eod.BusinessDate(db.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("End-of-day run for %s completed. Business date is now %s.\n", job.Date.Format("2006-01-02"), next.Format("2006-01-02"))
+}
+
+func printRun(run models.EODRun) {
+	fmt.Printf("End-of-day run %d for %s: %s\n", run.RunID, run.BusinessDate.Format("2006-01-02"), run.Status)
+	for _, s := range run.Steps {
+		fmt.Printf("  %d. %-20s %-10s attempts=%d", s.Position, s.Step, s.Status, s.Attempts)
+		if s.Error != nil {
+			fmt.Printf("  error: %s", *s.Error)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,37 @@
+// Command feebatch charges the monthly maintenance fee for the month ending on -date. On
+// any other date it does nothing, so it can be scheduled daily; the end-of-day run also
+// includes it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"banking-app/db"
+	"banking-app/fees"
+)
+
+func main() {
+	date := flag.String("date", time.Now().Format("2006-01-02"), "business date to run the batch for (YYYY-MM-DD)")
+	flag.Parse()
+
+	asOf, err := time.Parse("2006-01-02", *date)
+	if err != nil {
+		log.Fatalf("Invalid -date %q: %v", *date, err)
+	}
+
+	dataSourceName := os.Getenv("MYSQL_DSN")
+	if dataSourceName == "" {
+		log.Fatal("MYSQL_DSN environment variable not set. Please set it to your MySQL connection string.")
+	}
+	db.InitDB(dataSourceName)
+	defer db.CloseDB()
+
+	if err := fees.RunMonthly(asOf); err != nil {
+		log.Fatalf("Fee batch for %s failed: %v", *date, err)
+	}
+	fmt.Printf("Fee batch for %s completed.\n", *date)
+}
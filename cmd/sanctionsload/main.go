@@ -0,0 +1,84 @@
+// Command sanctionsload loads a sanctions or PEP list from local files, replacing the
+// previous version of that list, and optionally screens all customers against the
+// updated lists.
+//
+//	sanctionsload -list OFAC-SDN -format ofac-csv -file sdn.csv -alt alt.csv -rescreen
+//	sanctionsload -list OFAC-SDN -format ofac-xml -file sdn.xml
+//	sanctionsload -list PEP -format csv -file peps.csv -pep
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"banking-app/db"
+	"banking-app/sanctions"
+)
+
+func main() {
+	list := flag.String("list", "", "name of the list to load, e.g. OFAC-SDN")
+	format := flag.String("format", "csv", "file format: ofac-csv, ofac-xml or csv")
+	file := flag.String("file", "", "list file")
+	alt := flag.String("alt", "", "OFAC alias file (alt.csv), for -format ofac-csv")
+	pep := flag.Bool("pep", false, "the list holds politically exposed persons, for -format csv")
+	rescreen := flag.Bool("rescreen", false, "screen all customers after loading")
+	flag.Parse()
+
+	if *list == "" || *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("Opening %s: %v", *file, err)
+	}
+	defer f.Close()
+
+	var entries []sanctions.Entry
+	switch *format {
+	case "ofac-csv":
+		var aliases io.Reader
+		if *alt != "" {
+			a, err := os.Open(*alt)
+			if err != nil {
+				log.Fatalf("Opening %s: %v", *alt, err)
+			}
+			defer a.Close()
+			aliases = a
+		}
+		entries, err = sanctions.LoadOFACCSV(f, aliases)
+	case "ofac-xml":
+		entries, err = sanctions.LoadOFACXML(f)
+	case "csv":
+		entries, err = sanctions.LoadCSV(f, *pep)
+	default:
+		log.Fatalf("Unknown -format %q", *format)
+	}
+	if err != nil {
+		log.Fatalf("Reading %s: %v", *file, err)
+	}
+
+	dataSourceName := os.Getenv("MYSQL_DSN")
+	if dataSourceName == "" {
+		log.Fatal("MYSQL_DSN environment variable not set. Please set it to your MySQL connection string.")
+	}
+	db.InitDB(dataSourceName)
+	defer db.CloseDB()
+
+	if err := sanctions.Replace(*list, entries); err != nil {
+		log.Fatalf("Loading %s failed: %v", *list, err)
+	}
+	fmt.Printf("Loaded %d entries into %s.\n", len(entries), *list)
+
+	if *rescreen {
+		flagged, err := sanctions.RescreenAll()
+		if err != nil {
+			log.Fatalf("Rescreening customers failed: %v", err)
+		}
+		fmt.Printf("Rescreening completed: %d customers pending review or confirmed.\n", flagged)
+	}
+}
@@ -0,0 +1,36 @@
+// Command termbatch matures the term deposits whose term ends on or before -date, paying
+// them out or rolling them over as instructed. The end-of-day run also includes it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"banking-app/db"
+	"banking-app/termdeposit"
+)
+
+func main() {
+	date := flag.String("date", time.Now().Format("2006-01-02"), "business date to run the batch for (YYYY-MM-DD)")
+	flag.Parse()
+
+	asOf, err := time.Parse("2006-01-02", *date)
+	if err != nil {
+		log.Fatalf("Invalid -date %q: %v", *date, err)
+	}
+
+	dataSourceName := os.Getenv("MYSQL_DSN")
+	if dataSourceName == "" {
+		log.Fatal("MYSQL_DSN environment variable not set. Please set it to your MySQL connection string.")
+	}
+	db.InitDB(dataSourceName)
+	defer db.CloseDB()
+
+	if err := termdeposit.RunDaily(asOf); err != nil {
+		log.Fatalf("Term deposit batch for %s failed: %v", *date, err)
+	}
+	fmt.Printf("Term deposit batch for %s completed.\n", *date)
+}
@@ -0,0 +1,111 @@
+package credit
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+)
+
+// Credit transaction types stored in credit_transactions.type
+const (
+	TypePurchase = "purchase"
+	TypeRefund   = "refund"
+	TypePayment  = "payment"
+	TypeInterest = "interest"
+	TypeFee      = "fee"
+
+	TypeDisputeCredit   = "dispute_credit"   // Provisional credit of a disputed charge
+	TypeDisputeReversal = "dispute_reversal" // Takes back a dispute credit that was not upheld
+)
+
+// ErrNoCreditAccount is returned when a credit card has no credit line attached
+var ErrNoCreditAccount = errors.New("credit card has no credit account")
+
+const accountColumns = "credit_account_id, card_id, credit_limit, balance_owed, accrued_interest, purchase_apr, statement_day, grace_days, min_payment_percent, min_payment_floor, late_fee, revolving, last_accrual_date, created_at"
+
+func scanAccount(row *sql.Row) (models.CreditAccount, error) {
+	var ca models.CreditAccount
+	err := row.Scan(&ca.CreditAccountID, &ca.CardID, &ca.CreditLimit, &ca.BalanceOwed, &ca.AccruedInterest, &ca.PurchaseAPR,
+		&ca.StatementDay, &ca.GraceDays, &ca.MinPaymentPercent, &ca.MinPaymentFloor, &ca.LateFee, &ca.Revolving, &ca.LastAccrualDate, &ca.CreatedAt)
+	return ca, err
+}
+
+// LockByCard loads and locks the credit account behind a credit card
+func LockByCard(tx *sql.Tx, cardID int) (models.CreditAccount, error) {
+	ca, err := scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM credit_accounts WHERE card_id = ? FOR UPDATE", cardID))
+	if err == sql.ErrNoRows {
+		return ca, ErrNoCreditAccount
+	}
+	if err != nil {
+		return ca, fmt.Errorf("locking credit account for card %d: %w", cardID, err)
+	}
+	return ca, nil
+}
+
+// Lock loads and locks a credit account by ID, returning sql.ErrNoRows if it does not exist
+func Lock(tx *sql.Tx, creditAccountID int) (models.CreditAccount, error) {
+	return scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM credit_accounts WHERE credit_account_id = ? FOR UPDATE", creditAccountID))
+}
+
+// Get loads a credit account by ID without locking it
+func Get(creditAccountID int) (models.CreditAccount, error) {
+	return scanAccount(db.DB.QueryRow("SELECT "+accountColumns+" FROM credit_accounts WHERE credit_account_id = ?", creditAccountID))
+}
+
+// Available returns the unused part of the credit line
+func Available(ca models.CreditAccount) float64 {
+	return ca.CreditLimit - ca.BalanceOwed
+}
+
+// Post adds a movement to a credit account and adjusts the balance owed.
+// Purchases, interest, fees and dispute reversals increase the balance; refunds,
+// payments and dispute credits reduce it.
+func Post(tx *sql.Tx, creditAccountID int, txnType string, amount float64, description string) error {
+	_, err := PostEntry(tx, creditAccountID, txnType, amount, description)
+	return err
+}
+
+// PostEntry is Post returning the ID of the credit_transactions row
+func PostEntry(tx *sql.Tx, creditAccountID int, txnType string, amount float64, description string) (int64, error) {
+	delta := amount
+	if txnType == TypeRefund || txnType == TypePayment || txnType == TypeDisputeCredit {
+		delta = -amount
+	}
+	if _, err := tx.Exec("UPDATE credit_accounts SET balance_owed = balance_owed + ? WHERE credit_account_id = ?", delta, creditAccountID); err != nil {
+		return 0, fmt.Errorf("updating balance of credit account %d: %w", creditAccountID, err)
+	}
+	result, err := tx.Exec("INSERT INTO credit_transactions (credit_account_id, type, amount, description) VALUES (?, ?, ?, ?)",
+		creditAccountID, txnType, amount, description)
+	if err != nil {
+		return 0, fmt.Errorf("posting %s to credit account %d: %w", txnType, creditAccountID, err)
+	}
+	return result.LastInsertId()
+}
+
+// ApplyPayment records a payment against the credit account and the latest unsettled statement
+func ApplyPayment(tx *sql.Tx, creditAccountID int, amount float64, description string) error {
+	if err := Post(tx, creditAccountID, TypePayment, amount, description); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE credit_statements SET paid_amount = paid_amount + ?
+		WHERE credit_account_id = ? AND status = 'issued' ORDER BY period_end DESC LIMIT 1`, amount, creditAccountID)
+	if err != nil {
+		return fmt.Errorf("applying payment to statement of credit account %d: %w", creditAccountID, err)
+	}
+	return nil
+}
+
+// MinimumPayment is the larger of the percentage of the balance and the floor,
+// never more than the balance itself
+func MinimumPayment(ca models.CreditAccount, closing float64) float64 {
+	if closing <= 0 {
+		return 0
+	}
+	min := math.Max(ca.MinPaymentFloor, ledger.Round(closing*ca.MinPaymentPercent/100))
+	return math.Min(min, closing)
+}
@@ -0,0 +1,217 @@
+package credit
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+)
+
+// RunDaily runs the credit card cycle for the given business date on every credit account:
+// settles statements whose due date has passed (charging late fees), accrues purchase
+// interest on revolving balances and issues statements for cycles closing on asOf.
+// Each account is processed in its own SQL transaction and every step is idempotent,
+// so a failed run can simply be repeated for the same date.
+func RunDaily(asOf time.Time) error {
+	asOf = ledger.DateOnly(asOf)
+
+	rows, err := db.DB.Query("SELECT credit_account_id FROM credit_accounts ORDER BY credit_account_id")
+	if err != nil {
+		return fmt.Errorf("listing credit accounts: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning credit account ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("listing credit accounts: %w", err)
+	}
+
+	failed := 0
+	for _, id := range ids {
+		if err := runAccount(id, asOf); err != nil {
+			log.Printf("Error running credit cycle for credit account %d: %v", id, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("credit cycle failed for %d of %d accounts", failed, len(ids))
+	}
+	return nil
+}
+
+func runAccount(creditAccountID int, asOf time.Time) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	ca, err := Lock(tx, creditAccountID)
+	if err != nil {
+		return err
+	}
+
+	if err := settleDueStatements(tx, &ca, asOf); err != nil {
+		return err
+	}
+	if err := accrueInterest(tx, &ca, asOf); err != nil {
+		return err
+	}
+	if asOf.Day() == ca.StatementDay {
+		if err := issueStatement(tx, &ca, asOf); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// settleDueStatements closes out statements whose due date has passed. A statement
+// not paid in full makes the account revolving; one below the minimum payment incurs
+// the late fee.
+func settleDueStatements(tx *sql.Tx, ca *models.CreditAccount, asOf time.Time) error {
+	rows, err := tx.Query(`SELECT statement_id, closing_balance, minimum_payment, paid_amount FROM credit_statements
+		WHERE credit_account_id = ? AND status = 'issued' AND due_date < ? ORDER BY period_end`, ca.CreditAccountID, asOf)
+	if err != nil {
+		return fmt.Errorf("loading due statements: %w", err)
+	}
+	var due []models.CreditStatement
+	for rows.Next() {
+		var s models.CreditStatement
+		if err := rows.Scan(&s.StatementID, &s.ClosingBalance, &s.MinimumPayment, &s.PaidAmount); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning due statement: %w", err)
+		}
+		due = append(due, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("loading due statements: %w", err)
+	}
+
+	for _, s := range due {
+		status := "paid_in_full"
+		switch {
+		case s.PaidAmount < s.MinimumPayment:
+			status = "missed"
+		case s.PaidAmount < s.ClosingBalance:
+			status = "minimum_paid"
+		}
+
+		lateFee := status == "missed" && ca.LateFee > 0
+		if lateFee {
+			if err := Post(tx, ca.CreditAccountID, TypeFee, ca.LateFee, fmt.Sprintf("Late payment fee for statement %d", s.StatementID)); err != nil {
+				return err
+			}
+			ca.BalanceOwed += ca.LateFee
+		}
+		if _, err := tx.Exec("UPDATE credit_statements SET status = ?, late_fee_charged = ? WHERE statement_id = ?", status, lateFee, s.StatementID); err != nil {
+			return fmt.Errorf("settling statement %d: %w", s.StatementID, err)
+		}
+
+		// Paying the statement in full restores the grace period on new purchases
+		ca.Revolving = status != "paid_in_full"
+		if _, err := tx.Exec("UPDATE credit_accounts SET revolving = ? WHERE credit_account_id = ?", ca.Revolving, ca.CreditAccountID); err != nil {
+			return fmt.Errorf("updating revolving flag: %w", err)
+		}
+	}
+	return nil
+}
+
+// accrueInterest adds one day of purchase interest on a revolving balance.
+// Interest accrues in full precision and is charged when the next statement is issued.
+func accrueInterest(tx *sql.Tx, ca *models.CreditAccount, asOf time.Time) error {
+	if ca.LastAccrualDate != nil && !ledger.DateOnly(*ca.LastAccrualDate).Before(asOf) {
+		return nil // Already accrued for this date
+	}
+
+	interest := 0.0
+	if ca.Revolving && ca.BalanceOwed > 0 {
+		interest = ca.BalanceOwed * ca.PurchaseAPR / 100 / 365
+	}
+	ca.AccruedInterest += interest
+	ca.LastAccrualDate = &asOf
+	_, err := tx.Exec("UPDATE credit_accounts SET accrued_interest = ?, last_accrual_date = ? WHERE credit_account_id = ?",
+		ca.AccruedInterest, asOf, ca.CreditAccountID)
+	if err != nil {
+		return fmt.Errorf("accruing interest: %w", err)
+	}
+	return nil
+}
+
+// issueStatement charges accrued interest and closes the cycle ending on asOf
+func issueStatement(tx *sql.Tx, ca *models.CreditAccount, asOf time.Time) error {
+	var exists bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM credit_statements WHERE credit_account_id = ? AND period_end = ?)", ca.CreditAccountID, asOf).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("checking for existing statement: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	if interest := ledger.Round(ca.AccruedInterest); interest > 0 {
+		if err := Post(tx, ca.CreditAccountID, TypeInterest, interest, "Purchase interest"); err != nil {
+			return err
+		}
+		ca.BalanceOwed += interest
+	}
+	if _, err := tx.Exec("UPDATE credit_accounts SET accrued_interest = 0 WHERE credit_account_id = ?", ca.CreditAccountID); err != nil {
+		return fmt.Errorf("resetting accrued interest: %w", err)
+	}
+	ca.AccruedInterest = 0
+
+	st := models.CreditStatement{
+		CreditAccountID: ca.CreditAccountID,
+		PeriodStart:     ledger.DateOnly(ca.CreatedAt),
+		PeriodEnd:       asOf,
+		DueDate:         asOf.AddDate(0, 0, ca.GraceDays),
+	}
+	var previousEnd time.Time
+	err = tx.QueryRow("SELECT period_end, closing_balance FROM credit_statements WHERE credit_account_id = ? ORDER BY period_end DESC LIMIT 1",
+		ca.CreditAccountID).Scan(&previousEnd, &st.OpeningBalance)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("loading previous statement: %w", err)
+	}
+	if err == nil {
+		st.PeriodStart = previousEnd.AddDate(0, 0, 1)
+	}
+
+	// Totals of everything posted during the cycle, end date inclusive. Dispute credits
+	// and their reversals count against purchases, like refunds.
+	err = tx.QueryRow(`SELECT
+			COALESCE(SUM(CASE WHEN type IN ('purchase', 'dispute_reversal') THEN amount WHEN type IN ('refund', 'dispute_credit') THEN -amount END), 0),
+			COALESCE(SUM(CASE WHEN type = 'payment' THEN amount END), 0),
+			COALESCE(SUM(CASE WHEN type = 'interest' THEN amount END), 0),
+			COALESCE(SUM(CASE WHEN type = 'fee' THEN amount END), 0)
+		FROM credit_transactions WHERE credit_account_id = ? AND created_at >= ? AND created_at < ?`,
+		ca.CreditAccountID, st.PeriodStart, asOf.AddDate(0, 0, 1)).Scan(&st.Purchases, &st.Payments, &st.Interest, &st.Fees)
+	if err != nil {
+		return fmt.Errorf("summing cycle transactions: %w", err)
+	}
+
+	st.ClosingBalance = ledger.Round(ca.BalanceOwed)
+	st.MinimumPayment = MinimumPayment(*ca, st.ClosingBalance)
+	status := "issued"
+	if st.ClosingBalance <= 0 {
+		status = "paid_in_full" // Nothing to pay
+	}
+	_, err = tx.Exec(`INSERT INTO credit_statements (credit_account_id, period_start, period_end, opening_balance, purchases, payments,
+		interest, fees, closing_balance, minimum_payment, due_date, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		st.CreditAccountID, st.PeriodStart, st.PeriodEnd, st.OpeningBalance, st.Purchases, st.Payments,
+		st.Interest, st.Fees, st.ClosingBalance, st.MinimumPayment, st.DueDate, status)
+	if err != nil {
+		return fmt.Errorf("inserting statement: %w", err)
+	}
+	return nil
+}
@@ -11,6 +11,13 @@ import (
 // DB is the global database connection pool
 var DB *sql.DB
 
+// Querier runs queries either directly on DB or inside a transaction; both *sql.DB
+// and *sql.Tx satisfy it
+type Querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // InitDB initializes the database connection
 func InitDB(dataSourceName string) {
 	var err error
@@ -0,0 +1,22 @@
+-- Card network requests received by the ISO 8583 simulator.
+-- 'held' rows reduce the available balance of the account until captured or reversed.
+CREATE TABLE IF NOT EXISTS card_authorizations (
+    authorization_id INT AUTO_INCREMENT PRIMARY KEY,
+    card_id          INT NOT NULL,
+    account_id       INT NOT NULL,
+    mti              CHAR(4) NOT NULL,
+    stan             CHAR(6) NOT NULL,
+    rrn              VARCHAR(12) NOT NULL,
+    amount           DECIMAL(15, 2) NOT NULL,
+    mcc              CHAR(4) NOT NULL DEFAULT '',
+    merchant_id      VARCHAR(15) NOT NULL DEFAULT '',
+    response_code    CHAR(2) NOT NULL,
+    auth_code        VARCHAR(6) NOT NULL DEFAULT '',
+    status           ENUM('held', 'captured', 'reversed', 'declined') NOT NULL,
+    created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (card_id) REFERENCES cards(card_id),
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id),
+    INDEX idx_card_authorizations_stan (card_id, mti, stan),
+    INDEX idx_card_authorizations_rrn (card_id, rrn),
+    INDEX idx_card_authorizations_account_status (account_id, status)
+);
@@ -0,0 +1,16 @@
+-- Customer card controls: status, spending limits and merchant category blocks.
+ALTER TABLE cards
+    ADD COLUMN status ENUM('active', 'frozen', 'blocked', 'expired') NOT NULL DEFAULT 'active',
+    ADD COLUMN per_transaction_limit DECIMAL(15, 2) NULL,
+    ADD COLUMN daily_limit DECIMAL(15, 2) NULL;
+
+ALTER TABLE card_authorizations
+    ADD COLUMN decline_reason VARCHAR(32) NOT NULL DEFAULT '' AFTER response_code;
+
+CREATE TABLE IF NOT EXISTS card_mcc_blocks (
+    card_id    INT NOT NULL,
+    mcc        CHAR(4) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (card_id, mcc),
+    FOREIGN KEY (card_id) REFERENCES cards(card_id)
+);
@@ -0,0 +1,49 @@
+-- Credit lines behind credit cards, their movements and monthly statements.
+CREATE TABLE IF NOT EXISTS credit_accounts (
+    credit_account_id   INT AUTO_INCREMENT PRIMARY KEY,
+    card_id             INT NOT NULL UNIQUE,
+    credit_limit        DECIMAL(15, 2) NOT NULL,
+    balance_owed        DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    accrued_interest    DECIMAL(15, 6) NOT NULL DEFAULT 0,
+    purchase_apr        DECIMAL(6, 3) NOT NULL,
+    statement_day       TINYINT NOT NULL,
+    grace_days          INT NOT NULL DEFAULT 21,
+    min_payment_percent DECIMAL(5, 2) NOT NULL DEFAULT 3,
+    min_payment_floor   DECIMAL(15, 2) NOT NULL DEFAULT 25,
+    late_fee            DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    revolving           BOOLEAN NOT NULL DEFAULT FALSE,
+    last_accrual_date   DATE NULL,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (card_id) REFERENCES cards(card_id)
+);
+
+CREATE TABLE IF NOT EXISTS credit_transactions (
+    credit_transaction_id INT AUTO_INCREMENT PRIMARY KEY,
+    credit_account_id     INT NOT NULL,
+    type                  ENUM('purchase', 'refund', 'payment', 'interest', 'fee') NOT NULL,
+    amount                DECIMAL(15, 2) NOT NULL,
+    description           VARCHAR(255) NOT NULL DEFAULT '',
+    created_at            TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (credit_account_id) REFERENCES credit_accounts(credit_account_id),
+    INDEX idx_credit_transactions_account_date (credit_account_id, created_at)
+);
+
+CREATE TABLE IF NOT EXISTS credit_statements (
+    statement_id      INT AUTO_INCREMENT PRIMARY KEY,
+    credit_account_id INT NOT NULL,
+    period_start      DATE NOT NULL,
+    period_end        DATE NOT NULL,
+    opening_balance   DECIMAL(15, 2) NOT NULL,
+    purchases         DECIMAL(15, 2) NOT NULL,
+    payments          DECIMAL(15, 2) NOT NULL,
+    interest          DECIMAL(15, 2) NOT NULL,
+    fees              DECIMAL(15, 2) NOT NULL,
+    closing_balance   DECIMAL(15, 2) NOT NULL,
+    minimum_payment   DECIMAL(15, 2) NOT NULL,
+    due_date          DATE NOT NULL,
+    paid_amount       DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    late_fee_charged  BOOLEAN NOT NULL DEFAULT FALSE,
+    status            ENUM('issued', 'paid_in_full', 'minimum_paid', 'missed') NOT NULL DEFAULT 'issued',
+    FOREIGN KEY (credit_account_id) REFERENCES credit_accounts(credit_account_id),
+    UNIQUE KEY uq_credit_statements_period (credit_account_id, period_end)
+);
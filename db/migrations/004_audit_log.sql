@@ -0,0 +1,39 @@
+-- Append-only, hash-chained audit log of state-changing requests.
+-- Each row's hash covers its contents and the previous row's hash, so edits,
+-- deletions and gaps in seq are detected by cmd/auditverify.
+CREATE TABLE IF NOT EXISTS audit_log (
+    seq           BIGINT PRIMARY KEY,
+    created_at    DATETIME(6) NOT NULL,
+    actor_user_id INT NULL,
+    actor_role    VARCHAR(20) NOT NULL,
+    action        VARCHAR(64) NOT NULL,
+    entity_type   VARCHAR(32) NOT NULL,
+    entity_id     VARCHAR(64) NOT NULL,
+    before_value  MEDIUMTEXT NULL, -- JSON text, kept byte-for-byte so the hash can be recomputed
+    after_value   MEDIUMTEXT NULL,
+    request_id    VARCHAR(64) NOT NULL,
+    prev_hash     CHAR(64) NOT NULL,
+    hash          CHAR(64) NOT NULL,
+    INDEX idx_audit_log_entity (entity_type, entity_id),
+    INDEX idx_audit_log_actor (actor_user_id)
+);
+
+-- Single-row pointer to the end of the chain. Writers lock it to append in order,
+-- and the verifier compares it with the last row to detect a truncated tail.
+CREATE TABLE IF NOT EXISTS audit_chain_head (
+    id   TINYINT PRIMARY KEY,
+    seq  BIGINT NOT NULL,
+    hash CHAR(64) NOT NULL
+);
+INSERT IGNORE INTO audit_chain_head (id, seq, hash) VALUES (1, 0, REPEAT('0', 64));
+
+DELIMITER //
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log FOR EACH ROW
+BEGIN
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+END//
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log FOR EACH ROW
+BEGIN
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+END//
+DELIMITER ;
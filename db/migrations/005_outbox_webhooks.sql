@@ -0,0 +1,35 @@
+-- Account events written in the same transaction as the balance change, and their
+-- delivery to registered webhooks.
+CREATE TABLE IF NOT EXISTS outbox_events (
+    event_id      BIGINT AUTO_INCREMENT PRIMARY KEY,
+    event_type    VARCHAR(64) NOT NULL,
+    aggregate_id  VARCHAR(64) NOT NULL,
+    payload       MEDIUMTEXT NOT NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    dispatched_at TIMESTAMP NULL, -- Set once deliveries have been created for every subscription
+    INDEX idx_outbox_events_undispatched (dispatched_at, event_id)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    subscription_id INT AUTO_INCREMENT PRIMARY KEY,
+    url             VARCHAR(2048) NOT NULL,
+    secret          VARCHAR(128) NOT NULL,
+    event_types     VARCHAR(512) NOT NULL DEFAULT '*', -- Comma-separated, '*' for all
+    active          BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    delivery_id     BIGINT AUTO_INCREMENT PRIMARY KEY,
+    event_id        BIGINT NOT NULL,
+    subscription_id INT NOT NULL,
+    status          ENUM('pending', 'delivered', 'dead') NOT NULL DEFAULT 'pending',
+    attempts        INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error      VARCHAR(1024) NOT NULL DEFAULT '',
+    delivered_at    TIMESTAMP NULL,
+    FOREIGN KEY (event_id) REFERENCES outbox_events(event_id),
+    FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions(subscription_id),
+    UNIQUE KEY uq_webhook_deliveries (event_id, subscription_id),
+    INDEX idx_webhook_deliveries_due (status, next_attempt_at)
+);
@@ -0,0 +1,9 @@
+-- Arranged overdrafts on current accounts and daily overdraft interest accrual.
+ALTER TABLE accounts
+    ADD COLUMN overdraft_limit DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN overdraft_rate DECIMAL(6, 3) NOT NULL DEFAULT 19.900,
+    ADD COLUMN overdraft_interest_accrued DECIMAL(15, 6) NOT NULL DEFAULT 0,
+    -- Business date the overdraft cycle last ran; cleared when the account leaves the cycle
+    ADD COLUMN overdraft_last_run DATE NULL,
+    -- First day of the month in which the unarranged overdraft fee was last charged
+    ADD COLUMN overdraft_fee_month DATE NULL;
@@ -0,0 +1,40 @@
+-- Limits on withdrawals and outgoing transfers by account type and customer tier,
+-- with per-account overrides. NULL means no limit.
+ALTER TABLE transactions
+    MODIFY COLUMN type ENUM('deposit', 'withdrawal', 'transfer_in', 'transfer_out', 'fee', 'interest') NOT NULL;
+
+-- Usage is summed over an account's recent outflows inside the locking transaction
+CREATE INDEX idx_transactions_account_date ON transactions (account_id, transaction_date);
+
+ALTER TABLE customers
+    ADD COLUMN tier ENUM('standard', 'premium', 'private') NOT NULL DEFAULT 'standard';
+
+CREATE TABLE IF NOT EXISTS transaction_limits (
+    account_type    ENUM('savings', 'current') NOT NULL,
+    customer_tier   ENUM('standard', 'premium', 'private') NOT NULL,
+    per_transaction DECIMAL(15, 2) NULL,
+    daily_amount    DECIMAL(15, 2) NULL,
+    monthly_amount  DECIMAL(15, 2) NULL,
+    daily_count     INT NULL,
+    updated_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (account_type, customer_tier)
+);
+
+INSERT IGNORE INTO transaction_limits (account_type, customer_tier, per_transaction, daily_amount, monthly_amount, daily_count) VALUES
+    ('savings', 'standard', 2000, 5000, 20000, 5),
+    ('savings', 'premium', 10000, 25000, 100000, 10),
+    ('savings', 'private', NULL, 100000, NULL, NULL),
+    ('current', 'standard', 5000, 10000, 50000, 20),
+    ('current', 'premium', 25000, 50000, 250000, 50),
+    ('current', 'private', NULL, 250000, NULL, NULL);
+
+-- A non-NULL column replaces the corresponding default for that one account
+CREATE TABLE IF NOT EXISTS account_limit_overrides (
+    account_id      INT PRIMARY KEY,
+    per_transaction DECIMAL(15, 2) NULL,
+    daily_amount    DECIMAL(15, 2) NULL,
+    monthly_amount  DECIMAL(15, 2) NULL,
+    daily_count     INT NULL,
+    updated_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id)
+);
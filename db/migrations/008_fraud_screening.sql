@@ -0,0 +1,38 @@
+-- Fraud screening of withdrawals and transfers, and the queue of transfers held for review.
+ALTER TABLE transactions
+    ADD COLUMN counterparty_account_id INT NULL AFTER account_id,
+    ADD INDEX idx_transactions_counterparty (account_id, counterparty_account_id);
+
+CREATE TABLE IF NOT EXISTS fraud_decisions (
+    decision_id             BIGINT AUTO_INCREMENT PRIMARY KEY,
+    kind                    ENUM('withdrawal', 'transfer') NOT NULL,
+    account_id              INT NOT NULL,
+    counterparty_account_id INT NULL,
+    amount                  DECIMAL(15, 2) NOT NULL,
+    decision                ENUM('allow', 'review', 'deny') NOT NULL,
+    score                   INT NOT NULL,
+    outcomes                TEXT NOT NULL, -- JSON array of per-rule outcomes
+    request_id              VARCHAR(64) NOT NULL DEFAULT '',
+    review_outcome          ENUM('approved', 'rejected') NULL, -- Set once an employee reviews the held transfer
+    created_at              TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_fraud_decisions_decision (decision, created_at),
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id)
+);
+
+CREATE TABLE IF NOT EXISTS pending_transfers (
+    pending_transfer_id INT AUTO_INCREMENT PRIMARY KEY,
+    decision_id         BIGINT NOT NULL,
+    from_account_id     INT NOT NULL,
+    to_account_id       INT NOT NULL,
+    amount              DECIMAL(15, 2) NOT NULL,
+    status              ENUM('pending', 'approved', 'rejected') NOT NULL DEFAULT 'pending',
+    requested_by        INT NULL, -- users.user_id
+    reviewed_by         INT NULL, -- users.user_id
+    review_note         VARCHAR(255) NOT NULL DEFAULT '',
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reviewed_at         TIMESTAMP NULL,
+    INDEX idx_pending_transfers_status (status, created_at),
+    FOREIGN KEY (decision_id) REFERENCES fraud_decisions(decision_id),
+    FOREIGN KEY (from_account_id) REFERENCES accounts(account_id),
+    FOREIGN KEY (to_account_id) REFERENCES accounts(account_id)
+);
@@ -0,0 +1,53 @@
+-- Sanctions and PEP lists, screening of customers and the case queue for hits.
+ALTER TABLE customers
+    ADD COLUMN screening_status ENUM('clear', 'pending', 'confirmed') NOT NULL DEFAULT 'clear';
+
+CREATE TABLE IF NOT EXISTS sanctions_lists (
+    list_name   VARCHAR(64) PRIMARY KEY,
+    entry_count INT NOT NULL,
+    loaded_at   TIMESTAMP(6) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sanctions_entries (
+    entry_id        BIGINT AUTO_INCREMENT PRIMARY KEY,
+    list_name       VARCHAR(64) NOT NULL,
+    external_id     VARCHAR(64) NOT NULL,
+    entry_type      ENUM('individual', 'entity') NOT NULL,
+    name            VARCHAR(512) NOT NULL,
+    normalized_name VARCHAR(512) NOT NULL,
+    dob             DATE NULL,
+    birth_year      INT NULL,
+    program         VARCHAR(255) NOT NULL DEFAULT '',
+    pep             BOOLEAN NOT NULL DEFAULT FALSE,
+    active          BOOLEAN NOT NULL DEFAULT TRUE, -- FALSE once the entry is no longer on the list
+    UNIQUE KEY uq_sanctions_entries_source (list_name, external_id)
+);
+
+CREATE TABLE IF NOT EXISTS sanctions_aliases (
+    alias_id        BIGINT AUTO_INCREMENT PRIMARY KEY,
+    entry_id        BIGINT NOT NULL,
+    name            VARCHAR(512) NOT NULL,
+    normalized_name VARCHAR(512) NOT NULL,
+    FOREIGN KEY (entry_id) REFERENCES sanctions_entries(entry_id)
+);
+
+CREATE TABLE IF NOT EXISTS screening_cases (
+    case_id       INT AUTO_INCREMENT PRIMARY KEY,
+    customer_id   INT NOT NULL,
+    entry_id      BIGINT NOT NULL,
+    list_name     VARCHAR(64) NOT NULL,
+    screened_name VARCHAR(255) NOT NULL,
+    matched_name  VARCHAR(512) NOT NULL,
+    score         DECIMAL(4, 3) NOT NULL,
+    pep           BOOLEAN NOT NULL DEFAULT FALSE,
+    trigger_event ENUM('onboarding', 'update', 'transfer', 'rescreen') NOT NULL,
+    status        ENUM('open', 'cleared', 'confirmed') NOT NULL DEFAULT 'open',
+    reviewed_by   INT NULL, -- users.user_id
+    review_note   VARCHAR(255) NOT NULL DEFAULT '',
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reviewed_at   TIMESTAMP NULL,
+    UNIQUE KEY uq_screening_cases_hit (customer_id, entry_id),
+    INDEX idx_screening_cases_status (status, created_at),
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id),
+    FOREIGN KEY (entry_id) REFERENCES sanctions_entries(entry_id)
+);
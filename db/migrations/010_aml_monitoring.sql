@@ -0,0 +1,34 @@
+-- Suspicious activity cases opened by the AML monitoring scan, and their history.
+CREATE TABLE IF NOT EXISTS aml_cases (
+    case_id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    scenario         ENUM('structuring', 'rapid_movement', 'dormant_reactivation') NOT NULL,
+    account_id       INT NOT NULL,
+    customer_id      INT NOT NULL,
+    amount           DECIMAL(15, 2) NOT NULL,
+    evidence         JSON NOT NULL, -- Summary and supporting transactions
+    detected_for     DATE NOT NULL, -- Business date of the scan that opened the case
+    status           ENUM('open', 'investigating', 'escalated', 'filed', 'closed') NOT NULL DEFAULT 'open',
+    assigned_to      INT NULL, -- employees.employee_id
+    report_reference VARCHAR(64) NULL, -- Reference of the filed suspicious activity report
+    filed_at         TIMESTAMP NULL,
+    created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_aml_cases_subject (scenario, account_id, detected_for),
+    INDEX idx_aml_cases_status (status, created_at),
+    INDEX idx_aml_cases_filed (filed_at),
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id),
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id),
+    FOREIGN KEY (assigned_to) REFERENCES employees(employee_id)
+);
+
+CREATE TABLE IF NOT EXISTS aml_case_events (
+    event_id      BIGINT AUTO_INCREMENT PRIMARY KEY,
+    case_id       BIGINT NOT NULL,
+    from_status   VARCHAR(20) NOT NULL DEFAULT '', -- Empty when the case is opened
+    to_status     VARCHAR(20) NOT NULL,
+    actor_user_id INT NULL, -- NULL for the scanner
+    note          VARCHAR(1000) NOT NULL DEFAULT '',
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_aml_case_events_case (case_id, event_id),
+    FOREIGN KEY (case_id) REFERENCES aml_cases(case_id)
+);
@@ -0,0 +1,27 @@
+-- KYC documents and the verification status of customers. Existing customers were
+-- onboarded before document checks and are treated as verified.
+ALTER TABLE customers
+    ADD COLUMN kyc_status ENUM('unverified', 'pending', 'verified', 'rejected') NOT NULL DEFAULT 'unverified';
+
+UPDATE customers SET kyc_status = 'verified';
+
+CREATE TABLE IF NOT EXISTS kyc_documents (
+    document_id   INT AUTO_INCREMENT PRIMARY KEY,
+    customer_id   INT NOT NULL,
+    document_type ENUM('id', 'proof_of_address') NOT NULL,
+    file_name     VARCHAR(255) NOT NULL,
+    content_type  VARCHAR(100) NOT NULL,
+    size_bytes    BIGINT NOT NULL,
+    sha256        CHAR(64) NOT NULL,
+    storage_key   VARCHAR(255) NOT NULL, -- Key in the document blob store
+    status        ENUM('pending', 'approved', 'rejected') NOT NULL DEFAULT 'pending',
+    uploaded_by   INT NOT NULL, -- users.user_id
+    reviewed_by   INT NULL, -- users.user_id
+    review_note   VARCHAR(255) NOT NULL DEFAULT '',
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reviewed_at   TIMESTAMP NULL,
+    UNIQUE KEY uq_kyc_documents_storage_key (storage_key),
+    INDEX idx_kyc_documents_customer (customer_id, document_type, document_id),
+    INDEX idx_kyc_documents_status (status, created_at),
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id)
+);
@@ -0,0 +1,19 @@
+-- Account lifecycle status and its history. Existing accounts are active; new accounts
+-- start pending until an employee activates them.
+ALTER TABLE accounts
+    ADD COLUMN status ENUM('pending', 'active', 'frozen', 'dormant', 'closed') NOT NULL DEFAULT 'pending',
+    ADD COLUMN closed_date DATE NULL;
+
+UPDATE accounts SET status = 'active';
+
+CREATE TABLE IF NOT EXISTS account_status_events (
+    event_id      BIGINT AUTO_INCREMENT PRIMARY KEY,
+    account_id    INT NOT NULL,
+    from_status   VARCHAR(20) NOT NULL,
+    to_status     VARCHAR(20) NOT NULL,
+    reason        VARCHAR(255) NOT NULL,
+    actor_user_id INT NOT NULL, -- users.user_id
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_account_status_events_account (account_id, event_id),
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id)
+);
@@ -0,0 +1,46 @@
+-- Joint accounts: secondary holders, signing rules and co-signed transfer requests.
+-- The primary holder remains accounts.customer_id.
+CREATE TABLE IF NOT EXISTS account_holders (
+    account_id  INT NOT NULL,
+    customer_id INT NOT NULL,
+    role        ENUM('joint', 'authorized_signatory', 'view_only') NOT NULL,
+    added_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account_id, customer_id),
+    INDEX idx_account_holders_customer (customer_id),
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id),
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id)
+);
+
+CREATE TABLE IF NOT EXISTS account_signing_rules (
+    account_id INT PRIMARY KEY,
+    rule       ENUM('any_one', 'all_must_approve') NOT NULL DEFAULT 'any_one',
+    threshold  DECIMAL(15, 2) NOT NULL DEFAULT 0.00, -- Transfers above it need every signer under 'all_must_approve'
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id)
+);
+
+CREATE TABLE IF NOT EXISTS transfer_approvals (
+    approval_id     INT AUTO_INCREMENT PRIMARY KEY,
+    from_account_id INT NOT NULL,
+    to_account_id   INT NOT NULL,
+    amount          DECIMAL(15, 2) NOT NULL,
+    requested_by    INT NOT NULL, -- customers.customer_id
+    status          ENUM('pending', 'approved', 'rejected', 'executed') NOT NULL DEFAULT 'pending',
+    created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    decided_at      TIMESTAMP NULL, -- When the last signature arrived
+    executed_at     TIMESTAMP NULL,
+    INDEX idx_transfer_approvals_from (from_account_id, status),
+    FOREIGN KEY (from_account_id) REFERENCES accounts(account_id),
+    FOREIGN KEY (to_account_id) REFERENCES accounts(account_id)
+);
+
+CREATE TABLE IF NOT EXISTS transfer_approval_signatures (
+    approval_id INT NOT NULL,
+    customer_id INT NOT NULL,
+    decision    ENUM('pending', 'approved', 'rejected') NOT NULL DEFAULT 'pending',
+    decided_by  INT NULL, -- users.user_id
+    decided_at  TIMESTAMP NULL,
+    PRIMARY KEY (approval_id, customer_id),
+    INDEX idx_transfer_approval_signatures_customer (customer_id, decision),
+    FOREIGN KEY (approval_id) REFERENCES transfer_approvals(approval_id)
+);
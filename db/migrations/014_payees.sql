@@ -0,0 +1,27 @@
+-- Saved payees with confirmation-of-payee results and a cooling-off window during which
+-- transfers to a new payee are capped.
+CREATE TABLE IF NOT EXISTS payees (
+    payee_id          INT AUTO_INCREMENT PRIMARY KEY,
+    customer_id       INT NOT NULL, -- Customer who saved the payee
+    name              VARCHAR(100) NOT NULL, -- Name as entered, checked against the destination's holders
+    account_number    VARCHAR(20) NOT NULL, -- Destination account, resolved from the IBAN if one was given
+    iban              VARCHAR(34) NULL,
+    nickname          VARCHAR(50) NOT NULL DEFAULT '',
+    name_match        ENUM('match', 'close_match', 'no_match') NOT NULL,
+    cooling_off_until TIMESTAMP NOT NULL,
+    created_by        INT NULL, -- users.user_id
+    created_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_payees_customer_account (customer_id, account_number),
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id)
+);
+
+-- Single row of bank-wide payee settings
+CREATE TABLE IF NOT EXISTS payee_settings (
+    settings_id       TINYINT PRIMARY KEY DEFAULT 1,
+    cooling_off_hours INT NOT NULL DEFAULT 24,
+    new_payee_limit   DECIMAL(15, 2) NOT NULL DEFAULT 1000.00, -- Total that may be sent to a payee during its cooling-off window
+    updated_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CHECK (settings_id = 1)
+);
+
+INSERT IGNORE INTO payee_settings (settings_id) VALUES (1);
@@ -0,0 +1,49 @@
+-- Maker-checker approval of high-value staff operations. An operation at or above its
+-- threshold is stored as a pending request and only executed once a second employee
+-- approves it.
+CREATE TABLE IF NOT EXISTS approval_thresholds (
+    operation    VARCHAR(40) PRIMARY KEY,
+    threshold    DECIMAL(15, 2) NULL, -- NULL disables approval for the operation
+    checker_role ENUM('employee', 'admin') NOT NULL DEFAULT 'employee', -- Least authority that may approve
+    updated_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+INSERT IGNORE INTO approval_thresholds (operation, threshold, checker_role) VALUES
+    ('transfer', 10000.00, 'employee'),
+    ('overdraft', 5000.00, 'employee'),
+    ('account_closure', 0.00, 'employee');
+
+CREATE TABLE IF NOT EXISTS approval_requests (
+    approval_request_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    operation           VARCHAR(40) NOT NULL,
+    entity_type         VARCHAR(40) NOT NULL,
+    entity_id           VARCHAR(64) NOT NULL,
+    branch_id           INT NOT NULL, -- Branch whose staff may approve
+    amount              DECIMAL(15, 2) NOT NULL,
+    route_vars          JSON NOT NULL, -- Route variables of the original request
+    body                JSON NOT NULL, -- Decoded body of the original request
+    status              ENUM('pending', 'approved', 'rejected', 'executed', 'accepted', 'failed') NOT NULL DEFAULT 'pending', -- 'accepted': held or scheduled by the operation
+    maker_user_id       INT NOT NULL, -- users.user_id
+    checker_user_id     INT NULL, -- users.user_id
+    decision_note       VARCHAR(1000) NOT NULL DEFAULT '',
+    result_status       INT NULL, -- HTTP status of the execution
+    result_body         TEXT NULL,
+    execution_id        VARCHAR(32) NULL, -- Stored in the operation's transaction by the execution that took effect
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    decided_at          TIMESTAMP NULL,
+    executed_at         TIMESTAMP NULL,
+    INDEX idx_approval_requests_status (status, created_at),
+    INDEX idx_approval_requests_entity (entity_type, entity_id)
+);
+
+CREATE TABLE IF NOT EXISTS approval_request_events (
+    event_id            BIGINT AUTO_INCREMENT PRIMARY KEY,
+    approval_request_id BIGINT NOT NULL,
+    from_status         VARCHAR(20) NOT NULL DEFAULT '', -- Empty when the request is made
+    to_status           VARCHAR(20) NOT NULL,
+    actor_user_id       INT NULL,
+    note                VARCHAR(1000) NOT NULL DEFAULT '',
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_approval_request_events_request (approval_request_id, event_id),
+    FOREIGN KEY (approval_request_id) REFERENCES approval_requests(approval_request_id)
+);
@@ -0,0 +1,69 @@
+-- Teller sessions at branches: the cash drawer of each session by denomination, the cash
+-- deposits and withdrawals booked against it, and overages and shortages found when the
+-- drawer is balanced at the end of the shift.
+CREATE TABLE IF NOT EXISTS teller_sessions (
+    session_id       INT AUTO_INCREMENT PRIMARY KEY,
+    employee_id      INT NOT NULL,
+    branch_id        INT NOT NULL,
+    status           ENUM('open', 'closed') NOT NULL DEFAULT 'open',
+    opening_total    DECIMAL(15, 2) NOT NULL,
+    expected_total   DECIMAL(15, 2) NULL, -- Drawer according to the bookings, set on close
+    counted_total    DECIMAL(15, 2) NULL, -- Drawer as counted on close
+    variance         DECIMAL(15, 2) NULL, -- counted_total - expected_total
+    opened_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    closed_at        TIMESTAMP NULL,
+    closed_by        INT NULL, -- users.user_id
+    close_note       VARCHAR(1000) NOT NULL DEFAULT '',
+    open_employee_id INT AS (CASE WHEN status = 'open' THEN employee_id END) STORED, -- One open session per employee
+    UNIQUE KEY uq_teller_sessions_open (open_employee_id),
+    INDEX idx_teller_sessions_branch (branch_id, status, opened_at),
+    FOREIGN KEY (employee_id) REFERENCES employees(employee_id),
+    FOREIGN KEY (branch_id) REFERENCES branches(branch_id)
+);
+
+-- Notes and coins currently in the drawer of a session
+CREATE TABLE IF NOT EXISTS teller_drawers (
+    session_id   INT NOT NULL,
+    denomination DECIMAL(10, 2) NOT NULL,
+    count        INT NOT NULL,
+    PRIMARY KEY (session_id, denomination),
+    FOREIGN KEY (session_id) REFERENCES teller_sessions(session_id),
+    CHECK (count >= 0)
+);
+
+-- Drawer counts made when opening and closing a session
+CREATE TABLE IF NOT EXISTS teller_session_counts (
+    session_id   INT NOT NULL,
+    kind         ENUM('opening', 'closing') NOT NULL,
+    denomination DECIMAL(10, 2) NOT NULL,
+    count        INT NOT NULL,
+    PRIMARY KEY (session_id, kind, denomination),
+    FOREIGN KEY (session_id) REFERENCES teller_sessions(session_id)
+);
+
+CREATE TABLE IF NOT EXISTS teller_cash_movements (
+    movement_id    BIGINT AUTO_INCREMENT PRIMARY KEY,
+    session_id     INT NOT NULL,
+    account_id     INT NOT NULL,
+    transaction_id BIGINT NOT NULL,
+    kind           ENUM('deposit', 'withdrawal') NOT NULL,
+    amount         DECIMAL(15, 2) NOT NULL,
+    cash           JSON NOT NULL, -- Denominations handed over or paid out
+    created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_teller_cash_movements_session (session_id, movement_id),
+    FOREIGN KEY (session_id) REFERENCES teller_sessions(session_id),
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id)
+);
+
+-- The branch's cash over and short postings from drawer balancing
+CREATE TABLE IF NOT EXISTS branch_cash_postings (
+    posting_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    branch_id  INT NOT NULL,
+    session_id INT NOT NULL,
+    type       ENUM('overage', 'shortage') NOT NULL,
+    amount     DECIMAL(15, 2) NOT NULL, -- Always positive
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_branch_cash_postings_branch (branch_id, created_at),
+    FOREIGN KEY (branch_id) REFERENCES branches(branch_id),
+    FOREIGN KEY (session_id) REFERENCES teller_sessions(session_id)
+);
@@ -0,0 +1,33 @@
+-- Business date and the end-of-day runs that close it. The business date only moves
+-- forward when every end-of-day step for it has completed.
+CREATE TABLE IF NOT EXISTS business_date (
+    id            TINYINT PRIMARY KEY DEFAULT 1,
+    business_date DATE NOT NULL,
+    updated_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CHECK (id = 1)
+);
+
+INSERT IGNORE INTO business_date (id, business_date) VALUES (1, CURDATE());
+
+CREATE TABLE IF NOT EXISTS eod_runs (
+    run_id        INT AUTO_INCREMENT PRIMARY KEY,
+    business_date DATE NOT NULL,
+    status        ENUM('running', 'completed', 'failed') NOT NULL DEFAULT 'running',
+    started_by    INT NULL, -- users.user_id; NULL when started from the command line
+    started_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Of the latest attempt
+    finished_at   TIMESTAMP NULL,
+    UNIQUE KEY uq_eod_runs_date (business_date)
+);
+
+CREATE TABLE IF NOT EXISTS eod_run_steps (
+    run_id      INT NOT NULL,
+    step        VARCHAR(40) NOT NULL,
+    position    INT NOT NULL, -- Steps run in ascending position
+    status      ENUM('pending', 'running', 'completed', 'failed') NOT NULL DEFAULT 'pending',
+    attempts    INT NOT NULL DEFAULT 0,
+    started_at  TIMESTAMP NULL,
+    finished_at TIMESTAMP NULL,
+    error       TEXT NULL, -- Of the latest failed attempt
+    PRIMARY KEY (run_id, step),
+    FOREIGN KEY (run_id) REFERENCES eod_runs(run_id)
+);
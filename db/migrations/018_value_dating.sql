@@ -0,0 +1,62 @@
+-- Bank holiday calendars per country, loaded from files with cmd/calendarload.
+-- Saturdays and Sundays are never business days and are not listed.
+CREATE TABLE IF NOT EXISTS holidays (
+    country      CHAR(2) NOT NULL,
+    holiday_date DATE NOT NULL,
+    name         VARCHAR(100) NOT NULL,
+    PRIMARY KEY (country, holiday_date)
+);
+
+-- Payments requested at or after the cut-off, or on a day that is not a business day,
+-- are value-dated to the next business day. Times are in the server's local time zone.
+CREATE TABLE IF NOT EXISTS cut_off_times (
+    payment_type VARCHAR(20) PRIMARY KEY,
+    cut_off      TIME NOT NULL,
+    updated_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+INSERT IGNORE INTO cut_off_times (payment_type, cut_off) VALUES
+    ('transfer', '17:30:00'),
+    ('payee', '15:30:00');
+
+-- Booking date is the business date the row was posted on; value date is the business
+-- date from which the money counts. Rows posted before this migration get both from
+-- their timestamp.
+ALTER TABLE transactions
+    ADD COLUMN booking_date DATE NULL AFTER transaction_date,
+    ADD COLUMN value_date   DATE NULL AFTER booking_date;
+
+UPDATE transactions SET booking_date = DATE(transaction_date), value_date = DATE(transaction_date) WHERE booking_date IS NULL;
+
+ALTER TABLE transactions
+    MODIFY COLUMN booking_date DATE NOT NULL,
+    MODIFY COLUMN value_date   DATE NOT NULL,
+    ADD INDEX idx_transactions_account_booking (account_id, booking_date);
+
+-- Co-signed transfers keep their payment type for the cut-off at the last signature
+ALTER TABLE transfer_approvals
+    ADD COLUMN payment_type VARCHAR(20) NOT NULL DEFAULT 'transfer' AFTER amount;
+
+-- Transfers held for fraud review keep their payment type for the cut-off when they are approved
+ALTER TABLE pending_transfers
+    ADD COLUMN payment_type VARCHAR(20) NOT NULL DEFAULT 'transfer' AFTER amount;
+
+-- Transfers accepted after cut-off, executed by the end-of-day run before their value date
+CREATE TABLE IF NOT EXISTS scheduled_transfers (
+    scheduled_transfer_id INT AUTO_INCREMENT PRIMARY KEY,
+    from_account_id       INT NOT NULL,
+    to_account_id         INT NOT NULL,
+    amount                DECIMAL(15, 2) NOT NULL,
+    payment_type          VARCHAR(20) NOT NULL,
+    value_date            DATE NOT NULL,
+    status                ENUM('scheduled', 'executed', 'failed', 'cancelled') NOT NULL DEFAULT 'scheduled',
+    failure_reason        VARCHAR(255) NULL,
+    requested_by          INT NULL, -- users.user_id
+    request_id            VARCHAR(64) NOT NULL DEFAULT '',
+    created_at            TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at           TIMESTAMP NULL, -- Executed, failed or cancelled
+    FOREIGN KEY (from_account_id) REFERENCES accounts(account_id),
+    FOREIGN KEY (to_account_id) REFERENCES accounts(account_id),
+    INDEX idx_scheduled_transfers_due (status, value_date),
+    INDEX idx_scheduled_transfers_from (from_account_id, status)
+);
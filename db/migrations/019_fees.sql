@@ -0,0 +1,67 @@
+-- Fee engine: schedules by account type and fee type, waivers per account, and the
+-- charges posted. Each charge debits the account and credits the fee income account; a
+-- refund credits the account ('fee_refund') and debits the fee income account ('fee_income_refund').
+ALTER TABLE transactions
+    MODIFY COLUMN type ENUM('deposit', 'withdrawal', 'transfer_in', 'transfer_out', 'fee', 'interest', 'fee_income', 'fee_refund', 'fee_income_refund') NOT NULL;
+
+-- The bank-owned account fee income is credited to. No fee can be activated until it is set.
+CREATE TABLE IF NOT EXISTS fee_settings (
+    settings_id       TINYINT PRIMARY KEY DEFAULT 1,
+    income_account_id INT NULL,
+    updated_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (income_account_id) REFERENCES accounts(account_id),
+    CHECK (settings_id = 1)
+);
+
+INSERT IGNORE INTO fee_settings (settings_id) VALUES (1);
+
+-- A fee is amount + rate% of the movement, once the month's free movements are used up.
+-- Monthly maintenance is a flat amount charged at the end of each calendar month.
+CREATE TABLE IF NOT EXISTS fee_schedules (
+    account_type   ENUM('savings', 'current') NOT NULL,
+    fee_type       ENUM('monthly_maintenance', 'withdrawal', 'inter_branch_transfer', 'fx') NOT NULL,
+    amount         DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    rate           DECIMAL(7, 4) NOT NULL DEFAULT 0, -- Percent of the movement's amount
+    free_per_month INT NOT NULL DEFAULT 0,
+    active         BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (account_type, fee_type)
+);
+
+-- Fee-bearing movements per calendar month, counted against the free allowance
+CREATE TABLE IF NOT EXISTS fee_usage (
+    account_id INT NOT NULL,
+    fee_type   VARCHAR(30) NOT NULL,
+    month      DATE NOT NULL, -- First day of the month
+    movements  INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (account_id, fee_type, month),
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id)
+);
+
+CREATE TABLE IF NOT EXISTS fee_waivers (
+    waiver_id   INT AUTO_INCREMENT PRIMARY KEY,
+    account_id  INT NOT NULL,
+    fee_type    VARCHAR(30) NULL, -- NULL waives every fee
+    reason      VARCHAR(255) NOT NULL,
+    valid_until DATE NULL, -- Last day covered; NULL for no end
+    created_by  INT NOT NULL, -- users.user_id
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_by  INT NULL,
+    revoked_at  TIMESTAMP NULL,
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id),
+    INDEX idx_fee_waivers_account (account_id, revoked_at)
+);
+
+CREATE TABLE IF NOT EXISTS fee_charges (
+    charge_id      BIGINT AUTO_INCREMENT PRIMARY KEY,
+    account_id     INT NOT NULL,
+    fee_type       VARCHAR(30) NOT NULL,
+    amount         DECIMAL(15, 2) NOT NULL,
+    transaction_id BIGINT NOT NULL, -- The fee debit on the account
+    reference      VARCHAR(64) NULL, -- What incurred the fee, e.g. '2026-10' for maintenance or 'card_authorization:17'
+    status         ENUM('charged', 'refunded') NOT NULL DEFAULT 'charged',
+    created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    refunded_at    TIMESTAMP NULL,
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id),
+    UNIQUE KEY uq_fee_charges_reference (account_id, fee_type, reference)
+);
@@ -0,0 +1,51 @@
+-- Term deposits: fixed-rate, fixed-term accounts funded from an existing account. At
+-- maturity they roll over or pay out; before it they can only be broken with a penalty.
+ALTER TABLE accounts
+    MODIFY COLUMN account_type ENUM('savings', 'current', 'term') NOT NULL;
+
+ALTER TABLE transactions
+    MODIFY COLUMN type ENUM('deposit', 'withdrawal', 'transfer_in', 'transfer_out', 'fee', 'interest', 'fee_income', 'fee_refund', 'interest_paid', 'fee_income_refund') NOT NULL;
+
+-- Term deposits paid out at maturity are closed by the batch, without an acting user
+ALTER TABLE account_status_events
+    MODIFY COLUMN actor_user_id INT NULL;
+
+-- Rates offered for new deposits and rollovers, by term
+CREATE TABLE IF NOT EXISTS term_deposit_rates (
+    term_months  INT PRIMARY KEY,
+    rate         DECIMAL(6, 3) NOT NULL, -- Annual interest rate, e.g. 4.25
+    penalty_rate DECIMAL(6, 3) NOT NULL DEFAULT 0, -- Early withdrawal penalty, percent of principal
+    min_amount   DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    active       BOOLEAN NOT NULL DEFAULT TRUE, -- Offered for new deposits
+    updated_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+INSERT IGNORE INTO term_deposit_rates (term_months, rate, penalty_rate, min_amount) VALUES
+    (3, 3.000, 0.500, 1000),
+    (6, 3.500, 0.750, 1000),
+    (12, 4.000, 1.000, 1000),
+    (24, 4.250, 1.500, 1000);
+
+-- The current term of each term deposit account. A rollover starts a new term on the same
+-- row; the terms before it are in the audit log.
+CREATE TABLE IF NOT EXISTS term_deposits (
+    account_id           INT PRIMARY KEY,
+    funding_account_id   INT NOT NULL,
+    payout_account_id    INT NOT NULL, -- Nominated account for interest or the payout at maturity
+    principal            DECIMAL(15, 2) NOT NULL,
+    rate                 DECIMAL(6, 3) NOT NULL,
+    penalty_rate         DECIMAL(6, 3) NOT NULL,
+    term_months          INT NOT NULL,
+    start_date           DATE NOT NULL,
+    maturity_date        DATE NOT NULL,
+    maturity_instruction ENUM('rollover', 'rollover_principal', 'payout') NOT NULL,
+    status               ENUM('open', 'matured', 'withdrawn') NOT NULL DEFAULT 'open',
+    rollovers            INT NOT NULL DEFAULT 0,
+    created_by           INT NOT NULL, -- users.user_id
+    created_at           TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    closed_at            TIMESTAMP NULL,
+    INDEX idx_term_deposits_maturity (status, maturity_date),
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id),
+    FOREIGN KEY (funding_account_id) REFERENCES accounts(account_id),
+    FOREIGN KEY (payout_account_id) REFERENCES accounts(account_id)
+);
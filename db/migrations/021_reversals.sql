@@ -0,0 +1,37 @@
+-- Reversals of posted transactions. A reversal is a contra entry pointing back at the row
+-- it reverses; the two legs of a transfer or fee are linked so both are reversed together.
+ALTER TABLE transactions
+    MODIFY COLUMN type ENUM('deposit', 'withdrawal', 'transfer_in', 'transfer_out', 'fee', 'interest', 'fee_income', 'fee_refund', 'interest_paid',
+        'fee_income_refund', 'reversal_credit', 'reversal_debit') NOT NULL,
+    ADD COLUMN linked_transaction_id BIGINT NULL, -- The other leg of a transfer, fee or fee refund
+    ADD COLUMN reversal_of BIGINT NULL, -- Set on contra entries; a row can be reversed once
+    ADD UNIQUE KEY uq_transactions_reversal_of (reversal_of);
+
+-- Link the legs of earlier movements. Both legs were posted in the same statement batch:
+-- they name each other as counterparty and share the amount, the timestamp and the
+-- description (a transfer's names the other account). Legs matching more than one
+-- candidate are left unlinked, and ledger.Reverse refuses to reverse them.
+CREATE TABLE reversal_leg_pairs AS
+SELECT o.transaction_id AS out_id, i.transaction_id AS in_id
+FROM transactions o
+JOIN accounts oa ON oa.account_id = o.account_id
+JOIN transactions i ON i.account_id = o.counterparty_account_id AND i.counterparty_account_id = o.account_id
+    AND i.amount = o.amount AND i.transaction_date = o.transaction_date
+JOIN accounts ia ON ia.account_id = i.account_id
+WHERE (o.type = 'transfer_out' AND i.type = 'transfer_in'
+        AND o.description = CONCAT('Transfer to ', ia.account_number) AND i.description = CONCAT('Transfer from ', oa.account_number))
+    OR (o.type = 'fee' AND i.type = 'fee_income' AND i.description = o.description)
+    OR (o.type = 'fee_refund' AND i.type = 'fee_income_refund' AND i.description = o.description);
+
+UPDATE transactions o
+JOIN reversal_leg_pairs p ON p.out_id = o.transaction_id
+JOIN transactions i ON i.transaction_id = p.in_id
+SET o.linked_transaction_id = i.transaction_id, i.linked_transaction_id = o.transaction_id
+WHERE p.out_id IN (SELECT out_id FROM (SELECT out_id FROM reversal_leg_pairs GROUP BY out_id HAVING COUNT(*) = 1) unique_out)
+  AND p.in_id IN (SELECT in_id FROM (SELECT in_id FROM reversal_leg_pairs GROUP BY in_id HAVING COUNT(*) = 1) unique_in);
+
+DROP TABLE reversal_leg_pairs;
+
+-- Reversals by staff wait for a second employee from this amount
+INSERT IGNORE INTO approval_thresholds (operation, threshold, checker_role) VALUES
+    ('reversal', 1000.00, 'employee');
@@ -0,0 +1,72 @@
+-- Disputes raised by customers against debits on their accounts and charges on their credit
+-- cards. A dispute may be given a provisional credit while it is investigated; the credit is
+-- kept if the dispute is upheld and reversed if it is rejected or withdrawn. A card dispute is
+-- credited to the credit line.
+ALTER TABLE transactions
+    MODIFY COLUMN type ENUM('deposit', 'withdrawal', 'transfer_in', 'transfer_out', 'fee', 'interest', 'fee_income', 'fee_refund', 'interest_paid',
+        'fee_income_refund', 'reversal_credit', 'reversal_debit', 'dispute_credit') NOT NULL;
+
+ALTER TABLE credit_transactions
+    MODIFY COLUMN type ENUM('purchase', 'refund', 'payment', 'interest', 'fee', 'dispute_credit', 'dispute_reversal') NOT NULL;
+
+CREATE TABLE IF NOT EXISTS disputes (
+    dispute_id            BIGINT AUTO_INCREMENT PRIMARY KEY,
+    transaction_id        BIGINT NULL, -- The disputed debit of a deposit account
+    card_transaction_id   INT NULL, -- Or the disputed charge on a credit line, in credit_transactions
+    credit_account_id     INT NULL, -- The credit line of a card dispute
+    account_id            INT NOT NULL, -- The deposit account, or the account the card is issued on
+    reason_code           ENUM('unauthorized', 'duplicate', 'incorrect_amount', 'not_received', 'not_as_described', 'cancelled_recurring') NOT NULL,
+    amount                DECIMAL(15, 2) NOT NULL, -- Up to the amount of the transaction
+    description           VARCHAR(1000) NOT NULL,
+    status                ENUM('open', 'investigating', 'awaiting_customer', 'chargeback', 'upheld', 'rejected', 'withdrawn') NOT NULL DEFAULT 'open',
+    assigned_to           INT NULL, -- employees.employee_id
+    credit_transaction_id BIGINT NULL, -- The dispute credit, provisional until the dispute is upheld; in credit_transactions for a card dispute
+    credit_reversal_id    BIGINT NULL, -- Its reversal when the dispute was rejected or withdrawn
+    chargeback_reference  VARCHAR(64) NULL, -- Reference of the chargeback raised with the merchant's bank
+    resolution_note       VARCHAR(1000) NOT NULL DEFAULT '',
+    filed_by              INT NOT NULL, -- users.user_id
+    created_at            TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at            TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    resolved_at           TIMESTAMP NULL,
+    INDEX idx_disputes_transaction (transaction_id),
+    INDEX idx_disputes_card_transaction (card_transaction_id),
+    INDEX idx_disputes_account (account_id, dispute_id),
+    INDEX idx_disputes_status (status, created_at),
+    FOREIGN KEY (transaction_id) REFERENCES transactions(transaction_id),
+    FOREIGN KEY (card_transaction_id) REFERENCES credit_transactions(credit_transaction_id),
+    FOREIGN KEY (credit_account_id) REFERENCES credit_accounts(credit_account_id),
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id),
+    FOREIGN KEY (assigned_to) REFERENCES employees(employee_id)
+);
+
+CREATE TABLE IF NOT EXISTS dispute_events (
+    event_id      BIGINT AUTO_INCREMENT PRIMARY KEY,
+    dispute_id    BIGINT NOT NULL,
+    from_status   VARCHAR(20) NOT NULL DEFAULT '', -- Empty when the dispute is filed
+    to_status     VARCHAR(20) NOT NULL,
+    actor_user_id INT NOT NULL, -- users.user_id
+    note          VARCHAR(1000) NOT NULL DEFAULT '',
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_dispute_events_dispute (dispute_id, event_id),
+    FOREIGN KEY (dispute_id) REFERENCES disputes(dispute_id)
+);
+
+CREATE TABLE IF NOT EXISTS dispute_evidence (
+    evidence_id  BIGINT AUTO_INCREMENT PRIMARY KEY,
+    dispute_id   BIGINT NOT NULL,
+    description  VARCHAR(255) NOT NULL DEFAULT '',
+    file_name    VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes   BIGINT NOT NULL,
+    sha256       CHAR(64) NOT NULL,
+    storage_key  VARCHAR(255) NOT NULL, -- Key in the document blob store
+    uploaded_by  INT NOT NULL, -- users.user_id
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_dispute_evidence_storage_key (storage_key),
+    INDEX idx_dispute_evidence_dispute (dispute_id, evidence_id),
+    FOREIGN KEY (dispute_id) REFERENCES disputes(dispute_id)
+);
+
+-- Dispute credits granted by staff wait for a second employee from this amount
+INSERT IGNORE INTO approval_thresholds (operation, threshold, checker_role) VALUES
+    ('dispute_credit', 1000.00, 'employee');
@@ -0,0 +1,58 @@
+-- Direct debits. A creditor is an organisation whose account with us receives the money
+-- it collects. Customers authorise a creditor with a mandate on one of their accounts;
+-- the creditor then requests collections under the mandate, which the end-of-day run
+-- takes on their due date.
+ALTER TABLE transactions
+    MODIFY COLUMN type ENUM('deposit', 'withdrawal', 'transfer_in', 'transfer_out', 'fee', 'interest', 'fee_income', 'fee_refund', 'interest_paid',
+        'fee_income_refund', 'reversal_credit', 'reversal_debit', 'dispute_credit', 'direct_debit', 'direct_debit_in') NOT NULL;
+
+CREATE TABLE IF NOT EXISTS direct_debit_creditors (
+    creditor_id         INT AUTO_INCREMENT PRIMARY KEY,
+    name                VARCHAR(100) NOT NULL,
+    creditor_identifier VARCHAR(35) NOT NULL, -- Scheme identifier quoted on the customer's mandate
+    account_id          INT NOT NULL, -- Account the collections are paid into
+    status              ENUM('active', 'suspended') NOT NULL DEFAULT 'active',
+    created_by          INT NOT NULL, -- users.user_id
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_direct_debit_creditors_identifier (creditor_identifier),
+    FOREIGN KEY (account_id) REFERENCES accounts(account_id)
+);
+
+CREATE TABLE IF NOT EXISTS direct_debit_mandates (
+    mandate_id        BIGINT AUTO_INCREMENT PRIMARY KEY,
+    creditor_id       INT NOT NULL,
+    debtor_account_id INT NOT NULL,
+    reference         VARCHAR(35) NOT NULL, -- The creditor's reference for the customer, e.g. a customer number
+    max_amount        DECIMAL(15, 2) NOT NULL, -- Largest single collection allowed
+    frequency         ENUM('once', 'weekly', 'monthly', 'quarterly', 'yearly') NOT NULL,
+    status            ENUM('active', 'revoked') NOT NULL DEFAULT 'active',
+    created_by        INT NOT NULL, -- users.user_id
+    created_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_by        INT NULL, -- users.user_id
+    revoked_at        TIMESTAMP NULL,
+    revocation_reason VARCHAR(255) NULL,
+    UNIQUE KEY uq_direct_debit_mandates_reference (creditor_id, reference),
+    INDEX idx_direct_debit_mandates_debtor (debtor_account_id, status),
+    FOREIGN KEY (creditor_id) REFERENCES direct_debit_creditors(creditor_id),
+    FOREIGN KEY (debtor_account_id) REFERENCES accounts(account_id)
+);
+
+CREATE TABLE IF NOT EXISTS direct_debit_collections (
+    collection_id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+    mandate_id            BIGINT NOT NULL,
+    amount                DECIMAL(15, 2) NOT NULL,
+    due_date              DATE NOT NULL, -- Business date the money is taken on
+    description           VARCHAR(140) NOT NULL DEFAULT '',
+    status                ENUM('pending', 'collected', 'failed', 'cancelled', 'refunded') NOT NULL DEFAULT 'pending',
+    failure_reason        VARCHAR(255) NULL,
+    transaction_id        BIGINT NULL, -- The debit on the debtor's account
+    refund_transaction_id BIGINT NULL, -- Its reversal when refunded
+    requested_by          INT NOT NULL, -- users.user_id
+    created_at            TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at           TIMESTAMP NULL, -- Collected, failed or cancelled
+    refunded_at           TIMESTAMP NULL,
+    INDEX idx_direct_debit_collections_due (status, due_date),
+    INDEX idx_direct_debit_collections_mandate (mandate_id, due_date),
+    FOREIGN KEY (mandate_id) REFERENCES direct_debit_mandates(mandate_id)
+);
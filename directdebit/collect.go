@@ -0,0 +1,153 @@
+package directdebit
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"banking-app/audit"
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+	"banking-app/outbox"
+)
+
+// process is recorded as the request ID of audit entries written by the collection run
+const process = "direct-debit-batch"
+
+// RunDaily takes every pending collection due on or before asOf. Each is processed in
+// its own SQL transaction and only while still pending, so a failed run can simply be
+// repeated. A collection that cannot be taken fails without moving any money.
+func RunDaily(asOf time.Time) error {
+	rows, err := db.DB.Query("SELECT collection_id FROM direct_debit_collections WHERE status = ? AND due_date <= ? ORDER BY due_date, collection_id",
+		StatusPending, asOf.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("listing due direct debits: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning collection ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("listing due direct debits: %w", err)
+	}
+
+	failed := 0
+	for _, id := range ids {
+		if err := collect(id, asOf); err != nil {
+			log.Printf("Error collecting direct debit %d: %v", id, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("collecting direct debits failed for %d of %d", failed, len(ids))
+	}
+	return nil
+}
+
+func collect(id int64, asOf time.Time) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	c, m, err := Lock(tx, id)
+	if err != nil {
+		return err
+	}
+	if c.Status != StatusPending || c.DueDate.After(asOf) {
+		return nil // Cancelled since it was listed
+	}
+	debtor, err := ledger.LockAccount(tx, m.DebtorAccountNumber)
+	if err != nil {
+		return fmt.Errorf("locking debtor account: %w", err)
+	}
+	creditor, err := ledger.LockAccount(tx, m.CreditorAccountNumber)
+	if err != nil {
+		return fmt.Errorf("locking creditor account: %w", err)
+	}
+	var creditorStatus string
+	if err := tx.QueryRow("SELECT status FROM direct_debit_creditors WHERE creditor_id = ?", m.CreditorID).Scan(&creditorStatus); err != nil {
+		return fmt.Errorf("loading creditor %d: %w", m.CreditorID, err)
+	}
+	entityID := strconv.FormatInt(id, 10)
+	payload := map[string]interface{}{
+		"collection_id":           id,
+		"mandate_id":              m.MandateID,
+		"creditor_identifier":     m.CreditorIdentifier,
+		"creditor_account_number": creditor.AccountNumber,
+		"reference":               m.Reference,
+		"account_number":          debtor.AccountNumber,
+		"amount":                  c.Amount,
+		"due_date":                c.DueDate.Format("2006-01-02"),
+	}
+
+	if reason := refusal(m, creditorStatus, debtor, creditor, c.Amount); reason != "" {
+		_, err := tx.Exec("UPDATE direct_debit_collections SET status = ?, failure_reason = ?, finished_at = NOW() WHERE collection_id = ?", StatusFailed, reason, id)
+		if err != nil {
+			return fmt.Errorf("failing collection: %w", err)
+		}
+		err = audit.RecordSystemTx(tx, process, audit.Entry{Action: "direct_debit.fail", EntityType: "direct_debit_collection", EntityID: entityID,
+			Before: map[string]string{"status": StatusPending}, After: map[string]string{"status": StatusFailed, "reason": reason}})
+		if err != nil {
+			return err
+		}
+		payload["reason"] = reason
+		if err := outbox.Enqueue(tx, outbox.EventDirectDebitFailed, debtor.AccountNumber, payload); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	txnID, err := ledger.DirectDebit(tx, debtor, creditor, c.Amount, Description(m))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE direct_debit_collections SET status = ?, transaction_id = ?, finished_at = NOW() WHERE collection_id = ?", StatusCollected, txnID, id)
+	if err != nil {
+		return fmt.Errorf("completing collection: %w", err)
+	}
+	err = audit.RecordSystemTx(tx, process, audit.Entry{Action: "direct_debit.collect", EntityType: "direct_debit_collection", EntityID: entityID,
+		Before: map[string]interface{}{"status": StatusPending, "balance": debtor.Balance, "creditor_balance": creditor.Balance},
+		After: map[string]interface{}{"status": StatusCollected, "balance": debtor.Balance - c.Amount, "creditor_balance": creditor.Balance + c.Amount,
+			"transaction_id": txnID}})
+	if err != nil {
+		return err
+	}
+	payload["transaction_id"] = txnID
+	if err := outbox.Enqueue(tx, outbox.EventDirectDebitCollected, debtor.AccountNumber, payload); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// refusal returns why a collection cannot be taken, or "" if it can
+func refusal(m models.DirectDebitMandate, creditorStatus string, debtor, creditor models.Account, amount float64) string {
+	if m.Status != MandateActive {
+		return "Mandate has been revoked"
+	}
+	if creditorStatus != CreditorActive {
+		return "Creditor is suspended"
+	}
+	if amount > m.MaxAmount {
+		return fmt.Sprintf("Amount exceeds the mandate's maximum of %.2f", m.MaxAmount)
+	}
+	if !ledger.CanDebit(debtor) {
+		return ledger.Refusal(debtor)
+	}
+	if !ledger.CanCredit(creditor) {
+		return ledger.Refusal(creditor)
+	}
+	if ledger.Available(debtor) < amount {
+		return "Insufficient funds in debtor account"
+	}
+	return ""
+}
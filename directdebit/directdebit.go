@@ -0,0 +1,201 @@
+// Package directdebit lets creditors registered with the bank, such as utilities, pull
+// payments from customers' accounts. A customer authorises a creditor with a mandate on
+// one of their accounts, capping each collection and how often one may be taken. The
+// creditor requests each collection ahead of its due date, which notifies the customer,
+// and the end-of-day run takes the money on that date. The customer can cancel a pending
+// collection, revoke the mandate at any time, and have a collection refunded without
+// giving a reason for RefundWindowDays after it was taken.
+package directdebit
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+)
+
+// NoticeDays is how many days before its due date a collection must be requested, so
+// the customer is notified in time to fund the account or cancel it
+const NoticeDays = 2
+
+// RefundWindowDays is how many days after its due date the customer can have a
+// collection refunded unconditionally
+const RefundWindowDays = 56
+
+// Creditor statuses stored in direct_debit_creditors.status
+const (
+	CreditorActive    = "active"
+	CreditorSuspended = "suspended" // May not take new mandates or collect
+)
+
+// Mandate statuses stored in direct_debit_mandates.status
+const (
+	MandateActive  = "active"
+	MandateRevoked = "revoked"
+)
+
+// Frequencies stored in direct_debit_mandates.frequency
+const (
+	FrequencyOnce      = "once" // A single collection
+	FrequencyWeekly    = "weekly"
+	FrequencyMonthly   = "monthly"
+	FrequencyQuarterly = "quarterly"
+	FrequencyYearly    = "yearly"
+)
+
+// IsFrequency reports whether f is a known frequency
+func IsFrequency(f string) bool {
+	switch f {
+	case FrequencyOnce, FrequencyWeekly, FrequencyMonthly, FrequencyQuarterly, FrequencyYearly:
+		return true
+	}
+	return false
+}
+
+// Collection statuses stored in direct_debit_collections.status
+const (
+	StatusPending   = "pending"
+	StatusCollected = "collected"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	StatusRefunded  = "refunded"
+)
+
+// CreditorColumns lists the creditor columns read by ScanCreditor, selected from CreditorTables
+const CreditorColumns = "c.creditor_id, c.name, c.creditor_identifier, a.account_number, c.status, c.created_by, c.created_at, c.updated_at"
+
+// CreditorTables joins a creditor to its account
+const CreditorTables = "direct_debit_creditors c JOIN accounts a ON a.account_id = c.account_id"
+
+// ScanCreditor reads a creditor row selected with CreditorColumns
+func ScanCreditor(row interface{ Scan(...interface{}) error }, c *models.DirectDebitCreditor) error {
+	return row.Scan(&c.CreditorID, &c.Name, &c.CreditorIdentifier, &c.AccountNumber, &c.Status, &c.CreatedBy, &c.CreatedAt, &c.UpdatedAt)
+}
+
+// MandateColumns lists the mandate columns read by ScanMandate, selected from MandateTables
+const MandateColumns = `m.mandate_id, m.creditor_id, c.name, c.creditor_identifier, ca.account_number, da.account_number, m.reference, m.max_amount,
+	m.frequency, m.status, m.created_by, m.created_at, m.revoked_by, m.revoked_at, m.revocation_reason`
+
+// MandateTables joins a mandate to its creditor and both accounts
+const MandateTables = `direct_debit_mandates m
+	JOIN direct_debit_creditors c ON c.creditor_id = m.creditor_id
+	JOIN accounts ca ON ca.account_id = c.account_id
+	JOIN accounts da ON da.account_id = m.debtor_account_id`
+
+// ScanMandate reads a mandate row selected with MandateColumns
+func ScanMandate(row interface{ Scan(...interface{}) error }, m *models.DirectDebitMandate) error {
+	return row.Scan(&m.MandateID, &m.CreditorID, &m.CreditorName, &m.CreditorIdentifier, &m.CreditorAccountNumber, &m.DebtorAccountNumber, &m.Reference,
+		&m.MaxAmount, &m.Frequency, &m.Status, &m.CreatedBy, &m.CreatedAt, &m.RevokedBy, &m.RevokedAt, &m.RevocationReason)
+}
+
+// GetMandate loads a mandate, returning sql.ErrNoRows if it does not exist
+func GetMandate(q db.Querier, mandateID int64) (models.DirectDebitMandate, error) {
+	var m models.DirectDebitMandate
+	err := ScanMandate(q.QueryRow("SELECT "+MandateColumns+" FROM "+MandateTables+" WHERE m.mandate_id = ?", mandateID), &m)
+	return m, err
+}
+
+// LockMandate loads a mandate and locks its row FOR UPDATE inside tx. Collections are
+// locked after their mandate. It returns sql.ErrNoRows if the mandate does not exist.
+func LockMandate(tx *sql.Tx, mandateID int64) (models.DirectDebitMandate, error) {
+	var m models.DirectDebitMandate
+	err := ScanMandate(tx.QueryRow("SELECT "+MandateColumns+" FROM "+MandateTables+" WHERE m.mandate_id = ? FOR UPDATE OF m", mandateID), &m)
+	return m, err
+}
+
+// CollectionColumns lists the collection columns read by ScanCollection
+const CollectionColumns = `collection_id, mandate_id, amount, due_date, description, status, failure_reason, transaction_id, refund_transaction_id,
+	requested_by, created_at, finished_at, refunded_at`
+
+// ScanCollection reads a collection row selected with CollectionColumns
+func ScanCollection(row interface{ Scan(...interface{}) error }, c *models.DirectDebitCollection) error {
+	return row.Scan(&c.CollectionID, &c.MandateID, &c.Amount, &c.DueDate, &c.Description, &c.Status, &c.FailureReason, &c.TransactionID, &c.RefundTransactionID,
+		&c.RequestedBy, &c.CreatedAt, &c.FinishedAt, &c.RefundedAt)
+}
+
+// Lock loads a collection and its mandate, locking the mandate and then the collection
+// FOR UPDATE inside tx. It returns sql.ErrNoRows if the collection does not exist.
+func Lock(tx *sql.Tx, collectionID int64) (models.DirectDebitCollection, models.DirectDebitMandate, error) {
+	var c models.DirectDebitCollection
+	var m models.DirectDebitMandate
+	var mandateID int64
+	if err := tx.QueryRow("SELECT mandate_id FROM direct_debit_collections WHERE collection_id = ?", collectionID).Scan(&mandateID); err != nil {
+		return c, m, err
+	}
+	m, err := LockMandate(tx, mandateID)
+	if err != nil {
+		return c, m, fmt.Errorf("locking mandate %d: %w", mandateID, err)
+	}
+	err = ScanCollection(tx.QueryRow("SELECT "+CollectionColumns+" FROM direct_debit_collections WHERE collection_id = ? FOR UPDATE", collectionID), &c)
+	return c, m, err
+}
+
+// period returns the bounds, both exclusive, of the dates within one period of due
+func period(frequency string, due time.Time) (time.Time, time.Time) {
+	switch frequency {
+	case FrequencyWeekly:
+		return due.AddDate(0, 0, -7), due.AddDate(0, 0, 7)
+	case FrequencyMonthly:
+		return due.AddDate(0, -1, 0), due.AddDate(0, 1, 0)
+	case FrequencyQuarterly:
+		return due.AddDate(0, -3, 0), due.AddDate(0, 3, 0)
+	case FrequencyYearly:
+		return due.AddDate(-1, 0, 0), due.AddDate(1, 0, 0)
+	}
+	// A single collection leaves no room for another
+	return time.Time{}, due.AddDate(1000, 0, 0)
+}
+
+// Conflicting returns the ID of a pending or collected collection of the mandate within
+// one period of due, or 0 if a collection may be taken on that date. Failed, cancelled
+// and refunded collections do not count.
+func Conflicting(q db.Querier, m models.DirectDebitMandate, due time.Time) (int64, error) {
+	from, to := period(m.Frequency, due)
+	var id int64
+	err := q.QueryRow(`SELECT collection_id FROM direct_debit_collections
+		WHERE mandate_id = ? AND status IN (?, ?) AND due_date > ? AND due_date < ? LIMIT 1`,
+		m.MandateID, StatusPending, StatusCollected, from.Format("2006-01-02"), to.Format("2006-01-02")).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("checking collections of mandate %d: %w", m.MandateID, err)
+	}
+	return id, nil
+}
+
+// Description is the text posted on both accounts for a collection under a mandate
+func Description(m models.DirectDebitMandate) string {
+	return fmt.Sprintf("Direct debit %s %s", m.CreditorName, m.Reference)
+}
+
+// Refund gives a collected amount back to the customer by reversing both legs of the
+// collection, even if that overdraws the creditor's account. The caller has locked the
+// collection with Lock and both accounts, and checked the refund is allowed.
+func Refund(tx *sql.Tx, c models.DirectDebitCollection, m models.DirectDebitMandate) (int64, error) {
+	debit, err := ledger.LockEntry(tx, *c.TransactionID)
+	if err != nil {
+		return 0, fmt.Errorf("loading debit of collection %d: %w", c.CollectionID, err)
+	}
+	legs := []ledger.Entry{debit}
+	if debit.LinkedID != nil {
+		credit, err := ledger.LockEntry(tx, *debit.LinkedID)
+		if err != nil {
+			return 0, fmt.Errorf("loading credit of collection %d: %w", c.CollectionID, err)
+		}
+		legs = append(legs, credit)
+	}
+	ids, err := ledger.Reverse(tx, legs, "Refund: "+Description(m))
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("UPDATE direct_debit_collections SET status = ?, refund_transaction_id = ?, refunded_at = NOW() WHERE collection_id = ?",
+		StatusRefunded, ids[0], c.CollectionID)
+	if err != nil {
+		return 0, fmt.Errorf("refunding collection %d: %w", c.CollectionID, err)
+	}
+	return ids[0], nil
+}
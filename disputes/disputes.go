@@ -0,0 +1,216 @@
+// Package disputes tracks customers' disputes of debits on their accounts and charges on
+// their credit cards, from filing through investigation and chargeback to resolution. Staff
+// may credit the disputed amount, to the account or the credit line, while the dispute is
+// open; the credit is provisional until the dispute is upheld, and is reversed if the
+// dispute is rejected or withdrawn.
+package disputes
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"banking-app/blobstore"
+	"banking-app/credit"
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+)
+
+// Evidence holds the uploaded evidence files; main replaces it with the configured store
+var Evidence blobstore.Store
+
+// FilingWindowDays is how many days after its booking date a transaction can be disputed
+const FilingWindowDays = 120
+
+// Reason codes stored in disputes.reason_code
+const (
+	ReasonUnauthorized       = "unauthorized" // The customer did not make or allow the payment
+	ReasonDuplicate          = "duplicate"    // Charged more than once for the same purchase
+	ReasonIncorrectAmount    = "incorrect_amount"
+	ReasonNotReceived        = "not_received" // Goods or services paid for never arrived
+	ReasonNotAsDescribed     = "not_as_described"
+	ReasonCancelledRecurring = "cancelled_recurring" // Charged after cancelling a subscription
+)
+
+// IsReason reports whether code is a known reason code
+func IsReason(code string) bool {
+	switch code {
+	case ReasonUnauthorized, ReasonDuplicate, ReasonIncorrectAmount, ReasonNotReceived, ReasonNotAsDescribed, ReasonCancelledRecurring:
+		return true
+	}
+	return false
+}
+
+// Statuses stored in disputes.status
+const (
+	StatusOpen             = "open"
+	StatusInvestigating    = "investigating"
+	StatusAwaitingCustomer = "awaiting_customer" // More information was asked of the customer
+	StatusChargeback       = "chargeback"        // A chargeback was raised with the merchant's bank
+	StatusUpheld           = "upheld"            // Decided for the customer; the credit is final
+	StatusRejected         = "rejected"          // Decided against the customer; the credit is reversed
+	StatusWithdrawn        = "withdrawn"         // Dropped by the customer; the credit is reversed
+)
+
+// CanTransition reports whether a dispute may move from one status to another.
+// Upheld, rejected and withdrawn disputes are final.
+func CanTransition(from, to string) bool {
+	switch from {
+	case StatusOpen:
+		return to == StatusInvestigating || to == StatusWithdrawn
+	case StatusInvestigating:
+		return to == StatusAwaitingCustomer || to == StatusChargeback || to == StatusUpheld || to == StatusRejected || to == StatusWithdrawn
+	case StatusAwaitingCustomer:
+		return to == StatusInvestigating || to == StatusRejected || to == StatusWithdrawn
+	case StatusChargeback:
+		return to == StatusUpheld || to == StatusRejected || to == StatusWithdrawn
+	}
+	return false
+}
+
+// IsFinal reports whether a dispute in the given status is resolved
+func IsFinal(status string) bool {
+	return status == StatusUpheld || status == StatusRejected || status == StatusWithdrawn
+}
+
+// Disputable reports whether a transaction of the given type can be disputed: money taken
+// from the account by a withdrawal, card payment, transfer, direct debit, fee or interest charge
+func Disputable(txnType string) bool {
+	switch txnType {
+	case ledger.TypeWithdrawal, ledger.TypeTransferOut, ledger.TypeDirectDebit, ledger.TypeFee, ledger.TypeInterest:
+		return true
+	}
+	return false
+}
+
+// CardDisputable reports whether a credit card transaction of the given type can be
+// disputed: a purchase, or a fee or interest charged to the credit line
+func CardDisputable(txnType string) bool {
+	switch txnType {
+	case credit.TypePurchase, credit.TypeFee, credit.TypeInterest:
+		return true
+	}
+	return false
+}
+
+// Columns lists the dispute columns read by Scan, selected from Tables
+const Columns = `d.dispute_id, d.transaction_id, d.card_transaction_id, d.credit_account_id, d.account_id, a.account_number, d.reason_code, d.amount, d.description, d.status, d.assigned_to,
+	d.credit_transaction_id, d.credit_reversal_id, d.chargeback_reference, d.resolution_note, d.filed_by, d.created_at, d.updated_at, d.resolved_at`
+
+// Tables joins a dispute to its account
+const Tables = "disputes d JOIN accounts a ON a.account_id = d.account_id"
+
+// Scan reads a dispute row selected with Columns
+func Scan(row interface{ Scan(...interface{}) error }, d *models.Dispute) error {
+	return row.Scan(&d.DisputeID, &d.TransactionID, &d.CardTransactionID, &d.CreditAccountID, &d.AccountID, &d.AccountNumber, &d.ReasonCode, &d.Amount, &d.Description, &d.Status, &d.AssignedTo,
+		&d.CreditTransactionID, &d.CreditReversalID, &d.ChargebackReference, &d.ResolutionNote, &d.FiledBy, &d.CreatedAt, &d.UpdatedAt, &d.ResolvedAt)
+}
+
+// Lock loads a dispute and locks its row FOR UPDATE inside tx.
+// It returns sql.ErrNoRows if the dispute does not exist.
+func Lock(tx *sql.Tx, disputeID int64) (models.Dispute, error) {
+	var d models.Dispute
+	err := Scan(tx.QueryRow("SELECT "+Columns+" FROM "+Tables+" WHERE d.dispute_id = ? FOR UPDATE OF d", disputeID), &d)
+	return d, err
+}
+
+// Unresolved returns the ID of the unresolved dispute of a transaction, or 0 if it has none
+func Unresolved(q db.Querier, transactionID int64) (int64, error) {
+	return unresolved(q, "transaction_id", transactionID)
+}
+
+// UnresolvedCard returns the ID of the unresolved dispute of a credit card transaction, or 0 if it has none
+func UnresolvedCard(q db.Querier, cardTransactionID int64) (int64, error) {
+	return unresolved(q, "card_transaction_id", cardTransactionID)
+}
+
+func unresolved(q db.Querier, column string, transactionID int64) (int64, error) {
+	var id int64
+	err := q.QueryRow("SELECT dispute_id FROM disputes WHERE "+column+" = ? AND status NOT IN (?, ?, ?) LIMIT 1",
+		transactionID, StatusUpheld, StatusRejected, StatusWithdrawn).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("checking disputes of transaction %d: %w", transactionID, err)
+	}
+	return id, nil
+}
+
+// AddEvent records a step in the history of a dispute
+func AddEvent(tx *sql.Tx, disputeID int64, from, to string, actorUserID int, note string) error {
+	_, err := tx.Exec("INSERT INTO dispute_events (dispute_id, from_status, to_status, actor_user_id, note) VALUES (?, ?, ?, ?, ?)",
+		disputeID, from, to, actorUserID, note)
+	if err != nil {
+		return fmt.Errorf("recording event of dispute %d: %w", disputeID, err)
+	}
+	return nil
+}
+
+// Credit posts the disputed amount to the account, or to the credit line of a card dispute,
+// and records it on the dispute. The caller has locked the dispute, the account and the credit
+// line, and checked the account can be credited.
+func Credit(tx *sql.Tx, d models.Dispute) (int64, error) {
+	if d.CreditAccountID != nil {
+		id, err := credit.PostEntry(tx, *d.CreditAccountID, credit.TypeDisputeCredit, d.Amount, fmt.Sprintf("Dispute %d credit", d.DisputeID))
+		if err != nil {
+			return 0, err
+		}
+		return id, setCredit(tx, d, id)
+	}
+	if _, err := tx.Exec("UPDATE accounts SET balance = balance + ? WHERE account_id = ?", d.Amount, d.AccountID); err != nil {
+		return 0, fmt.Errorf("crediting account %d for dispute %d: %w", d.AccountID, d.DisputeID, err)
+	}
+	id, err := ledger.Post(tx, d.AccountID, ledger.TypeDisputeCredit, d.Amount, fmt.Sprintf("Dispute %d credit", d.DisputeID))
+	if err != nil {
+		return 0, err
+	}
+	return id, setCredit(tx, d, id)
+}
+
+func setCredit(tx *sql.Tx, d models.Dispute, id int64) error {
+	if _, err := tx.Exec("UPDATE disputes SET credit_transaction_id = ? WHERE dispute_id = ?", id, d.DisputeID); err != nil {
+		return fmt.Errorf("recording credit of dispute %d: %w", d.DisputeID, err)
+	}
+	return nil
+}
+
+// ReverseCredit takes back the credit of a dispute rejected or withdrawn (status), even if
+// that overdraws the account or takes the credit line over its limit: the customer was told
+// the credit was provisional. The caller has locked the dispute, its account and credit line.
+func ReverseCredit(tx *sql.Tx, d models.Dispute, status string) (int64, error) {
+	if d.CreditAccountID != nil {
+		id, err := credit.PostEntry(tx, *d.CreditAccountID, credit.TypeDisputeReversal, d.Amount, fmt.Sprintf("Dispute %d %s", d.DisputeID, status))
+		if err != nil {
+			return 0, err
+		}
+		return id, setReversal(tx, d, id)
+	}
+	entry, err := ledger.LockEntry(tx, *d.CreditTransactionID)
+	if err != nil {
+		return 0, fmt.Errorf("loading credit of dispute %d: %w", d.DisputeID, err)
+	}
+	ids, err := ledger.Reverse(tx, []ledger.Entry{entry}, fmt.Sprintf("Dispute %d %s", d.DisputeID, status))
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], setReversal(tx, d, ids[0])
+}
+
+func setReversal(tx *sql.Tx, d models.Dispute, id int64) error {
+	if _, err := tx.Exec("UPDATE disputes SET credit_reversal_id = ? WHERE dispute_id = ?", id, d.DisputeID); err != nil {
+		return fmt.Errorf("recording reversal of the credit of dispute %d: %w", d.DisputeID, err)
+	}
+	return nil
+}
+
+// NewStorageKey returns a fresh, unguessable key for a dispute's evidence file
+func NewStorageKey(disputeID int64) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating evidence key: %w", err)
+	}
+	return fmt.Sprintf("disputes/%d/%s", disputeID, hex.EncodeToString(b)), nil
+}
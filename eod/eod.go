@@ -0,0 +1,270 @@
+// Package eod runs the end-of-day cycle that closes a business date. The business date is
+// kept separately from the wall clock and moves to the next day only once every step of
+// the cycle has completed for it. Steps run in order; a failed step stops the run, and
+// starting again resumes from the first step not yet completed. Each step must be
+// idempotent for a date, as a step that failed part way is run again in full.
+package eod
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"banking-app/aml"
+	"banking-app/audit"
+	"banking-app/calendar"
+	"banking-app/credit"
+	"banking-app/db"
+	"banking-app/directdebit"
+	"banking-app/fees"
+	"banking-app/ledger"
+	"banking-app/overdraft"
+	"banking-app/scheduled"
+	"banking-app/termdeposit"
+)
+
+// Run statuses stored in eod_runs.status
+const (
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunFailed    = "failed"
+)
+
+// Step statuses stored in eod_run_steps.status
+const (
+	StepPending   = "pending"
+	StepRunning   = "running"
+	StepCompleted = "completed"
+	StepFailed    = "failed"
+)
+
+// Step is one stage of the end-of-day cycle
+type Step struct {
+	Name string
+	Run  func(asOf time.Time) error
+}
+
+// Steps are run in this order. Postings come first so the AML scan sees the whole day.
+// Scheduled transfers run after the day's interest so they count from the next business
+// date, their earliest value date.
+var Steps = []Step{
+	{Name: "overdraft", Run: overdraft.RunDaily},
+	{Name: "credit", Run: credit.RunDaily},
+	{Name: "term_deposits", Run: termdeposit.RunDaily},
+	{Name: "direct_debits", Run: directdebit.RunDaily},
+	{Name: "fees", Run: fees.RunMonthly},
+	{Name: "scheduled_transfers", Run: func(asOf time.Time) error {
+		next, err := NextBusinessDate(db.DB, asOf)
+		if err != nil {
+			return err
+		}
+		return scheduled.Execute(next)
+	}},
+	{Name: "aml_scan", Run: func(asOf time.Time) error {
+		_, err := aml.Scan(asOf)
+		return err
+	}},
+}
+
+// ErrRunning is returned when another end-of-day run holds the lock
+var ErrRunning = errors.New("an end-of-day run is already in progress")
+
+// lockName is the MySQL named lock held for the duration of a run. It is tied to the
+// connection, so a crashed run releases it.
+const lockName = "banking-app.eod"
+
+// process is recorded as the request ID of audit entries written by the cycle
+const process = "eod"
+
+// BusinessDate returns the current business date
+func BusinessDate(q db.Querier) (time.Time, error) {
+	var d time.Time
+	if err := q.QueryRow("SELECT business_date FROM business_date WHERE id = 1").Scan(&d); err != nil {
+		return d, fmt.Errorf("loading business date: %w", err)
+	}
+	return ledger.DateOnly(d), nil
+}
+
+// NextBusinessDate returns the business date that follows d: the next business day in
+// the payment calendar, skipping weekends and bank holidays
+func NextBusinessDate(q db.Querier, d time.Time) (time.Time, error) {
+	return calendar.NextBusinessDay(q, calendar.Country, d)
+}
+
+// Job is an end-of-day run that holds the run lock
+type Job struct {
+	conn  *sql.Conn
+	RunID int
+	Date  time.Time
+}
+
+// Begin takes the run lock and prepares the run of the current business date, creating
+// it or resetting its failed steps so they run again. startedBy is nil for the command line.
+// The caller must call Run, which releases the lock.
+func Begin(startedBy *int) (*Job, error) {
+	ctx := context.Background()
+	conn, err := db.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", lockName).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("taking end-of-day lock: %w", err)
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, ErrRunning
+	}
+
+	j := &Job{conn: conn}
+	if err := j.prepare(startedBy); err != nil {
+		j.release()
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Job) prepare(startedBy *int) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	if j.Date, err = BusinessDate(tx); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO eod_runs (business_date, status, started_by) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE status = VALUES(status), started_by = VALUES(started_by), started_at = NOW(), finished_at = NULL`,
+		j.Date, RunRunning, startedBy)
+	if err != nil {
+		return fmt.Errorf("starting end-of-day run for %s: %w", j.Date.Format("2006-01-02"), err)
+	}
+	if err := tx.QueryRow("SELECT run_id FROM eod_runs WHERE business_date = ?", j.Date).Scan(&j.RunID); err != nil {
+		return fmt.Errorf("loading end-of-day run for %s: %w", j.Date.Format("2006-01-02"), err)
+	}
+
+	for i, s := range Steps {
+		if _, err := tx.Exec("INSERT IGNORE INTO eod_run_steps (run_id, step, position) VALUES (?, ?, ?)", j.RunID, s.Name, i+1); err != nil {
+			return fmt.Errorf("adding step %s to end-of-day run %d: %w", s.Name, j.RunID, err)
+		}
+	}
+	// Nothing else can be running while we hold the lock, so a running step was interrupted
+	_, err = tx.Exec("UPDATE eod_run_steps SET status = ? WHERE run_id = ? AND status IN (?, ?)", StepPending, j.RunID, StepFailed, StepRunning)
+	if err != nil {
+		return fmt.Errorf("resetting failed steps of end-of-day run %d: %w", j.RunID, err)
+	}
+
+	err = audit.RecordSystemTx(tx, process, audit.Entry{Action: "eod.start", EntityType: "eod_run", EntityID: j.Date.Format("2006-01-02"),
+		After: map[string]interface{}{"run_id": j.RunID, "started_by": startedBy}})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (j *Job) release() {
+	if _, err := j.conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName); err != nil {
+		log.Printf("Error releasing end-of-day lock: %v", err)
+	}
+	j.conn.Close()
+}
+
+// Run executes the steps not yet completed, in order, stopping at the first failure.
+// When all have completed the run is closed and the business date moves on.
+func (j *Job) Run() error {
+	defer j.release()
+
+	done, err := j.completedSteps()
+	if err != nil {
+		return j.finish(err)
+	}
+	for _, s := range Steps {
+		if done[s.Name] {
+			continue
+		}
+		if err := j.runStep(s); err != nil {
+			return j.finish(fmt.Errorf("step %s: %w", s.Name, err))
+		}
+	}
+	return j.finish(nil)
+}
+
+func (j *Job) completedSteps() (map[string]bool, error) {
+	rows, err := db.DB.Query("SELECT step FROM eod_run_steps WHERE run_id = ? AND status = ?", j.RunID, StepCompleted)
+	if err != nil {
+		return nil, fmt.Errorf("loading steps of end-of-day run %d: %w", j.RunID, err)
+	}
+	defer rows.Close()
+
+	done := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		done[name] = true
+	}
+	return done, rows.Err()
+}
+
+func (j *Job) runStep(s Step) error {
+	_, err := db.DB.Exec("UPDATE eod_run_steps SET status = ?, attempts = attempts + 1, started_at = NOW(), finished_at = NULL WHERE run_id = ? AND step = ?",
+		StepRunning, j.RunID, s.Name)
+	if err != nil {
+		return fmt.Errorf("marking step running: %w", err)
+	}
+
+	stepErr := s.Run(j.Date)
+	status, message := StepCompleted, sql.NullString{}
+	if stepErr != nil {
+		status, message = StepFailed, sql.NullString{String: stepErr.Error(), Valid: true}
+	}
+	_, err = db.DB.Exec("UPDATE eod_run_steps SET status = ?, finished_at = NOW(), error = ? WHERE run_id = ? AND step = ?",
+		status, message, j.RunID, s.Name)
+	if stepErr != nil {
+		return stepErr
+	}
+	if err != nil {
+		return fmt.Errorf("marking step completed: %w", err)
+	}
+	return nil
+}
+
+// finish records the outcome of the run and, if it succeeded, advances the business date
+func (j *Job) finish(runErr error) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return errors.Join(runErr, err)
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	status, after := RunCompleted, map[string]interface{}{"run_id": j.RunID}
+	if runErr != nil {
+		status, after["error"] = RunFailed, runErr.Error()
+	}
+	if _, err := tx.Exec("UPDATE eod_runs SET status = ?, finished_at = NOW() WHERE run_id = ?", status, j.RunID); err != nil {
+		return errors.Join(runErr, fmt.Errorf("closing end-of-day run %d: %w", j.RunID, err))
+	}
+	if runErr == nil {
+		next, err := NextBusinessDate(tx, j.Date)
+		if err != nil {
+			return errors.Join(runErr, err)
+		}
+		if _, err := tx.Exec("UPDATE business_date SET business_date = ? WHERE id = 1 AND business_date = ?", next, j.Date); err != nil {
+			return errors.Join(runErr, fmt.Errorf("advancing business date: %w", err))
+		}
+		after["next_business_date"] = next.Format("2006-01-02")
+	}
+	if err := audit.RecordSystemTx(tx, process, audit.Entry{Action: "eod." + status, EntityType: "eod_run", EntityID: j.Date.Format("2006-01-02"), After: after}); err != nil {
+		return errors.Join(runErr, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Join(runErr, err)
+	}
+	return runErr
+}
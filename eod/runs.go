@@ -0,0 +1,57 @@
+package eod
+
+import (
+	"fmt"
+	"time"
+
+	"banking-app/db"
+	"banking-app/models"
+)
+
+const runColumns = "run_id, business_date, status, started_by, started_at, finished_at"
+
+// GetRun returns the run of a business date with its steps, or sql.ErrNoRows if there is none
+func GetRun(date time.Time) (models.EODRun, error) {
+	var r models.EODRun
+	err := db.DB.QueryRow("SELECT "+runColumns+" FROM eod_runs WHERE business_date = ?", date).Scan(
+		&r.RunID, &r.BusinessDate, &r.Status, &r.StartedBy, &r.StartedAt, &r.FinishedAt)
+	if err != nil {
+		return r, err
+	}
+
+	rows, err := db.DB.Query(`SELECT step, position, status, attempts, started_at, finished_at, error
+		FROM eod_run_steps WHERE run_id = ? ORDER BY position`, r.RunID)
+	if err != nil {
+		return r, fmt.Errorf("loading steps of end-of-day run %d: %w", r.RunID, err)
+	}
+	defer rows.Close()
+
+	r.Steps = []models.EODRunStep{}
+	for rows.Next() {
+		var s models.EODRunStep
+		if err := rows.Scan(&s.Step, &s.Position, &s.Status, &s.Attempts, &s.StartedAt, &s.FinishedAt, &s.Error); err != nil {
+			return r, fmt.Errorf("scanning step of end-of-day run %d: %w", r.RunID, err)
+		}
+		r.Steps = append(r.Steps, s)
+	}
+	return r, rows.Err()
+}
+
+// ListRuns returns the most recent runs, newest first, without their steps
+func ListRuns(limit int) ([]models.EODRun, error) {
+	rows, err := db.DB.Query("SELECT "+runColumns+" FROM eod_runs ORDER BY business_date DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, fmt.Errorf("listing end-of-day runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []models.EODRun{}
+	for rows.Next() {
+		var r models.EODRun
+		if err := rows.Scan(&r.RunID, &r.BusinessDate, &r.Status, &r.StartedBy, &r.StartedAt, &r.FinishedAt); err != nil {
+			return nil, fmt.Errorf("scanning end-of-day run: %w", err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
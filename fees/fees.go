@@ -0,0 +1,220 @@
+// Package fees charges account fees according to schedules by account type and fee
+// type. Movement fees are evaluated as withdrawals, transfers and card purchases are
+// posted; monthly maintenance is charged by the monthly run. Every charge is a pair of
+// ledger rows, a debit on the account and a credit on the fee income account, and a
+// waiver on the account stops the charge. Fees may take an account overdrawn.
+package fees
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+)
+
+// Fee types stored in fee_schedules.fee_type
+const (
+	TypeMaintenance = "monthly_maintenance"
+	TypeWithdrawal  = "withdrawal"
+	TypeInterBranch = "inter_branch_transfer"
+	TypeFX          = "fx" // Card purchases in a foreign currency
+)
+
+// IsType reports whether s is a known fee type
+func IsType(s string) bool {
+	return s == TypeMaintenance || s == TypeWithdrawal || s == TypeInterBranch || s == TypeFX
+}
+
+// Charge statuses stored in fee_charges.status
+const (
+	StatusCharged  = "charged"
+	StatusRefunded = "refunded"
+)
+
+// descriptions label the fee rows in the transaction history
+var descriptions = map[string]string{
+	TypeMaintenance: "Monthly maintenance fee",
+	TypeWithdrawal:  "Withdrawal fee",
+	TypeInterBranch: "Inter-branch transfer fee",
+	TypeFX:          "Foreign currency transaction fee",
+}
+
+// ErrNoIncomeAccount is returned when a fee is due but no fee income account is set
+var ErrNoIncomeAccount = errors.New("no fee income account is set")
+
+// IncomeAccountID returns the account fee income is credited to, or nil if none is set
+func IncomeAccountID(q db.Querier) (*int, error) {
+	var id *int
+	if err := q.QueryRow("SELECT income_account_id FROM fee_settings WHERE settings_id = 1").Scan(&id); err != nil {
+		return nil, fmt.Errorf("loading fee settings: %w", err)
+	}
+	return id, nil
+}
+
+// ScheduleColumns lists the fee schedule columns read by ScanSchedule
+const ScheduleColumns = "account_type, fee_type, amount, rate, free_per_month, active, updated_at"
+
+// ScanSchedule reads a fee schedule row selected with ScheduleColumns
+func ScanSchedule(row interface{ Scan(...interface{}) error }, s *models.FeeSchedule) error {
+	return row.Scan(&s.AccountType, &s.FeeType, &s.Amount, &s.Rate, &s.FreePerMonth, &s.Active, &s.UpdatedAt)
+}
+
+// GetSchedule returns the schedule of a fee for an account type, or nil if there is none
+func GetSchedule(q db.Querier, accountType, feeType string) (*models.FeeSchedule, error) {
+	var s models.FeeSchedule
+	err := ScanSchedule(q.QueryRow("SELECT "+ScheduleColumns+" FROM fee_schedules WHERE account_type = ? AND fee_type = ?", accountType, feeType), &s)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading %s fee schedule for %s accounts: %w", feeType, accountType, err)
+	}
+	return &s, nil
+}
+
+// Waived reports whether a waiver on the account covers a fee on the given day
+func Waived(q db.Querier, accountID int, feeType string, on time.Time) (bool, error) {
+	var waived bool
+	err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM fee_waivers WHERE account_id = ? AND (fee_type IS NULL OR fee_type = ?)
+		AND revoked_at IS NULL AND (valid_until IS NULL OR valid_until >= ?))`, accountID, feeType, on.Format("2006-01-02")).Scan(&waived)
+	if err != nil {
+		return false, fmt.Errorf("checking fee waivers of account %d: %w", accountID, err)
+	}
+	return waived, nil
+}
+
+// Apply charges the fee a movement of amount incurs on an account locked by the caller
+// and returns what was charged, 0 if nothing. The movement counts against the free
+// allowance of the business date's month even when the fee is waived. reference identifies the movement so the
+// fee can be refunded with it, or is "" if it cannot be.
+func Apply(tx *sql.Tx, accountID int, feeType string, amount float64, reference string) (float64, error) {
+	var accountType string
+	if err := tx.QueryRow("SELECT account_type FROM accounts WHERE account_id = ?", accountID).Scan(&accountType); err != nil {
+		return 0, fmt.Errorf("loading account %d for fees: %w", accountID, err)
+	}
+	s, err := GetSchedule(tx, accountType, feeType)
+	if err != nil || s == nil || !s.Active {
+		return 0, err
+	}
+	var today time.Time
+	if err := tx.QueryRow("SELECT business_date FROM business_date WHERE id = 1").Scan(&today); err != nil {
+		return 0, fmt.Errorf("loading business date for fees: %w", err)
+	}
+	today = ledger.DateOnly(today)
+	month := today.AddDate(0, 0, 1-today.Day())
+
+	_, err = tx.Exec(`INSERT INTO fee_usage (account_id, fee_type, month, movements) VALUES (?, ?, ?, 1)
+		ON DUPLICATE KEY UPDATE movements = movements + 1`, accountID, feeType, month)
+	if err != nil {
+		return 0, fmt.Errorf("counting %s fee usage of account %d: %w", feeType, accountID, err)
+	}
+	var movements int
+	err = tx.QueryRow("SELECT movements FROM fee_usage WHERE account_id = ? AND fee_type = ? AND month = ?",
+		accountID, feeType, month).Scan(&movements)
+	if err != nil {
+		return 0, fmt.Errorf("loading %s fee usage of account %d: %w", feeType, accountID, err)
+	}
+	if movements <= s.FreePerMonth {
+		return 0, nil
+	}
+	return charge(tx, accountID, feeType, ledger.Round(s.Amount+amount*s.Rate/100), reference, today)
+}
+
+// ForTransfer charges the fees a transfer incurs on its locked source account
+func ForTransfer(tx *sql.Tx, from, to models.Account, amount float64) (float64, error) {
+	if from.BranchID == to.BranchID {
+		return 0, nil
+	}
+	return Apply(tx, from.AccountID, TypeInterBranch, amount, "")
+}
+
+// charge posts a fee unless it is waived on the given day. The fee income account itself
+// pays no fees.
+func charge(tx *sql.Tx, accountID int, feeType string, fee float64, reference string, on time.Time) (float64, error) {
+	if fee <= 0 {
+		return 0, nil
+	}
+	waived, err := Waived(tx, accountID, feeType, on)
+	if err != nil || waived {
+		return 0, err
+	}
+	incomeID, err := IncomeAccountID(tx)
+	if err != nil {
+		return 0, err
+	}
+	if incomeID == nil {
+		return 0, ErrNoIncomeAccount
+	}
+	if *incomeID == accountID {
+		return 0, nil
+	}
+
+	txnID, err := ledger.Fee(tx, accountID, *incomeID, fee, descriptions[feeType])
+	if err != nil {
+		return 0, err
+	}
+	var ref *string
+	if reference != "" {
+		ref = &reference
+	}
+	_, err = tx.Exec("INSERT INTO fee_charges (account_id, fee_type, amount, transaction_id, reference) VALUES (?, ?, ?, ?, ?)",
+		accountID, feeType, fee, txnID, ref)
+	if err != nil {
+		return 0, fmt.Errorf("recording %s fee on account %d: %w", feeType, accountID, err)
+	}
+	return fee, nil
+}
+
+// Refund gives back the fees charged for a movement, identified by the reference it was
+// charged with, on an account locked by the caller. It returns the amount refunded.
+func Refund(tx *sql.Tx, accountID int, reference string) (float64, error) {
+	rows, err := tx.Query("SELECT charge_id, fee_type, amount FROM fee_charges WHERE account_id = ? AND reference = ? AND status = ? FOR UPDATE",
+		accountID, reference, StatusCharged)
+	if err != nil {
+		return 0, fmt.Errorf("loading fees of %s: %w", reference, err)
+	}
+	type due struct {
+		id      int64
+		feeType string
+		amount  float64
+	}
+	var charges []due
+	for rows.Next() {
+		var c due
+		if err := rows.Scan(&c.id, &c.feeType, &c.amount); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scanning fee of %s: %w", reference, err)
+		}
+		charges = append(charges, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("loading fees of %s: %w", reference, err)
+	}
+	if len(charges) == 0 {
+		return 0, nil
+	}
+
+	incomeID, err := IncomeAccountID(tx)
+	if err != nil {
+		return 0, err
+	}
+	if incomeID == nil {
+		return 0, ErrNoIncomeAccount
+	}
+	refunded := 0.0
+	for _, c := range charges {
+		if err := ledger.RefundFee(tx, accountID, *incomeID, c.amount, descriptions[c.feeType]+" refund"); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec("UPDATE fee_charges SET status = ?, refunded_at = NOW() WHERE charge_id = ?", StatusRefunded, c.id); err != nil {
+			return 0, fmt.Errorf("refunding fee %d: %w", c.id, err)
+		}
+		refunded += c.amount
+	}
+	return ledger.Round(refunded), nil
+}
@@ -0,0 +1,97 @@
+package fees
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"banking-app/audit"
+	"banking-app/db"
+	"banking-app/ledger"
+)
+
+// process is recorded as the request ID of audit entries written by the monthly run
+const process = "fee-batch"
+
+// RunMonthly charges the monthly maintenance fee for the month ending on asOf; on any
+// other day it does nothing. Accounts opened by then and not closed are charged once per
+// month, each in its own SQL transaction, so a failed run can simply be repeated.
+func RunMonthly(asOf time.Time) error {
+	if asOf.AddDate(0, 0, 1).Day() != 1 {
+		return nil
+	}
+	period := asOf.Format("2006-01")
+
+	rows, err := db.DB.Query(`SELECT a.account_id FROM accounts a
+		JOIN fee_schedules s ON s.account_type = a.account_type AND s.fee_type = ? AND s.active
+		WHERE a.status NOT IN ('pending', 'closed') AND a.opened_date <= ?
+		AND NOT EXISTS (SELECT 1 FROM fee_charges c WHERE c.account_id = a.account_id AND c.fee_type = ? AND c.reference = ?)
+		ORDER BY a.account_id`, TypeMaintenance, asOf.Format("2006-01-02"), TypeMaintenance, period)
+	if err != nil {
+		return fmt.Errorf("listing accounts for maintenance fees: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning account ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("listing accounts for maintenance fees: %w", err)
+	}
+
+	failed := 0
+	for _, id := range ids {
+		if err := chargeMaintenance(id, asOf); err != nil {
+			log.Printf("Error charging maintenance fee to account %d: %v", id, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("maintenance fees failed for %d of %d accounts", failed, len(ids))
+	}
+	return nil
+}
+
+func chargeMaintenance(accountID int, asOf time.Time) error {
+	period := asOf.Format("2006-01")
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var accountType string
+	var balance float64
+	err = tx.QueryRow("SELECT account_type, balance FROM accounts WHERE account_id = ? FOR UPDATE", accountID).Scan(&accountType, &balance)
+	if err != nil {
+		return err
+	}
+	var charged bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM fee_charges WHERE account_id = ? AND fee_type = ? AND reference = ?)", accountID, TypeMaintenance, period).Scan(&charged)
+	if err != nil || charged {
+		return err
+	}
+	s, err := GetSchedule(tx, accountType, TypeMaintenance)
+	if err != nil || s == nil || !s.Active {
+		return err
+	}
+
+	fee, err := charge(tx, accountID, TypeMaintenance, s.Amount, period, asOf)
+	if err != nil {
+		return err
+	}
+	if fee > 0 {
+		err = audit.RecordSystemTx(tx, process, audit.Entry{Action: "account.maintenance_fee", EntityType: "account", EntityID: strconv.Itoa(accountID),
+			Before: map[string]float64{"balance": balance}, After: map[string]interface{}{"balance": ledger.Round(balance - fee), "fee": fee, "period": period}})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,138 @@
+// Package fraud screens money movement before it is committed. An Engine runs a set
+// of pluggable rules; each returns allow, review or deny with a risk score, and the
+// combined result decides whether the movement goes ahead, waits for an employee or
+// is refused. Every result is stored in fraud_decisions so rules can be tuned.
+package fraud
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"banking-app/models"
+)
+
+// Decisions, in increasing order of severity
+const (
+	Allow  = "allow"
+	Review = "review"
+	Deny   = "deny"
+)
+
+// Kinds of money movement that are screened
+const (
+	KindWithdrawal = "withdrawal"
+	KindTransfer   = "transfer"
+)
+
+// Event is a money movement about to be committed
+type Event struct {
+	Kind    string
+	Account models.Account  // Account the money leaves
+	To      *models.Account // Destination of a transfer, nil for withdrawals
+	Amount  float64
+	At      time.Time
+}
+
+// Outcome is the verdict of one rule
+type Outcome struct {
+	Rule     string `json:"rule"`
+	Decision string `json:"decision"`
+	Score    int    `json:"score"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Rule evaluates an event. Rules run inside the caller's SQL transaction, after the
+// accounts involved have been locked, and may query the transaction history.
+type Rule interface {
+	Name() string
+	Evaluate(tx *sql.Tx, e Event) (Outcome, error)
+}
+
+// Result is the combined verdict of all rules
+type Result struct {
+	Decision string
+	Score    int
+	Outcomes []Outcome
+}
+
+// Engine runs rules and combines their outcomes. The decision is the most severe
+// rule decision, escalated when the summed score reaches ReviewScore or DenyScore.
+type Engine struct {
+	Rules       []Rule
+	ReviewScore int
+	DenyScore   int
+}
+
+// NewEngine returns an engine with the built-in rules and default thresholds
+func NewEngine() *Engine {
+	return &Engine{
+		Rules: []Rule{
+			Velocity{Window: time.Hour, MaxCount: 10},
+			AmountAnomaly{Lookback: 90 * 24 * time.Hour, MinHistory: 5, Factor: 3},
+			NewDestination{Threshold: 1000},
+			NightWithdrawal{FromHour: 0, ToHour: 5, Threshold: 1000},
+		},
+		ReviewScore: 60,
+		DenyScore:   100,
+	}
+}
+
+// Default is the engine used by the money-movement handlers
+var Default = NewEngine()
+
+// Add registers another rule
+func (en *Engine) Add(r Rule) {
+	en.Rules = append(en.Rules, r)
+}
+
+// Screen evaluates every rule against the event
+func (en *Engine) Screen(tx *sql.Tx, e Event) (Result, error) {
+	res := Result{Decision: Allow}
+	for _, rule := range en.Rules {
+		o, err := rule.Evaluate(tx, e)
+		if err != nil {
+			return res, fmt.Errorf("fraud rule %s: %w", rule.Name(), err)
+		}
+		o.Rule = rule.Name()
+		if o.Decision == "" {
+			o.Decision = Allow
+		}
+		res.Outcomes = append(res.Outcomes, o)
+		res.Score += o.Score
+		res.Decision = worst(res.Decision, o.Decision)
+	}
+	if en.DenyScore > 0 && res.Score >= en.DenyScore {
+		res.Decision = Deny
+	} else if en.ReviewScore > 0 && res.Score >= en.ReviewScore {
+		res.Decision = worst(res.Decision, Review)
+	}
+	return res, nil
+}
+
+func worst(a, b string) string {
+	severity := map[string]int{Allow: 0, Review: 1, Deny: 2}
+	if severity[b] > severity[a] {
+		return b
+	}
+	return a
+}
+
+// Record stores a screening result in the caller's SQL transaction and returns its ID
+func Record(tx *sql.Tx, e Event, res Result, requestID string) (int64, error) {
+	outcomes, err := json.Marshal(res.Outcomes)
+	if err != nil {
+		return 0, fmt.Errorf("encoding rule outcomes: %w", err)
+	}
+	var toID *int
+	if e.To != nil {
+		toID = &e.To.AccountID
+	}
+	result, err := tx.Exec(`INSERT INTO fraud_decisions (kind, account_id, counterparty_account_id, amount, decision, score, outcomes, request_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, e.Kind, e.Account.AccountID, toID, e.Amount, res.Decision, res.Score, string(outcomes), requestID)
+	if err != nil {
+		return 0, fmt.Errorf("recording fraud decision: %w", err)
+	}
+	return result.LastInsertId()
+}
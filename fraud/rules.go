@@ -0,0 +1,106 @@
+package fraud
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Velocity flags accounts sending money out unusually often
+type Velocity struct {
+	Window   time.Duration
+	MaxCount int // Withdrawals and outgoing transfers allowed within Window before review
+}
+
+func (Velocity) Name() string { return "velocity" }
+
+func (v Velocity) Evaluate(tx *sql.Tx, e Event) (Outcome, error) {
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM transactions WHERE account_id = ? AND type IN ('withdrawal', 'transfer_out') AND transaction_date >= NOW() - INTERVAL ? SECOND",
+		e.Account.AccountID, int(v.Window.Seconds())).Scan(&n)
+	if err != nil {
+		return Outcome{}, err
+	}
+	if n+1 > v.MaxCount {
+		return Outcome{Decision: Review, Score: 50, Reason: fmt.Sprintf("%d outflows within %s", n+1, v.Window)}, nil
+	}
+	return Outcome{Decision: Allow}, nil
+}
+
+// AmountAnomaly flags amounts far above what the customer usually moves: more than
+// Factor standard deviations above the mean, and more than Factor times the mean,
+// of the customer's outflows across all their accounts
+type AmountAnomaly struct {
+	Lookback   time.Duration
+	MinHistory int // Outflows needed before the rule applies
+	Factor     float64
+}
+
+func (AmountAnomaly) Name() string { return "amount_anomaly" }
+
+func (a AmountAnomaly) Evaluate(tx *sql.Tx, e Event) (Outcome, error) {
+	var n int
+	var mean, stddev float64
+	err := tx.QueryRow(`SELECT COUNT(*), COALESCE(AVG(t.amount), 0), COALESCE(STDDEV_POP(t.amount), 0)
+		FROM transactions t JOIN accounts a ON a.account_id = t.account_id
+		WHERE a.customer_id = ? AND t.type IN ('withdrawal', 'transfer_out') AND t.transaction_date >= NOW() - INTERVAL ? SECOND`,
+		e.Account.CustomerID, int(a.Lookback.Seconds())).Scan(&n, &mean, &stddev)
+	if err != nil {
+		return Outcome{}, err
+	}
+	if n < a.MinHistory {
+		return Outcome{Decision: Allow}, nil
+	}
+	if e.Amount > mean+a.Factor*stddev && e.Amount > a.Factor*mean {
+		score := 30
+		// Very large deviations weigh more, up to the point of forcing review on their own
+		if stddev > 0 {
+			score += int(math.Min(30, (e.Amount-mean)/stddev))
+		}
+		return Outcome{Decision: Allow, Score: score, Reason: fmt.Sprintf("amount %.2f against a usual %.2f", e.Amount, mean)}, nil
+	}
+	return Outcome{Decision: Allow}, nil
+}
+
+// NewDestination flags large first transfers to an account never paid before
+type NewDestination struct {
+	Threshold float64
+}
+
+func (NewDestination) Name() string { return "new_destination" }
+
+func (d NewDestination) Evaluate(tx *sql.Tx, e Event) (Outcome, error) {
+	if e.To == nil {
+		return Outcome{Decision: Allow}, nil
+	}
+	var seen bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM transactions WHERE account_id = ? AND counterparty_account_id = ? AND type = 'transfer_out')",
+		e.Account.AccountID, e.To.AccountID).Scan(&seen)
+	if err != nil {
+		return Outcome{}, err
+	}
+	if seen {
+		return Outcome{Decision: Allow}, nil
+	}
+	if e.Amount >= d.Threshold {
+		return Outcome{Decision: Review, Score: 40, Reason: "first transfer to this destination"}, nil
+	}
+	return Outcome{Decision: Allow, Score: 10, Reason: "first transfer to this destination"}, nil
+}
+
+// NightWithdrawal flags large cash withdrawals between FromHour and ToHour local time
+type NightWithdrawal struct {
+	FromHour, ToHour int
+	Threshold        float64
+}
+
+func (NightWithdrawal) Name() string { return "night_withdrawal" }
+
+func (nw NightWithdrawal) Evaluate(tx *sql.Tx, e Event) (Outcome, error) {
+	hour := e.At.Hour()
+	if e.Kind != KindWithdrawal || hour < nw.FromHour || hour >= nw.ToHour || e.Amount < nw.Threshold {
+		return Outcome{Decision: Allow}, nil
+	}
+	return Outcome{Decision: Review, Score: 40, Reason: fmt.Sprintf("withdrawal of %.2f at %02d:%02d", e.Amount, hour, e.At.Minute())}, nil
+}
@@ -4,7 +4,7 @@ go 1.24.5
 
 require github.com/go-sql-driver/mysql v1.9.3
 
-require github.com/rs/cors v1.11.1 // indirect
+require github.com/rs/cors v1.11.1
 
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"banking-app/aml"
+	"banking-app/audit"
+	"banking-app/db"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+const amlCaseColumns = `case_id, scenario, account_id, customer_id, amount, evidence, detected_for, status, assigned_to,
+	report_reference, filed_at, created_at, updated_at`
+
+func scanAMLCase(row interface{ Scan(...interface{}) error }, c *models.AMLCase) error {
+	return row.Scan(&c.CaseID, &c.Scenario, &c.AccountID, &c.CustomerID, &c.Amount, &c.Evidence, &c.DetectedFor, &c.Status, &c.AssignedTo,
+		&c.ReportReference, &c.FiledAt, &c.CreatedAt, &c.UpdatedAt)
+}
+
+// GetAMLCases lists AML cases, oldest first, filtered with ?status= and ?assigned_to=
+// (an employee ID, or "none" for unassigned cases)
+func GetAMLCases(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can review AML cases")
+		return
+	}
+
+	query := "SELECT " + amlCaseColumns + " FROM aml_cases WHERE 1 = 1"
+	var args []interface{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	if assigned := r.URL.Query().Get("assigned_to"); assigned == "none" {
+		query += " AND assigned_to IS NULL"
+	} else if assigned != "" {
+		employeeID, err := strconv.Atoi(assigned)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "assigned_to must be an employee ID or 'none'")
+			return
+		}
+		query += " AND assigned_to = ?"
+		args = append(args, employeeID)
+	}
+	query += " ORDER BY created_at, case_id LIMIT 500"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Printf("Error listing AML cases: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve AML cases")
+		return
+	}
+	defer rows.Close()
+
+	cases := []models.AMLCase{}
+	for rows.Next() {
+		var c models.AMLCase
+		if err := scanAMLCase(rows, &c); err != nil {
+			log.Printf("Error scanning AML case: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve AML cases")
+			return
+		}
+		cases = append(cases, c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating AML cases: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve AML cases")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cases)
+}
+
+// GetAMLCase returns a case with its history
+func GetAMLCase(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can review AML cases")
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid case ID")
+		return
+	}
+
+	var c models.AMLCase
+	if err := scanAMLCase(db.DB.QueryRow("SELECT "+amlCaseColumns+" FROM aml_cases WHERE case_id = ?", id), &c); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Case not found")
+		} else {
+			log.Printf("Error fetching AML case: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve AML case")
+		}
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT event_id, from_status, to_status, actor_user_id, note, created_at
+		FROM aml_case_events WHERE case_id = ? ORDER BY event_id`, id)
+	if err != nil {
+		log.Printf("Error fetching AML case events: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve AML case")
+		return
+	}
+	defer rows.Close()
+
+	c.Events = []models.AMLCaseEvent{}
+	for rows.Next() {
+		var e models.AMLCaseEvent
+		if err := rows.Scan(&e.EventID, &e.FromStatus, &e.ToStatus, &e.ActorUserID, &e.Note, &e.CreatedAt); err != nil {
+			log.Printf("Error scanning AML case event: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve AML case")
+			return
+		}
+		c.Events = append(c.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating AML case events: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve AML case")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, c)
+}
+
+// AssignAMLCase assigns an open or in-progress case to an employee
+func AssignAMLCase(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can assign AML cases")
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid case ID")
+		return
+	}
+	var req models.AssignAMLCaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for AML case assignment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign case")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM employees WHERE employee_id = ?)", req.EmployeeID).Scan(&exists); err != nil {
+		log.Printf("Error checking employee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign case")
+		return
+	}
+	if !exists {
+		respondWithError(w, http.StatusBadRequest, "Employee not found")
+		return
+	}
+
+	var status string
+	var previous *int
+	err = tx.QueryRow("SELECT status, assigned_to FROM aml_cases WHERE case_id = ? FOR UPDATE", id).Scan(&status, &previous)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Case not found")
+		} else {
+			log.Printf("Error fetching AML case: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to assign case")
+		}
+		return
+	}
+	if status == aml.StatusFiled || status == aml.StatusClosed {
+		respondWithError(w, http.StatusConflict, "Case has already been "+status)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE aml_cases SET assigned_to = ? WHERE case_id = ?", req.EmployeeID, id); err != nil {
+		log.Printf("Error assigning AML case: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign case")
+		return
+	}
+	if err := aml.AddEvent(tx, id, status, status, &actor.UserID, fmt.Sprintf("Assigned to employee %d", req.EmployeeID)); err != nil {
+		log.Printf("Error recording AML case event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign case")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "aml_case.assign", EntityType: "aml_case", EntityID: strconv.FormatInt(id, 10),
+		Before: map[string]interface{}{"assigned_to": previous},
+		After:  map[string]interface{}{"assigned_to": req.EmployeeID}})
+	if err != nil {
+		log.Printf("Error writing audit log for AML case assignment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign case")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing AML case assignment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign case")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"case_id": id, "assigned_to": req.EmployeeID})
+}
+
+// TransitionAMLCase moves a case through its workflow. Filing a case requires the
+// reference of the suspicious activity report submitted to the authorities.
+func TransitionAMLCase(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can review AML cases")
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid case ID")
+		return
+	}
+	var req models.TransitionAMLCaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	req.ReportReference = strings.TrimSpace(req.ReportReference)
+	if req.Note == "" || len(req.Note) > 1000 {
+		respondWithError(w, http.StatusBadRequest, "A note of at most 1000 characters is required")
+		return
+	}
+	if req.Status == aml.StatusFiled && (req.ReportReference == "" || len(req.ReportReference) > 64) {
+		respondWithError(w, http.StatusBadRequest, "Filing requires a report reference of at most 64 characters")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for AML case transition: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update case")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var current string
+	if err := tx.QueryRow("SELECT status FROM aml_cases WHERE case_id = ? FOR UPDATE", id).Scan(&current); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Case not found")
+		} else {
+			log.Printf("Error fetching AML case: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update case")
+		}
+		return
+	}
+	if !aml.CanTransition(current, req.Status) {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Case cannot move from '%s' to '%s'", current, req.Status))
+		return
+	}
+
+	if req.Status == aml.StatusFiled {
+		_, err = tx.Exec("UPDATE aml_cases SET status = ?, report_reference = ?, filed_at = NOW() WHERE case_id = ?", req.Status, req.ReportReference, id)
+	} else {
+		_, err = tx.Exec("UPDATE aml_cases SET status = ? WHERE case_id = ?", req.Status, id)
+	}
+	if err != nil {
+		log.Printf("Error updating AML case: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update case")
+		return
+	}
+	if err := aml.AddEvent(tx, id, current, req.Status, &actor.UserID, req.Note); err != nil {
+		log.Printf("Error recording AML case event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update case")
+		return
+	}
+	after := map[string]interface{}{"status": req.Status, "note": req.Note}
+	if req.Status == aml.StatusFiled {
+		after["report_reference"] = req.ReportReference
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "aml_case." + req.Status, EntityType: "aml_case", EntityID: strconv.FormatInt(id, 10),
+		Before: map[string]string{"status": current}, After: after})
+	if err != nil {
+		log.Printf("Error writing audit log for AML case transition: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update case")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing AML case transition: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update case")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"case_id": id, "status": req.Status})
+}
+
+// ExportAMLReports writes the cases filed in [?from=, ?to=] (YYYY-MM-DD, default the
+// last 30 days) as CSV, for reconciliation with the reports submitted to the authorities
+func ExportAMLReports(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsAdmin() {
+		respondWithError(w, http.StatusForbidden, "Only administrators can export filed reports")
+		return
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	var err error
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			respondWithError(w, http.StatusBadRequest, "from must be a date (YYYY-MM-DD)")
+			return
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			respondWithError(w, http.StatusBadRequest, "to must be a date (YYYY-MM-DD)")
+			return
+		}
+	}
+	fromDay := from.Format("2006-01-02")
+	toDay := to.Format("2006-01-02")
+
+	rows, err := db.DB.Query(`SELECT c.case_id, c.report_reference, c.filed_at, c.scenario, c.detected_for, a.account_number,
+			c.customer_id, cu.name, c.amount, c.assigned_to, c.evidence
+		FROM aml_cases c
+		JOIN accounts a ON a.account_id = c.account_id
+		JOIN customers cu ON cu.customer_id = c.customer_id
+		WHERE c.status = ? AND c.filed_at >= ? AND c.filed_at < ? + INTERVAL 1 DAY
+		ORDER BY c.filed_at, c.case_id`, aml.StatusFiled, fromDay, toDay)
+	if err != nil {
+		log.Printf("Error exporting filed AML reports: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to export reports")
+		return
+	}
+	defer rows.Close()
+
+	type report struct {
+		caseID                             int64
+		reference, scenario, account, name string
+		evidence                           string
+		filedAt, detectedFor               time.Time
+		customerID                         int
+		amount                             float64
+		assignedTo                         *int
+	}
+	var reports []report
+	for rows.Next() {
+		var rp report
+		if err := rows.Scan(&rp.caseID, &rp.reference, &rp.filedAt, &rp.scenario, &rp.detectedFor, &rp.account,
+			&rp.customerID, &rp.name, &rp.amount, &rp.assignedTo, &rp.evidence); err != nil {
+			log.Printf("Error scanning filed AML report: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to export reports")
+			return
+		}
+		reports = append(reports, rp)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating filed AML reports: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to export reports")
+		return
+	}
+
+	// The export itself is sensitive: record who took it
+	if !auditAccess(w, r, audit.Entry{Action: "aml_report.export", EntityType: "aml_case", EntityID: fromDay + "/" + toDay,
+		After: map[string]interface{}{"from": fromDay, "to": toDay, "count": len(reports)}}, "Failed to export reports") {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"aml-reports-%s-%s.csv\"", fromDay, toDay))
+	w.WriteHeader(http.StatusOK)
+	out := csv.NewWriter(w)
+	out.Write([]string{"case_id", "report_reference", "filed_at", "scenario", "detected_for", "account_number",
+		"customer_id", "customer_name", "amount", "assigned_to", "summary"})
+	for _, rp := range reports {
+		var evidence aml.Evidence
+		if err := json.Unmarshal([]byte(rp.evidence), &evidence); err != nil {
+			log.Printf("Error decoding evidence of AML case %d: %v", rp.caseID, err)
+		}
+		assignedTo := ""
+		if rp.assignedTo != nil {
+			assignedTo = strconv.Itoa(*rp.assignedTo)
+		}
+		out.Write([]string{strconv.FormatInt(rp.caseID, 10), rp.reference, rp.filedAt.Format(time.RFC3339), rp.scenario,
+			rp.detectedFor.Format("2006-01-02"), rp.account, strconv.Itoa(rp.customerID), rp.name,
+			strconv.FormatFloat(rp.amount, 'f', 2, 64), assignedTo, evidence.Summary})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		log.Printf("Error writing AML report export: %v", err)
+	}
+}
@@ -0,0 +1,649 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"banking-app/approvals"
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/db"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+const approvalRequestColumns = `approval_request_id, operation, entity_type, entity_id, branch_id, amount, body, status, maker_user_id,
+	checker_user_id, decision_note, result_status, result_body, created_at, decided_at, executed_at`
+
+func scanApprovalRequest(row interface{ Scan(...interface{}) error }, a *models.ApprovalRequest) error {
+	return row.Scan(&a.ApprovalRequestID, &a.Operation, &a.EntityType, &a.EntityID, &a.BranchID, &a.Amount, &a.Body, &a.Status, &a.MakerUserID,
+		&a.CheckerUserID, &a.DecisionNote, &a.ResultStatus, &a.ResultBody, &a.CreatedAt, &a.DecidedAt, &a.ExecutedAt)
+}
+
+// holdForApproval stores the operation for a checker instead of executing it when it
+// needs approval, committing tx and writing a 202 response. It reports whether it wrote
+// a response, in which case the caller must stop. An operation executing the approved
+// request approved is never held again.
+func holdForApproval(w http.ResponseWriter, r *http.Request, tx *sql.Tx, actor auth.Actor, approved int64, p approvals.Pending) bool {
+	if approved != 0 {
+		return false
+	}
+	required, err := approvals.Required(tx, actor, p.Operation, p.Amount)
+	if err != nil {
+		log.Printf("Error checking approval threshold: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process request")
+		return true
+	}
+	if !required {
+		return false
+	}
+
+	id, err := approvals.Submit(tx, p, actor.UserID)
+	if err != nil {
+		log.Printf("Error submitting approval request: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process request")
+		return true
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "approval.submit", EntityType: "approval_request", EntityID: strconv.FormatInt(id, 10),
+		After: map[string]interface{}{"operation": p.Operation, "entity_type": p.EntityType, "entity_id": p.EntityID, "amount": p.Amount, "body": p.Body}})
+	if err != nil {
+		log.Printf("Error writing audit log for approval request: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process request")
+		return true
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing approval request: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process request")
+		return true
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"message":             "Request needs approval by a second employee",
+		"approval_request_id": id,
+		"status":              approvals.StatusPending,
+	})
+	return true
+}
+
+// GetApprovalRequests lists approval requests, oldest first, filtered with ?status= and
+// ?operation=. Employees see the requests of their branch.
+func GetApprovalRequests(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can view approval requests")
+		return
+	}
+
+	query := "SELECT " + approvalRequestColumns + " FROM approval_requests WHERE 1 = 1"
+	var args []interface{}
+	if !actor.IsAdmin() {
+		query += " AND branch_id = ?"
+		args = append(args, actor.BranchID)
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	if operation := r.URL.Query().Get("operation"); operation != "" {
+		query += " AND operation = ?"
+		args = append(args, operation)
+	}
+	query += " ORDER BY created_at, approval_request_id LIMIT 500"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Printf("Error listing approval requests: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve approval requests")
+		return
+	}
+	defer rows.Close()
+
+	list := []models.ApprovalRequest{}
+	for rows.Next() {
+		var a models.ApprovalRequest
+		if err := scanApprovalRequest(rows, &a); err != nil {
+			log.Printf("Error scanning approval request: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve approval requests")
+			return
+		}
+		list = append(list, a)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating approval requests: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve approval requests")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// loadApprovalRequest reads a request with its history
+func loadApprovalRequest(id int64) (models.ApprovalRequest, error) {
+	var a models.ApprovalRequest
+	if err := scanApprovalRequest(db.DB.QueryRow("SELECT "+approvalRequestColumns+" FROM approval_requests WHERE approval_request_id = ?", id), &a); err != nil {
+		return a, err
+	}
+
+	rows, err := db.DB.Query(`SELECT event_id, from_status, to_status, actor_user_id, note, created_at
+		FROM approval_request_events WHERE approval_request_id = ? ORDER BY event_id`, id)
+	if err != nil {
+		return a, fmt.Errorf("loading events of approval request %d: %w", id, err)
+	}
+	defer rows.Close()
+
+	a.Events = []models.ApprovalRequestEvent{}
+	for rows.Next() {
+		var e models.ApprovalRequestEvent
+		if err := rows.Scan(&e.EventID, &e.FromStatus, &e.ToStatus, &e.ActorUserID, &e.Note, &e.CreatedAt); err != nil {
+			return a, fmt.Errorf("scanning event of approval request %d: %w", id, err)
+		}
+		a.Events = append(a.Events, e)
+	}
+	return a, rows.Err()
+}
+
+// GetApprovalRequest returns an approval request with its history
+func GetApprovalRequest(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid approval request ID")
+		return
+	}
+
+	a, err := loadApprovalRequest(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Approval request not found")
+		} else {
+			log.Printf("Error fetching approval request: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve approval request")
+		}
+		return
+	}
+	if !actor.IsStaffOf(a.BranchID) && actor.UserID != a.MakerUserID {
+		respondWithError(w, http.StatusForbidden, "Not allowed to view this approval request")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, a)
+}
+
+// ApproveApprovalRequest approves a pending request and executes it as its maker
+func ApproveApprovalRequest(w http.ResponseWriter, r *http.Request) {
+	decideApprovalRequest(w, r, approvals.StatusApproved, "approval.approve")
+}
+
+// RejectApprovalRequest rejects a pending request; a note is required
+func RejectApprovalRequest(w http.ResponseWriter, r *http.Request) {
+	decideApprovalRequest(w, r, approvals.StatusRejected, "approval.reject")
+}
+
+// decideApprovalRequest records the checker's decision and, for an approval, executes the
+// request once the decision is committed, recording how the execution went
+func decideApprovalRequest(w http.ResponseWriter, r *http.Request, decision, action string) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can decide approval requests")
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid approval request ID")
+		return
+	}
+	var req models.DecideApprovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if decision == approvals.StatusRejected && req.Note == "" {
+		respondWithError(w, http.StatusBadRequest, "A note is required to reject a request")
+		return
+	}
+	if len(req.Note) > 1000 {
+		respondWithError(w, http.StatusBadRequest, "Note must be at most 1000 characters")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for approval decision: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to decide approval request")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var a models.ApprovalRequest
+	var routeVars string
+	err = tx.QueryRow("SELECT "+approvalRequestColumns+", route_vars FROM approval_requests WHERE approval_request_id = ? FOR UPDATE", id).Scan(
+		&a.ApprovalRequestID, &a.Operation, &a.EntityType, &a.EntityID, &a.BranchID, &a.Amount, &a.Body, &a.Status, &a.MakerUserID,
+		&a.CheckerUserID, &a.DecisionNote, &a.ResultStatus, &a.ResultBody, &a.CreatedAt, &a.DecidedAt, &a.ExecutedAt, &routeVars)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Approval request not found")
+		} else {
+			log.Printf("Error fetching approval request: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to decide approval request")
+		}
+		return
+	}
+	if a.Status != approvals.StatusPending {
+		respondWithError(w, http.StatusConflict, "Approval request has already been "+a.Status)
+		return
+	}
+	rule, err := approvals.GetThreshold(tx, a.Operation)
+	if err != nil {
+		log.Printf("Error loading approval threshold: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to decide approval request")
+		return
+	}
+	if !approvals.CanCheck(actor, rule, a.MakerUserID, a.BranchID) {
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("Request must be decided by a %s of the branch other than its maker", rule.CheckerRole))
+		return
+	}
+
+	_, err = tx.Exec("UPDATE approval_requests SET status = ?, checker_user_id = ?, decision_note = ?, decided_at = NOW() WHERE approval_request_id = ?",
+		decision, actor.UserID, req.Note, id)
+	if err == nil {
+		err = approvals.AddEvent(tx, id, a.Status, decision, &actor.UserID, req.Note)
+	}
+	if err != nil {
+		log.Printf("Error deciding approval request: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to decide approval request")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: action, EntityType: "approval_request", EntityID: strconv.FormatInt(id, 10),
+		Before: map[string]interface{}{"status": a.Status}, After: map[string]interface{}{"status": decision, "note": req.Note}})
+	if err != nil {
+		log.Printf("Error writing audit log for approval decision: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to decide approval request")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing approval decision: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to decide approval request")
+		return
+	}
+
+	if decision == approvals.StatusApproved {
+		if err := runApprovalRequest(r, actor, a, routeVars); err != nil {
+			log.Printf("Error recording execution of approval request %d: %v", id, err)
+			respondWithError(w, http.StatusInternalServerError, "Request was executed but its result could not be recorded")
+			return
+		}
+	}
+
+	a, err = loadApprovalRequest(id)
+	if err != nil {
+		log.Printf("Error reading back approval request: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve approval request")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, a)
+}
+
+// ExecuteApprovalRequest recovers an approved request whose execution was interrupted,
+// e.g. by a restart. If the operation took effect only its outcome is recorded;
+// otherwise the request is executed again.
+func ExecuteApprovalRequest(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can execute approval requests")
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid approval request ID")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for approval execution: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to execute approval request")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var a models.ApprovalRequest
+	var routeVars string
+	var claimedBy sql.NullString
+	err = tx.QueryRow("SELECT "+approvalRequestColumns+", route_vars, execution_id FROM approval_requests WHERE approval_request_id = ? FOR UPDATE", id).Scan(
+		&a.ApprovalRequestID, &a.Operation, &a.EntityType, &a.EntityID, &a.BranchID, &a.Amount, &a.Body, &a.Status, &a.MakerUserID,
+		&a.CheckerUserID, &a.DecisionNote, &a.ResultStatus, &a.ResultBody, &a.CreatedAt, &a.DecidedAt, &a.ExecutedAt, &routeVars, &claimedBy)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Approval request not found")
+		} else {
+			log.Printf("Error fetching approval request: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to execute approval request")
+		}
+		return
+	}
+	if a.Status != approvals.StatusApproved {
+		respondWithError(w, http.StatusConflict, "Approval request is "+a.Status)
+		return
+	}
+	rule, err := approvals.GetThreshold(tx, a.Operation)
+	if err != nil {
+		log.Printf("Error loading approval threshold: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to execute approval request")
+		return
+	}
+	if !approvals.CanCheck(actor, rule, a.MakerUserID, a.BranchID) {
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("Request must be executed by a %s of the branch other than its maker", rule.CheckerRole))
+		return
+	}
+
+	if claimedBy.Valid {
+		// The operation committed but its outcome was never recorded
+		_, err = tx.Exec("UPDATE approval_requests SET status = ? WHERE approval_request_id = ?", approvals.StatusExecuted, id)
+		if err == nil {
+			err = approvals.AddEvent(tx, id, approvals.StatusApproved, approvals.StatusExecuted, &actor.UserID, "Recovered: the operation had taken effect")
+		}
+		if err != nil {
+			log.Printf("Error recovering approval request: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to execute approval request")
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			log.Printf("Error committing approval request recovery: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to execute approval request")
+			return
+		}
+	} else {
+		tx.Rollback()
+		if err := runApprovalRequest(r, actor, a, routeVars); err != nil {
+			log.Printf("Error recording execution of approval request %d: %v", id, err)
+			respondWithError(w, http.StatusInternalServerError, "Request was executed but its result could not be recorded")
+			return
+		}
+	}
+
+	a, err = loadApprovalRequest(id)
+	if err != nil {
+		log.Printf("Error reading back approval request: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve approval request")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, a)
+}
+
+// runApprovalRequest executes an approved request and records the outcome. A request
+// whose route variables cannot be decoded is failed without being executed.
+func runApprovalRequest(r *http.Request, checker auth.Actor, a models.ApprovalRequest, routeVars string) error {
+	execution := approvals.NewExecution(a.ApprovalRequestID)
+	var vars map[string]string
+	if err := json.Unmarshal([]byte(routeVars), &vars); err != nil {
+		log.Printf("Error decoding route variables of approval request %d: %v", a.ApprovalRequestID, err)
+		return recordApprovalExecution(execution, checker, http.StatusInternalServerError, "Invalid route variables")
+	}
+	status, body := executeApprovalRequest(r, a, vars, execution)
+	return recordApprovalExecution(execution, checker, status, body)
+}
+
+// operationResult collects the response written by an approved operation, which is
+// stored as the outcome of its approval request
+type operationResult struct {
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (o *operationResult) Header() http.Header {
+	if o.header == nil {
+		o.header = http.Header{}
+	}
+	return o.header
+}
+
+func (o *operationResult) WriteHeader(status int) {
+	if o.status == 0 {
+		o.status = status
+	}
+}
+
+func (o *operationResult) Write(b []byte) (int, error) {
+	o.WriteHeader(http.StatusOK)
+	return o.body.Write(b)
+}
+
+// executeApprovalRequest executes an approved request as its maker, under the checker's
+// request ID. It claims the request in a new SQL transaction and runs the operation in it
+// from the stored body and route variables, so that the claim commits only if the
+// operation does. It returns the operation's response.
+func executeApprovalRequest(r *http.Request, a models.ApprovalRequest, vars map[string]string, execution approvals.Execution) (int, string) {
+	maker, err := auth.Lookup(a.MakerUserID)
+	if err != nil {
+		log.Printf("Error loading maker of approval request %d: %v", a.ApprovalRequestID, err)
+		return http.StatusInternalServerError, "Maker could not be loaded"
+	}
+	// Not tied to the checker's connection: the execution must finish once started
+	r = r.WithContext(auth.WithActor(context.Background(), maker))
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for approval execution: %v", err)
+		return http.StatusInternalServerError, "Failed to execute approval request"
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	if err := approvals.Claim(tx, execution); err != nil {
+		if err == approvals.ErrAlreadyExecuted {
+			return http.StatusConflict, err.Error()
+		}
+		log.Printf("Error claiming approval request %d: %v", a.ApprovalRequestID, err)
+		return http.StatusInternalServerError, "Failed to execute approval request"
+	}
+
+	res := &operationResult{}
+	id := a.ApprovalRequestID
+	switch a.Operation {
+	case approvals.OpTransfer:
+		var req models.TransferRequest
+		if decodeApprovedBody(res, a, &req) {
+			transfer(res, r, tx, maker, req, id)
+		}
+	case approvals.OpOverdraft:
+		var req models.SetOverdraftRequest
+		if decodeApprovedBody(res, a, &req) {
+			setOverdraft(res, r, tx, maker, vars["accountNumber"], req, id)
+		}
+	case approvals.OpAccountClosure:
+		var req models.CloseAccountRequest
+		if decodeApprovedBody(res, a, &req) {
+			closeAccount(res, r, tx, maker, vars["accountNumber"], req, id)
+		}
+	case approvals.OpReversal:
+		var req models.ReverseTransactionRequest
+		transactionID, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			respondWithError(res, http.StatusBadRequest, "Invalid transaction ID")
+		} else if decodeApprovedBody(res, a, &req) {
+			reverseTransaction(res, r, tx, maker, transactionID, req, id)
+		}
+	case approvals.OpDisputeCredit:
+		var req models.DisputeCreditRequest
+		disputeID, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			respondWithError(res, http.StatusBadRequest, "Invalid dispute ID")
+		} else if decodeApprovedBody(res, a, &req) {
+			creditDispute(res, r, tx, maker, disputeID, req, id)
+		}
+	default:
+		respondWithError(res, http.StatusInternalServerError, "Unknown operation "+a.Operation)
+	}
+	return res.status, res.body.String()
+}
+
+// decodeApprovedBody decodes the stored body of an approved request into v, writing an
+// error response if it cannot
+func decodeApprovedBody(w http.ResponseWriter, a models.ApprovalRequest, v interface{}) bool {
+	if err := json.Unmarshal([]byte(a.Body), v); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return false
+	}
+	return true
+}
+
+// recordApprovalExecution stores the outcome of an execution. Whether the operation took
+// effect is read from the request's claim, which commits with the operation: an execution
+// whose claim committed is executed, or accepted if the operation was held or scheduled,
+// unless the operation refused the request and committed only the record of the refusal,
+// such as a screening case. One whose claim rolled back has failed. An execution that
+// lost to another leaves the outcome to it.
+func recordApprovalExecution(execution approvals.Execution, checker auth.Actor, status int, body string) error {
+	id := execution.RequestID
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	current, claimedBy, err := approvals.Lock(tx, id)
+	if err != nil {
+		return err
+	}
+	var outcome string
+	switch {
+	case current != approvals.StatusApproved:
+		return nil // Another execution has recorded the outcome
+	case claimedBy == execution.Token && status == http.StatusAccepted:
+		outcome = approvals.StatusAccepted
+	case claimedBy == execution.Token && status < http.StatusMultipleChoices:
+		outcome = approvals.StatusExecuted
+	case claimedBy != "" && claimedBy != execution.Token:
+		return nil
+	default:
+		outcome = approvals.StatusFailed
+	}
+
+	_, err = tx.Exec("UPDATE approval_requests SET status = ?, result_status = ?, result_body = ?, executed_at = COALESCE(executed_at, NOW()) WHERE approval_request_id = ?",
+		outcome, status, body, id)
+	if err != nil {
+		return fmt.Errorf("updating approval request %d: %w", id, err)
+	}
+	if err := approvals.AddEvent(tx, id, approvals.StatusApproved, outcome, &checker.UserID, fmt.Sprintf("HTTP %d", status)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetApprovalThresholds lists the approval rule of every operation
+func GetApprovalThresholds(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can view approval thresholds")
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT operation, threshold, checker_role FROM approval_thresholds ORDER BY operation")
+	if err != nil {
+		log.Printf("Error listing approval thresholds: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve approval thresholds")
+		return
+	}
+	defer rows.Close()
+
+	list := []models.ApprovalThreshold{}
+	for rows.Next() {
+		var t models.ApprovalThreshold
+		if err := rows.Scan(&t.Operation, &t.Threshold, &t.CheckerRole); err != nil {
+			log.Printf("Error scanning approval threshold: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve approval thresholds")
+			return
+		}
+		list = append(list, t)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating approval thresholds: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve approval thresholds")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// UpdateApprovalThreshold sets the approval rule of an operation. Requests already
+// pending keep waiting for a checker.
+func UpdateApprovalThreshold(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	operation := mux.Vars(r)["operation"]
+	if !approvals.IsOperation(operation) {
+		respondWithError(w, http.StatusNotFound, "Unknown operation")
+		return
+	}
+	var req models.ApprovalThreshold
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Threshold != nil && *req.Threshold < 0 {
+		respondWithError(w, http.StatusBadRequest, "Threshold cannot be negative")
+		return
+	}
+	if req.CheckerRole != auth.RoleEmployee && req.CheckerRole != auth.RoleAdmin {
+		respondWithError(w, http.StatusBadRequest, "checker_role must be 'employee' or 'admin'")
+		return
+	}
+	req.Operation = operation
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for approval threshold: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update approval threshold")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	before, err := approvals.GetThreshold(tx, operation)
+	if err != nil {
+		log.Printf("Error loading approval threshold: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update approval threshold")
+		return
+	}
+	_, err = tx.Exec(`INSERT INTO approval_thresholds (operation, threshold, checker_role) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE threshold = VALUES(threshold), checker_role = VALUES(checker_role)`, operation, req.Threshold, req.CheckerRole)
+	if err != nil {
+		log.Printf("Error updating approval threshold: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update approval threshold")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "approval_threshold.update", EntityType: "approval_threshold", EntityID: operation,
+		Before: map[string]interface{}{"threshold": before.Threshold, "checker_role": before.CheckerRole}, After: req})
+	if err != nil {
+		log.Printf("Error writing audit log for approval threshold: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update approval threshold")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing approval threshold: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update approval threshold")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, req)
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"banking-app/audit"
+)
+
+// auditAccess records that sensitive data is about to be handed out. Nothing changes
+// in the database, so the entry has its own transaction, but the data must not be
+// sent unless the entry was written. It writes an error response and returns false
+// if the entry could not be recorded.
+func auditAccess(w http.ResponseWriter, r *http.Request, e audit.Entry, failure string) bool {
+	if err := audit.Record(r, e); err != nil {
+		log.Printf("Error writing audit log for %s on %s %s: %v", e.Action, e.EntityType, e.EntityID, err)
+		respondWithError(w, http.StatusInternalServerError, failure)
+		return false
+	}
+	return true
+}
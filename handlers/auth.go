@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"banking-app/auth"
+)
+
+// requireActor identifies the caller, writing a 401 response if that is not possible
+func requireActor(w http.ResponseWriter, r *http.Request) (auth.Actor, bool) {
+	actor, err := auth.FromRequest(r)
+	if err != nil {
+		if err == auth.ErrUnauthenticated {
+			respondWithError(w, http.StatusUnauthorized, "Authentication required")
+		} else {
+			log.Printf("Error identifying user: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to identify user")
+		}
+		return actor, false
+	}
+	return actor, true
+}
+
+// requireAdmin identifies the caller and checks that they are an administrator
+func requireAdmin(w http.ResponseWriter, r *http.Request) (auth.Actor, bool) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return actor, false
+	}
+	if !actor.IsAdmin() {
+		respondWithError(w, http.StatusForbidden, "Administrator role required")
+		return actor, false
+	}
+	return actor, true
+}
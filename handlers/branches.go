@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"banking-app/audit"
+	"banking-app/db"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+// branchIDFromRequest parses the {id} route variable, writing a 400 response if it is invalid
+func branchIDFromRequest(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid branch ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// CreateBranch handles the creation of a new branch
+func CreateBranch(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	var req models.CreateBranchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.Name, req.Location = strings.TrimSpace(req.Name), strings.TrimSpace(req.Location)
+	if req.Name == "" || req.Location == "" {
+		respondWithError(w, http.StatusBadRequest, "Name and location are required")
+		return
+	}
+	// A new branch has no employees yet, so nobody can qualify as its manager
+	if req.ManagerID != nil {
+		respondWithError(w, http.StatusBadRequest, "Assign a manager once employees have joined the branch")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for branch: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create branch")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	result, err := tx.Exec("INSERT INTO branches (name, location) VALUES (?, ?)", req.Name, req.Location)
+	if err != nil {
+		log.Printf("Error creating branch: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create branch")
+		return
+	}
+
+	branchID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for branch: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get branch ID")
+		return
+	}
+
+	branch := models.Branch{
+		BranchID: int(branchID),
+		Name:     req.Name,
+		Location: req.Location,
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "branch.create", EntityType: "branch", EntityID: strconv.Itoa(branch.BranchID), After: branch})
+	if err != nil {
+		log.Printf("Error writing audit log for branch: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create branch")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing branch: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create branch")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, branch)
+}
+
+// GetBranches lists all branches
+func GetBranches(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.DB.Query("SELECT branch_id, name, location, manager_id FROM branches ORDER BY branch_id")
+	if err != nil {
+		log.Printf("Error listing branches: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve branches")
+		return
+	}
+	defer rows.Close()
+
+	branches := []models.Branch{}
+	for rows.Next() {
+		var b models.Branch
+		if err := rows.Scan(&b.BranchID, &b.Name, &b.Location, &b.ManagerID); err != nil {
+			log.Printf("Error scanning branch: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve branches")
+			return
+		}
+		branches = append(branches, b)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating branches: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve branches")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, branches)
+}
+
+// GetBranchByID retrieves a branch by its ID
+func GetBranchByID(w http.ResponseWriter, r *http.Request) {
+	id, ok := branchIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var b models.Branch
+	err := db.DB.QueryRow("SELECT branch_id, name, location, manager_id FROM branches WHERE branch_id = ?", id).Scan(
+		&b.BranchID, &b.Name, &b.Location, &b.ManagerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Branch not found")
+		} else {
+			log.Printf("Error getting branch by ID: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve branch")
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, b)
+}
+
+// UpdateBranch changes the name and location of a branch
+func UpdateBranch(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	id, ok := branchIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateBranchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.Name, req.Location = strings.TrimSpace(req.Name), strings.TrimSpace(req.Location)
+	if req.Name == "" || req.Location == "" {
+		respondWithError(w, http.StatusBadRequest, "Name and location are required")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for branch update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update branch")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var before models.UpdateBranchRequest
+	err = tx.QueryRow("SELECT name, location FROM branches WHERE branch_id = ? FOR UPDATE", id).Scan(&before.Name, &before.Location)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Branch not found")
+		} else {
+			log.Printf("Error getting branch for update: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update branch")
+		}
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE branches SET name = ?, location = ? WHERE branch_id = ?", req.Name, req.Location, id); err != nil {
+		log.Printf("Error updating branch: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update branch")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "branch.update", EntityType: "branch", EntityID: strconv.Itoa(id), Before: before, After: req})
+	if err != nil {
+		log.Printf("Error writing audit log for branch update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update branch")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing branch update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update branch")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"branch_id": id, "name": req.Name, "location": req.Location})
+}
+
+// DeleteBranch removes a branch that no longer has accounts or employees
+func DeleteBranch(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	id, ok := branchIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for branch deletion: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete branch")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var inUse bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM accounts WHERE branch_id = ?)
+		OR EXISTS(SELECT 1 FROM employees WHERE branch_id = ?)`, id, id).Scan(&inUse)
+	if err != nil {
+		log.Printf("Error checking branch usage: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete branch")
+		return
+	}
+	if inUse {
+		respondWithError(w, http.StatusConflict, "Branch still has accounts or employees")
+		return
+	}
+
+	result, err := tx.Exec("DELETE FROM branches WHERE branch_id = ?", id)
+	if err != nil {
+		log.Printf("Error deleting branch: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete branch")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Branch not found")
+		return
+	}
+	if err := audit.RecordTx(tx, r, audit.Entry{Action: "branch.delete", EntityType: "branch", EntityID: strconv.Itoa(id)}); err != nil {
+		log.Printf("Error writing audit log for branch deletion: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete branch")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing branch deletion: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete branch")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Branch deleted"})
+}
+
+// AssignBranchManager sets or clears the manager of a branch.
+// The manager must be an employee of that branch.
+func AssignBranchManager(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	id, ok := branchIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.AssignBranchManagerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for branch manager: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign manager")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var previousManagerID *int
+	if err := tx.QueryRow("SELECT manager_id FROM branches WHERE branch_id = ? FOR UPDATE", id).Scan(&previousManagerID); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Branch not found")
+		} else {
+			log.Printf("Error locking branch: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to assign manager")
+		}
+		return
+	}
+
+	if req.ManagerID != nil {
+		// Lock the employee so they cannot move branch while being assigned
+		var employeeBranch int
+		err := tx.QueryRow("SELECT branch_id FROM employees WHERE employee_id = ? FOR UPDATE", *req.ManagerID).Scan(&employeeBranch)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusBadRequest, "Manager is not an existing employee")
+			} else {
+				log.Printf("Error checking manager employee: %v", err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to assign manager")
+			}
+			return
+		}
+		if employeeBranch != id {
+			respondWithError(w, http.StatusBadRequest, "Manager must be an employee of this branch")
+			return
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE branches SET manager_id = ? WHERE branch_id = ?", req.ManagerID, id); err != nil {
+		log.Printf("Error assigning branch manager: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign manager")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "branch.manager", EntityType: "branch", EntityID: strconv.Itoa(id),
+		Before: map[string]*int{"manager_id": previousManagerID}, After: map[string]*int{"manager_id": req.ManagerID}})
+	if err != nil {
+		log.Printf("Error writing audit log for branch manager: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign manager")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing branch manager: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign manager")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"branch_id": id, "manager_id": req.ManagerID})
+}
+
+// GetBranchAccounts lists the accounts held at a branch. Only staff of that branch may see them.
+func GetBranchAccounts(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, ok := branchIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsStaffOf(id) {
+		respondWithError(w, http.StatusForbidden, "Only staff of this branch can list its accounts")
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT account_id, customer_id, account_number, account_type, balance, opened_date, branch_id, overdraft_limit, overdraft_rate, status
+		FROM accounts WHERE branch_id = ? ORDER BY account_id`, id)
+	if err != nil {
+		log.Printf("Error listing branch accounts: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve accounts")
+		return
+	}
+	defer rows.Close()
+
+	accounts := []models.Account{}
+	for rows.Next() {
+		var a models.Account
+		if err := rows.Scan(&a.AccountID, &a.CustomerID, &a.AccountNumber, &a.AccountType, &a.Balance, &a.OpenedDate, &a.BranchID, &a.OverdraftLimit, &a.OverdraftRate, &a.Status); err != nil {
+			log.Printf("Error scanning branch account: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve accounts")
+			return
+		}
+		accounts = append(accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating branch accounts: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve accounts")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, accounts)
+}
+
+// GetBranchCustomers lists customers holding at least one account at a branch.
+// Only staff of that branch may see them.
+func GetBranchCustomers(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, ok := branchIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsStaffOf(id) {
+		respondWithError(w, http.StatusForbidden, "Only staff of this branch can list its customers")
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT c.customer_id, c.name, c.email, c.phone, c.address, c.dob, c.national_id, c.created_at
+		FROM customers c WHERE EXISTS(SELECT 1 FROM accounts a WHERE a.customer_id = c.customer_id AND a.branch_id = ?)
+		ORDER BY c.customer_id`, id)
+	if err != nil {
+		log.Printf("Error listing branch customers: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve customers")
+		return
+	}
+	defer rows.Close()
+
+	customers := []models.Customer{}
+	for rows.Next() {
+		var c models.Customer
+		if err := rows.Scan(&c.CustomerID, &c.Name, &c.Email, &c.Phone, &c.Address, &c.DOB, &c.NationalID, &c.CreatedAt); err != nil {
+			log.Printf("Error scanning branch customer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve customers")
+			return
+		}
+		customers = append(customers, c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating branch customers: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve customers")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, customers)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"banking-app/audit"
+	"banking-app/calendar"
+	"banking-app/db"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+// GetHolidays lists the bank holidays of a year, ?year= defaulting to the current one, in
+// the calendar of ?country=, defaulting to the one that applies to payments
+func GetHolidays(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireActor(w, r); !ok {
+		return
+	}
+	country := strings.ToUpper(r.URL.Query().Get("country"))
+	if country == "" {
+		country = calendar.Country
+	}
+	if !calendar.IsCountry(country) {
+		respondWithError(w, http.StatusBadRequest, "Country must be a two-letter country code")
+		return
+	}
+	year := time.Now().Year()
+	if s := r.URL.Query().Get("year"); s != "" {
+		y, err := strconv.Atoi(s)
+		if err != nil || y < 1900 || y > 9999 {
+			respondWithError(w, http.StatusBadRequest, "Invalid year")
+			return
+		}
+		year = y
+	}
+
+	rows, err := db.DB.Query("SELECT country, holiday_date, name FROM holidays WHERE country = ? AND holiday_date BETWEEN ? AND ? ORDER BY holiday_date",
+		country, strconv.Itoa(year)+"-01-01", strconv.Itoa(year)+"-12-31")
+	if err != nil {
+		log.Printf("Error listing holidays: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve holidays")
+		return
+	}
+	defer rows.Close()
+
+	holidays := []models.Holiday{}
+	for rows.Next() {
+		var h models.Holiday
+		if err := rows.Scan(&h.Country, &h.Date, &h.Name); err != nil {
+			log.Printf("Error scanning holiday: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve holidays")
+			return
+		}
+		holidays = append(holidays, h)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating holidays: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve holidays")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, holidays)
+}
+
+// GetCutOffTimes lists the cut-off time of each payment type
+func GetCutOffTimes(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireActor(w, r); !ok {
+		return
+	}
+	rows, err := db.DB.Query("SELECT payment_type, cut_off, updated_at FROM cut_off_times ORDER BY payment_type")
+	if err != nil {
+		log.Printf("Error listing cut-off times: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve cut-off times")
+		return
+	}
+	defer rows.Close()
+
+	cutOffs := []models.CutOffTime{}
+	for rows.Next() {
+		var c models.CutOffTime
+		if err := rows.Scan(&c.PaymentType, &c.CutOff, &c.UpdatedAt); err != nil {
+			log.Printf("Error scanning cut-off time: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve cut-off times")
+			return
+		}
+		cutOffs = append(cutOffs, c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating cut-off times: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve cut-off times")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cutOffs)
+}
+
+// UpdateCutOffTime changes the cut-off of a payment type for transfers requested from now on
+func UpdateCutOffTime(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	paymentType := mux.Vars(r)["paymentType"]
+	if !calendar.IsPaymentType(paymentType) {
+		respondWithError(w, http.StatusNotFound, "Unknown payment type")
+		return
+	}
+	var req models.UpdateCutOffTimeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	cutOff, err := calendar.ParseTime(req.CutOff)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Cut-off must be a time of day as HH:MM or HH:MM:SS")
+		return
+	}
+	formatted := time.Time{}.Add(cutOff).Format("15:04:05")
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for cut-off time: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update cut-off time")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var before string
+	err = tx.QueryRow("SELECT cut_off FROM cut_off_times WHERE payment_type = ? FOR UPDATE", paymentType).Scan(&before)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error getting cut-off time: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update cut-off time")
+		return
+	}
+	_, err = tx.Exec("INSERT INTO cut_off_times (payment_type, cut_off) VALUES (?, ?) ON DUPLICATE KEY UPDATE cut_off = VALUES(cut_off)", paymentType, formatted)
+	if err != nil {
+		log.Printf("Error updating cut-off time: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update cut-off time")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "cut_off_time.update", EntityType: "cut_off_time", EntityID: paymentType,
+		Before: map[string]string{"cut_off": before}, After: map[string]string{"cut_off": formatted}})
+	if err != nil {
+		log.Printf("Error writing audit log for cut-off time: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update cut-off time")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing cut-off time: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update cut-off time")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"payment_type": paymentType, "cut_off": formatted})
+}
@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/cards"
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+// loadCard fetches the card in the {id} route variable and checks the actor may use its
+// account: to see the card's controls, or with sign set to change them. Inside tx the
+// card and then its account are locked, the order card authorization takes them in.
+// It writes the error response itself and returns false if the card cannot be used.
+func loadCard(w http.ResponseWriter, r *http.Request, tx *sql.Tx, actor auth.Actor, sign bool) (models.Card, bool) {
+	var card models.Card
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid card ID")
+		return card, false
+	}
+
+	query := "SELECT card_id, account_id, card_number, card_type, expiry_date, created_at, status, per_transaction_limit, daily_limit FROM cards WHERE card_id = ?"
+	var row *sql.Row
+	if tx != nil {
+		row = tx.QueryRow(query+" FOR UPDATE", id)
+	} else {
+		row = db.DB.QueryRow(query, id)
+	}
+	err = row.Scan(&card.CardID, &card.AccountID, &card.CardNumber, &card.CardType, &card.ExpiryDate, &card.CreatedAt, &card.Status, &card.PerTransactionLimit, &card.DailyLimit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Card not found")
+		} else {
+			log.Printf("Error getting card by ID: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve card")
+		}
+		return card, false
+	}
+
+	var account models.Account
+	if tx != nil {
+		account, err = ledger.LockAccountByID(tx, card.AccountID)
+	} else {
+		account, err = ledger.GetAccountByID(card.AccountID)
+	}
+	if err != nil {
+		log.Printf("Error getting account of card: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve card")
+		return card, false
+	}
+	var q db.Querier = db.DB
+	if tx != nil {
+		q = tx
+	}
+	_, ok := authorizeAccount(w, q, actor, account, sign)
+	return card, ok
+}
+
+// GetCardControls returns a card's status, spending limits and blocked merchant categories
+func GetCardControls(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	card, ok := loadCard(w, r, nil, actor, false)
+	if !ok {
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT mcc FROM card_mcc_blocks WHERE card_id = ? ORDER BY mcc", card.CardID)
+	if err != nil {
+		log.Printf("Error getting MCC blocks: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve card controls")
+		return
+	}
+	defer rows.Close()
+
+	blocked := []string{}
+	for rows.Next() {
+		var mcc string
+		if err := rows.Scan(&mcc); err != nil {
+			log.Printf("Error scanning MCC block: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve card controls")
+			return
+		}
+		blocked = append(blocked, mcc)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating MCC blocks: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve card controls")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"card_id":               card.CardID,
+		"status":                card.Status,
+		"per_transaction_limit": card.PerTransactionLimit,
+		"daily_limit":           card.DailyLimit,
+		"blocked_mccs":          blocked,
+	})
+}
+
+// UpdateCardStatus freezes, unfreezes or permanently blocks a card
+func UpdateCardStatus(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.UpdateCardStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Status != cards.StatusActive && req.Status != cards.StatusFrozen && req.Status != cards.StatusBlocked {
+		respondWithError(w, http.StatusBadRequest, "Status must be 'active', 'frozen' or 'blocked'")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for card status: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update card status")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	card, ok := loadCard(w, r, tx, actor, true)
+	if !ok {
+		return
+	}
+	if req.Status == card.Status {
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{"card_id": card.CardID, "status": card.Status})
+		return
+	}
+	if !cards.CanTransition(card.Status, req.Status) {
+		respondWithError(w, http.StatusConflict, "Cannot change card status from "+card.Status+" to "+req.Status)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE cards SET status = ? WHERE card_id = ?", req.Status, card.CardID); err != nil {
+		log.Printf("Error updating card status: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update card status")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "card.status", EntityType: "card", EntityID: strconv.Itoa(card.CardID),
+		Before: map[string]string{"status": card.Status}, After: map[string]string{"status": req.Status}})
+	if err != nil {
+		log.Printf("Error writing audit log for card status: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update card status")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing card status: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update card status")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"card_id": card.CardID, "status": req.Status})
+}
+
+// UpdateCardLimits sets or clears the per-transaction and daily spending limits of a card
+func UpdateCardLimits(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.UpdateCardLimitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if (req.PerTransactionLimit != nil && *req.PerTransactionLimit <= 0) || (req.DailyLimit != nil && *req.DailyLimit <= 0) {
+		respondWithError(w, http.StatusBadRequest, "Limits must be positive")
+		return
+	}
+	if req.PerTransactionLimit != nil && req.DailyLimit != nil && *req.PerTransactionLimit > *req.DailyLimit {
+		respondWithError(w, http.StatusBadRequest, "Per-transaction limit cannot exceed the daily limit")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for card limits: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update card limits")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	card, ok := loadCard(w, r, tx, actor, true)
+	if !ok {
+		return
+	}
+	_, err = tx.Exec("UPDATE cards SET per_transaction_limit = ?, daily_limit = ? WHERE card_id = ?", req.PerTransactionLimit, req.DailyLimit, card.CardID)
+	if err != nil {
+		log.Printf("Error updating card limits: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update card limits")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "card.limits", EntityType: "card", EntityID: strconv.Itoa(card.CardID),
+		Before: map[string]*float64{"per_transaction_limit": card.PerTransactionLimit, "daily_limit": card.DailyLimit},
+		After:  map[string]*float64{"per_transaction_limit": req.PerTransactionLimit, "daily_limit": req.DailyLimit}})
+	if err != nil {
+		log.Printf("Error writing audit log for card limits: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update card limits")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing card limits: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update card limits")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"card_id":               card.CardID,
+		"per_transaction_limit": req.PerTransactionLimit,
+		"daily_limit":           req.DailyLimit,
+	})
+}
+
+// AddCardMCCBlock blocks a merchant category code on a card
+func AddCardMCCBlock(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.CardMCCBlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if !isMCC(req.MCC) {
+		respondWithError(w, http.StatusBadRequest, "MCC must be a 4-digit code")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for MCC block: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to block merchant category")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	card, ok := loadCard(w, r, tx, actor, true)
+	if !ok {
+		return
+	}
+	result, err := tx.Exec("INSERT IGNORE INTO card_mcc_blocks (card_id, mcc) VALUES (?, ?)", card.CardID, req.MCC)
+	if err != nil {
+		log.Printf("Error adding MCC block: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to block merchant category")
+		return
+	}
+	// Blocking an already blocked category changes nothing to audit
+	if n, _ := result.RowsAffected(); n > 0 {
+		err = audit.RecordTx(tx, r, audit.Entry{Action: "card.mcc_block", EntityType: "card", EntityID: strconv.Itoa(card.CardID),
+			After: map[string]string{"blocked_mcc": req.MCC}})
+		if err != nil {
+			log.Printf("Error writing audit log for MCC block: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to block merchant category")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing MCC block: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to block merchant category")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{"card_id": card.CardID, "mcc": req.MCC})
+}
+
+// RemoveCardMCCBlock unblocks a merchant category code on a card
+func RemoveCardMCCBlock(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for MCC unblock: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to unblock merchant category")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	card, ok := loadCard(w, r, tx, actor, true)
+	if !ok {
+		return
+	}
+	mcc := mux.Vars(r)["mcc"]
+	result, err := tx.Exec("DELETE FROM card_mcc_blocks WHERE card_id = ? AND mcc = ?", card.CardID, mcc)
+	if err != nil {
+		log.Printf("Error removing MCC block: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to unblock merchant category")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Merchant category is not blocked")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "card.mcc_unblock", EntityType: "card", EntityID: strconv.Itoa(card.CardID),
+		Before: map[string]string{"blocked_mcc": mcc}})
+	if err != nil {
+		log.Printf("Error writing audit log for MCC unblock: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to unblock merchant category")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing MCC unblock: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to unblock merchant category")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Merchant category unblocked"})
+}
+
+func isMCC(s string) bool {
+	if len(s) != 4 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
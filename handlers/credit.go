@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/credit"
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateCreditAccount opens a credit line for an existing credit card
+func CreateCreditAccount(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.CreateCreditAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.CreditLimit <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Credit limit must be positive")
+		return
+	}
+	if req.PurchaseAPR < 0 || req.MinPaymentPercent < 0 || req.MinPaymentFloor < 0 || req.LateFee < 0 {
+		respondWithError(w, http.StatusBadRequest, "Rates and fees cannot be negative")
+		return
+	}
+	// Days 29-31 do not exist in every month
+	if req.StatementDay < 1 || req.StatementDay > 28 {
+		respondWithError(w, http.StatusBadRequest, "Statement day must be between 1 and 28")
+		return
+	}
+	if req.GraceDays <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Grace period must be at least one day")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for credit account: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create credit account")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	// Check that the card exists and is a credit card
+	var cardType string
+	var accountID int
+	err = tx.QueryRow("SELECT card_type, account_id FROM cards WHERE card_id = ? FOR UPDATE", req.CardID).Scan(&cardType, &accountID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, "Card does not exist")
+		} else {
+			log.Printf("Error checking card for credit account: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to create credit account")
+		}
+		return
+	}
+	account, err := ledger.LockAccountByID(tx, accountID)
+	if err != nil {
+		log.Printf("Error fetching account of card for credit account: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create credit account")
+		return
+	}
+	// The credit limit is a lending decision, so only the account's branch can grant it
+	if !actor.IsStaffOf(account.BranchID) {
+		respondWithError(w, http.StatusForbidden, "Only staff of the account's branch can open a credit line")
+		return
+	}
+	if cardType != "credit" {
+		respondWithError(w, http.StatusBadRequest, "Credit accounts can only be opened for credit cards")
+		return
+	}
+
+	result, err := tx.Exec(`INSERT INTO credit_accounts (card_id, credit_limit, purchase_apr, statement_day, grace_days, min_payment_percent, min_payment_floor, late_fee)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		req.CardID, req.CreditLimit, req.PurchaseAPR, req.StatementDay, req.GraceDays, req.MinPaymentPercent, req.MinPaymentFloor, req.LateFee)
+	if err != nil {
+		log.Printf("Error creating credit account: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create credit account")
+		return
+	}
+
+	creditAccountID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for credit account: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get credit account ID")
+		return
+	}
+
+	ca, err := credit.Lock(tx, int(creditAccountID))
+	if err != nil {
+		log.Printf("Error reading back credit account: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve credit account")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "credit_account.create", EntityType: "credit_account", EntityID: strconv.Itoa(ca.CreditAccountID), After: ca})
+	if err != nil {
+		log.Printf("Error writing audit log for credit account: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create credit account")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing credit account: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create credit account")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, ca)
+}
+
+// cardAccount loads the deposit account a card is issued on
+func cardAccount(cardID int) (models.Account, error) {
+	var accountID int
+	if err := db.DB.QueryRow("SELECT account_id FROM cards WHERE card_id = ?", cardID).Scan(&accountID); err != nil {
+		return models.Account{}, err
+	}
+	return ledger.GetAccountByID(accountID)
+}
+
+// getCreditAccount loads the credit account in the {id} route variable and checks the
+// actor may see the account its card is issued on. It writes an error response if not.
+func getCreditAccount(w http.ResponseWriter, r *http.Request, actor auth.Actor, failure string) (models.CreditAccount, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid credit account ID")
+		return models.CreditAccount{}, false
+	}
+
+	ca, err := credit.Get(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Credit account not found")
+		} else {
+			log.Printf("Error getting credit account: %v", err)
+			respondWithError(w, http.StatusInternalServerError, failure)
+		}
+		return ca, false
+	}
+	account, err := cardAccount(ca.CardID)
+	if err != nil {
+		log.Printf("Error getting account of credit card: %v", err)
+		respondWithError(w, http.StatusInternalServerError, failure)
+		return ca, false
+	}
+	_, ok := authorizeAccount(w, db.DB, actor, account, false)
+	return ca, ok
+}
+
+// GetCreditAccount retrieves a credit account with its available credit
+func GetCreditAccount(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	ca, ok := getCreditAccount(w, r, actor, "Failed to retrieve credit account")
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"credit_account":   ca,
+		"available_credit": credit.Available(ca),
+	})
+}
+
+// GetCreditStatements lists the statements of a credit account, newest first
+func GetCreditStatements(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	ca, ok := getCreditAccount(w, r, actor, "Failed to retrieve statements")
+	if !ok {
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT statement_id, credit_account_id, period_start, period_end, opening_balance, purchases, payments,
+		interest, fees, closing_balance, minimum_payment, due_date, paid_amount, status
+		FROM credit_statements WHERE credit_account_id = ? ORDER BY period_end DESC`, ca.CreditAccountID)
+	if err != nil {
+		log.Printf("Error getting credit statements: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve statements")
+		return
+	}
+	defer rows.Close()
+
+	statements := []models.CreditStatement{}
+	for rows.Next() {
+		var s models.CreditStatement
+		if err := rows.Scan(&s.StatementID, &s.CreditAccountID, &s.PeriodStart, &s.PeriodEnd, &s.OpeningBalance, &s.Purchases, &s.Payments,
+			&s.Interest, &s.Fees, &s.ClosingBalance, &s.MinimumPayment, &s.DueDate, &s.PaidAmount, &s.Status); err != nil {
+			log.Printf("Error scanning credit statement: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve statements")
+			return
+		}
+		statements = append(statements, s)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating credit statements: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve statements")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, statements)
+}
+
+// MakeCreditPayment pays down a credit account from a deposit account
+func MakeCreditPayment(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid credit account ID")
+		return
+	}
+
+	var req models.CreditPaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Amount <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Payment amount must be positive")
+		return
+	}
+
+	// Start a transaction for atomicity
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for credit payment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process payment")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	account, err := ledger.LockAccount(tx, req.FromAccountNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Source account not found")
+		} else {
+			log.Printf("Error fetching source account for credit payment: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve source account balance")
+		}
+		return
+	}
+
+	ca, err := credit.Lock(tx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Credit account not found")
+		} else {
+			log.Printf("Error locking credit account for payment: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process payment")
+		}
+		return
+	}
+
+	if _, ok := authorizeAccount(w, tx, actor, account, true); !ok {
+		return
+	}
+	// Paying someone else's card would be a transfer that skips limits and screening,
+	// so the payer must also have access to the account the card is issued on
+	cardAcct, err := cardAccount(ca.CardID)
+	if err != nil {
+		log.Printf("Error getting account of credit card for payment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process payment")
+		return
+	}
+	if _, ok := authorizeAccount(w, tx, actor, cardAcct, false); !ok {
+		return
+	}
+	// Anything above what is owed would leave a credit balance to spend
+	if owed := ledger.Round(ca.BalanceOwed + ca.AccruedInterest); req.Amount > owed {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Payment exceeds the %.2f owed on the credit account", owed))
+		return
+	}
+	if !ledger.CanDebit(account) {
+		refuseAccountStatus(w, account)
+		return
+	}
+	accountID, balance := account.AccountID, account.Balance
+	if ledger.Available(account) < req.Amount {
+		respondWithError(w, http.StatusBadRequest, "Insufficient funds in source account")
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE accounts SET balance = ? WHERE account_id = ?", balance-req.Amount, accountID); err != nil {
+		log.Printf("Error debiting account for credit payment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update source account balance")
+		return
+	}
+	if _, err := ledger.Post(tx, accountID, ledger.TypeWithdrawal, req.Amount, "Credit card payment"); err != nil {
+		log.Printf("Error recording credit payment transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process payment")
+		return
+	}
+	if err := credit.ApplyPayment(tx, ca.CreditAccountID, req.Amount, "Payment from "+req.FromAccountNumber); err != nil {
+		log.Printf("Error applying credit payment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process payment")
+		return
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "credit_account.payment", EntityType: "credit_account", EntityID: strconv.Itoa(ca.CreditAccountID),
+		Before: map[string]interface{}{"balance_owed": ca.BalanceOwed, "from_account_number": req.FromAccountNumber, "from_balance": balance},
+		After:  map[string]interface{}{"balance_owed": ca.BalanceOwed - req.Amount, "from_account_number": req.FromAccountNumber, "from_balance": balance - req.Amount, "amount": req.Amount}})
+	if err != nil {
+		log.Printf("Error writing audit log for credit payment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process payment")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction for credit payment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to commit payment transaction")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message":           "Payment successful",
+		"credit_account_id": ca.CreditAccountID,
+		"balance_owed":      ca.BalanceOwed - req.Amount,
+	})
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"banking-app/audit"
+	"banking-app/db"
+	"banking-app/models"
+	"banking-app/sanctions"
+
+	"github.com/gorilla/mux"
+)
+
+const customerColumns = "customer_id, name, email, phone, address, dob, national_id, created_at, tier, screening_status, kyc_status"
+
+// customerIDFromRequest parses the {id} route variable, writing a 400 response if it is invalid
+func customerIDFromRequest(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid customer ID")
+		return 0, false
+	}
+	return id, true
+}
+
+func scanCustomer(row *sql.Row) (models.Customer, error) {
+	var c models.Customer
+	err := row.Scan(&c.CustomerID, &c.Name, &c.Email, &c.Phone, &c.Address, &c.DOB, &c.NationalID, &c.CreatedAt, &c.Tier, &c.ScreeningStatus, &c.KYCStatus)
+	return c, err
+}
+
+// validCustomer trims and checks the customer details, writing a 400 response if they are invalid
+func validCustomer(w http.ResponseWriter, req *models.CreateCustomerRequest) (time.Time, bool) {
+	req.Name, req.Email, req.Phone = strings.TrimSpace(req.Name), strings.TrimSpace(req.Email), strings.TrimSpace(req.Phone)
+	req.Address, req.NationalID = strings.TrimSpace(req.Address), strings.TrimSpace(req.NationalID)
+	if req.Name == "" || req.NationalID == "" {
+		respondWithError(w, http.StatusBadRequest, "Name and national ID are required")
+		return time.Time{}, false
+	}
+	dob, err := time.Parse("2006-01-02", req.DOB)
+	if err != nil || dob.After(time.Now()) {
+		respondWithError(w, http.StatusBadRequest, "Date of birth must be a past date in YYYY-MM-DD format")
+		return time.Time{}, false
+	}
+	return dob, true
+}
+
+// CreateCustomer onboards a customer and screens them against the sanctions and PEP lists
+func CreateCustomer(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can onboard customers")
+		return
+	}
+
+	var req models.CreateCustomerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	dob, ok := validCustomer(w, &req)
+	if !ok {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for customer creation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create customer")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	result, err := tx.Exec("INSERT INTO customers (name, email, phone, address, dob, national_id) VALUES (?, ?, ?, ?, ?, ?)",
+		req.Name, req.Email, req.Phone, req.Address, dob, req.NationalID)
+	if err != nil {
+		log.Printf("Error creating customer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create customer")
+		return
+	}
+	customerID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for customer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get customer ID")
+		return
+	}
+
+	if _, err := sanctions.ScreenCustomer(tx, int(customerID), req.Name, &dob, sanctions.TriggerOnboarding); err != nil {
+		log.Printf("Error screening new customer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create customer")
+		return
+	}
+	customer, err := scanCustomer(tx.QueryRow("SELECT "+customerColumns+" FROM customers WHERE customer_id = ?", customerID))
+	if err != nil {
+		log.Printf("Error reading back customer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create customer")
+		return
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "customer.create", EntityType: "customer", EntityID: strconv.Itoa(customer.CustomerID), After: customer})
+	if err != nil {
+		log.Printf("Error writing audit log for customer creation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create customer")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing customer creation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create customer")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, customer)
+}
+
+// GetCustomer retrieves a customer; customers can only see themselves
+func GetCustomer(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, ok := customerIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() && (actor.CustomerID == nil || *actor.CustomerID != id) {
+		respondWithError(w, http.StatusForbidden, "Not allowed to view this customer")
+		return
+	}
+
+	customer, err := scanCustomer(db.DB.QueryRow("SELECT "+customerColumns+" FROM customers WHERE customer_id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Customer not found")
+		} else {
+			log.Printf("Error getting customer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve customer")
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, customer)
+}
+
+// UpdateCustomer changes a customer's details. A changed name or date of birth is screened again.
+func UpdateCustomer(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can update customers")
+		return
+	}
+	id, ok := customerIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateCustomerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	details := models.CreateCustomerRequest(req)
+	dob, ok := validCustomer(w, &details)
+	if !ok {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for customer update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update customer")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	before, err := scanCustomer(tx.QueryRow("SELECT "+customerColumns+" FROM customers WHERE customer_id = ? FOR UPDATE", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Customer not found")
+		} else {
+			log.Printf("Error getting customer for update: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update customer")
+		}
+		return
+	}
+
+	_, err = tx.Exec("UPDATE customers SET name = ?, email = ?, phone = ?, address = ?, dob = ?, national_id = ? WHERE customer_id = ?",
+		details.Name, details.Email, details.Phone, details.Address, dob, details.NationalID, id)
+	if err != nil {
+		log.Printf("Error updating customer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update customer")
+		return
+	}
+	if details.Name != before.Name || !dob.Equal(before.DOB) {
+		if _, err := sanctions.ScreenCustomer(tx, id, details.Name, &dob, sanctions.TriggerUpdate); err != nil {
+			log.Printf("Error screening updated customer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update customer")
+			return
+		}
+	}
+	after, err := scanCustomer(tx.QueryRow("SELECT "+customerColumns+" FROM customers WHERE customer_id = ?", id))
+	if err != nil {
+		log.Printf("Error reading back customer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update customer")
+		return
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "customer.update", EntityType: "customer", EntityID: strconv.Itoa(id), Before: before, After: after})
+	if err != nil {
+		log.Printf("Error writing audit log for customer update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update customer")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing customer update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update customer")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, after)
+}
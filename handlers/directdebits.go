@@ -0,0 +1,1010 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/db"
+	"banking-app/directdebit"
+	"banking-app/disputes"
+	"banking-app/eod"
+	"banking-app/holders"
+	"banking-app/kyc"
+	"banking-app/ledger"
+	"banking-app/models"
+	"banking-app/outbox"
+
+	"github.com/gorilla/mux"
+)
+
+// actsFor reports whether the actor may act for an account on a mandate: staff of its
+// branch, or one of its holders, whose role with sign set must also allow moving money
+func actsFor(q db.Querier, actor auth.Actor, account models.Account, sign bool) (bool, error) {
+	if actor.IsStaffOf(account.BranchID) {
+		return true, nil
+	}
+	if actor.CustomerID == nil {
+		return false, nil
+	}
+	role, err := holders.Role(q, account, *actor.CustomerID)
+	if err != nil {
+		return false, err
+	}
+	return role != "" && (!sign || holders.CanSign(role)), nil
+}
+
+// CreateDirectDebitCreditor registers an organisation allowed to collect direct debits
+// into one of its accounts with us
+func CreateDirectDebitCreditor(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	var req models.CreateDirectDebitCreditorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.CreditorIdentifier = strings.ToUpper(strings.TrimSpace(req.CreditorIdentifier))
+	if req.Name == "" || len(req.Name) > 100 {
+		respondWithError(w, http.StatusBadRequest, "A name of at most 100 characters is required")
+		return
+	}
+	if req.CreditorIdentifier == "" || len(req.CreditorIdentifier) > 35 {
+		respondWithError(w, http.StatusBadRequest, "A creditor identifier of at most 35 characters is required")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for creditor: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to register creditor")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	account, err := ledger.LockAccount(tx, req.AccountNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error fetching creditor account: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to register creditor")
+		}
+		return
+	}
+	if !ledger.CanCredit(account) {
+		refuseAccountStatus(w, account)
+		return
+	}
+	var taken bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM direct_debit_creditors WHERE creditor_identifier = ?)", req.CreditorIdentifier).Scan(&taken); err != nil {
+		log.Printf("Error checking creditor identifier: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to register creditor")
+		return
+	}
+	if taken {
+		respondWithErrorCode(w, http.StatusConflict, "creditor_identifier_taken", "A creditor with this identifier is already registered")
+		return
+	}
+
+	result, err := tx.Exec("INSERT INTO direct_debit_creditors (name, creditor_identifier, account_id, created_by) VALUES (?, ?, ?, ?)",
+		req.Name, req.CreditorIdentifier, account.AccountID, actor.UserID)
+	if err != nil {
+		log.Printf("Error recording creditor: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to register creditor")
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for creditor: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to register creditor")
+		return
+	}
+	var creditor models.DirectDebitCreditor
+	err = directdebit.ScanCreditor(tx.QueryRow("SELECT "+directdebit.CreditorColumns+" FROM "+directdebit.CreditorTables+" WHERE c.creditor_id = ?", id), &creditor)
+	if err != nil {
+		log.Printf("Error reading back creditor: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to register creditor")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "direct_debit_creditor.create", EntityType: "direct_debit_creditor", EntityID: strconv.FormatInt(id, 10),
+		After: creditor})
+	if err != nil {
+		log.Printf("Error writing audit log for creditor: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to register creditor")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing creditor: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to register creditor")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, creditor)
+}
+
+// GetDirectDebitCreditors lists the registered creditors by name, filtered with ?status=
+func GetDirectDebitCreditors(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireActor(w, r); !ok {
+		return
+	}
+
+	query := "SELECT " + directdebit.CreditorColumns + " FROM " + directdebit.CreditorTables
+	var args []interface{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " WHERE c.status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY c.name, c.creditor_id"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Printf("Error listing creditors: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve creditors")
+		return
+	}
+	defer rows.Close()
+
+	creditors := []models.DirectDebitCreditor{}
+	for rows.Next() {
+		var c models.DirectDebitCreditor
+		if err := directdebit.ScanCreditor(rows, &c); err != nil {
+			log.Printf("Error scanning creditor: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve creditors")
+			return
+		}
+		creditors = append(creditors, c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating creditors: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve creditors")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, creditors)
+}
+
+// UpdateDirectDebitCreditorStatus suspends or reactivates a creditor. A suspended
+// creditor takes no new mandates, and its collections fail when they fall due.
+func UpdateDirectDebitCreditorStatus(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid creditor ID")
+		return
+	}
+	var req models.UpdateDirectDebitCreditorStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Status != directdebit.CreditorActive && req.Status != directdebit.CreditorSuspended {
+		respondWithError(w, http.StatusBadRequest, "status must be 'active' or 'suspended'")
+		return
+	}
+	if !validReason(w, &req.Reason) {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for creditor status: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update creditor")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var current string
+	if err := tx.QueryRow("SELECT status FROM direct_debit_creditors WHERE creditor_id = ? FOR UPDATE", id).Scan(&current); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Creditor not found")
+		} else {
+			log.Printf("Error fetching creditor: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update creditor")
+		}
+		return
+	}
+	if current == req.Status {
+		respondWithError(w, http.StatusConflict, "Creditor is already "+current)
+		return
+	}
+	if _, err := tx.Exec("UPDATE direct_debit_creditors SET status = ? WHERE creditor_id = ?", req.Status, id); err != nil {
+		log.Printf("Error updating creditor status: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update creditor")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "direct_debit_creditor.update_status", EntityType: "direct_debit_creditor", EntityID: strconv.Itoa(id),
+		Before: map[string]string{"status": current}, After: map[string]string{"status": req.Status, "reason": req.Reason}})
+	if err != nil {
+		log.Printf("Error writing audit log for creditor status: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update creditor")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing creditor status: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update creditor")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"creditor_id": id, "status": req.Status})
+}
+
+// CreateMandate authorises a creditor to collect from an account the customer may move
+// money from, up to max_amount at a time and at most once per frequency period
+func CreateMandate(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.CreateMandateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.CreditorIdentifier = strings.ToUpper(strings.TrimSpace(req.CreditorIdentifier))
+	req.Reference = strings.TrimSpace(req.Reference)
+	if req.Reference == "" || len(req.Reference) > 35 {
+		respondWithError(w, http.StatusBadRequest, "A reference of at most 35 characters is required")
+		return
+	}
+	if req.MaxAmount <= 0 {
+		respondWithError(w, http.StatusBadRequest, "max_amount must be positive")
+		return
+	}
+	if !directdebit.IsFrequency(req.Frequency) {
+		respondWithError(w, http.StatusBadRequest, "frequency must be one of 'once', 'weekly', 'monthly', 'quarterly', 'yearly'")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for mandate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create mandate")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var creditorID, creditorAccountID int
+	var creditorStatus string
+	err = tx.QueryRow("SELECT creditor_id, account_id, status FROM direct_debit_creditors WHERE creditor_identifier = ?", req.CreditorIdentifier).Scan(
+		&creditorID, &creditorAccountID, &creditorStatus)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Creditor not found")
+		} else {
+			log.Printf("Error fetching creditor for mandate: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to create mandate")
+		}
+		return
+	}
+	if creditorStatus != directdebit.CreditorActive {
+		respondWithErrorCode(w, http.StatusConflict, "creditor_suspended", "Creditor is suspended")
+		return
+	}
+
+	debtor, err := ledger.LockAccount(tx, req.DebtorAccountNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error fetching account for mandate: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to create mandate")
+		}
+		return
+	}
+	if _, ok := authorizeAccount(w, tx, actor, debtor, true); !ok {
+		return
+	}
+	if debtor.AccountID == creditorAccountID {
+		respondWithError(w, http.StatusBadRequest, "A creditor cannot collect from its own account")
+		return
+	}
+	if !ledger.CanDebit(debtor) {
+		refuseAccountStatus(w, debtor)
+		return
+	}
+	kycStatus, err := kyc.CustomerStatus(tx, debtor.CustomerID)
+	if err != nil {
+		log.Printf("Error checking KYC status for mandate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create mandate")
+		return
+	}
+	if kycStatus != kyc.StatusVerified {
+		refuseUnverified(w)
+		return
+	}
+	var taken bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM direct_debit_mandates WHERE creditor_id = ? AND reference = ?)", creditorID, req.Reference).Scan(&taken)
+	if err != nil {
+		log.Printf("Error checking mandate reference: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create mandate")
+		return
+	}
+	if taken {
+		respondWithErrorCode(w, http.StatusConflict, "mandate_reference_taken", "The creditor already has a mandate with this reference")
+		return
+	}
+
+	result, err := tx.Exec(`INSERT INTO direct_debit_mandates (creditor_id, debtor_account_id, reference, max_amount, frequency, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)`, creditorID, debtor.AccountID, req.Reference, req.MaxAmount, req.Frequency, actor.UserID)
+	if err != nil {
+		log.Printf("Error recording mandate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create mandate")
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for mandate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create mandate")
+		return
+	}
+	mandate, err := directdebit.GetMandate(tx, id)
+	if err != nil {
+		log.Printf("Error reading back mandate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create mandate")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "mandate.create", EntityType: "direct_debit_mandate", EntityID: strconv.FormatInt(id, 10),
+		After: mandate})
+	if err != nil {
+		log.Printf("Error writing audit log for mandate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create mandate")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing mandate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create mandate")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, mandate)
+}
+
+// GetAccountMandates lists the mandates an account pays under or, for a creditor's
+// account, collects under, newest first
+func GetAccountMandates(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	account, err := ledger.GetAccount(mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error fetching account for mandates: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve mandates")
+		}
+		return
+	}
+	if _, ok := authorizeAccount(w, db.DB, actor, account, false); !ok {
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT "+directdebit.MandateColumns+" FROM "+directdebit.MandateTables+
+		" WHERE m.debtor_account_id = ? OR c.account_id = ? ORDER BY m.mandate_id DESC", account.AccountID, account.AccountID)
+	if err != nil {
+		log.Printf("Error listing mandates: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve mandates")
+		return
+	}
+	defer rows.Close()
+
+	mandates := []models.DirectDebitMandate{}
+	for rows.Next() {
+		var m models.DirectDebitMandate
+		if err := directdebit.ScanMandate(rows, &m); err != nil {
+			log.Printf("Error scanning mandate: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve mandates")
+			return
+		}
+		mandates = append(mandates, m)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating mandates: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve mandates")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, mandates)
+}
+
+// getMandate loads the mandate in the route and checks the actor may see it, acting for
+// either its debtor or its creditor. It writes an error response if not.
+func getMandate(w http.ResponseWriter, r *http.Request, actor auth.Actor, failure string) (models.DirectDebitMandate, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid mandate ID")
+		return models.DirectDebitMandate{}, false
+	}
+	m, err := directdebit.GetMandate(db.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Mandate not found")
+		} else {
+			log.Printf("Error fetching mandate: %v", err)
+			respondWithError(w, http.StatusInternalServerError, failure)
+		}
+		return m, false
+	}
+	for _, number := range []string{m.DebtorAccountNumber, m.CreditorAccountNumber} {
+		account, err := ledger.GetAccount(number)
+		if err != nil {
+			log.Printf("Error fetching account of mandate: %v", err)
+			respondWithError(w, http.StatusInternalServerError, failure)
+			return m, false
+		}
+		allowed, err := actsFor(db.DB, actor, account, false)
+		if err != nil {
+			log.Printf("Error checking account holder: %v", err)
+			respondWithError(w, http.StatusInternalServerError, failure)
+			return m, false
+		}
+		if allowed {
+			return m, true
+		}
+	}
+	respondWithError(w, http.StatusForbidden, "Not allowed to access this mandate")
+	return m, false
+}
+
+// GetMandate returns a mandate
+func GetMandate(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if m, ok := getMandate(w, r, actor, "Failed to retrieve mandate"); ok {
+		respondWithJSON(w, http.StatusOK, m)
+	}
+}
+
+// lockMandateAccounts locks the debtor and creditor accounts of a mandate, in that order
+func lockMandateAccounts(tx *sql.Tx, m models.DirectDebitMandate) (models.Account, models.Account, error) {
+	debtor, err := ledger.LockAccount(tx, m.DebtorAccountNumber)
+	if err != nil {
+		return debtor, models.Account{}, fmt.Errorf("locking debtor account: %w", err)
+	}
+	creditor, err := ledger.LockAccount(tx, m.CreditorAccountNumber)
+	if err != nil {
+		return debtor, creditor, fmt.Errorf("locking creditor account: %w", err)
+	}
+	return debtor, creditor, nil
+}
+
+// RevokeMandate withdraws a creditor's authority to collect from the account. Pending
+// collections under the mandate are cancelled.
+func RevokeMandate(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid mandate ID")
+		return
+	}
+	var req models.RevokeMandateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if !validReason(w, &req.Reason) {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for mandate revocation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke mandate")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	m, err := directdebit.LockMandate(tx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Mandate not found")
+		} else {
+			log.Printf("Error fetching mandate: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to revoke mandate")
+		}
+		return
+	}
+	debtor, err := ledger.LockAccount(tx, m.DebtorAccountNumber)
+	if err != nil {
+		log.Printf("Error locking account of mandate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke mandate")
+		return
+	}
+	if allowed, err := actsFor(tx, actor, debtor, true); err != nil || !allowed {
+		if err != nil {
+			log.Printf("Error checking account holder: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to revoke mandate")
+		} else {
+			respondWithError(w, http.StatusForbidden, "Only the account holder can revoke a mandate")
+		}
+		return
+	}
+	if m.Status != directdebit.MandateActive {
+		respondWithError(w, http.StatusConflict, "Mandate is already "+m.Status)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE direct_debit_mandates SET status = ?, revoked_by = ?, revoked_at = NOW(), revocation_reason = ? WHERE mandate_id = ?",
+		directdebit.MandateRevoked, actor.UserID, req.Reason, id)
+	if err != nil {
+		log.Printf("Error revoking mandate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke mandate")
+		return
+	}
+	result, err := tx.Exec("UPDATE direct_debit_collections SET status = ?, failure_reason = ?, finished_at = NOW() WHERE mandate_id = ? AND status = ?",
+		directdebit.StatusCancelled, "Mandate revoked", id, directdebit.StatusPending)
+	if err != nil {
+		log.Printf("Error cancelling collections of revoked mandate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke mandate")
+		return
+	}
+	cancelled, err := result.RowsAffected()
+	if err != nil {
+		log.Printf("Error counting cancelled collections: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke mandate")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "mandate.revoke", EntityType: "direct_debit_mandate", EntityID: strconv.FormatInt(id, 10),
+		Before: map[string]string{"status": m.Status},
+		After:  map[string]interface{}{"status": directdebit.MandateRevoked, "reason": req.Reason, "cancelled_collections": cancelled}})
+	if err != nil {
+		log.Printf("Error writing audit log for mandate revocation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke mandate")
+		return
+	}
+	if m, err = directdebit.GetMandate(tx, id); err != nil {
+		log.Printf("Error reading back mandate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke mandate")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing mandate revocation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke mandate")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, m)
+}
+
+// CreateCollection requests a collection under a mandate. It must stay within the
+// mandate's maximum and frequency and fall due at least directdebit.NoticeDays after
+// the business date; the customer is notified of it straight away.
+func CreateCollection(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid mandate ID")
+		return
+	}
+	var req models.CreateCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Amount <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Amount must be positive")
+		return
+	}
+	dueDate, err := time.Parse("2006-01-02", req.DueDate)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "due_date must be YYYY-MM-DD")
+		return
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	if len(req.Description) > 140 {
+		respondWithError(w, http.StatusBadRequest, "Description must be at most 140 characters")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for collection: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to request collection")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	// Locking the mandate serializes its collections
+	m, err := directdebit.LockMandate(tx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Mandate not found")
+		} else {
+			log.Printf("Error fetching mandate: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to request collection")
+		}
+		return
+	}
+	creditorAccount, err := ledger.GetAccount(m.CreditorAccountNumber)
+	if err != nil {
+		log.Printf("Error fetching creditor account: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to request collection")
+		return
+	}
+	if allowed, err := actsFor(tx, actor, creditorAccount, true); err != nil || !allowed {
+		if err != nil {
+			log.Printf("Error checking account holder: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to request collection")
+		} else {
+			respondWithError(w, http.StatusForbidden, "Only the creditor can request collections under a mandate")
+		}
+		return
+	}
+	if m.Status != directdebit.MandateActive {
+		respondWithErrorCode(w, http.StatusConflict, "mandate_revoked", "Mandate has been revoked")
+		return
+	}
+	var creditorStatus string
+	if err := tx.QueryRow("SELECT status FROM direct_debit_creditors WHERE creditor_id = ?", m.CreditorID).Scan(&creditorStatus); err != nil {
+		log.Printf("Error fetching creditor: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to request collection")
+		return
+	}
+	if creditorStatus != directdebit.CreditorActive {
+		respondWithErrorCode(w, http.StatusConflict, "creditor_suspended", "Creditor is suspended")
+		return
+	}
+	if req.Amount > m.MaxAmount {
+		respondWithErrorCode(w, http.StatusConflict, "mandate_amount_exceeded", fmt.Sprintf("Amount exceeds the mandate's maximum of %.2f", m.MaxAmount))
+		return
+	}
+
+	today, err := eod.BusinessDate(tx)
+	if err != nil {
+		log.Printf("Error getting business date for collection: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to request collection")
+		return
+	}
+	if dueDate.Before(today.AddDate(0, 0, directdebit.NoticeDays)) {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("due_date must be at least %d days after the business date %s", directdebit.NoticeDays, today.Format("2006-01-02")))
+		return
+	}
+	conflict, err := directdebit.Conflicting(tx, m, dueDate)
+	if err != nil {
+		log.Printf("Error checking mandate frequency: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to request collection")
+		return
+	}
+	if conflict != 0 {
+		respondWithErrorCode(w, http.StatusConflict, "mandate_frequency_exceeded",
+			fmt.Sprintf("Collection %d already falls within the same period of this %s mandate", conflict, m.Frequency))
+		return
+	}
+
+	result, err := tx.Exec("INSERT INTO direct_debit_collections (mandate_id, amount, due_date, description, requested_by) VALUES (?, ?, ?, ?, ?)",
+		id, req.Amount, req.DueDate, req.Description, actor.UserID)
+	if err != nil {
+		log.Printf("Error recording collection: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to request collection")
+		return
+	}
+	collectionID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for collection: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to request collection")
+		return
+	}
+	var c models.DirectDebitCollection
+	err = directdebit.ScanCollection(tx.QueryRow("SELECT "+directdebit.CollectionColumns+" FROM direct_debit_collections WHERE collection_id = ?", collectionID), &c)
+	if err != nil {
+		log.Printf("Error reading back collection: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to request collection")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "direct_debit.request", EntityType: "direct_debit_collection", EntityID: strconv.FormatInt(collectionID, 10),
+		After: c})
+	if err != nil {
+		log.Printf("Error writing audit log for collection: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to request collection")
+		return
+	}
+	// The pre-notification tells the customer what will be taken and when
+	err = outbox.Enqueue(tx, outbox.EventDirectDebitNotified, m.DebtorAccountNumber, map[string]interface{}{
+		"collection_id":       collectionID,
+		"mandate_id":          id,
+		"creditor_name":       m.CreditorName,
+		"creditor_identifier": m.CreditorIdentifier,
+		"reference":           m.Reference,
+		"account_number":      m.DebtorAccountNumber,
+		"amount":              req.Amount,
+		"due_date":            req.DueDate,
+		"description":         req.Description,
+	})
+	if err != nil {
+		log.Printf("Error writing direct debit notification: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to request collection")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing collection: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to request collection")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, c)
+}
+
+// GetMandateCollections lists the collections requested under a mandate, latest due first
+func GetMandateCollections(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	m, ok := getMandate(w, r, actor, "Failed to retrieve collections")
+	if !ok {
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT "+directdebit.CollectionColumns+" FROM direct_debit_collections WHERE mandate_id = ? ORDER BY due_date DESC, collection_id DESC LIMIT 500",
+		m.MandateID)
+	if err != nil {
+		log.Printf("Error listing collections: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve collections")
+		return
+	}
+	defer rows.Close()
+
+	collections := []models.DirectDebitCollection{}
+	for rows.Next() {
+		var c models.DirectDebitCollection
+		if err := directdebit.ScanCollection(rows, &c); err != nil {
+			log.Printf("Error scanning collection: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve collections")
+			return
+		}
+		collections = append(collections, c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating collections: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve collections")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, collections)
+}
+
+// lockCollection locks the collection in the route with its mandate and both accounts,
+// writing an error response if it does not exist
+func lockCollection(w http.ResponseWriter, r *http.Request, tx *sql.Tx, failure string) (models.DirectDebitCollection, models.DirectDebitMandate, models.Account, models.Account, bool) {
+	var debtor, creditor models.Account
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid collection ID")
+		return models.DirectDebitCollection{}, models.DirectDebitMandate{}, debtor, creditor, false
+	}
+	c, m, err := directdebit.Lock(tx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Collection not found")
+		} else {
+			log.Printf("Error fetching collection: %v", err)
+			respondWithError(w, http.StatusInternalServerError, failure)
+		}
+		return c, m, debtor, creditor, false
+	}
+	if debtor, creditor, err = lockMandateAccounts(tx, m); err != nil {
+		log.Printf("Error locking accounts of collection: %v", err)
+		respondWithError(w, http.StatusInternalServerError, failure)
+		return c, m, debtor, creditor, false
+	}
+	return c, m, debtor, creditor, true
+}
+
+// CancelCollection cancels a pending collection before it is taken, at the request of
+// either the customer or the creditor
+func CancelCollection(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.CancelCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if !validReason(w, &req.Reason) {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for collection cancellation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel collection")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	c, _, debtor, creditor, ok := lockCollection(w, r, tx, "Failed to cancel collection")
+	if !ok {
+		return
+	}
+	party := ""
+	for side, account := range map[string]models.Account{"debtor": debtor, "creditor": creditor} {
+		allowed, err := actsFor(tx, actor, account, true)
+		if err != nil {
+			log.Printf("Error checking account holder: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to cancel collection")
+			return
+		}
+		if allowed {
+			party = side
+			break
+		}
+	}
+	if party == "" {
+		respondWithError(w, http.StatusForbidden, "Not allowed to cancel this collection")
+		return
+	}
+	if c.Status != directdebit.StatusPending {
+		respondWithError(w, http.StatusConflict, "Collection is already "+c.Status)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE direct_debit_collections SET status = ?, failure_reason = ?, finished_at = NOW() WHERE collection_id = ?",
+		directdebit.StatusCancelled, req.Reason, c.CollectionID)
+	if err != nil {
+		log.Printf("Error cancelling collection: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel collection")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "direct_debit.cancel", EntityType: "direct_debit_collection", EntityID: strconv.FormatInt(c.CollectionID, 10),
+		Before: map[string]string{"status": c.Status},
+		After:  map[string]string{"status": directdebit.StatusCancelled, "reason": req.Reason, "cancelled_for": party}})
+	if err != nil {
+		log.Printf("Error writing audit log for collection cancellation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel collection")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing collection cancellation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel collection")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"collection_id": c.CollectionID, "status": directdebit.StatusCancelled})
+}
+
+// RefundCollection gives a collected payment back to the customer, no questions asked,
+// within directdebit.RefundWindowDays of its due date. Later claims go through a dispute.
+func RefundCollection(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.RefundCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > 255 {
+		respondWithError(w, http.StatusBadRequest, "Reason must be at most 255 characters")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for direct debit refund: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to refund collection")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	c, m, debtor, creditor, ok := lockCollection(w, r, tx, "Failed to refund collection")
+	if !ok {
+		return
+	}
+	if allowed, err := actsFor(tx, actor, debtor, true); err != nil || !allowed {
+		if err != nil {
+			log.Printf("Error checking account holder: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to refund collection")
+		} else {
+			respondWithError(w, http.StatusForbidden, "Only the account holder can have a collection refunded")
+		}
+		return
+	}
+	if c.Status != directdebit.StatusCollected {
+		respondWithError(w, http.StatusConflict, "Only collected payments can be refunded; collection is "+c.Status)
+		return
+	}
+	today, err := eod.BusinessDate(tx)
+	if err != nil {
+		log.Printf("Error getting business date for direct debit refund: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to refund collection")
+		return
+	}
+	if today.After(c.DueDate.AddDate(0, 0, directdebit.RefundWindowDays)) {
+		respondWithErrorCode(w, http.StatusConflict, "refund_window_passed",
+			fmt.Sprintf("Collections can only be refunded within %d days; file a dispute instead", directdebit.RefundWindowDays))
+		return
+	}
+
+	debit, err := ledger.LockEntry(tx, *c.TransactionID)
+	if err != nil {
+		log.Printf("Error fetching debit of collection: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to refund collection")
+		return
+	}
+	if debit.ReversedBy != nil {
+		respondWithErrorCode(w, http.StatusConflict, "already_reversed", fmt.Sprintf("Transaction %d was already reversed by transaction %d", debit.TransactionID, *debit.ReversedBy))
+		return
+	}
+	// A dispute of the same debit would give the money back twice
+	disputeID, err := disputes.Unresolved(tx, debit.TransactionID)
+	if err != nil {
+		log.Printf("Error checking disputes of collection: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to refund collection")
+		return
+	}
+	if disputeID != 0 {
+		respondWithErrorCode(w, http.StatusConflict, "disputed", fmt.Sprintf("Transaction %d is under dispute %d", debit.TransactionID, disputeID))
+		return
+	}
+	var upheld bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM disputes WHERE transaction_id = ? AND status = ?)", debit.TransactionID, disputes.StatusUpheld).Scan(&upheld)
+	if err != nil {
+		log.Printf("Error checking upheld disputes of collection: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to refund collection")
+		return
+	}
+	if upheld {
+		respondWithErrorCode(w, http.StatusConflict, "disputed", fmt.Sprintf("Transaction %d was already credited by an upheld dispute", debit.TransactionID))
+		return
+	}
+	for _, a := range []models.Account{debtor, creditor} {
+		if a.Status == ledger.StatusFrozen || a.Status == ledger.StatusClosed {
+			refuseAccountStatus(w, a)
+			return
+		}
+	}
+
+	refundID, err := directdebit.Refund(tx, c, m)
+	if err != nil {
+		log.Printf("Error refunding collection: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to refund collection")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "direct_debit.refund", EntityType: "direct_debit_collection", EntityID: strconv.FormatInt(c.CollectionID, 10),
+		Before: map[string]string{"status": c.Status},
+		After:  map[string]interface{}{"status": directdebit.StatusRefunded, "refund_transaction_id": refundID, "reason": req.Reason}})
+	if err != nil {
+		log.Printf("Error writing audit log for direct debit refund: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to refund collection")
+		return
+	}
+	err = outbox.Enqueue(tx, outbox.EventDirectDebitRefunded, debtor.AccountNumber, map[string]interface{}{
+		"collection_id":           c.CollectionID,
+		"mandate_id":              m.MandateID,
+		"creditor_identifier":     m.CreditorIdentifier,
+		"creditor_account_number": creditor.AccountNumber,
+		"reference":               m.Reference,
+		"account_number":          debtor.AccountNumber,
+		"amount":                  c.Amount,
+		"refund_transaction_id":   refundID,
+	})
+	if err != nil {
+		log.Printf("Error writing direct debit refund event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to refund collection")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing direct debit refund: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to refund collection")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{"collection_id": c.CollectionID, "refund_transaction_id": refundID, "amount": c.Amount})
+}
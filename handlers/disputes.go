@@ -0,0 +1,942 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"banking-app/approvals"
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/blobstore"
+	"banking-app/credit"
+	"banking-app/db"
+	"banking-app/disputes"
+	"banking-app/eod"
+	"banking-app/ledger"
+	"banking-app/models"
+	"banking-app/outbox"
+
+	"github.com/gorilla/mux"
+)
+
+const disputeEvidenceColumns = "evidence_id, dispute_id, description, file_name, content_type, size_bytes, sha256, uploaded_by, created_at"
+
+func scanDisputeEvidence(row interface{ Scan(...interface{}) error }, e *models.DisputeEvidence) error {
+	return row.Scan(&e.EvidenceID, &e.DisputeID, &e.Description, &e.FileName, &e.ContentType, &e.SizeBytes, &e.SHA256, &e.UploadedBy, &e.CreatedAt)
+}
+
+// disputeEvent is the outbox payload describing the current state of a dispute
+func disputeEvent(d models.Dispute) map[string]interface{} {
+	return map[string]interface{}{
+		"account_number":        d.AccountNumber,
+		"dispute_id":            d.DisputeID,
+		"transaction_id":        d.TransactionID,
+		"card_transaction_id":   d.CardTransactionID,
+		"reason_code":           d.ReasonCode,
+		"amount":                d.Amount,
+		"status":                d.Status,
+		"credit_transaction_id": d.CreditTransactionID,
+		"credit_reversal_id":    d.CreditReversalID,
+	}
+}
+
+// disputedDebit is the transaction a dispute is filed against: a debit of a deposit
+// account, or a charge on a credit line kept in credit_transactions
+type disputedDebit struct {
+	Column          string // The disputes column referencing it
+	ID              int64
+	CreditAccountID *int // Set for a card charge
+	AccountID       int  // The account, or the account the card is issued on
+	Type            string
+	Amount          float64
+	BookingDate     time.Time
+	ReversedBy      *int64
+}
+
+// lockDisputedDebit locks the transaction a dispute is filed against, which serializes
+// disputes of it. It writes an error response if the transaction cannot be loaded.
+func lockDisputedDebit(w http.ResponseWriter, tx *sql.Tx, req models.CreateDisputeRequest) (disputedDebit, bool) {
+	var debit disputedDebit
+	var err error
+	if req.CardTransactionID != 0 {
+		debit.Column, debit.ID = "card_transaction_id", req.CardTransactionID
+		err = tx.QueryRow(`SELECT ct.credit_account_id, c.account_id, ct.type, ct.amount, DATE(ct.created_at)
+			FROM credit_transactions ct
+			JOIN credit_accounts ca ON ca.credit_account_id = ct.credit_account_id
+			JOIN cards c ON c.card_id = ca.card_id
+			WHERE ct.credit_transaction_id = ? FOR UPDATE OF ct`, req.CardTransactionID).
+			Scan(&debit.CreditAccountID, &debit.AccountID, &debit.Type, &debit.Amount, &debit.BookingDate)
+	} else {
+		debit.Column, debit.ID = "transaction_id", req.TransactionID
+		var entry ledger.Entry
+		if entry, err = ledger.LockEntry(tx, req.TransactionID); err == nil {
+			debit.AccountID, debit.Type, debit.Amount, debit.ReversedBy = entry.AccountID, entry.Type, entry.Amount, entry.ReversedBy
+			err = tx.QueryRow("SELECT booking_date FROM transactions WHERE transaction_id = ?", entry.TransactionID).Scan(&debit.BookingDate)
+		}
+	}
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Transaction not found")
+		return debit, false
+	}
+	if err != nil {
+		log.Printf("Error fetching transaction for dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file dispute")
+		return debit, false
+	}
+	return debit, true
+}
+
+// CreateDispute files a dispute of a debit on an account the customer may move money
+// from, or of a charge on a credit card issued on such an account. The dispute covers the
+// whole transaction unless a smaller amount is given, and must be filed within
+// disputes.FilingWindowDays of the transaction's booking date.
+func CreateDispute(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.CreateDisputeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if (req.TransactionID == 0) == (req.CardTransactionID == 0) {
+		respondWithError(w, http.StatusBadRequest, "Exactly one of transaction_id and card_transaction_id is required")
+		return
+	}
+	if !disputes.IsReason(req.ReasonCode) {
+		respondWithError(w, http.StatusBadRequest, "reason_code must be one of 'unauthorized', 'duplicate', 'incorrect_amount', 'not_received', 'not_as_described', 'cancelled_recurring'")
+		return
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	if req.Description == "" || len(req.Description) > 1000 {
+		respondWithError(w, http.StatusBadRequest, "A description of at most 1000 characters is required")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file dispute")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	debit, ok := lockDisputedDebit(w, tx, req)
+	if !ok {
+		return
+	}
+	account, err := ledger.LockAccountByID(tx, debit.AccountID)
+	if err != nil {
+		log.Printf("Error locking account for dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file dispute")
+		return
+	}
+	if _, ok := authorizeAccount(w, tx, actor, account, true); !ok {
+		return
+	}
+	if account.AccountType == ledger.AccountTerm {
+		respondWithError(w, http.StatusConflict, "Movements of a term deposit cannot be disputed")
+		return
+	}
+	if debit.CreditAccountID != nil && !disputes.CardDisputable(debit.Type) || debit.CreditAccountID == nil && !disputes.Disputable(debit.Type) {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("A %s transaction cannot be disputed", debit.Type))
+		return
+	}
+	if debit.ReversedBy != nil {
+		respondWithErrorCode(w, http.StatusConflict, "already_reversed", fmt.Sprintf("Transaction %d was already reversed by transaction %d", debit.ID, *debit.ReversedBy))
+		return
+	}
+
+	today, err := eod.BusinessDate(tx)
+	if err != nil {
+		log.Printf("Error getting business date for dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file dispute")
+		return
+	}
+	if debit.BookingDate.AddDate(0, 0, disputes.FilingWindowDays).Before(today) {
+		respondWithErrorCode(w, http.StatusConflict, "filing_window_passed",
+			fmt.Sprintf("Transactions can only be disputed within %d days", disputes.FilingWindowDays))
+		return
+	}
+
+	var open int64
+	if debit.CreditAccountID != nil {
+		open, err = disputes.UnresolvedCard(tx, debit.ID)
+	} else {
+		open, err = disputes.Unresolved(tx, debit.ID)
+	}
+	if err != nil {
+		log.Printf("Error checking disputes of transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file dispute")
+		return
+	}
+	if open != 0 {
+		respondWithErrorCode(w, http.StatusConflict, "already_disputed", fmt.Sprintf("Transaction %d is already under dispute %d", debit.ID, open))
+		return
+	}
+	// What an upheld dispute already gave back cannot be disputed again
+	var upheld float64
+	err = tx.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM disputes WHERE "+debit.Column+" = ? AND status = ?",
+		debit.ID, disputes.StatusUpheld).Scan(&upheld)
+	if err != nil {
+		log.Printf("Error summing upheld disputes: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file dispute")
+		return
+	}
+	remaining := ledger.Round(debit.Amount - upheld)
+	amount := remaining
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+	if amount <= 0 || amount > remaining {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Amount must be positive and at most %.2f", remaining))
+		return
+	}
+
+	result, err := tx.Exec("INSERT INTO disputes ("+debit.Column+", credit_account_id, account_id, reason_code, amount, description, filed_by) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		debit.ID, debit.CreditAccountID, account.AccountID, req.ReasonCode, amount, req.Description, actor.UserID)
+	if err != nil {
+		log.Printf("Error recording dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file dispute")
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file dispute")
+		return
+	}
+	if err := disputes.AddEvent(tx, id, "", disputes.StatusOpen, actor.UserID, req.Description); err != nil {
+		log.Printf("Error recording dispute event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file dispute")
+		return
+	}
+	dispute, err := disputes.Lock(tx, id)
+	if err != nil {
+		log.Printf("Error reading back dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file dispute")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "dispute.file", EntityType: "dispute", EntityID: strconv.FormatInt(id, 10),
+		After: map[string]interface{}{debit.Column: debit.ID, "reason_code": req.ReasonCode, "amount": amount}})
+	if err != nil {
+		log.Printf("Error writing audit log for dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file dispute")
+		return
+	}
+	if err := outbox.Enqueue(tx, outbox.EventDisputed, account.AccountNumber, disputeEvent(dispute)); err != nil {
+		log.Printf("Error writing dispute event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file dispute")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file dispute")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, dispute)
+}
+
+// GetDisputes lists disputes, oldest first. Staff see the disputes of their branch,
+// filtered with ?status=, ?assigned_to= (an employee ID, or "none") and ?account_number=;
+// customers see the disputes of the accounts they hold.
+func GetDisputes(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+
+	query := "SELECT " + disputes.Columns + " FROM " + disputes.Tables + " WHERE 1 = 1"
+	var args []interface{}
+	switch {
+	case actor.IsAdmin():
+	case actor.IsEmployee() && actor.BranchID != nil:
+		query += " AND a.branch_id = ?"
+		args = append(args, *actor.BranchID)
+	case actor.CustomerID != nil:
+		query += " AND (a.customer_id = ? OR d.account_id IN (SELECT account_id FROM account_holders WHERE customer_id = ?))"
+		args = append(args, *actor.CustomerID, *actor.CustomerID)
+	default:
+		respondWithError(w, http.StatusForbidden, "Not allowed to view disputes")
+		return
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " AND d.status = ?"
+		args = append(args, status)
+	}
+	if number := r.URL.Query().Get("account_number"); number != "" {
+		query += " AND a.account_number = ?"
+		args = append(args, number)
+	}
+	if assigned := r.URL.Query().Get("assigned_to"); assigned == "none" {
+		query += " AND d.assigned_to IS NULL"
+	} else if assigned != "" {
+		employeeID, err := strconv.Atoi(assigned)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "assigned_to must be an employee ID or 'none'")
+			return
+		}
+		query += " AND d.assigned_to = ?"
+		args = append(args, employeeID)
+	}
+	query += " ORDER BY d.created_at, d.dispute_id LIMIT 500"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Printf("Error listing disputes: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve disputes")
+		return
+	}
+	defer rows.Close()
+
+	list := []models.Dispute{}
+	for rows.Next() {
+		var d models.Dispute
+		if err := disputes.Scan(rows, &d); err != nil {
+			log.Printf("Error scanning dispute: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve disputes")
+			return
+		}
+		list = append(list, d)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating disputes: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve disputes")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// getDispute loads the dispute in the route and checks the actor may see it: staff of
+// the account's branch or one of its holders. It writes an error response if not.
+func getDispute(w http.ResponseWriter, r *http.Request, actor auth.Actor, failure string) (models.Dispute, bool) {
+	var d models.Dispute
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid dispute ID")
+		return d, false
+	}
+	if err := disputes.Scan(db.DB.QueryRow("SELECT "+disputes.Columns+" FROM "+disputes.Tables+" WHERE d.dispute_id = ?", id), &d); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Dispute not found")
+		} else {
+			log.Printf("Error fetching dispute: %v", err)
+			respondWithError(w, http.StatusInternalServerError, failure)
+		}
+		return d, false
+	}
+	account, err := ledger.GetAccount(d.AccountNumber)
+	if err != nil {
+		log.Printf("Error fetching account of dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, failure)
+		return d, false
+	}
+	_, ok := authorizeAccount(w, db.DB, actor, account, false)
+	return d, ok
+}
+
+// lockDispute locks the dispute in the route, its account and, for a card dispute, the
+// credit line, checking the actor is staff of the account's branch or, with sign set, a
+// holder who may move money from it. It refuses resolved disputes, writing an error
+// response if not allowed.
+func lockDispute(w http.ResponseWriter, r *http.Request, tx *sql.Tx, actor auth.Actor, sign bool, failure string) (models.Dispute, models.Account, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid dispute ID")
+		return models.Dispute{}, models.Account{}, false
+	}
+	return lockDisputeByID(w, tx, actor, id, sign, failure)
+}
+
+// lockDisputeByID is lockDispute for a dispute known by its ID
+func lockDisputeByID(w http.ResponseWriter, tx *sql.Tx, actor auth.Actor, id int64, sign bool, failure string) (models.Dispute, models.Account, bool) {
+	var account models.Account
+	d, err := disputes.Lock(tx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Dispute not found")
+		} else {
+			log.Printf("Error fetching dispute: %v", err)
+			respondWithError(w, http.StatusInternalServerError, failure)
+		}
+		return d, account, false
+	}
+	if account, err = ledger.LockAccountByID(tx, d.AccountID); err != nil {
+		log.Printf("Error locking account of dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, failure)
+		return d, account, false
+	}
+	if _, ok := authorizeAccount(w, tx, actor, account, sign); !ok {
+		return d, account, false
+	}
+	if disputes.IsFinal(d.Status) {
+		respondWithError(w, http.StatusConflict, "Dispute has already been "+d.Status)
+		return d, account, false
+	}
+	if d.CreditAccountID != nil {
+		if _, err := credit.Lock(tx, *d.CreditAccountID); err != nil {
+			log.Printf("Error locking credit account of dispute: %v", err)
+			respondWithError(w, http.StatusInternalServerError, failure)
+			return d, account, false
+		}
+	}
+	return d, account, true
+}
+
+// GetDispute returns a dispute with its history and evidence
+func GetDispute(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	d, ok := getDispute(w, r, actor, "Failed to retrieve dispute")
+	if !ok {
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT event_id, from_status, to_status, actor_user_id, note, created_at
+		FROM dispute_events WHERE dispute_id = ? ORDER BY event_id`, d.DisputeID)
+	if err != nil {
+		log.Printf("Error fetching dispute events: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve dispute")
+		return
+	}
+	defer rows.Close()
+	d.Events = []models.DisputeEvent{}
+	for rows.Next() {
+		var e models.DisputeEvent
+		if err := rows.Scan(&e.EventID, &e.FromStatus, &e.ToStatus, &e.ActorUserID, &e.Note, &e.CreatedAt); err != nil {
+			log.Printf("Error scanning dispute event: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve dispute")
+			return
+		}
+		d.Events = append(d.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating dispute events: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve dispute")
+		return
+	}
+
+	evidence, err := db.DB.Query("SELECT "+disputeEvidenceColumns+" FROM dispute_evidence WHERE dispute_id = ? ORDER BY evidence_id", d.DisputeID)
+	if err != nil {
+		log.Printf("Error fetching dispute evidence: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve dispute")
+		return
+	}
+	defer evidence.Close()
+	d.Evidence = []models.DisputeEvidence{}
+	for evidence.Next() {
+		var e models.DisputeEvidence
+		if err := scanDisputeEvidence(evidence, &e); err != nil {
+			log.Printf("Error scanning dispute evidence: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve dispute")
+			return
+		}
+		d.Evidence = append(d.Evidence, e)
+	}
+	if err := evidence.Err(); err != nil {
+		log.Printf("Error iterating dispute evidence: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve dispute")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, d)
+}
+
+// AssignDispute assigns an unresolved dispute to an employee
+func AssignDispute(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can assign disputes")
+		return
+	}
+	var req models.AssignDisputeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for dispute assignment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign dispute")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM employees WHERE employee_id = ?)", req.EmployeeID).Scan(&exists); err != nil {
+		log.Printf("Error checking employee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign dispute")
+		return
+	}
+	if !exists {
+		respondWithError(w, http.StatusBadRequest, "Employee not found")
+		return
+	}
+	d, _, ok := lockDispute(w, r, tx, actor, false, "Failed to assign dispute")
+	if !ok {
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE disputes SET assigned_to = ? WHERE dispute_id = ?", req.EmployeeID, d.DisputeID); err != nil {
+		log.Printf("Error assigning dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign dispute")
+		return
+	}
+	if err := disputes.AddEvent(tx, d.DisputeID, d.Status, d.Status, actor.UserID, fmt.Sprintf("Assigned to employee %d", req.EmployeeID)); err != nil {
+		log.Printf("Error recording dispute event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign dispute")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "dispute.assign", EntityType: "dispute", EntityID: strconv.FormatInt(d.DisputeID, 10),
+		Before: map[string]interface{}{"assigned_to": d.AssignedTo},
+		After:  map[string]interface{}{"assigned_to": req.EmployeeID}})
+	if err != nil {
+		log.Printf("Error writing audit log for dispute assignment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign dispute")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing dispute assignment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign dispute")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"dispute_id": d.DisputeID, "assigned_to": req.EmployeeID})
+}
+
+// CreditDispute credits the disputed amount to the account, or the credit line of a card
+// dispute, while the dispute is investigated. The credit stays provisional until the dispute is upheld.
+func CreditDispute(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can credit disputes")
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid dispute ID")
+		return
+	}
+	var req models.DisputeCreditRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for dispute credit: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to credit dispute")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	creditDispute(w, r, tx, actor, id, req, 0)
+}
+
+// creditDispute credits dispute id inside tx, committing it and writing the response.
+// approved is the approval request being executed, 0 for a new credit.
+func creditDispute(w http.ResponseWriter, r *http.Request, tx *sql.Tx, actor auth.Actor, id int64, req models.DisputeCreditRequest, approved int64) {
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > 1000 {
+		respondWithError(w, http.StatusBadRequest, "Note must be at most 1000 characters")
+		return
+	}
+
+	d, account, ok := lockDisputeByID(w, tx, actor, id, false, "Failed to credit dispute")
+	if !ok {
+		return
+	}
+	if d.CreditTransactionID != nil {
+		respondWithErrorCode(w, http.StatusConflict, "already_credited", fmt.Sprintf("Dispute was already credited by transaction %d", *d.CreditTransactionID))
+		return
+	}
+	if !ledger.CanCredit(account) {
+		refuseAccountStatus(w, account)
+		return
+	}
+
+	if holdForApproval(w, r, tx, actor, approved, approvals.Pending{Operation: approvals.OpDisputeCredit, EntityType: "dispute", EntityID: strconv.FormatInt(d.DisputeID, 10),
+		BranchID: account.BranchID, Amount: d.Amount, RouteVars: map[string]string{"id": strconv.FormatInt(d.DisputeID, 10)}, Body: req}) {
+		return
+	}
+
+	creditID, err := disputes.Credit(tx, d)
+	if err != nil {
+		log.Printf("Error crediting dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to credit dispute")
+		return
+	}
+	d.CreditTransactionID = &creditID
+	note := fmt.Sprintf("Provisional credit of %.2f", d.Amount)
+	if req.Note != "" {
+		note += ": " + req.Note
+	}
+	if err := disputes.AddEvent(tx, d.DisputeID, d.Status, d.Status, actor.UserID, note); err != nil {
+		log.Printf("Error recording dispute event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to credit dispute")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "dispute.credit", EntityType: "dispute", EntityID: strconv.FormatInt(d.DisputeID, 10),
+		After: map[string]interface{}{"credit_transaction_id": creditID, "amount": d.Amount, "note": req.Note}})
+	if err != nil {
+		log.Printf("Error writing audit log for dispute credit: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to credit dispute")
+		return
+	}
+	if err := outbox.Enqueue(tx, outbox.EventDisputed, account.AccountNumber, disputeEvent(d)); err != nil {
+		log.Printf("Error writing dispute event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to credit dispute")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing dispute credit: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to credit dispute")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{"dispute_id": d.DisputeID, "credit_transaction_id": creditID, "amount": d.Amount})
+}
+
+// TransitionDispute moves a dispute through its workflow. Customers can only withdraw
+// their dispute. Upholding a dispute needs its credit to have been posted and makes it
+// final; rejecting or withdrawing it reverses the credit. Raising a chargeback requires
+// the reference given by the merchant's bank.
+func TransitionDispute(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.TransitionDisputeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if !actor.IsEmployee() && req.Status != disputes.StatusWithdrawn {
+		respondWithError(w, http.StatusForbidden, "Customers can only withdraw a dispute")
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	req.ChargebackReference = strings.TrimSpace(req.ChargebackReference)
+	if req.Note == "" || len(req.Note) > 1000 {
+		respondWithError(w, http.StatusBadRequest, "A note of at most 1000 characters is required")
+		return
+	}
+	if req.Status == disputes.StatusChargeback && (req.ChargebackReference == "" || len(req.ChargebackReference) > 64) {
+		respondWithError(w, http.StatusBadRequest, "A chargeback requires a reference of at most 64 characters")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for dispute transition: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update dispute")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	d, account, ok := lockDispute(w, r, tx, actor, true, "Failed to update dispute")
+	if !ok {
+		return
+	}
+	current := d.Status
+	if !disputes.CanTransition(current, req.Status) {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Dispute cannot move from '%s' to '%s'", current, req.Status))
+		return
+	}
+
+	switch req.Status {
+	case disputes.StatusUpheld:
+		if d.CreditTransactionID == nil {
+			respondWithErrorCode(w, http.StatusConflict, "not_credited", "Credit the dispute before upholding it")
+			return
+		}
+	case disputes.StatusRejected, disputes.StatusWithdrawn:
+		if d.CreditTransactionID != nil {
+			// Taking the credit back is a correction: it may overdraw, but not pass a freeze or closure
+			if account.Status == ledger.StatusFrozen || account.Status == ledger.StatusClosed {
+				refuseAccountStatus(w, account)
+				return
+			}
+			reversalID, err := disputes.ReverseCredit(tx, d, req.Status)
+			if err != nil {
+				log.Printf("Error reversing dispute credit: %v", err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to update dispute")
+				return
+			}
+			d.CreditReversalID = &reversalID
+		}
+	}
+
+	switch {
+	case disputes.IsFinal(req.Status):
+		_, err = tx.Exec("UPDATE disputes SET status = ?, resolution_note = ?, resolved_at = NOW() WHERE dispute_id = ?", req.Status, req.Note, d.DisputeID)
+	case req.Status == disputes.StatusChargeback:
+		_, err = tx.Exec("UPDATE disputes SET status = ?, chargeback_reference = ? WHERE dispute_id = ?", req.Status, req.ChargebackReference, d.DisputeID)
+	case req.Status == disputes.StatusInvestigating && d.AssignedTo == nil && actor.EmployeeID != nil:
+		// Whoever picks up an unassigned dispute owns it
+		_, err = tx.Exec("UPDATE disputes SET status = ?, assigned_to = ? WHERE dispute_id = ?", req.Status, *actor.EmployeeID, d.DisputeID)
+	default:
+		_, err = tx.Exec("UPDATE disputes SET status = ? WHERE dispute_id = ?", req.Status, d.DisputeID)
+	}
+	if err != nil {
+		log.Printf("Error updating dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update dispute")
+		return
+	}
+	if err := disputes.AddEvent(tx, d.DisputeID, current, req.Status, actor.UserID, req.Note); err != nil {
+		log.Printf("Error recording dispute event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update dispute")
+		return
+	}
+	if d, err = disputes.Lock(tx, d.DisputeID); err != nil {
+		log.Printf("Error reading back dispute: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update dispute")
+		return
+	}
+
+	after := map[string]interface{}{"status": req.Status, "note": req.Note}
+	if req.Status == disputes.StatusChargeback {
+		after["chargeback_reference"] = req.ChargebackReference
+	}
+	if d.CreditReversalID != nil {
+		after["credit_reversal_id"] = *d.CreditReversalID
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "dispute." + req.Status, EntityType: "dispute", EntityID: strconv.FormatInt(d.DisputeID, 10),
+		Before: map[string]string{"status": current}, After: after})
+	if err != nil {
+		log.Printf("Error writing audit log for dispute transition: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update dispute")
+		return
+	}
+	if err := outbox.Enqueue(tx, outbox.EventDisputed, account.AccountNumber, disputeEvent(d)); err != nil {
+		log.Printf("Error writing dispute event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update dispute")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing dispute transition: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update dispute")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, d)
+}
+
+// UploadDisputeEvidence attaches a file sent as multipart form data with fields "file"
+// and an optional "description" to an unresolved dispute. Evidence from the customer
+// answers a request for information and puts the dispute back under investigation.
+func UploadDisputeEvidence(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	d, ok := getDispute(w, r, actor, "Failed to upload evidence")
+	if !ok {
+		return
+	}
+	if disputes.IsFinal(d.Status) {
+		respondWithError(w, http.StatusConflict, "Dispute has already been "+d.Status)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxDocumentSize+1<<20) // Room for the multipart envelope
+	if err := r.ParseMultipartForm(maxDocumentSize); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Evidence must be multipart form data of at most 10 MB")
+		return
+	}
+	description := strings.TrimSpace(r.FormValue("description"))
+	if len(description) > 255 {
+		respondWithError(w, http.StatusBadRequest, "Description must be at most 255 characters")
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "A file is required")
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, maxDocumentSize+1))
+	if err != nil {
+		log.Printf("Error reading uploaded evidence: %v", err)
+		respondWithError(w, http.StatusBadRequest, "Failed to read file")
+		return
+	}
+	if len(content) == 0 || len(content) > maxDocumentSize {
+		respondWithError(w, http.StatusBadRequest, "File must be between 1 byte and 10 MB")
+		return
+	}
+	// Trust the bytes, not the client's declared type
+	contentType := http.DetectContentType(content)
+	if !documentContentTypes[contentType] {
+		respondWithError(w, http.StatusBadRequest, "File must be a PDF, JPEG or PNG")
+		return
+	}
+	fileName := filepath.Base(header.Filename)
+	if len(fileName) > 255 {
+		fileName = fileName[:255]
+	}
+	sum := sha256.Sum256(content)
+
+	key, err := disputes.NewStorageKey(d.DisputeID)
+	if err != nil {
+		log.Printf("Error creating evidence key: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload evidence")
+		return
+	}
+	if err := disputes.Evidence.Put(key, bytes.NewReader(content)); err != nil {
+		log.Printf("Error storing evidence: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload evidence")
+		return
+	}
+	// The stored file is orphaned unless the row referencing it is committed
+	committed := false
+	defer func() {
+		if !committed {
+			if err := disputes.Evidence.Delete(key); err != nil {
+				log.Printf("Error removing orphaned evidence %s: %v", key, err)
+			}
+		}
+	}()
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for evidence upload: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload evidence")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	// The dispute may have been resolved while the file was stored
+	d, account, ok := lockDispute(w, r, tx, actor, false, "Failed to upload evidence")
+	if !ok {
+		return
+	}
+	result, err := tx.Exec(`INSERT INTO dispute_evidence (dispute_id, description, file_name, content_type, size_bytes, sha256, storage_key, uploaded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, d.DisputeID, description, fileName, contentType, len(content), hex.EncodeToString(sum[:]), key, actor.UserID)
+	if err != nil {
+		log.Printf("Error recording evidence: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload evidence")
+		return
+	}
+	evidenceID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for evidence: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload evidence")
+		return
+	}
+
+	status := d.Status
+	if !actor.IsEmployee() && d.Status == disputes.StatusAwaitingCustomer {
+		status = disputes.StatusInvestigating
+		if _, err := tx.Exec("UPDATE disputes SET status = ? WHERE dispute_id = ?", status, d.DisputeID); err != nil {
+			log.Printf("Error updating dispute: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to upload evidence")
+			return
+		}
+	}
+	if err := disputes.AddEvent(tx, d.DisputeID, d.Status, status, actor.UserID, fmt.Sprintf("Evidence %d added: %s", evidenceID, fileName)); err != nil {
+		log.Printf("Error recording dispute event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload evidence")
+		return
+	}
+
+	var evidence models.DisputeEvidence
+	if err := scanDisputeEvidence(tx.QueryRow("SELECT "+disputeEvidenceColumns+" FROM dispute_evidence WHERE evidence_id = ?", evidenceID), &evidence); err != nil {
+		log.Printf("Error reading back evidence: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload evidence")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "dispute_evidence.upload", EntityType: "dispute_evidence", EntityID: strconv.FormatInt(evidenceID, 10),
+		After: map[string]interface{}{"dispute_id": d.DisputeID, "sha256": evidence.SHA256, "dispute_status": status}})
+	if err != nil {
+		log.Printf("Error writing audit log for evidence upload: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload evidence")
+		return
+	}
+	if status != d.Status {
+		d.Status = status
+		if err := outbox.Enqueue(tx, outbox.EventDisputed, account.AccountNumber, disputeEvent(d)); err != nil {
+			log.Printf("Error writing dispute event: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to upload evidence")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing evidence upload: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload evidence")
+		return
+	}
+	committed = true
+	respondWithJSON(w, http.StatusCreated, evidence)
+}
+
+// GetDisputeEvidenceContent downloads the stored file of a dispute's evidence
+func GetDisputeEvidenceContent(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	d, ok := getDispute(w, r, actor, "Failed to retrieve evidence")
+	if !ok {
+		return
+	}
+	evidenceID, err := strconv.ParseInt(mux.Vars(r)["evidenceId"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid evidence ID")
+		return
+	}
+
+	var key, fileName, contentType string
+	err = db.DB.QueryRow("SELECT storage_key, file_name, content_type FROM dispute_evidence WHERE evidence_id = ? AND dispute_id = ?",
+		evidenceID, d.DisputeID).Scan(&key, &fileName, &contentType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Evidence not found")
+		} else {
+			log.Printf("Error fetching evidence: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve evidence")
+		}
+		return
+	}
+	content, err := disputes.Evidence.Get(key)
+	if err != nil {
+		if err == blobstore.ErrNotFound {
+			log.Printf("Evidence %d is missing from the blob store (key %s)", evidenceID, key)
+		} else {
+			log.Printf("Error opening evidence %d: %v", evidenceID, err)
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve evidence")
+		return
+	}
+	defer content.Close()
+
+	if !auditAccess(w, r, audit.Entry{Action: "dispute_evidence.view", EntityType: "dispute_evidence", EntityID: strconv.FormatInt(evidenceID, 10)}, "Failed to retrieve evidence") {
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(fileName))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("Error sending evidence %d: %v", evidenceID, err)
+	}
+}
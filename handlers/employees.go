@@ -0,0 +1,558 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"banking-app/audit"
+	"banking-app/db"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+// employeeIDFromRequest parses the {id} route variable, writing a 400 response if it is invalid
+func employeeIDFromRequest(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid employee ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// wouldCreateCycle reports whether making managerID the manager of employeeID would
+// create a loop, i.e. employeeID already appears in managerID's management chain.
+// The chain is locked so a concurrent assignment cannot close a loop in the meantime.
+func wouldCreateCycle(tx *sql.Tx, employeeID, managerID int) (bool, error) {
+	if employeeID == managerID {
+		return true, nil
+	}
+	// UNION (not UNION ALL) stops the recursion even if the data already contains a loop
+	rows, err := tx.Query(`WITH RECURSIVE chain (employee_id, manager_id) AS (
+			SELECT employee_id, manager_id FROM employees WHERE employee_id = ?
+			UNION
+			SELECT e.employee_id, e.manager_id FROM employees e JOIN chain c ON e.employee_id = c.manager_id
+		)
+		SELECT employee_id FROM employees WHERE employee_id IN (SELECT employee_id FROM chain) FOR UPDATE`, managerID)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	cycle := false
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return false, err
+		}
+		if id == employeeID {
+			cycle = true
+		}
+	}
+	return cycle, rows.Err()
+}
+
+// CreateEmployee handles the creation of a new employee
+func CreateEmployee(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	var req models.CreateEmployeeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.Name, req.Position = strings.TrimSpace(req.Name), strings.TrimSpace(req.Position)
+	if req.Name == "" || req.Position == "" {
+		respondWithError(w, http.StatusBadRequest, "Name and position are required")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for employee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create employee")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var branchExists bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM branches WHERE branch_id = ?)", req.BranchID).Scan(&branchExists)
+	if err != nil || !branchExists {
+		respondWithError(w, http.StatusBadRequest, "Branch does not exist")
+		return
+	}
+	if req.ManagerID != nil {
+		var managerExists bool
+		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM employees WHERE employee_id = ?)", *req.ManagerID).Scan(&managerExists)
+		if err != nil || !managerExists {
+			respondWithError(w, http.StatusBadRequest, "Manager does not exist")
+			return
+		}
+	}
+
+	result, err := tx.Exec("INSERT INTO employees (name, position, branch_id, manager_id) VALUES (?, ?, ?, ?)",
+		req.Name, req.Position, req.BranchID, req.ManagerID)
+	if err != nil {
+		log.Printf("Error creating employee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create employee")
+		return
+	}
+
+	employeeID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for employee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get employee ID")
+		return
+	}
+
+	employee := models.Employee{
+		EmployeeID: int(employeeID),
+		Name:       req.Name,
+		Position:   req.Position,
+		BranchID:   req.BranchID,
+		ManagerID:  req.ManagerID,
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "employee.create", EntityType: "employee", EntityID: strconv.Itoa(employee.EmployeeID), After: employee})
+	if err != nil {
+		log.Printf("Error writing audit log for employee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create employee")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing employee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create employee")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, employee)
+}
+
+// GetEmployees lists employees. Administrators see everyone and may filter with
+// ?branch_id=; employees see the staff of their own branch.
+func GetEmployees(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can list employees")
+		return
+	}
+
+	query := "SELECT employee_id, name, position, branch_id, manager_id FROM employees"
+	var args []interface{}
+	if !actor.IsAdmin() {
+		query += " WHERE branch_id = ?"
+		args = append(args, *actor.BranchID)
+	} else if branch := r.URL.Query().Get("branch_id"); branch != "" {
+		branchID, err := strconv.Atoi(branch)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid branch ID")
+			return
+		}
+		query += " WHERE branch_id = ?"
+		args = append(args, branchID)
+	}
+
+	rows, err := db.DB.Query(query+" ORDER BY employee_id", args...)
+	if err != nil {
+		log.Printf("Error listing employees: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve employees")
+		return
+	}
+	defer rows.Close()
+
+	employees := []models.Employee{}
+	for rows.Next() {
+		var e models.Employee
+		if err := rows.Scan(&e.EmployeeID, &e.Name, &e.Position, &e.BranchID, &e.ManagerID); err != nil {
+			log.Printf("Error scanning employee: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve employees")
+			return
+		}
+		employees = append(employees, e)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating employees: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve employees")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, employees)
+}
+
+// GetEmployeeByID retrieves an employee by their ID
+func GetEmployeeByID(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can view employees")
+		return
+	}
+	id, ok := employeeIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var e models.Employee
+	err := db.DB.QueryRow("SELECT employee_id, name, position, branch_id, manager_id FROM employees WHERE employee_id = ?", id).Scan(
+		&e.EmployeeID, &e.Name, &e.Position, &e.BranchID, &e.ManagerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Employee not found")
+		} else {
+			log.Printf("Error getting employee by ID: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve employee")
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, e)
+}
+
+// UpdateEmployee changes the name and position of an employee
+func UpdateEmployee(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	id, ok := employeeIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateEmployeeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.Name, req.Position = strings.TrimSpace(req.Name), strings.TrimSpace(req.Position)
+	if req.Name == "" || req.Position == "" {
+		respondWithError(w, http.StatusBadRequest, "Name and position are required")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for employee update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update employee")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var before models.UpdateEmployeeRequest
+	err = tx.QueryRow("SELECT name, position FROM employees WHERE employee_id = ? FOR UPDATE", id).Scan(&before.Name, &before.Position)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Employee not found")
+		} else {
+			log.Printf("Error getting employee for update: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update employee")
+		}
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE employees SET name = ?, position = ? WHERE employee_id = ?", req.Name, req.Position, id); err != nil {
+		log.Printf("Error updating employee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update employee")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "employee.update", EntityType: "employee", EntityID: strconv.Itoa(id), Before: before, After: req})
+	if err != nil {
+		log.Printf("Error writing audit log for employee update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update employee")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing employee update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update employee")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"employee_id": id, "name": req.Name, "position": req.Position})
+}
+
+// DeleteEmployee removes an employee who manages nobody and has no login
+func DeleteEmployee(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	id, ok := employeeIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for employee deletion: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete employee")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var inUse bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM employees WHERE manager_id = ?)
+		OR EXISTS(SELECT 1 FROM branches WHERE manager_id = ?)
+		OR EXISTS(SELECT 1 FROM users WHERE employee_id = ?)`, id, id, id).Scan(&inUse)
+	if err != nil {
+		log.Printf("Error checking employee usage: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete employee")
+		return
+	}
+	if inUse {
+		respondWithError(w, http.StatusConflict, "Employee still has reports, manages a branch or has a user login")
+		return
+	}
+
+	result, err := tx.Exec("DELETE FROM employees WHERE employee_id = ?", id)
+	if err != nil {
+		log.Printf("Error deleting employee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete employee")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Employee not found")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "employee.delete", EntityType: "employee", EntityID: strconv.Itoa(id)})
+	if err != nil {
+		log.Printf("Error writing audit log for employee deletion: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete employee")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing employee deletion: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete employee")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Employee deleted"})
+}
+
+// AssignEmployeeManager sets or clears an employee's manager, refusing assignments
+// that would make the hierarchy circular
+func AssignEmployeeManager(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	id, ok := employeeIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.AssignManagerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for employee manager: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign manager")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var previousManagerID *int
+	if err := tx.QueryRow("SELECT manager_id FROM employees WHERE employee_id = ? FOR UPDATE", id).Scan(&previousManagerID); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Employee not found")
+		} else {
+			log.Printf("Error getting employee for manager assignment: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to assign manager")
+		}
+		return
+	}
+
+	if req.ManagerID != nil {
+		var managerExists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM employees WHERE employee_id = ?)", *req.ManagerID).Scan(&managerExists); err != nil {
+			log.Printf("Error checking manager existence: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to assign manager")
+			return
+		}
+		if !managerExists {
+			respondWithError(w, http.StatusBadRequest, "Manager does not exist")
+			return
+		}
+
+		cycle, err := wouldCreateCycle(tx, id, *req.ManagerID)
+		if err != nil {
+			log.Printf("Error checking management chain: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to assign manager")
+			return
+		}
+		if cycle {
+			respondWithError(w, http.StatusConflict, "Assignment would create a management cycle")
+			return
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE employees SET manager_id = ? WHERE employee_id = ?", req.ManagerID, id); err != nil {
+		log.Printf("Error assigning employee manager: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign manager")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "employee.manager", EntityType: "employee", EntityID: strconv.Itoa(id),
+		Before: map[string]*int{"manager_id": previousManagerID}, After: map[string]*int{"manager_id": req.ManagerID}})
+	if err != nil {
+		log.Printf("Error writing audit log for employee manager: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign manager")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing employee manager: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to assign manager")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"employee_id": id, "manager_id": req.ManagerID})
+}
+
+// TransferEmployee moves an employee to another branch. Branch data access follows
+// the employee's branch, so the move also moves their access; if they managed their
+// old branch, that branch is left without a manager.
+func TransferEmployee(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	id, ok := employeeIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TransferEmployeeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for employee transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to transfer employee")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var oldBranchID int
+	if err := tx.QueryRow("SELECT branch_id FROM employees WHERE employee_id = ? FOR UPDATE", id).Scan(&oldBranchID); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Employee not found")
+		} else {
+			log.Printf("Error getting employee for transfer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to transfer employee")
+		}
+		return
+	}
+	if oldBranchID == req.BranchID {
+		respondWithError(w, http.StatusBadRequest, "Employee already works at this branch")
+		return
+	}
+
+	var branchExists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM branches WHERE branch_id = ?)", req.BranchID).Scan(&branchExists); err != nil {
+		log.Printf("Error checking branch for transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to transfer employee")
+		return
+	}
+	if !branchExists {
+		respondWithError(w, http.StatusBadRequest, "Branch does not exist")
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE branches SET manager_id = NULL WHERE branch_id = ? AND manager_id = ?", oldBranchID, id); err != nil {
+		log.Printf("Error clearing manager of old branch: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to transfer employee")
+		return
+	}
+	if _, err := tx.Exec("UPDATE employees SET branch_id = ? WHERE employee_id = ?", req.BranchID, id); err != nil {
+		log.Printf("Error transferring employee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to transfer employee")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "employee.transfer", EntityType: "employee", EntityID: strconv.Itoa(id),
+		Before: map[string]int{"branch_id": oldBranchID}, After: map[string]int{"branch_id": req.BranchID}})
+	if err != nil {
+		log.Printf("Error writing audit log for employee transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to transfer employee")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing employee transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to transfer employee")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"employee_id":    id,
+		"from_branch_id": oldBranchID,
+		"branch_id":      req.BranchID,
+	})
+}
+
+// GetEmployeeReports returns the full reporting tree below an employee
+func GetEmployeeReports(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can view reporting lines")
+		return
+	}
+	id, ok := employeeIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// The employee and everyone below them, in no particular order
+	rows, err := db.DB.Query(`WITH RECURSIVE subtree AS (
+			SELECT employee_id, name, position, branch_id, manager_id FROM employees WHERE employee_id = ?
+			UNION
+			SELECT e.employee_id, e.name, e.position, e.branch_id, e.manager_id FROM employees e JOIN subtree s ON e.manager_id = s.employee_id
+		)
+		SELECT employee_id, name, position, branch_id, manager_id FROM subtree ORDER BY employee_id`, id)
+	if err != nil {
+		log.Printf("Error getting reporting tree: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve reports")
+		return
+	}
+	defer rows.Close()
+
+	nodes := map[int]*models.ReportingNode{}
+	var order []*models.ReportingNode
+	for rows.Next() {
+		node := &models.ReportingNode{Reports: []*models.ReportingNode{}}
+		if err := rows.Scan(&node.EmployeeID, &node.Name, &node.Position, &node.BranchID, &node.ManagerID); err != nil {
+			log.Printf("Error scanning reporting tree: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve reports")
+			return
+		}
+		nodes[node.EmployeeID] = node
+		order = append(order, node)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating reporting tree: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve reports")
+		return
+	}
+
+	root, ok := nodes[id]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Employee not found")
+		return
+	}
+	for _, node := range order {
+		if node == root || node.ManagerID == nil {
+			continue
+		}
+		if manager, ok := nodes[*node.ManagerID]; ok {
+			manager.Reports = append(manager.Reports, node)
+		}
+	}
+	respondWithJSON(w, http.StatusOK, root)
+}
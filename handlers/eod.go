@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"banking-app/db"
+	"banking-app/eod"
+
+	"github.com/gorilla/mux"
+)
+
+// GetBusinessDate returns the current business date
+func GetBusinessDate(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can view the business date")
+		return
+	}
+	date, err := eod.BusinessDate(db.DB)
+	if err != nil {
+		log.Printf("Error getting business date: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve business date")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"business_date": date.Format("2006-01-02")})
+}
+
+// StartEODRun starts the end-of-day run of the current business date, or resumes it from
+// its first step not yet completed. The run continues in the background; poll
+// GET /eod/runs/{date} for its progress.
+func StartEODRun(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := eod.Begin(&actor.UserID)
+	if err == eod.ErrRunning {
+		respondWithError(w, http.StatusConflict, "An end-of-day run is already in progress")
+		return
+	}
+	if err != nil {
+		log.Printf("Error starting end-of-day run: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to start end-of-day run")
+		return
+	}
+	run, err := eod.GetRun(job.Date)
+	go func() {
+		if err := job.Run(); err != nil {
+			log.Printf("Error in end-of-day run for %s: %v", job.Date.Format("2006-01-02"), err)
+		}
+	}()
+	if err != nil {
+		log.Printf("Error reading back end-of-day run: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "End-of-day run started but could not be retrieved")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, run)
+}
+
+// GetEODRuns lists the most recent end-of-day runs
+func GetEODRuns(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can view end-of-day runs")
+		return
+	}
+	runs, err := eod.ListRuns(100)
+	if err != nil {
+		log.Printf("Error listing end-of-day runs: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve end-of-day runs")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, runs)
+}
+
+// GetEODRun returns the run of a business date with the status of each step
+func GetEODRun(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can view end-of-day runs")
+		return
+	}
+	date, err := time.Parse("2006-01-02", mux.Vars(r)["date"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Date must be YYYY-MM-DD")
+		return
+	}
+
+	run, err := eod.GetRun(date)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "No end-of-day run for this date")
+		} else {
+			log.Printf("Error fetching end-of-day run: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve end-of-day run")
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, run)
+}
@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"banking-app/audit"
+	"banking-app/db"
+	"banking-app/fees"
+	"banking-app/ledger"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+// GetFeeSchedules lists the fee schedules of every account type
+func GetFeeSchedules(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can view fee schedules")
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT " + fees.ScheduleColumns + " FROM fee_schedules ORDER BY account_type, fee_type")
+	if err != nil {
+		log.Printf("Error listing fee schedules: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve fee schedules")
+		return
+	}
+	defer rows.Close()
+
+	schedules := []models.FeeSchedule{}
+	for rows.Next() {
+		var s models.FeeSchedule
+		if err := fees.ScanSchedule(rows, &s); err != nil {
+			log.Printf("Error scanning fee schedule: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve fee schedules")
+			return
+		}
+		schedules = append(schedules, s)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating fee schedules: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve fee schedules")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, schedules)
+}
+
+// UpdateFeeSchedule sets how much a fee costs on an account type and whether it is charged
+func UpdateFeeSchedule(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	accountType, feeType := vars["accountType"], vars["feeType"]
+	if accountType != "savings" && accountType != "current" {
+		respondWithError(w, http.StatusBadRequest, "Account type must be 'savings' or 'current'")
+		return
+	}
+	if !fees.IsType(feeType) {
+		respondWithError(w, http.StatusBadRequest, "Fee type must be 'monthly_maintenance', 'withdrawal', 'inter_branch_transfer' or 'fx'")
+		return
+	}
+
+	var req models.UpdateFeeScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Amount < 0 || req.FreePerMonth < 0 || req.Rate < 0 || req.Rate > 100 {
+		respondWithError(w, http.StatusBadRequest, "Amount and free movements cannot be negative and rate must be between 0 and 100")
+		return
+	}
+	if feeType == fees.TypeMaintenance && (req.Rate != 0 || req.FreePerMonth != 0) {
+		respondWithError(w, http.StatusBadRequest, "Monthly maintenance is a flat amount without rate or free movements")
+		return
+	}
+	if req.Active {
+		incomeID, err := fees.IncomeAccountID(db.DB)
+		if err != nil {
+			log.Printf("Error getting fee income account: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update fee schedule")
+			return
+		}
+		if incomeID == nil {
+			respondWithErrorCode(w, http.StatusConflict, "no_fee_income_account", "Set the fee income account before activating fees")
+			return
+		}
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for fee schedule: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update fee schedule")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	before, err := fees.GetSchedule(tx, accountType, feeType)
+	if err != nil {
+		log.Printf("Error loading fee schedule: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update fee schedule")
+		return
+	}
+	_, err = tx.Exec(`INSERT INTO fee_schedules (account_type, fee_type, amount, rate, free_per_month, active) VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE amount = VALUES(amount), rate = VALUES(rate), free_per_month = VALUES(free_per_month), active = VALUES(active)`,
+		accountType, feeType, req.Amount, req.Rate, req.FreePerMonth, req.Active)
+	if err != nil {
+		log.Printf("Error updating fee schedule: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update fee schedule")
+		return
+	}
+	after := models.FeeSchedule{AccountType: accountType, FeeType: feeType, Amount: req.Amount, Rate: req.Rate, FreePerMonth: req.FreePerMonth, Active: req.Active, UpdatedAt: time.Now()}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "fee_schedule.update", EntityType: "fee_schedule", EntityID: accountType + "/" + feeType, Before: before, After: after})
+	if err != nil {
+		log.Printf("Error writing audit log for fee schedule: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update fee schedule")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing fee schedule: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update fee schedule")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, after)
+}
+
+// GetFeeSettings returns the account fee income is credited to
+func GetFeeSettings(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can view fee settings")
+		return
+	}
+	var s models.FeeSettings
+	err := db.DB.QueryRow(`SELECT a.account_number FROM fee_settings s LEFT JOIN accounts a ON a.account_id = s.income_account_id
+		WHERE s.settings_id = 1`).Scan(&s.IncomeAccountNumber)
+	if err != nil {
+		log.Printf("Error getting fee settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve fee settings")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, s)
+}
+
+// UpdateFeeSettings moves fee income to another bank-owned account. It cannot be unset,
+// as active fees need somewhere to go.
+func UpdateFeeSettings(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	var req models.FeeSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.IncomeAccountNumber == nil || *req.IncomeAccountNumber == "" {
+		respondWithError(w, http.StatusBadRequest, "income_account_number is required")
+		return
+	}
+	account, err := ledger.GetAccount(*req.IncomeAccountNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error getting fee income account: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update fee settings")
+		}
+		return
+	}
+	if account.Status != ledger.StatusActive {
+		refuseAccountStatus(w, account)
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for fee settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update fee settings")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var before models.FeeSettings
+	err = tx.QueryRow(`SELECT a.account_number FROM fee_settings s LEFT JOIN accounts a ON a.account_id = s.income_account_id
+		WHERE s.settings_id = 1 FOR UPDATE OF s`).Scan(&before.IncomeAccountNumber)
+	if err != nil {
+		log.Printf("Error getting fee settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update fee settings")
+		return
+	}
+	if _, err := tx.Exec("UPDATE fee_settings SET income_account_id = ? WHERE settings_id = 1", account.AccountID); err != nil {
+		log.Printf("Error updating fee settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update fee settings")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "fee_settings.update", EntityType: "fee_settings", EntityID: "1", Before: before, After: req})
+	if err != nil {
+		log.Printf("Error writing audit log for fee settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update fee settings")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing fee settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update fee settings")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, req)
+}
+
+// feeAccount loads the account named in the route and checks the actor may see it
+func feeAccount(w http.ResponseWriter, r *http.Request) (models.Account, bool) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return models.Account{}, false
+	}
+	account, err := ledger.GetAccount(mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error getting account for fees: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve account")
+		}
+		return account, false
+	}
+	if _, ok := authorizeAccount(w, db.DB, actor, account, false); !ok {
+		return account, false
+	}
+	return account, true
+}
+
+// GetFeeCharges lists the fees charged to an account, newest first
+func GetFeeCharges(w http.ResponseWriter, r *http.Request) {
+	account, ok := feeAccount(w, r)
+	if !ok {
+		return
+	}
+	rows, err := db.DB.Query(`SELECT charge_id, fee_type, amount, transaction_id, reference, status, created_at, refunded_at
+		FROM fee_charges WHERE account_id = ? ORDER BY charge_id DESC LIMIT 100`, account.AccountID)
+	if err != nil {
+		log.Printf("Error listing fee charges: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve fee charges")
+		return
+	}
+	defer rows.Close()
+
+	charges := []models.FeeCharge{}
+	for rows.Next() {
+		var c models.FeeCharge
+		if err := rows.Scan(&c.ChargeID, &c.FeeType, &c.Amount, &c.TransactionID, &c.Reference, &c.Status, &c.CreatedAt, &c.RefundedAt); err != nil {
+			log.Printf("Error scanning fee charge: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve fee charges")
+			return
+		}
+		charges = append(charges, c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating fee charges: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve fee charges")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, charges)
+}
+
+const feeWaiverColumns = "w.waiver_id, a.account_number, w.fee_type, w.reason, w.valid_until, w.created_by, w.created_at, w.revoked_by, w.revoked_at"
+
+func scanFeeWaiver(row interface{ Scan(...interface{}) error }, fw *models.FeeWaiver) error {
+	return row.Scan(&fw.WaiverID, &fw.AccountNumber, &fw.FeeType, &fw.Reason, &fw.ValidUntil, &fw.CreatedBy, &fw.CreatedAt, &fw.RevokedBy, &fw.RevokedAt)
+}
+
+// GetFeeWaivers lists the fee waivers of an account, newest first
+func GetFeeWaivers(w http.ResponseWriter, r *http.Request) {
+	account, ok := feeAccount(w, r)
+	if !ok {
+		return
+	}
+	rows, err := db.DB.Query("SELECT "+feeWaiverColumns+" FROM fee_waivers w JOIN accounts a ON a.account_id = w.account_id WHERE w.account_id = ? ORDER BY w.waiver_id DESC",
+		account.AccountID)
+	if err != nil {
+		log.Printf("Error listing fee waivers: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve fee waivers")
+		return
+	}
+	defer rows.Close()
+
+	waivers := []models.FeeWaiver{}
+	for rows.Next() {
+		var fw models.FeeWaiver
+		if err := scanFeeWaiver(rows, &fw); err != nil {
+			log.Printf("Error scanning fee waiver: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve fee waivers")
+			return
+		}
+		waivers = append(waivers, fw)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating fee waivers: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve fee waivers")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, waivers)
+}
+
+// CreateFeeWaiver exempts an account from one fee, or every fee, until a date or until revoked
+func CreateFeeWaiver(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.CreateFeeWaiverRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" || len(req.Reason) > 255 {
+		respondWithError(w, http.StatusBadRequest, "Reason must be 1 to 255 characters")
+		return
+	}
+	if req.FeeType != nil && !fees.IsType(*req.FeeType) {
+		respondWithError(w, http.StatusBadRequest, "Fee type must be 'monthly_maintenance', 'withdrawal', 'inter_branch_transfer' or 'fx'")
+		return
+	}
+	var validUntil *time.Time
+	if req.ValidUntil != nil {
+		d, err := time.Parse("2006-01-02", *req.ValidUntil)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "valid_until must be YYYY-MM-DD")
+			return
+		}
+		if d.Format("2006-01-02") < time.Now().Format("2006-01-02") {
+			respondWithError(w, http.StatusBadRequest, "valid_until cannot be in the past")
+			return
+		}
+		validUntil = &d
+	}
+
+	account, err := ledger.GetAccount(mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error getting account for fee waiver: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to create fee waiver")
+		}
+		return
+	}
+	if !actor.IsStaffOf(account.BranchID) {
+		respondWithError(w, http.StatusForbidden, "Only staff of the account's branch can waive its fees")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for fee waiver: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create fee waiver")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	result, err := tx.Exec("INSERT INTO fee_waivers (account_id, fee_type, reason, valid_until, created_by) VALUES (?, ?, ?, ?, ?)",
+		account.AccountID, req.FeeType, req.Reason, validUntil, actor.UserID)
+	if err != nil {
+		log.Printf("Error creating fee waiver: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create fee waiver")
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for fee waiver: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create fee waiver")
+		return
+	}
+	var fw models.FeeWaiver
+	if err := scanFeeWaiver(tx.QueryRow("SELECT "+feeWaiverColumns+" FROM fee_waivers w JOIN accounts a ON a.account_id = w.account_id WHERE w.waiver_id = ?", id), &fw); err != nil {
+		log.Printf("Error reading back fee waiver: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create fee waiver")
+		return
+	}
+	if err := audit.RecordTx(tx, r, audit.Entry{Action: "fee_waiver.create", EntityType: "fee_waiver", EntityID: strconv.FormatInt(id, 10), After: fw}); err != nil {
+		log.Printf("Error writing audit log for fee waiver: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create fee waiver")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing fee waiver: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create fee waiver")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, fw)
+}
+
+// RevokeFeeWaiver ends a fee waiver; fees are charged again from now on
+func RevokeFeeWaiver(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid fee waiver ID")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for fee waiver revocation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke fee waiver")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var fw models.FeeWaiver
+	err = scanFeeWaiver(tx.QueryRow("SELECT "+feeWaiverColumns+" FROM fee_waivers w JOIN accounts a ON a.account_id = w.account_id WHERE w.waiver_id = ? FOR UPDATE OF w", id), &fw)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Fee waiver not found")
+		} else {
+			log.Printf("Error fetching fee waiver: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to revoke fee waiver")
+		}
+		return
+	}
+	account, err := ledger.GetAccount(fw.AccountNumber)
+	if err != nil {
+		log.Printf("Error getting account of fee waiver: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke fee waiver")
+		return
+	}
+	if !actor.IsStaffOf(account.BranchID) {
+		respondWithError(w, http.StatusForbidden, "Only staff of the account's branch can revoke its fee waivers")
+		return
+	}
+	if fw.RevokedAt != nil {
+		respondWithError(w, http.StatusConflict, "Fee waiver is already revoked")
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE fee_waivers SET revoked_by = ?, revoked_at = NOW() WHERE waiver_id = ?", actor.UserID, id); err != nil {
+		log.Printf("Error revoking fee waiver: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke fee waiver")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "fee_waiver.revoke", EntityType: "fee_waiver", EntityID: strconv.Itoa(id),
+		Before: fw, After: map[string]interface{}{"revoked_by": actor.UserID}})
+	if err != nil {
+		log.Printf("Error writing audit log for fee waiver revocation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke fee waiver")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing fee waiver revocation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke fee waiver")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"waiver_id": id, "status": "revoked"})
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/db"
+	"banking-app/fraud"
+	"banking-app/ledger"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+// screenMovement runs fraud screening on a locked money movement and stores the decision.
+// It writes a 500 response and returns false if screening fails.
+func screenMovement(w http.ResponseWriter, r *http.Request, tx *sql.Tx, ev fraud.Event) (fraud.Result, int64, bool) {
+	res, err := fraud.Default.Screen(tx, ev)
+	if err != nil {
+		log.Printf("Error screening %s for fraud: %v", ev.Kind, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process "+ev.Kind)
+		return res, 0, false
+	}
+	decisionID, err := fraud.Record(tx, ev, res, audit.RequestID(r))
+	if err != nil {
+		log.Printf("Error recording fraud decision: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process "+ev.Kind)
+		return res, 0, false
+	}
+	return res, decisionID, true
+}
+
+// refuseMovement commits the stored fraud decision without moving any money and
+// tells the caller the movement was refused
+func refuseMovement(w http.ResponseWriter, tx *sql.Tx, res fraud.Result) {
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing fraud decision: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process request")
+		return
+	}
+	if res.Decision == fraud.Review {
+		respondWithErrorCode(w, http.StatusForbidden, "fraud_review", "Request flagged for review, please contact your branch")
+		return
+	}
+	respondWithErrorCode(w, http.StatusForbidden, "fraud_denied", "Request declined by fraud screening")
+}
+
+// holdTransfer parks a transfer flagged for review in the pending queue instead of executing it
+func holdTransfer(w http.ResponseWriter, r *http.Request, tx *sql.Tx, decisionID int64, from, to models.Account, amount float64, paymentType string) {
+	var requestedBy *int
+	if actor, err := auth.FromRequest(r); err == nil {
+		requestedBy = &actor.UserID
+	}
+
+	result, err := tx.Exec("INSERT INTO pending_transfers (decision_id, from_account_id, to_account_id, amount, payment_type, requested_by) VALUES (?, ?, ?, ?, ?, ?)",
+		decisionID, from.AccountID, to.AccountID, amount, paymentType, requestedBy)
+	if err != nil {
+		log.Printf("Error holding transfer for review: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+	pendingID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for pending transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "account.transfer_held", EntityType: "pending_transfer", EntityID: strconv.FormatInt(pendingID, 10),
+		After: map[string]interface{}{"from_account_number": from.AccountNumber, "to_account_number": to.AccountNumber, "amount": amount, "decision_id": decisionID}})
+	if err != nil {
+		log.Printf("Error writing audit log for held transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing held transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to commit transfer transaction")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"message":             "Transfer held for review",
+		"pending_transfer_id": pendingID,
+		"status":              "pending",
+	})
+}
+
+// GetPendingTransfers lists transfers held by fraud screening, oldest first, optionally
+// filtered with ?status=. Employees see those of their own branch.
+func GetPendingTransfers(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can review held transfers")
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "pending"
+	}
+	if status != "pending" && status != "approved" && status != "rejected" {
+		respondWithError(w, http.StatusBadRequest, "Status must be 'pending', 'approved' or 'rejected'")
+		return
+	}
+
+	query := `SELECT pt.pending_transfer_id, pt.decision_id, fa.account_number, ta.account_number, pt.amount, pt.status,
+		pt.requested_by, pt.reviewed_by, pt.review_note, pt.created_at, pt.reviewed_at
+		FROM pending_transfers pt
+		JOIN accounts fa ON fa.account_id = pt.from_account_id
+		JOIN accounts ta ON ta.account_id = pt.to_account_id
+		WHERE pt.status = ?`
+	args := []interface{}{status}
+	if !actor.IsAdmin() {
+		if actor.BranchID == nil {
+			respondWithError(w, http.StatusForbidden, "Only staff of a branch can review its held transfers")
+			return
+		}
+		query += " AND fa.branch_id = ?"
+		args = append(args, *actor.BranchID)
+	}
+
+	rows, err := db.DB.Query(query+" ORDER BY pt.created_at, pt.pending_transfer_id LIMIT 500", args...)
+	if err != nil {
+		log.Printf("Error listing pending transfers: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve pending transfers")
+		return
+	}
+	defer rows.Close()
+
+	transfers := []models.PendingTransfer{}
+	for rows.Next() {
+		var pt models.PendingTransfer
+		if err := rows.Scan(&pt.PendingTransferID, &pt.DecisionID, &pt.FromAccountNumber, &pt.ToAccountNumber, &pt.Amount, &pt.Status,
+			&pt.RequestedBy, &pt.ReviewedBy, &pt.ReviewNote, &pt.CreatedAt, &pt.ReviewedAt); err != nil {
+			log.Printf("Error scanning pending transfer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve pending transfers")
+			return
+		}
+		transfers = append(transfers, pt)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating pending transfers: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve pending transfers")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, transfers)
+}
+
+// ApprovePendingTransfer executes a held transfer after employee review
+func ApprovePendingTransfer(w http.ResponseWriter, r *http.Request) {
+	reviewPendingTransfer(w, r, true)
+}
+
+// RejectPendingTransfer cancels a held transfer; no money moves
+func RejectPendingTransfer(w http.ResponseWriter, r *http.Request) {
+	reviewPendingTransfer(w, r, false)
+}
+
+func reviewPendingTransfer(w http.ResponseWriter, r *http.Request, approve bool) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid pending transfer ID")
+		return
+	}
+	var req models.ReviewPendingTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if len(req.Note) > 255 {
+		respondWithError(w, http.StatusBadRequest, "Note must be at most 255 characters")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for transfer review: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review transfer")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var pt models.PendingTransfer
+	var paymentType string
+	var instructedBy *int // Customer who requested the transfer through their own login
+	err = tx.QueryRow(`SELECT pt.decision_id, fa.account_number, ta.account_number, pt.amount, pt.payment_type, pt.status,
+			CASE WHEN u.role = 'customer' THEN u.customer_id END
+		FROM pending_transfers pt
+		JOIN accounts fa ON fa.account_id = pt.from_account_id
+		JOIN accounts ta ON ta.account_id = pt.to_account_id
+		LEFT JOIN users u ON u.user_id = pt.requested_by
+		WHERE pt.pending_transfer_id = ? FOR UPDATE OF pt`, id).Scan(&pt.DecisionID, &pt.FromAccountNumber, &pt.ToAccountNumber, &pt.Amount, &paymentType, &pt.Status, &instructedBy)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Pending transfer not found")
+		} else {
+			log.Printf("Error fetching pending transfer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to review transfer")
+		}
+		return
+	}
+	if pt.Status != "pending" {
+		respondWithError(w, http.StatusConflict, "Transfer has already been "+pt.Status)
+		return
+	}
+
+	from, err := ledger.LockAccount(tx, pt.FromAccountNumber)
+	if err != nil {
+		log.Printf("Error locking source account of pending transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review transfer")
+		return
+	}
+	to, err := ledger.LockAccount(tx, pt.ToAccountNumber)
+	if err != nil {
+		log.Printf("Error locking destination account of pending transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review transfer")
+		return
+	}
+	if !actor.IsStaffOf(from.BranchID) {
+		respondWithError(w, http.StatusForbidden, "Only staff of the source account's branch can review this transfer")
+		return
+	}
+
+	// The review is recorded with the transfer, or on its own when the transfer is rejected
+	review := func(tx *sql.Tx, action, status string) error {
+		_, err := tx.Exec("UPDATE pending_transfers SET status = ?, reviewed_by = ?, review_note = ?, reviewed_at = NOW() WHERE pending_transfer_id = ?",
+			status, actor.UserID, req.Note, id)
+		if err != nil {
+			return fmt.Errorf("updating pending transfer: %w", err)
+		}
+		// The review outcome labels the decision for tuning the rules
+		if _, err := tx.Exec("UPDATE fraud_decisions SET review_outcome = ? WHERE decision_id = ?", status, pt.DecisionID); err != nil {
+			return fmt.Errorf("labelling fraud decision: %w", err)
+		}
+		err = audit.RecordTx(tx, r, audit.Entry{Action: action, EntityType: "pending_transfer", EntityID: strconv.Itoa(id),
+			Before: map[string]string{"status": "pending"},
+			After:  map[string]interface{}{"status": status, "note": req.Note, "from_account_number": pt.FromAccountNumber, "to_account_number": pt.ToAccountNumber, "amount": pt.Amount}})
+		if err != nil {
+			return fmt.Errorf("writing audit log for transfer review: %w", err)
+		}
+		return nil
+	}
+
+	if approve {
+		// The reviewer has cleared the fraud screening, but everything else is checked again
+		// since the accounts, the customers and the business date may have changed while
+		// the transfer waited
+		if !checkTransfer(w, tx, from, to, pt.Amount, instructedBy) {
+			return
+		}
+		settleTransfer(w, r, tx, from, to, pt.Amount, paymentType, func(tx *sql.Tx) error {
+			return review(tx, "pending_transfer.approve", "approved")
+		})
+		return
+	}
+
+	if err := review(tx, "pending_transfer.reject", "rejected"); err != nil {
+		log.Printf("Error rejecting pending transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review transfer")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transfer review: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review transfer")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"pending_transfer_id": id, "status": "rejected"})
+}
+
+// GetFraudDecisions lists recent screening decisions, newest first, optionally filtered
+// with ?decision=, for tuning the rules
+func GetFraudDecisions(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	query := `SELECT decision_id, kind, account_id, counterparty_account_id, amount, decision, score, outcomes, request_id, review_outcome, created_at
+		FROM fraud_decisions`
+	var args []interface{}
+	if decision := r.URL.Query().Get("decision"); decision != "" {
+		if decision != fraud.Allow && decision != fraud.Review && decision != fraud.Deny {
+			respondWithError(w, http.StatusBadRequest, "Decision must be 'allow', 'review' or 'deny'")
+			return
+		}
+		query += " WHERE decision = ?"
+		args = append(args, decision)
+	}
+
+	rows, err := db.DB.Query(query+" ORDER BY decision_id DESC LIMIT 500", args...)
+	if err != nil {
+		log.Printf("Error listing fraud decisions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve fraud decisions")
+		return
+	}
+	defer rows.Close()
+
+	decisions := []models.FraudDecision{}
+	for rows.Next() {
+		var d models.FraudDecision
+		if err := rows.Scan(&d.DecisionID, &d.Kind, &d.AccountID, &d.CounterpartyAccountID, &d.Amount, &d.Decision, &d.Score,
+			&d.Outcomes, &d.RequestID, &d.ReviewOutcome, &d.CreatedAt); err != nil {
+			log.Printf("Error scanning fraud decision: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve fraud decisions")
+			return
+		}
+		decisions = append(decisions, d)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating fraud decisions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve fraud decisions")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, decisions)
+}
@@ -10,8 +10,23 @@ import (
 	"strconv"
 	"time"
 
+	"banking-app/approvals"
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/calendar"
 	"banking-app/db"    // Import our db package
+	"banking-app/eod"
+	"banking-app/fees"
+	"banking-app/fraud"
+	"banking-app/holders"
+	"banking-app/kyc"
+	"banking-app/ledger"
+	"banking-app/limits"
 	"banking-app/models" // Import our models package
+	"banking-app/outbox"
+	"banking-app/payees"
+	"banking-app/sanctions"
+	"banking-app/teller"
 
 	"github.com/gorilla/mux"
 )
@@ -34,6 +49,11 @@ func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
 }
 
+// respondWithErrorCode sends an error response with a machine-readable code
+func respondWithErrorCode(w http.ResponseWriter, status int, code, message string) {
+	respondWithJSON(w, status, map[string]string{"error": message, "code": code})
+}
+
 // GenerateAccountNumber generates a unique 10-digit account number
 func GenerateAccountNumber() string {
 	rand.Seed(time.Now().UnixNano())
@@ -50,7 +70,15 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 
 	// In a real app, hash the password here before storing
 	// For simplicity, we're storing it as plain text (DO NOT DO THIS IN PRODUCTION)
-	result, err := db.DB.Exec("INSERT INTO users (username, password) VALUES (?, ?)", req.Username, req.Password)
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for user: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	result, err := tx.Exec("INSERT INTO users (username, password) VALUES (?, ?)", req.Username, req.Password)
 	if err != nil {
 		log.Printf("Error creating user: %v", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to create user")
@@ -70,6 +98,17 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		// Password is not returned
 		CreatedAt: time.Now(), // This might be slightly off from DB's timestamp
 	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "user.create", EntityType: "user", EntityID: strconv.FormatInt(userID, 10), After: user})
+	if err != nil {
+		log.Printf("Error writing audit log for user: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing user: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
 	respondWithJSON(w, http.StatusCreated, user)
 }
 
@@ -105,16 +144,24 @@ func CreateAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for account: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create account")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
 	// Check if user exists
 	var userExists bool
-	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", req.UserID).Scan(&userExists)
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", req.UserID).Scan(&userExists)
 	if err != nil || !userExists {
 		respondWithError(w, http.StatusBadRequest, "User does not exist")
 		return
 	}
 
 	accountNumber := GenerateAccountNumber()
-	result, err := db.DB.Exec("INSERT INTO accounts (user_id, account_number, balance, currency) VALUES (?, ?, ?, ?)",
+	result, err := tx.Exec("INSERT INTO accounts (user_id, account_number, balance, currency) VALUES (?, ?, ?, ?)",
 		req.UserID, accountNumber, 0.00, req.Currency)
 	if err != nil {
 		log.Printf("Error creating account: %v", err)
@@ -137,6 +184,17 @@ func CreateAccount(w http.ResponseWriter, r *http.Request) {
 		Currency:      req.Currency,
 		CreatedAt:     time.Now(), // This might be slightly off from DB's timestamp
 	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "account.create", EntityType: "account", EntityID: accountNumber, After: account})
+	if err != nil {
+		log.Printf("Error writing audit log for account: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create account")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing account: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create account")
+		return
+	}
 	respondWithJSON(w, http.StatusCreated, account)
 }
 
@@ -173,6 +231,18 @@ func Deposit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Cash handed over at a counter goes into the teller's drawer
+	var actor auth.Actor
+	if len(req.Cash) > 0 {
+		var ok bool
+		if actor, ok = requireActor(w, r); !ok {
+			return
+		}
+		if !validCash(w, req.Amount, req.Cash) {
+			return
+		}
+	}
+
 	// Start a transaction for atomicity
 	tx, err := db.DB.Begin()
 	if err != nil {
@@ -182,9 +252,8 @@ func Deposit(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback() // Rollback on error, commit if successful
 
-	// Get current balance with a FOR UPDATE lock
-	var currentBalance float64
-	err = tx.QueryRow("SELECT balance FROM accounts WHERE account_number = ? FOR UPDATE", req.AccountNumber).Scan(&currentBalance)
+	// Get the account with a FOR UPDATE lock
+	account, err := ledger.LockAccount(tx, req.AccountNumber)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondWithError(w, http.StatusNotFound, "Account not found")
@@ -194,6 +263,18 @@ func Deposit(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if !ledger.CanCredit(account) {
+		refuseAccountStatus(w, account)
+		return
+	}
+	var session models.TellerSession
+	if len(req.Cash) > 0 {
+		var ok bool
+		if session, ok = lockTellerSession(w, tx, actor); !ok {
+			return
+		}
+	}
+	currentBalance := account.Balance
 
 	newBalance := currentBalance + req.Amount
 	_, err = tx.Exec("UPDATE accounts SET balance = ? WHERE account_number = ?", newBalance, req.AccountNumber)
@@ -202,6 +283,38 @@ func Deposit(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "Failed to update account balance")
 		return
 	}
+	description := "Deposit"
+	if len(req.Cash) > 0 {
+		description = "Cash deposit"
+	}
+	transactionID, err := ledger.Post(tx, account.AccountID, ledger.TypeDeposit, req.Amount, description)
+	if err != nil {
+		log.Printf("Error recording deposit transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process deposit")
+		return
+	}
+	if len(req.Cash) > 0 && !bookCash(w, tx, session, account.AccountID, transactionID, teller.KindDeposit, req.Amount, req.Cash) {
+		return
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "account.deposit", EntityType: "account", EntityID: req.AccountNumber,
+		Before: map[string]float64{"balance": currentBalance}, After: map[string]float64{"balance": newBalance, "amount": req.Amount}})
+	if err != nil {
+		log.Printf("Error writing audit log for deposit: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process deposit")
+		return
+	}
+
+	err = outbox.Enqueue(tx, outbox.EventDeposited, req.AccountNumber, map[string]interface{}{
+		"account_number": req.AccountNumber,
+		"amount":         req.Amount,
+		"new_balance":    newBalance,
+	})
+	if err != nil {
+		log.Printf("Error writing deposit event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process deposit")
+		return
+	}
 
 	if err := tx.Commit(); err != nil {
 		log.Printf("Error committing transaction for deposit: %v", err)
@@ -218,6 +331,11 @@ func Deposit(w http.ResponseWriter, r *http.Request) {
 
 // Withdraw funds from an account
 func Withdraw(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+
 	var req models.WithdrawRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
@@ -228,6 +346,9 @@ func Withdraw(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Withdrawal amount must be positive")
 		return
 	}
+	if len(req.Cash) > 0 && !validCash(w, req.Amount, req.Cash) {
+		return
+	}
 
 	// Start a transaction for atomicity
 	tx, err := db.DB.Begin()
@@ -238,9 +359,8 @@ func Withdraw(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback() // Rollback on error, commit if successful
 
-	// Get current balance with a FOR UPDATE lock
-	var currentBalance float64
-	err = tx.QueryRow("SELECT balance FROM accounts WHERE account_number = ? FOR UPDATE", req.AccountNumber).Scan(&currentBalance)
+	// Get the account with a FOR UPDATE lock
+	account, err := ledger.LockAccount(tx, req.AccountNumber)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondWithError(w, http.StatusNotFound, "Account not found")
@@ -250,12 +370,77 @@ func Withdraw(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	if _, ok := authorizeAccount(w, tx, actor, account, true); !ok {
+		return
+	}
+	if !ledger.CanDebit(account) {
+		refuseAccountStatus(w, account)
+		return
+	}
+	// Cash paid out at a counter comes from the teller's drawer
+	var session models.TellerSession
+	if len(req.Cash) > 0 {
+		if session, ok = lockTellerSession(w, tx, actor); !ok {
+			return
+		}
+	}
+	currentBalance := account.Balance
+
+	// The account's customer and a joint holder or signatory taking the money must both be verified
+	customers := movementCustomers(account, instructingCustomer(actor))
+	for _, customerID := range customers {
+		kycStatus, err := kyc.CustomerStatus(tx, customerID)
+		if err != nil {
+			log.Printf("Error checking KYC status for withdrawal: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process withdrawal")
+			return
+		}
+		if kycStatus != kyc.StatusVerified {
+			refuseUnverified(w)
+			return
+		}
+	}
 
-	if currentBalance < req.Amount {
+	// Current accounts may go overdrawn up to their arranged limit
+	if ledger.Available(account) < req.Amount {
 		respondWithError(w, http.StatusBadRequest, "Insufficient funds")
 		return
 	}
 
+	violation, err := limits.Check(tx, account, req.Amount)
+	if err != nil {
+		log.Printf("Error checking limits for withdrawal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process withdrawal")
+		return
+	}
+	if violation != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, violation.Code, violation.Message)
+		return
+	}
+
+	for _, customerID := range customers {
+		screeningStatus, err := sanctions.CustomerStatus(tx, customerID)
+		if err != nil {
+			log.Printf("Error checking sanctions screening for withdrawal: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process withdrawal")
+			return
+		}
+		if screeningStatus != sanctions.StatusClear {
+			refuseSanctioned(w, tx, screeningStatus)
+			return
+		}
+	}
+
+	// Withdrawals cannot be held, so anything but a clean screening is refused
+	screening, _, ok := screenMovement(w, r, tx, fraud.Event{Kind: fraud.KindWithdrawal, Account: account, Amount: req.Amount, At: time.Now()})
+	if !ok {
+		return
+	}
+	if screening.Decision != fraud.Allow {
+		refuseMovement(w, tx, screening)
+		return
+	}
+
 	newBalance := currentBalance - req.Amount
 	_, err = tx.Exec("UPDATE accounts SET balance = ? WHERE account_number = ?", newBalance, req.AccountNumber)
 	if err != nil {
@@ -263,6 +448,45 @@ func Withdraw(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "Failed to update account balance")
 		return
 	}
+	description := "Withdrawal"
+	if len(req.Cash) > 0 {
+		description = "Cash withdrawal"
+	}
+	transactionID, err := ledger.Post(tx, account.AccountID, ledger.TypeWithdrawal, req.Amount, description)
+	if err != nil {
+		log.Printf("Error recording withdrawal transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process withdrawal")
+		return
+	}
+	if len(req.Cash) > 0 && !bookCash(w, tx, session, account.AccountID, transactionID, teller.KindWithdrawal, req.Amount, req.Cash) {
+		return
+	}
+	fee, err := fees.Apply(tx, account.AccountID, fees.TypeWithdrawal, req.Amount, "")
+	if err != nil {
+		log.Printf("Error charging withdrawal fee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process withdrawal")
+		return
+	}
+	newBalance -= fee
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "account.withdraw", EntityType: "account", EntityID: req.AccountNumber,
+		Before: map[string]float64{"balance": currentBalance}, After: map[string]float64{"balance": newBalance, "amount": req.Amount, "fee": fee}})
+	if err != nil {
+		log.Printf("Error writing audit log for withdrawal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process withdrawal")
+		return
+	}
+
+	err = outbox.Enqueue(tx, outbox.EventWithdrawn, req.AccountNumber, map[string]interface{}{
+		"account_number": req.AccountNumber,
+		"amount":         req.Amount,
+		"new_balance":    newBalance,
+	})
+	if err != nil {
+		log.Printf("Error writing withdrawal event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process withdrawal")
+		return
+	}
 
 	if err := tx.Commit(); err != nil {
 		log.Printf("Error committing transaction for withdrawal: %v", err)
@@ -274,38 +498,73 @@ func Withdraw(w http.ResponseWriter, r *http.Request) {
 		"message":      "Withdrawal successful",
 		"account_number": req.AccountNumber,
 		"new_balance":  newBalance,
+		"fee":          fee,
 	})
 }
 
 // Transfer funds between accounts
 func Transfer(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+
 	var req models.TransferRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
+	// Start a transaction for atomicity
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	transfer(w, r, tx, actor, req, 0)
+}
+
+// transfer runs the transfer in req by actor inside tx, committing it and writing the
+// response. approved is the approval request being executed, 0 for a new transfer.
+func transfer(w http.ResponseWriter, r *http.Request, tx *sql.Tx, actor auth.Actor, req models.TransferRequest, approved int64) {
 	if req.Amount <= 0 {
 		respondWithError(w, http.StatusBadRequest, "Transfer amount must be positive")
 		return
 	}
-	if req.FromAccountNumber == req.ToAccountNumber {
-		respondWithError(w, http.StatusBadRequest, "Cannot transfer to the same account")
+	if req.PayeeID != nil && req.ToAccountNumber != "" {
+		respondWithError(w, http.StatusBadRequest, "Give either to_account_number or payee_id")
 		return
 	}
+	submitted := req // As sent, stored if the transfer needs approval
 
-	// Start a transaction for atomicity
-	tx, err := db.DB.Begin()
-	if err != nil {
-		log.Printf("Error starting transaction for transfer: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+	// A saved payee supplies the destination; customers can only pay their own payees
+	var payee *models.Payee
+	if req.PayeeID != nil {
+		p, err := payees.Get(tx, *req.PayeeID)
+		if err == nil && !actor.IsEmployee() && (actor.CustomerID == nil || *actor.CustomerID != p.CustomerID) {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusNotFound, "Payee not found")
+			} else {
+				log.Printf("Error fetching payee for transfer: %v", err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+			}
+			return
+		}
+		payee, req.ToAccountNumber = &p, p.AccountNumber
+	}
+	if req.FromAccountNumber == req.ToAccountNumber {
+		respondWithError(w, http.StatusBadRequest, "Cannot transfer to the same account")
 		return
 	}
-	defer tx.Rollback() // Rollback on error, commit if successful
 
-	// Get balances of both accounts with FOR UPDATE locks
-	var fromBalance, toBalance float64
-	err = tx.QueryRow("SELECT balance FROM accounts WHERE account_number = ? FOR UPDATE", req.FromAccountNumber).Scan(&fromBalance)
+	// Get both accounts with FOR UPDATE locks
+	fromAccount, err := ledger.LockAccount(tx, req.FromAccountNumber)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondWithError(w, http.StatusNotFound, "Source account not found")
@@ -316,7 +575,7 @@ func Transfer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = tx.QueryRow("SELECT balance FROM accounts WHERE account_number = ? FOR UPDATE", req.ToAccountNumber).Scan(&toBalance)
+	toAccount, err := ledger.LockAccount(tx, req.ToAccountNumber)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondWithError(w, http.StatusNotFound, "Destination account not found")
@@ -327,31 +586,235 @@ func Transfer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if fromBalance < req.Amount {
+	if _, ok := authorizeAccount(w, tx, actor, fromAccount, true); !ok {
+		return
+	}
+
+	// Staff may pay a payee on a customer's behalf, but only from an account that customer holds
+	if payee != nil {
+		role, err := holders.Role(tx, fromAccount, payee.CustomerID)
+		if err != nil {
+			log.Printf("Error checking payee owner for transfer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+			return
+		}
+		if role == "" {
+			respondWithError(w, http.StatusBadRequest, "Payee does not belong to a holder of the source account")
+			return
+		}
+		violation, err := payees.CheckCoolingOff(tx, *payee, toAccount, req.Amount, time.Now())
+		if err != nil {
+			log.Printf("Error checking new payee limit for transfer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+			return
+		}
+		if violation != nil {
+			respondWithErrorCode(w, http.StatusBadRequest, violation.Code, violation.Message)
+			return
+		}
+	}
+
+	paymentType := calendar.PaymentTransfer
+	if payee != nil {
+		paymentType = calendar.PaymentPayee
+	}
+
+	if holdForApproval(w, r, tx, actor, approved, approvals.Pending{Operation: approvals.OpTransfer, EntityType: "account", EntityID: fromAccount.AccountNumber,
+		BranchID: fromAccount.BranchID, Amount: req.Amount, Body: submitted}) {
+		return
+	}
+
+	// Co-signing applies to holders acting online; at the counter staff check signatures in person
+	if actor.CustomerID != nil && !actor.IsEmployee() {
+		rule, err := holders.GetSigningRule(tx, fromAccount.AccountID)
+		if err != nil {
+			log.Printf("Error loading signing rule for transfer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+			return
+		}
+		if holders.NeedsAllSigners(rule, req.Amount) {
+			requestTransferApproval(w, r, tx, actor, fromAccount, toAccount, req.Amount, paymentType)
+			return
+		}
+	}
+
+	completeTransfer(w, r, tx, fromAccount, toAccount, req.Amount, paymentType, instructingCustomer(actor), nil)
+}
+
+// completeTransfer runs the checks of a transfer between two locked accounts and, if they
+// pass, moves the money and commits tx, writing the response either way. A transfer past
+// the cut-off of its payment type is scheduled for its value date instead. instructedBy is
+// the customer who asked for the transfer through their own login, nil for staff. onSuccess,
+// if set, runs in tx once the transfer has been executed, scheduled or held for fraud review.
+func completeTransfer(w http.ResponseWriter, r *http.Request, tx *sql.Tx, fromAccount, toAccount models.Account, amount float64, paymentType string, instructedBy *int, onSuccess func(*sql.Tx) error) {
+	if !checkTransfer(w, tx, fromAccount, toAccount, amount, instructedBy) {
+		return
+	}
+
+	screening, decisionID, ok := screenMovement(w, r, tx, fraud.Event{Kind: fraud.KindTransfer, Account: fromAccount, To: &toAccount, Amount: amount, At: time.Now()})
+	if !ok {
+		return
+	}
+	switch screening.Decision {
+	case fraud.Deny:
+		refuseMovement(w, tx, screening)
+		return
+	case fraud.Review:
+		if onSuccess != nil {
+			if err := onSuccess(tx); err != nil {
+				log.Printf("Error completing transfer: %v", err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+				return
+			}
+		}
+		holdTransfer(w, r, tx, decisionID, fromAccount, toAccount, amount, paymentType)
+		return
+	}
+	settleTransfer(w, r, tx, fromAccount, toAccount, amount, paymentType, onSuccess)
+}
+
+// checkTransfer runs the checks every transfer must pass when it is executed: both
+// accounts open, the sender and the customer who instructed it verified, funds and
+// limits, and none of them a sanctions match. It writes an error response and returns
+// false if one fails.
+func checkTransfer(w http.ResponseWriter, tx *sql.Tx, fromAccount, toAccount models.Account, amount float64, instructedBy *int) bool {
+	if !ledger.CanDebit(fromAccount) {
+		refuseAccountStatus(w, fromAccount)
+		return false
+	}
+	if !ledger.CanCredit(toAccount) {
+		refuseAccountStatus(w, toAccount)
+		return false
+	}
+
+	// Only the sending side must be verified; receiving money needs no documents
+	customers := movementCustomers(fromAccount, instructedBy)
+	for _, customerID := range customers {
+		kycStatus, err := kyc.CustomerStatus(tx, customerID)
+		if err != nil {
+			log.Printf("Error checking KYC status for transfer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+			return false
+		}
+		if kycStatus != kyc.StatusVerified {
+			refuseUnverified(w)
+			return false
+		}
+	}
+
+	// Current accounts may go overdrawn up to their arranged limit
+	if ledger.Available(fromAccount) < amount {
 		respondWithError(w, http.StatusBadRequest, "Insufficient funds in source account")
+		return false
+	}
+
+	violation, err := limits.Check(tx, fromAccount, amount)
+	if err != nil {
+		log.Printf("Error checking limits for transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return false
+	}
+	if violation != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, violation.Code, violation.Message)
+		return false
+	}
+
+	// Neither party may be a confirmed or undecided sanctions match
+	screeningStatus, err := sanctions.ScreenCounterparties(tx, fromAccount.CustomerID, toAccount.CustomerID)
+	if err != nil {
+		log.Printf("Error running sanctions screening for transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return false
+	}
+	if screeningStatus != sanctions.StatusClear {
+		refuseSanctioned(w, tx, screeningStatus)
+		return false
+	}
+	// A joint holder or signatory giving the instruction is screened too
+	for _, customerID := range customers[1:] {
+		screeningStatus, err := sanctions.CustomerStatus(tx, customerID)
+		if err != nil {
+			log.Printf("Error checking sanctions screening for transfer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+			return false
+		}
+		if screeningStatus != sanctions.StatusClear {
+			refuseSanctioned(w, tx, screeningStatus)
+			return false
+		}
+	}
+	return true
+}
+
+// settleTransfer moves the money of a transfer that passed its checks and fraud screening,
+// or schedules it for its value date past the cut-off, then runs onSuccess and commits tx
+func settleTransfer(w http.ResponseWriter, r *http.Request, tx *sql.Tx, fromAccount, toAccount models.Account, amount float64, paymentType string, onSuccess func(*sql.Tx) error) {
+	fromBalance, toBalance := fromAccount.Balance, toAccount.Balance
+
+	// Past the cut-off, or on a day that is not a business day, the transfer waits for its value date
+	businessDate, err := eod.BusinessDate(tx)
+	if err != nil {
+		log.Printf("Error getting business date for transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+	valueDate, err := calendar.ValueDate(tx, paymentType, businessDate, time.Now())
+	if err != nil {
+		log.Printf("Error value-dating transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+	if valueDate.After(businessDate) {
+		scheduleTransfer(w, r, tx, fromAccount, toAccount, amount, paymentType, valueDate, onSuccess)
+		return
+	}
+
+	// Move the funds and record both sides in the transaction history
+	if err := ledger.Transfer(tx, fromAccount, toAccount, amount); err != nil {
+		log.Printf("Error moving funds for transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+	fee, err := fees.ForTransfer(tx, fromAccount, toAccount, amount)
+	if err != nil {
+		log.Printf("Error charging transfer fee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
 		return
 	}
 
-	// Update balances
-	_, err = tx.Exec("UPDATE accounts SET balance = ? WHERE account_number = ?", fromBalance-req.Amount, req.FromAccountNumber)
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "account.transfer", EntityType: "account", EntityID: fromAccount.AccountNumber,
+		Before: map[string]interface{}{"balance": fromBalance, "to_account_number": toAccount.AccountNumber, "to_balance": toBalance},
+		After: map[string]interface{}{"balance": fromBalance - amount - fee, "to_account_number": toAccount.AccountNumber, "to_balance": toBalance + amount, "amount": amount, "fee": fee}})
 	if err != nil {
-		log.Printf("Error updating source account balance for transfer: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to update source account balance")
+		log.Printf("Error writing audit log for transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
 		return
 	}
 
-	_, err = tx.Exec("UPDATE accounts SET balance = ? WHERE account_number = ?", toBalance+req.Amount, req.ToAccountNumber)
+	err = outbox.Enqueue(tx, outbox.EventTransferred, fromAccount.AccountNumber, map[string]interface{}{
+		"from_account_number": fromAccount.AccountNumber,
+		"to_account_number":   toAccount.AccountNumber,
+		"amount":              amount,
+	})
 	if err != nil {
-		log.Printf("Error updating destination account balance for transfer: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to update destination account balance")
+		log.Printf("Error writing transfer event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
 		return
 	}
 
+	if onSuccess != nil {
+		if err := onSuccess(tx); err != nil {
+			log.Printf("Error completing transfer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+			return
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		log.Printf("Error committing transaction for transfer: %v", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to commit transfer transaction")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Transfer successful"})
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "Transfer successful", "fee": fee})
 }
@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/db"
+	"banking-app/holders"
+	"banking-app/ledger"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+// authorizeAccount checks that the actor may act on an account: staff of its branch, or
+// one of its holders. With sign set the holder's role must also allow moving money.
+// It returns the holder's role ("" for staff), writing an error response if not allowed.
+func authorizeAccount(w http.ResponseWriter, q db.Querier, actor auth.Actor, account models.Account, sign bool) (string, bool) {
+	if actor.IsStaffOf(account.BranchID) {
+		return "", true
+	}
+	if actor.CustomerID == nil {
+		respondWithError(w, http.StatusForbidden, "Not allowed to access this account")
+		return "", false
+	}
+	role, err := holders.Role(q, account, *actor.CustomerID)
+	if err != nil {
+		log.Printf("Error checking account holder: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check account access")
+		return "", false
+	}
+	if role == "" {
+		respondWithError(w, http.StatusForbidden, "Not allowed to access this account")
+		return "", false
+	}
+	if sign && !holders.CanSign(role) {
+		respondWithErrorCode(w, http.StatusForbidden, "holder_cannot_sign", "Your role on this account does not allow moving money")
+		return role, false
+	}
+	return role, true
+}
+
+// instructingCustomer returns the customer who instructs a movement through their own
+// login, or nil when staff act for the account
+func instructingCustomer(actor auth.Actor) *int {
+	if actor.CustomerID == nil || actor.IsEmployee() {
+		return nil
+	}
+	return actor.CustomerID
+}
+
+// movementCustomers returns the customers whose KYC and sanctions status a debit of an
+// account depends on: the account's customer and, when a joint holder or signatory
+// instructs it, that customer too
+func movementCustomers(account models.Account, instructedBy *int) []int {
+	if instructedBy == nil || *instructedBy == account.CustomerID {
+		return []int{account.CustomerID}
+	}
+	return []int{account.CustomerID, *instructedBy}
+}
+
+// GetAccountHolders lists the holders of an account, primary first
+func GetAccountHolders(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	account, err := ledger.GetAccount(mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error fetching account for holders: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve holders")
+		}
+		return
+	}
+	if _, ok := authorizeAccount(w, db.DB, actor, account, false); !ok {
+		return
+	}
+
+	list, err := holders.List(db.DB, account)
+	if err != nil {
+		log.Printf("Error listing account holders: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve holders")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// lockAccountForHolders locks the account in the route and checks the actor is staff of
+// its branch; holders cannot add or change holders themselves
+func lockAccountForHolders(w http.ResponseWriter, r *http.Request, tx *sql.Tx, actor auth.Actor) (models.Account, bool) {
+	account, err := ledger.LockAccount(tx, mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error fetching account for holder change: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		}
+		return account, false
+	}
+	if !actor.IsStaffOf(account.BranchID) {
+		respondWithError(w, http.StatusForbidden, "Only staff of the account's branch can change its holders")
+		return account, false
+	}
+	if account.Status == ledger.StatusClosed {
+		refuseAccountStatus(w, account)
+		return account, false
+	}
+	return account, true
+}
+
+// AddAccountHolder adds a customer to an account with a secondary role
+func AddAccountHolder(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.AddAccountHolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if !holders.IsSecondaryRole(req.Role) {
+		respondWithError(w, http.StatusBadRequest, "Role must be 'joint', 'authorized_signatory' or 'view_only'")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for adding holder: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	account, ok := lockAccountForHolders(w, r, tx, actor)
+	if !ok {
+		return
+	}
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM customers WHERE customer_id = ?)", req.CustomerID).Scan(&exists); err != nil {
+		log.Printf("Error checking customer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	if !exists {
+		respondWithError(w, http.StatusBadRequest, "Customer not found")
+		return
+	}
+	current, err := holders.Role(tx, account, req.CustomerID)
+	if err != nil {
+		log.Printf("Error checking account holder: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	if current != "" {
+		respondWithError(w, http.StatusConflict, "Customer already holds this account as "+current)
+		return
+	}
+
+	if _, err := tx.Exec("INSERT INTO account_holders (account_id, customer_id, role) VALUES (?, ?, ?)", account.AccountID, req.CustomerID, req.Role); err != nil {
+		log.Printf("Error adding account holder: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "account.holder_add", EntityType: "account", EntityID: account.AccountNumber,
+		After: map[string]interface{}{"customer_id": req.CustomerID, "role": req.Role}})
+	if err != nil {
+		log.Printf("Error writing audit log for adding holder: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing holder addition: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{"account_number": account.AccountNumber, "customer_id": req.CustomerID, "role": req.Role})
+}
+
+// UpdateAccountHolder changes a holder's role. Promoting a holder to primary makes the
+// previous primary a joint holder.
+func UpdateAccountHolder(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	customerID, err := strconv.Atoi(mux.Vars(r)["customerId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid customer ID")
+		return
+	}
+	var req models.UpdateAccountHolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Role != holders.RolePrimary && !holders.IsSecondaryRole(req.Role) {
+		respondWithError(w, http.StatusBadRequest, "Role must be 'primary', 'joint', 'authorized_signatory' or 'view_only'")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for holder update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	account, ok := lockAccountForHolders(w, r, tx, actor)
+	if !ok {
+		return
+	}
+	current, err := holders.Role(tx, account, customerID)
+	if err != nil {
+		log.Printf("Error checking account holder: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	switch {
+	case current == "":
+		respondWithError(w, http.StatusNotFound, "Customer does not hold this account")
+		return
+	case current == req.Role:
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{"account_number": account.AccountNumber, "customer_id": customerID, "role": req.Role})
+		return
+	case current == holders.RolePrimary:
+		respondWithError(w, http.StatusBadRequest, "Promote another holder to primary instead")
+		return
+	}
+
+	if req.Role == holders.RolePrimary {
+		// The primary holder lives on the account itself; swap it with the promoted holder
+		if _, err = tx.Exec("DELETE FROM account_holders WHERE account_id = ? AND customer_id = ?", account.AccountID, customerID); err == nil {
+			_, err = tx.Exec("INSERT INTO account_holders (account_id, customer_id, role) VALUES (?, ?, ?)", account.AccountID, account.CustomerID, holders.RoleJoint)
+		}
+		if err == nil {
+			_, err = tx.Exec("UPDATE accounts SET customer_id = ? WHERE account_id = ?", customerID, account.AccountID)
+		}
+	} else {
+		_, err = tx.Exec("UPDATE account_holders SET role = ? WHERE account_id = ? AND customer_id = ?", req.Role, account.AccountID, customerID)
+	}
+	if err != nil {
+		log.Printf("Error updating account holder: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+
+	after := map[string]interface{}{"customer_id": customerID, "role": req.Role}
+	if req.Role == holders.RolePrimary {
+		after["previous_primary_customer_id"] = account.CustomerID
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "account.holder_update", EntityType: "account", EntityID: account.AccountNumber,
+		Before: map[string]interface{}{"customer_id": customerID, "role": current}, After: after})
+	if err != nil {
+		log.Printf("Error writing audit log for holder update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing holder update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"account_number": account.AccountNumber, "customer_id": customerID, "role": req.Role})
+}
+
+// RemoveAccountHolder removes a secondary holder from an account
+func RemoveAccountHolder(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	customerID, err := strconv.Atoi(mux.Vars(r)["customerId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid customer ID")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for holder removal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	account, ok := lockAccountForHolders(w, r, tx, actor)
+	if !ok {
+		return
+	}
+	if customerID == account.CustomerID {
+		respondWithError(w, http.StatusBadRequest, "The primary holder cannot be removed")
+		return
+	}
+	current, err := holders.Role(tx, account, customerID)
+	if err != nil {
+		log.Printf("Error checking account holder: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	if current == "" {
+		respondWithError(w, http.StatusNotFound, "Customer does not hold this account")
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM account_holders WHERE account_id = ? AND customer_id = ?", account.AccountID, customerID); err != nil {
+		log.Printf("Error removing account holder: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "account.holder_remove", EntityType: "account", EntityID: account.AccountNumber,
+		Before: map[string]interface{}{"customer_id": customerID, "role": current}})
+	if err != nil {
+		log.Printf("Error writing audit log for holder removal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing holder removal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update holders")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSigningRule returns the signing rule of an account
+func GetSigningRule(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	account, err := ledger.GetAccount(mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error fetching account for signing rule: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve signing rule")
+		}
+		return
+	}
+	if _, ok := authorizeAccount(w, db.DB, actor, account, false); !ok {
+		return
+	}
+
+	rule, err := holders.GetSigningRule(db.DB, account.AccountID)
+	if err != nil {
+		log.Printf("Error loading signing rule: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve signing rule")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, rule)
+}
+
+// SetSigningRule sets who must approve transfers from an account
+func SetSigningRule(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.SigningRule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Rule != holders.RuleAnyOne && req.Rule != holders.RuleAllMustApprove {
+		respondWithError(w, http.StatusBadRequest, "Rule must be 'any_one' or 'all_must_approve'")
+		return
+	}
+	if req.Threshold < 0 {
+		respondWithError(w, http.StatusBadRequest, "Threshold cannot be negative")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for signing rule: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update signing rule")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	account, ok := lockAccountForHolders(w, r, tx, actor)
+	if !ok {
+		return
+	}
+	previous, err := holders.GetSigningRule(tx, account.AccountID)
+	if err != nil {
+		log.Printf("Error loading signing rule: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update signing rule")
+		return
+	}
+	_, err = tx.Exec(`INSERT INTO account_signing_rules (account_id, rule, threshold) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE rule = VALUES(rule), threshold = VALUES(threshold)`, account.AccountID, req.Rule, req.Threshold)
+	if err != nil {
+		log.Printf("Error saving signing rule: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update signing rule")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "account.signing_rule", EntityType: "account", EntityID: account.AccountNumber,
+		Before: previous, After: req})
+	if err != nil {
+		log.Printf("Error writing audit log for signing rule: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update signing rule")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing signing rule: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update signing rule")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, req)
+}
@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"banking-app/audit"
+	"banking-app/blobstore"
+	"banking-app/db"
+	"banking-app/kyc"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+// maxDocumentSize bounds uploaded KYC documents
+const maxDocumentSize = 10 << 20
+
+// Sniffed content types accepted for KYC documents
+var documentContentTypes = map[string]bool{"application/pdf": true, "image/jpeg": true, "image/png": true}
+
+const kycDocumentColumns = `document_id, customer_id, document_type, file_name, content_type, size_bytes, sha256, status,
+	uploaded_by, reviewed_by, review_note, created_at, reviewed_at`
+
+func scanKYCDocument(row interface{ Scan(...interface{}) error }, d *models.KYCDocument) error {
+	return row.Scan(&d.DocumentID, &d.CustomerID, &d.DocumentType, &d.FileName, &d.ContentType, &d.SizeBytes, &d.SHA256, &d.Status,
+		&d.UploadedBy, &d.ReviewedBy, &d.ReviewNote, &d.CreatedAt, &d.ReviewedAt)
+}
+
+// refuseUnverified tells the caller a customer must complete KYC before moving money
+func refuseUnverified(w http.ResponseWriter) {
+	respondWithErrorCode(w, http.StatusForbidden, "kyc_unverified", "Customer identity has not been verified")
+}
+
+// UploadKYCDocument stores a document sent as multipart form data with fields
+// "document_type" and "file". Customers can upload their own documents.
+func UploadKYCDocument(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	customerID, ok := customerIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() && (actor.CustomerID == nil || *actor.CustomerID != customerID) {
+		respondWithError(w, http.StatusForbidden, "Not allowed to upload documents for this customer")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxDocumentSize+1<<20) // Room for the multipart envelope
+	if err := r.ParseMultipartForm(maxDocumentSize); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Document must be multipart form data of at most 10 MB")
+		return
+	}
+	docType := r.FormValue("document_type")
+	if !kyc.IsDocumentType(docType) {
+		respondWithError(w, http.StatusBadRequest, "document_type must be 'id' or 'proof_of_address'")
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "A file is required")
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, maxDocumentSize+1))
+	if err != nil {
+		log.Printf("Error reading uploaded document: %v", err)
+		respondWithError(w, http.StatusBadRequest, "Failed to read file")
+		return
+	}
+	if len(content) == 0 || len(content) > maxDocumentSize {
+		respondWithError(w, http.StatusBadRequest, "File must be between 1 byte and 10 MB")
+		return
+	}
+	// Trust the bytes, not the client's declared type
+	contentType := http.DetectContentType(content)
+	if !documentContentTypes[contentType] {
+		respondWithError(w, http.StatusBadRequest, "File must be a PDF, JPEG or PNG")
+		return
+	}
+	fileName := filepath.Base(header.Filename)
+	if len(fileName) > 255 {
+		fileName = fileName[:255]
+	}
+	sum := sha256.Sum256(content)
+
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM customers WHERE customer_id = ?)", customerID).Scan(&exists); err != nil {
+		log.Printf("Error checking customer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload document")
+		return
+	}
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Customer not found")
+		return
+	}
+
+	key, err := kyc.NewStorageKey(customerID)
+	if err != nil {
+		log.Printf("Error creating document key: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload document")
+		return
+	}
+	if err := kyc.Documents.Put(key, bytes.NewReader(content)); err != nil {
+		log.Printf("Error storing document: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload document")
+		return
+	}
+	// The stored file is orphaned unless the row referencing it is committed
+	committed := false
+	defer func() {
+		if !committed {
+			if err := kyc.Documents.Delete(key); err != nil {
+				log.Printf("Error removing orphaned document %s: %v", key, err)
+			}
+		}
+	}()
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for document upload: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload document")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	result, err := tx.Exec(`INSERT INTO kyc_documents (customer_id, document_type, file_name, content_type, size_bytes, sha256, storage_key, uploaded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, customerID, docType, fileName, contentType, len(content), hex.EncodeToString(sum[:]), key, actor.UserID)
+	if err != nil {
+		log.Printf("Error recording document: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload document")
+		return
+	}
+	documentID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for document: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload document")
+		return
+	}
+	status, err := kyc.UpdateStatus(tx, customerID)
+	if err != nil {
+		log.Printf("Error updating KYC status: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload document")
+		return
+	}
+
+	var doc models.KYCDocument
+	if err := scanKYCDocument(tx.QueryRow("SELECT "+kycDocumentColumns+" FROM kyc_documents WHERE document_id = ?", documentID), &doc); err != nil {
+		log.Printf("Error reading back document: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload document")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "kyc_document.upload", EntityType: "kyc_document", EntityID: strconv.Itoa(doc.DocumentID),
+		After: map[string]interface{}{"customer_id": customerID, "document_type": docType, "sha256": doc.SHA256, "customer_kyc_status": status}})
+	if err != nil {
+		log.Printf("Error writing audit log for document upload: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload document")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing document upload: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload document")
+		return
+	}
+	committed = true
+	respondWithJSON(w, http.StatusCreated, doc)
+}
+
+// GetKYCDocuments lists a customer's documents, newest first
+func GetKYCDocuments(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	customerID, ok := customerIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() && (actor.CustomerID == nil || *actor.CustomerID != customerID) {
+		respondWithError(w, http.StatusForbidden, "Not allowed to view documents of this customer")
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT "+kycDocumentColumns+" FROM kyc_documents WHERE customer_id = ? ORDER BY document_id DESC", customerID)
+	if err != nil {
+		log.Printf("Error listing documents: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve documents")
+		return
+	}
+	defer rows.Close()
+	writeKYCDocuments(w, rows)
+}
+
+// GetKYCDocumentContent downloads the stored file of a document
+func GetKYCDocumentContent(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	customerID, ok := customerIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() && (actor.CustomerID == nil || *actor.CustomerID != customerID) {
+		respondWithError(w, http.StatusForbidden, "Not allowed to view documents of this customer")
+		return
+	}
+	documentID, err := strconv.Atoi(mux.Vars(r)["documentId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	var key, fileName, contentType string
+	err = db.DB.QueryRow("SELECT storage_key, file_name, content_type FROM kyc_documents WHERE document_id = ? AND customer_id = ?",
+		documentID, customerID).Scan(&key, &fileName, &contentType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Document not found")
+		} else {
+			log.Printf("Error fetching document: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve document")
+		}
+		return
+	}
+	content, err := kyc.Documents.Get(key)
+	if err != nil {
+		if err == blobstore.ErrNotFound {
+			log.Printf("Document %d is missing from the blob store (key %s)", documentID, key)
+		} else {
+			log.Printf("Error opening document %d: %v", documentID, err)
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve document")
+		return
+	}
+	defer content.Close()
+
+	// Viewing identity documents is itself audited
+	if !auditAccess(w, r, audit.Entry{Action: "kyc_document.view", EntityType: "kyc_document", EntityID: strconv.Itoa(documentID)}, "Failed to retrieve document") {
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(fileName))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("Error sending document %d: %v", documentID, err)
+	}
+}
+
+// GetKYCReviewQueue lists documents awaiting review, oldest first
+func GetKYCReviewQueue(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can review KYC documents")
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT "+kycDocumentColumns+" FROM kyc_documents WHERE status = ? ORDER BY created_at, document_id LIMIT 500",
+		kyc.DocumentPending)
+	if err != nil {
+		log.Printf("Error listing KYC review queue: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve documents")
+		return
+	}
+	defer rows.Close()
+	writeKYCDocuments(w, rows)
+}
+
+func writeKYCDocuments(w http.ResponseWriter, rows *sql.Rows) {
+	docs := []models.KYCDocument{}
+	for rows.Next() {
+		var d models.KYCDocument
+		if err := scanKYCDocument(rows, &d); err != nil {
+			log.Printf("Error scanning document: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve documents")
+			return
+		}
+		docs = append(docs, d)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating documents: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve documents")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, docs)
+}
+
+// ApproveKYCDocument accepts a document; the customer is verified once every required
+// document type has an approved latest document
+func ApproveKYCDocument(w http.ResponseWriter, r *http.Request) {
+	reviewKYCDocument(w, r, kyc.DocumentApproved, "kyc_document.approve")
+}
+
+// RejectKYCDocument refuses a document; the customer must upload a replacement
+func RejectKYCDocument(w http.ResponseWriter, r *http.Request) {
+	reviewKYCDocument(w, r, kyc.DocumentRejected, "kyc_document.reject")
+}
+
+func reviewKYCDocument(w http.ResponseWriter, r *http.Request, status, action string) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can review KYC documents")
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+	var req models.ReviewKYCDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > 255 {
+		respondWithError(w, http.StatusBadRequest, "Note must be at most 255 characters")
+		return
+	}
+	// A customer is told why their document was refused
+	if status == kyc.DocumentRejected && req.Note == "" {
+		respondWithError(w, http.StatusBadRequest, "A note explaining the rejection is required")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for KYC review: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review document")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var customerID, uploadedBy int
+	var current string
+	err = tx.QueryRow("SELECT customer_id, uploaded_by, status FROM kyc_documents WHERE document_id = ? FOR UPDATE", id).Scan(&customerID, &uploadedBy, &current)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Document not found")
+		} else {
+			log.Printf("Error fetching KYC document: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to review document")
+		}
+		return
+	}
+	if current != kyc.DocumentPending {
+		respondWithError(w, http.StatusConflict, "Document has already been "+current)
+		return
+	}
+	// Whoever uploaded a document on a customer's behalf cannot also approve it
+	if uploadedBy == actor.UserID {
+		respondWithError(w, http.StatusForbidden, "Documents must be reviewed by someone other than the uploader")
+		return
+	}
+
+	_, err = tx.Exec("UPDATE kyc_documents SET status = ?, reviewed_by = ?, review_note = ?, reviewed_at = NOW() WHERE document_id = ?",
+		status, actor.UserID, req.Note, id)
+	if err != nil {
+		log.Printf("Error updating KYC document: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review document")
+		return
+	}
+	customerStatus, err := kyc.UpdateStatus(tx, customerID)
+	if err != nil {
+		log.Printf("Error updating customer KYC status: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review document")
+		return
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: action, EntityType: "kyc_document", EntityID: strconv.Itoa(id),
+		Before: map[string]string{"status": current},
+		After:  map[string]interface{}{"status": status, "note": req.Note, "customer_id": customerID, "customer_kyc_status": customerStatus}})
+	if err != nil {
+		log.Printf("Error writing audit log for KYC review: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review document")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing KYC review: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review document")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"document_id": id, "status": status, "customer_kyc_status": customerStatus})
+}
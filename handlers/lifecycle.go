@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"banking-app/approvals"
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+	"banking-app/outbox"
+
+	"github.com/gorilla/mux"
+)
+
+// refuseAccountStatus tells the caller an account's status does not allow the movement
+func refuseAccountStatus(w http.ResponseWriter, a models.Account) {
+	code := "account_" + a.Status
+	if a.AccountType == ledger.AccountTerm && a.Status != ledger.StatusClosed {
+		code = "term_deposit"
+	}
+	respondWithErrorCode(w, http.StatusForbidden, code, ledger.Refusal(a))
+}
+
+// ActivateAccount opens a pending account for use
+func ActivateAccount(w http.ResponseWriter, r *http.Request) {
+	transitionAccount(w, r, ledger.StatusPending, ledger.StatusActive, "account.activate")
+}
+
+// FreezeAccount blocks all money movement on an account
+func FreezeAccount(w http.ResponseWriter, r *http.Request) {
+	transitionAccount(w, r, "", ledger.StatusFrozen, "account.freeze")
+}
+
+// UnfreezeAccount lifts a freeze
+func UnfreezeAccount(w http.ResponseWriter, r *http.Request) {
+	transitionAccount(w, r, ledger.StatusFrozen, ledger.StatusActive, "account.unfreeze")
+}
+
+// MarkAccountDormant stops withdrawals from a long unused account until it is reactivated
+func MarkAccountDormant(w http.ResponseWriter, r *http.Request) {
+	transitionAccount(w, r, ledger.StatusActive, ledger.StatusDormant, "account.dormant")
+}
+
+// ReactivateAccount returns a dormant account to use
+func ReactivateAccount(w http.ResponseWriter, r *http.Request) {
+	transitionAccount(w, r, ledger.StatusDormant, ledger.StatusActive, "account.reactivate")
+}
+
+// validReason trims a status change reason, writing a 400 response if it is missing or too long
+func validReason(w http.ResponseWriter, reason *string) bool {
+	*reason = strings.TrimSpace(*reason)
+	if *reason == "" || len(*reason) > 255 {
+		respondWithError(w, http.StatusBadRequest, "A reason of at most 255 characters is required")
+		return false
+	}
+	return true
+}
+
+// lockAccountForStatusChange locks an account and checks the actor is staff of its
+// branch, writing an error response if not
+func lockAccountForStatusChange(w http.ResponseWriter, tx *sql.Tx, actor auth.Actor, accountNumber string) (models.Account, bool) {
+	account, err := ledger.LockAccount(tx, accountNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error fetching account for status change: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to change account status")
+		}
+		return account, false
+	}
+	if !actor.IsStaffOf(account.BranchID) {
+		respondWithError(w, http.StatusForbidden, "Only staff of the account's branch can change its status")
+		return account, false
+	}
+	return account, true
+}
+
+// transitionAccount moves the account in the route to status to. If from is set the
+// account must currently have that status, so that e.g. unfreezing a dormant account fails.
+func transitionAccount(w http.ResponseWriter, r *http.Request, from, to, action string) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.ChangeAccountStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if !validReason(w, &req.Reason) {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for account status change: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to change account status")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	account, ok := lockAccountForStatusChange(w, tx, actor, mux.Vars(r)["accountNumber"])
+	if !ok {
+		return
+	}
+	if (from != "" && account.Status != from) || !ledger.CanTransition(account.Status, to) {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Account cannot move from '%s' to '%s'", account.Status, to))
+		return
+	}
+
+	updated, err := changeAccountStatus(tx, r, actor, account, to, req.Reason, action, nil)
+	if err != nil {
+		log.Printf("Error changing account status: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to change account status")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing account status change: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to change account status")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// changeAccountStatus stores the new status with its history, audit entry and event.
+// extra is added to the audit entry and event payload.
+func changeAccountStatus(tx *sql.Tx, r *http.Request, actor auth.Actor, account models.Account, to, reason, action string, extra map[string]interface{}) (models.Account, error) {
+	query := "UPDATE accounts SET status = ? WHERE account_id = ?"
+	if to == ledger.StatusClosed {
+		// A closed account keeps no credit facility
+		query = "UPDATE accounts SET status = ?, closed_date = CURDATE(), overdraft_limit = 0 WHERE account_id = ?"
+	}
+	if _, err := tx.Exec(query, to, account.AccountID); err != nil {
+		return account, fmt.Errorf("updating status of account %d: %w", account.AccountID, err)
+	}
+	_, err := tx.Exec("INSERT INTO account_status_events (account_id, from_status, to_status, reason, actor_user_id) VALUES (?, ?, ?, ?, ?)",
+		account.AccountID, account.Status, to, reason, actor.UserID)
+	if err != nil {
+		return account, fmt.Errorf("recording status change of account %d: %w", account.AccountID, err)
+	}
+
+	updated, err := ledger.LockAccount(tx, account.AccountNumber)
+	if err != nil {
+		return account, fmt.Errorf("reading back account %d: %w", account.AccountID, err)
+	}
+	after := map[string]interface{}{"status": to, "reason": reason}
+	for k, v := range extra {
+		after[k] = v
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: action, EntityType: "account", EntityID: account.AccountNumber,
+		Before: map[string]string{"status": account.Status}, After: after})
+	if err != nil {
+		return account, err
+	}
+	payload := map[string]interface{}{"account_number": account.AccountNumber, "from_status": account.Status}
+	for k, v := range after {
+		payload[k] = v
+	}
+	if err := outbox.Enqueue(tx, outbox.EventStatusChanged, account.AccountNumber, payload); err != nil {
+		return account, err
+	}
+	return updated, nil
+}
+
+// closureBlockers are the kinds of activity that must be finished or cancelled before
+// an account can be closed, each counted by a query taking the account ID as every argument
+var closureBlockers = []struct {
+	name  string
+	query string
+}{
+	{"card holds", "SELECT COUNT(*) FROM card_authorizations WHERE status = 'held' AND account_id = ?"},
+	{"transfers held for review", "SELECT COUNT(*) FROM pending_transfers WHERE status = 'pending' AND (from_account_id = ? OR to_account_id = ?)"},
+	{"transfers awaiting signatures", `SELECT COUNT(*) FROM transfer_approvals
+		WHERE status IN ('pending', 'approved') AND (from_account_id = ? OR to_account_id = ?)`},
+	{"scheduled transfers", "SELECT COUNT(*) FROM scheduled_transfers WHERE status = 'scheduled' AND (from_account_id = ? OR to_account_id = ?)"},
+	{"direct debit mandates", `SELECT COUNT(*) FROM direct_debit_mandates m
+		JOIN direct_debit_creditors c ON c.creditor_id = m.creditor_id
+		WHERE m.status = 'active' AND (m.debtor_account_id = ? OR c.account_id = ?)`},
+	{"direct debit collections", `SELECT COUNT(*) FROM direct_debit_collections dc
+		JOIN direct_debit_mandates m ON m.mandate_id = dc.mandate_id
+		JOIN direct_debit_creditors c ON c.creditor_id = m.creditor_id
+		WHERE dc.status = 'pending' AND (m.debtor_account_id = ? OR c.account_id = ?)`},
+}
+
+// outstandingActivity lists the kinds of activity still in flight against an account,
+// including approval requests other than the one with ID self
+func outstandingActivity(tx *sql.Tx, account models.Account, self int64) ([]string, error) {
+	var outstanding []string
+	for _, b := range closureBlockers {
+		args := make([]interface{}, strings.Count(b.query, "?"))
+		for i := range args {
+			args[i] = account.AccountID
+		}
+		var n int
+		if err := tx.QueryRow(b.query, args...).Scan(&n); err != nil {
+			return nil, fmt.Errorf("counting %s of account %d: %w", b.name, account.AccountID, err)
+		}
+		if n > 0 {
+			outstanding = append(outstanding, b.name)
+		}
+	}
+
+	// Requests on the account itself, reversals of its transactions, credits for its
+	// disputes, and transfers into it
+	var requests int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM approval_requests ar
+		WHERE ar.status IN ('pending', 'approved') AND ar.approval_request_id <> ? AND (
+			(ar.entity_type = 'account' AND (ar.entity_id = ? OR ar.body->>'$.to_account_number' = ?))
+			OR (ar.entity_type = 'transaction' AND ar.entity_id IN (SELECT CAST(transaction_id AS CHAR) FROM transactions WHERE account_id = ?))
+			OR (ar.entity_type = 'dispute' AND ar.entity_id IN (SELECT CAST(dispute_id AS CHAR) FROM disputes WHERE account_id = ?)))`,
+		self, account.AccountNumber, account.AccountNumber, account.AccountID, account.AccountID).Scan(&requests)
+	if err != nil {
+		return nil, fmt.Errorf("counting approval requests of account %d: %w", account.AccountID, err)
+	}
+	if requests > 0 {
+		outstanding = append(outstanding, "approval requests")
+	}
+	return outstanding, nil
+}
+
+// CloseAccount closes an account for good. An overdrawn account must be repaid first; any
+// remaining balance is paid out to another active account of the same customer. Payments,
+// mandates and approvals still in flight must be finished or cancelled before closing.
+func CloseAccount(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.CloseAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for account closure: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to close account")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	closeAccount(w, r, tx, actor, mux.Vars(r)["accountNumber"], req, 0)
+}
+
+// closeAccount closes an account inside tx, committing it and writing the response.
+// approved is the approval request being executed, 0 for a new closure.
+func closeAccount(w http.ResponseWriter, r *http.Request, tx *sql.Tx, actor auth.Actor, accountNumber string, req models.CloseAccountRequest, approved int64) {
+	if !validReason(w, &req.Reason) {
+		return
+	}
+	req.PayoutAccountNumber = strings.TrimSpace(req.PayoutAccountNumber)
+
+	account, ok := lockAccountForStatusChange(w, tx, actor, accountNumber)
+	if !ok {
+		return
+	}
+	if account.AccountType == ledger.AccountTerm {
+		respondWithError(w, http.StatusConflict, "A term deposit closes at maturity or by early withdrawal")
+		return
+	}
+	if !ledger.CanTransition(account.Status, ledger.StatusClosed) {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Account cannot be closed while '%s'", account.Status))
+		return
+	}
+	if account.Balance < 0 {
+		respondWithError(w, http.StatusConflict, "Account is overdrawn; the balance must be repaid before closing")
+		return
+	}
+
+	// Nothing may still be in flight against the account but this closure
+	outstanding, err := outstandingActivity(tx, account, approved)
+	if err != nil {
+		log.Printf("Error checking outstanding activity before closure: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to close account")
+		return
+	}
+	if len(outstanding) > 0 {
+		respondWithErrorCode(w, http.StatusConflict, "account_has_outstanding_activity",
+			"Account cannot be closed while it has outstanding "+strings.Join(outstanding, ", "))
+		return
+	}
+
+	var payout models.Account
+	if account.Balance > 0 {
+		if req.PayoutAccountNumber == "" {
+			respondWithError(w, http.StatusBadRequest, "A payout account is required to close an account with a balance")
+			return
+		}
+		if req.PayoutAccountNumber == account.AccountNumber {
+			respondWithError(w, http.StatusBadRequest, "Payout account must be a different account")
+			return
+		}
+		payout, err = ledger.LockAccount(tx, req.PayoutAccountNumber)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusNotFound, "Payout account not found")
+			} else {
+				log.Printf("Error fetching payout account: %v", err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to close account")
+			}
+			return
+		}
+		// The balance belongs to the customer; staff cannot redirect it elsewhere
+		if payout.CustomerID != account.CustomerID {
+			respondWithError(w, http.StatusBadRequest, "Payout account must belong to the same customer")
+			return
+		}
+		if !ledger.CanCredit(payout) {
+			refuseAccountStatus(w, payout)
+			return
+		}
+	}
+
+	if holdForApproval(w, r, tx, actor, approved, approvals.Pending{Operation: approvals.OpAccountClosure, EntityType: "account", EntityID: account.AccountNumber,
+		BranchID: account.BranchID, Amount: account.Balance, RouteVars: map[string]string{"accountNumber": account.AccountNumber}, Body: req}) {
+		return
+	}
+
+	extra := map[string]interface{}{}
+	if account.Balance > 0 {
+		if err := ledger.Transfer(tx, account, payout, account.Balance); err != nil {
+			log.Printf("Error paying out balance on closure: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to close account")
+			return
+		}
+		err = outbox.Enqueue(tx, outbox.EventTransferred, account.AccountNumber, map[string]interface{}{
+			"from_account_number": account.AccountNumber,
+			"to_account_number":   payout.AccountNumber,
+			"amount":              account.Balance,
+		})
+		if err != nil {
+			log.Printf("Error writing transfer event: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to close account")
+			return
+		}
+		extra["payout_account_number"] = payout.AccountNumber
+		extra["payout_amount"] = account.Balance
+	}
+
+	updated, err := changeAccountStatus(tx, r, actor, account, ledger.StatusClosed, req.Reason, "account.close", extra)
+	if err != nil {
+		log.Printf("Error closing account: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to close account")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing account closure: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to close account")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// GetAccountStatusHistory lists the status changes of an account, oldest first
+func GetAccountStatusHistory(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	account, err := ledger.GetAccount(mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error fetching account for status history: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve status history")
+		}
+		return
+	}
+	if _, ok := authorizeAccount(w, db.DB, actor, account, false); !ok {
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT event_id, from_status, to_status, reason, actor_user_id, created_at
+		FROM account_status_events WHERE account_id = ? ORDER BY event_id`, account.AccountID)
+	if err != nil {
+		log.Printf("Error listing account status events: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve status history")
+		return
+	}
+	defer rows.Close()
+
+	events := []models.AccountStatusEvent{}
+	for rows.Next() {
+		var e models.AccountStatusEvent
+		if err := rows.Scan(&e.EventID, &e.FromStatus, &e.ToStatus, &e.Reason, &e.ActorUserID, &e.CreatedAt); err != nil {
+			log.Printf("Error scanning account status event: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve status history")
+			return
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating account status events: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve status history")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"banking-app/audit"
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/limits"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+// validLimits checks that no limit in l is negative, writing a 400 response if one is
+func validLimits(w http.ResponseWriter, l models.TransactionLimits) bool {
+	for _, v := range []*float64{l.PerTransaction, l.DailyAmount, l.MonthlyAmount} {
+		if v != nil && *v < 0 {
+			respondWithError(w, http.StatusBadRequest, "Limits cannot be negative")
+			return false
+		}
+	}
+	if l.DailyCount != nil && *l.DailyCount < 0 {
+		respondWithError(w, http.StatusBadRequest, "Limits cannot be negative")
+		return false
+	}
+	return true
+}
+
+// GetTransactionLimits lists the default limits by account type and customer tier
+func GetTransactionLimits(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can view limit configuration")
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT account_type, customer_tier, per_transaction, daily_amount, monthly_amount, daily_count
+		FROM transaction_limits ORDER BY account_type, customer_tier`)
+	if err != nil {
+		log.Printf("Error listing transaction limits: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve limits")
+		return
+	}
+	defer rows.Close()
+
+	all := []models.TransactionLimits{}
+	for rows.Next() {
+		var l models.TransactionLimits
+		if err := rows.Scan(&l.AccountType, &l.CustomerTier, &l.PerTransaction, &l.DailyAmount, &l.MonthlyAmount, &l.DailyCount); err != nil {
+			log.Printf("Error scanning transaction limits: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve limits")
+			return
+		}
+		all = append(all, l)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating transaction limits: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve limits")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, all)
+}
+
+// UpdateTransactionLimits sets the default limits for an account type and customer tier
+func UpdateTransactionLimits(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	accountType, tier := vars["accountType"], vars["tier"]
+	if accountType != "savings" && accountType != "current" {
+		respondWithError(w, http.StatusBadRequest, "Account type must be 'savings' or 'current'")
+		return
+	}
+	if !limits.IsTier(tier) {
+		respondWithError(w, http.StatusBadRequest, "Tier must be 'standard', 'premium' or 'private'")
+		return
+	}
+
+	var req models.TransactionLimits
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if !validLimits(w, req) {
+		return
+	}
+	req.AccountType, req.CustomerTier = accountType, tier
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for transaction limits: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	before, err := limits.Defaults(tx, accountType, tier)
+	if err != nil {
+		log.Printf("Error loading transaction limits: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+	_, err = tx.Exec(`INSERT INTO transaction_limits (account_type, customer_tier, per_transaction, daily_amount, monthly_amount, daily_count)
+		VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE per_transaction = VALUES(per_transaction), daily_amount = VALUES(daily_amount),
+		monthly_amount = VALUES(monthly_amount), daily_count = VALUES(daily_count)`,
+		accountType, tier, req.PerTransaction, req.DailyAmount, req.MonthlyAmount, req.DailyCount)
+	if err != nil {
+		log.Printf("Error updating transaction limits: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "limits.update_defaults", EntityType: "transaction_limits", EntityID: accountType + "/" + tier, Before: before, After: req})
+	if err != nil {
+		log.Printf("Error writing audit log for transaction limits: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction limits: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, req)
+}
+
+// GetAccountLimits returns the limits that apply to an account and how much of them is used
+func GetAccountLimits(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	account, err := ledger.GetAccount(mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error getting account for limits: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve limits")
+		}
+		return
+	}
+	if _, ok := authorizeAccount(w, db.DB, actor, account, false); !ok {
+		return
+	}
+
+	effective, err := limits.Effective(db.DB, account)
+	if err != nil {
+		log.Printf("Error getting effective limits: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve limits")
+		return
+	}
+	override, err := limits.Override(db.DB, account.AccountID)
+	if err != nil {
+		log.Printf("Error getting limit override: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve limits")
+		return
+	}
+	usage, err := limits.Usage(db.DB, account.AccountID)
+	if err != nil {
+		log.Printf("Error getting limit usage: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve limits")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"account_number": account.AccountNumber,
+		"effective":      effective,
+		"override":       override,
+		"usage":          usage,
+	})
+}
+
+// SetAccountLimits overrides the default limits of one account.
+// Fields left null fall back to the defaults.
+func SetAccountLimits(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.TransactionLimits
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if !validLimits(w, req) {
+		return
+	}
+	req.AccountType, req.CustomerTier = "", ""
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for limit override: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	account, err := ledger.LockAccount(tx, mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error fetching account for limit override: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		}
+		return
+	}
+	if !actor.IsStaffOf(account.BranchID) {
+		respondWithError(w, http.StatusForbidden, "Only staff of the account's branch can change its limits")
+		return
+	}
+
+	before, err := limits.Override(tx, account.AccountID)
+	if err != nil {
+		log.Printf("Error loading limit override: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+	_, err = tx.Exec(`INSERT INTO account_limit_overrides (account_id, per_transaction, daily_amount, monthly_amount, daily_count)
+		VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE per_transaction = VALUES(per_transaction), daily_amount = VALUES(daily_amount),
+		monthly_amount = VALUES(monthly_amount), daily_count = VALUES(daily_count)`,
+		account.AccountID, req.PerTransaction, req.DailyAmount, req.MonthlyAmount, req.DailyCount)
+	if err != nil {
+		log.Printf("Error saving limit override: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "account.limits_override", EntityType: "account", EntityID: account.AccountNumber, Before: before, After: req})
+	if err != nil {
+		log.Printf("Error writing audit log for limit override: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing limit override: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, req)
+}
+
+// DeleteAccountLimits removes an account's override so the defaults apply again
+func DeleteAccountLimits(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for limit override removal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	account, err := ledger.LockAccount(tx, mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error fetching account for limit override removal: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		}
+		return
+	}
+	if !actor.IsStaffOf(account.BranchID) {
+		respondWithError(w, http.StatusForbidden, "Only staff of the account's branch can change its limits")
+		return
+	}
+
+	before, err := limits.Override(tx, account.AccountID)
+	if err != nil {
+		log.Printf("Error loading limit override: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+	if before == nil {
+		respondWithError(w, http.StatusNotFound, "Account has no limit override")
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM account_limit_overrides WHERE account_id = ?", account.AccountID); err != nil {
+		log.Printf("Error deleting limit override: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "account.limits_override_delete", EntityType: "account", EntityID: account.AccountNumber, Before: before})
+	if err != nil {
+		log.Printf("Error writing audit log for limit override removal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing limit override removal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update limits")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Limit override removed"})
+}
+
+// UpdateCustomerTier moves a customer to another tier, changing their default limits
+func UpdateCustomerTier(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can change a customer's tier")
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid customer ID")
+		return
+	}
+
+	var req models.UpdateCustomerTierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if !limits.IsTier(req.Tier) {
+		respondWithError(w, http.StatusBadRequest, "Tier must be 'standard', 'premium' or 'private'")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for customer tier: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update tier")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var before string
+	if err := tx.QueryRow("SELECT tier FROM customers WHERE customer_id = ? FOR UPDATE", id).Scan(&before); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Customer not found")
+		} else {
+			log.Printf("Error getting customer tier: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update tier")
+		}
+		return
+	}
+	if _, err := tx.Exec("UPDATE customers SET tier = ? WHERE customer_id = ?", req.Tier, id); err != nil {
+		log.Printf("Error updating customer tier: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update tier")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "customer.tier_update", EntityType: "customer", EntityID: strconv.Itoa(id),
+		Before: map[string]string{"tier": before}, After: map[string]string{"tier": req.Tier}})
+	if err != nil {
+		log.Printf("Error writing audit log for customer tier: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update tier")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing customer tier: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update tier")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"customer_id": id, "tier": req.Tier})
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"banking-app/approvals"
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+// SetOverdraft grants or changes the arranged overdraft of a current account
+func SetOverdraft(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.SetOverdraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for overdraft update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update overdraft")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	setOverdraft(w, r, tx, actor, mux.Vars(r)["accountNumber"], req, 0)
+}
+
+// setOverdraft sets the overdraft in req on an account inside tx, committing it and
+// writing the response. approved is the approval request being executed, 0 if none.
+func setOverdraft(w http.ResponseWriter, r *http.Request, tx *sql.Tx, actor auth.Actor, accountNumber string, req models.SetOverdraftRequest, approved int64) {
+	if req.Limit < 0 {
+		respondWithError(w, http.StatusBadRequest, "Overdraft limit cannot be negative")
+		return
+	}
+	if req.InterestRate != nil && (*req.InterestRate < 0 || *req.InterestRate > 100) {
+		respondWithError(w, http.StatusBadRequest, "Interest rate must be between 0 and 100")
+		return
+	}
+	updateOverdraft(w, r, tx, actor, accountNumber, req, "account.overdraft_set", approved)
+}
+
+// RevokeOverdraft removes the arranged overdraft of a current account. An account that
+// is already overdrawn stays so; it is treated as unarranged from then on.
+func RevokeOverdraft(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for overdraft update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update overdraft")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	updateOverdraft(w, r, tx, actor, mux.Vars(r)["accountNumber"], models.SetOverdraftRequest{}, "account.overdraft_revoke", 0)
+}
+
+// updateOverdraft applies a new limit, and optionally rate, to an account
+func updateOverdraft(w http.ResponseWriter, r *http.Request, tx *sql.Tx, actor auth.Actor, accountNumber string, req models.SetOverdraftRequest, action string, approved int64) {
+	account, err := ledger.LockAccount(tx, accountNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error fetching account for overdraft update: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update overdraft")
+		}
+		return
+	}
+	if !actor.IsStaffOf(account.BranchID) {
+		respondWithError(w, http.StatusForbidden, "Only staff of the account's branch can manage its overdraft")
+		return
+	}
+	if account.AccountType != "current" {
+		respondWithError(w, http.StatusBadRequest, "Overdrafts are only available on current accounts")
+		return
+	}
+	// Only raising the limit extends credit; reductions and revocations need no second person
+	if req.Limit > account.OverdraftLimit && holdForApproval(w, r, tx, actor, approved, approvals.Pending{Operation: approvals.OpOverdraft, EntityType: "account",
+		EntityID: account.AccountNumber, BranchID: account.BranchID, Amount: req.Limit, RouteVars: map[string]string{"accountNumber": accountNumber}, Body: req}) {
+		return
+	}
+
+	updated := account
+	updated.OverdraftLimit = req.Limit
+	if req.InterestRate != nil {
+		updated.OverdraftRate = *req.InterestRate
+	}
+	_, err = tx.Exec("UPDATE accounts SET overdraft_limit = ?, overdraft_rate = ? WHERE account_id = ?",
+		updated.OverdraftLimit, updated.OverdraftRate, account.AccountID)
+	if err != nil {
+		log.Printf("Error updating overdraft: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update overdraft")
+		return
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: action, EntityType: "account", EntityID: account.AccountNumber,
+		Before: map[string]float64{"overdraft_limit": account.OverdraftLimit, "overdraft_rate": account.OverdraftRate},
+		After:  map[string]float64{"overdraft_limit": updated.OverdraftLimit, "overdraft_rate": updated.OverdraftRate}})
+	if err != nil {
+		log.Printf("Error writing audit log for overdraft update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update overdraft")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing overdraft update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update overdraft")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+	"banking-app/payees"
+
+	"github.com/gorilla/mux"
+)
+
+// payeeOwner checks that the actor may manage the payees of the customer in the URL
+func payeeOwner(w http.ResponseWriter, r *http.Request, actor auth.Actor) (int, bool) {
+	customerID, ok := customerIDFromRequest(w, r)
+	if !ok {
+		return 0, false
+	}
+	if !actor.IsEmployee() && (actor.CustomerID == nil || *actor.CustomerID != customerID) {
+		respondWithError(w, http.StatusForbidden, "Not allowed to manage payees of this customer")
+		return 0, false
+	}
+	return customerID, true
+}
+
+// GetPayees lists the saved payees of a customer
+func GetPayees(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	customerID, ok := payeeOwner(w, r, actor)
+	if !ok {
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT "+payees.Columns+" FROM payees WHERE customer_id = ? ORDER BY name, payee_id", customerID)
+	if err != nil {
+		log.Printf("Error listing payees: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve payees")
+		return
+	}
+	defer rows.Close()
+
+	list := []models.Payee{}
+	for rows.Next() {
+		var p models.Payee
+		if err := payees.Scan(rows, &p); err != nil {
+			log.Printf("Error scanning payee: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve payees")
+			return
+		}
+		list = append(list, p)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating payees: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve payees")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// CreatePayee saves a payee by account number or IBAN after checking the name entered
+// against the destination account's holders. A close or failed match is refused unless
+// the request accepts the mismatch.
+func CreatePayee(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	customerID, ok := payeeOwner(w, r, actor)
+	if !ok {
+		return
+	}
+	var req models.CreatePayeeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Nickname = strings.TrimSpace(req.Nickname)
+	if req.Name == "" || len(req.Name) > 100 {
+		respondWithError(w, http.StatusBadRequest, "Name is required and must be at most 100 characters")
+		return
+	}
+	if len(req.Nickname) > 50 {
+		respondWithError(w, http.StatusBadRequest, "Nickname must be at most 50 characters")
+		return
+	}
+	if (req.AccountNumber == "") == (req.IBAN == "") {
+		respondWithError(w, http.StatusBadRequest, "Give either account_number or iban")
+		return
+	}
+
+	accountNumber := req.AccountNumber
+	var iban *string
+	if req.IBAN != "" {
+		normalized := payees.NormalizeIBAN(req.IBAN)
+		if !payees.ValidIBAN(normalized) {
+			respondWithError(w, http.StatusBadRequest, "Invalid IBAN")
+			return
+		}
+		number, ours := payees.AccountNumber(normalized)
+		if !ours {
+			respondWithError(w, http.StatusBadRequest, "Payments to other banks are not supported")
+			return
+		}
+		accountNumber, iban = number, &normalized
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for payee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save payee")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM customers WHERE customer_id = ?)", customerID).Scan(&exists); err != nil {
+		log.Printf("Error checking customer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save payee")
+		return
+	}
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Customer not found")
+		return
+	}
+
+	destination, err := ledger.GetAccount(accountNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Destination account not found")
+		} else {
+			log.Printf("Error fetching payee account: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to save payee")
+		}
+		return
+	}
+	if !ledger.CanCredit(destination) {
+		refuseAccountStatus(w, destination)
+		return
+	}
+
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM payees WHERE customer_id = ? AND account_number = ?)", customerID, accountNumber).Scan(&exists); err != nil {
+		log.Printf("Error checking existing payee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save payee")
+		return
+	}
+	if exists {
+		respondWithError(w, http.StatusConflict, "A payee with this account is already saved")
+		return
+	}
+
+	match, closest, err := payees.ConfirmName(tx, destination, req.Name)
+	if err != nil {
+		log.Printf("Error confirming payee name: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save payee")
+		return
+	}
+	if match != payees.MatchExact && !req.AcceptMismatch {
+		if match == payees.MatchClose {
+			respondWithErrorCode(w, http.StatusConflict, "payee_close_match",
+				fmt.Sprintf("The account is held by %q; correct the name or set accept_mismatch to save it anyway", closest))
+		} else {
+			respondWithErrorCode(w, http.StatusConflict, "payee_no_match",
+				"The name does not match the account holder; check the details or set accept_mismatch to save it anyway")
+		}
+		return
+	}
+
+	settings, err := payees.GetSettings(tx)
+	if err != nil {
+		log.Printf("Error loading payee settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save payee")
+		return
+	}
+	result, err := tx.Exec(`INSERT INTO payees (customer_id, name, account_number, iban, nickname, name_match, cooling_off_until, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, NOW() + INTERVAL ? HOUR, ?)`,
+		customerID, req.Name, accountNumber, iban, req.Nickname, match, settings.CoolingOffHours, actor.UserID)
+	if err != nil {
+		log.Printf("Error saving payee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save payee")
+		return
+	}
+	payeeID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for payee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save payee")
+		return
+	}
+	p, err := payees.Get(tx, int(payeeID))
+	if err != nil {
+		log.Printf("Error reading back payee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save payee")
+		return
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "payee.create", EntityType: "payee", EntityID: strconv.Itoa(p.PayeeID), After: p})
+	if err != nil {
+		log.Printf("Error writing audit log for payee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save payee")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing payee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save payee")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, p)
+}
+
+// lockPayee loads the payee in the URL for update, checking it belongs to the customer in the URL
+func lockPayee(w http.ResponseWriter, r *http.Request, tx *sql.Tx, customerID int) (models.Payee, bool) {
+	var p models.Payee
+	payeeID, err := strconv.Atoi(mux.Vars(r)["payeeId"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid payee ID")
+		return p, false
+	}
+	err = payees.Scan(tx.QueryRow("SELECT "+payees.Columns+" FROM payees WHERE payee_id = ? AND customer_id = ? FOR UPDATE", payeeID, customerID), &p)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Payee not found")
+		} else {
+			log.Printf("Error locking payee: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update payee")
+		}
+		return p, false
+	}
+	return p, true
+}
+
+// UpdatePayee changes the nickname of a payee. The name and account cannot be changed;
+// the customer saves a new payee instead, which starts its own cooling-off window.
+func UpdatePayee(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	customerID, ok := payeeOwner(w, r, actor)
+	if !ok {
+		return
+	}
+	var req models.UpdatePayeeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.Nickname = strings.TrimSpace(req.Nickname)
+	if len(req.Nickname) > 50 {
+		respondWithError(w, http.StatusBadRequest, "Nickname must be at most 50 characters")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for payee update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update payee")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	p, ok := lockPayee(w, r, tx, customerID)
+	if !ok {
+		return
+	}
+	if _, err := tx.Exec("UPDATE payees SET nickname = ? WHERE payee_id = ?", req.Nickname, p.PayeeID); err != nil {
+		log.Printf("Error updating payee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update payee")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "payee.update", EntityType: "payee", EntityID: strconv.Itoa(p.PayeeID),
+		Before: map[string]interface{}{"nickname": p.Nickname}, After: map[string]interface{}{"nickname": req.Nickname}})
+	if err != nil {
+		log.Printf("Error writing audit log for payee update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update payee")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing payee update: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update payee")
+		return
+	}
+	p.Nickname = req.Nickname
+	respondWithJSON(w, http.StatusOK, p)
+}
+
+// DeletePayee removes a saved payee
+func DeletePayee(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	customerID, ok := payeeOwner(w, r, actor)
+	if !ok {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for payee removal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete payee")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	p, ok := lockPayee(w, r, tx, customerID)
+	if !ok {
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM payees WHERE payee_id = ?", p.PayeeID); err != nil {
+		log.Printf("Error deleting payee: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete payee")
+		return
+	}
+	if err := audit.RecordTx(tx, r, audit.Entry{Action: "payee.delete", EntityType: "payee", EntityID: strconv.Itoa(p.PayeeID), Before: p}); err != nil {
+		log.Printf("Error writing audit log for payee removal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete payee")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing payee removal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete payee")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPayeeSettings returns the cooling-off window and new-payee limit
+func GetPayeeSettings(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can view payee settings")
+		return
+	}
+	s, err := payees.GetSettings(db.DB)
+	if err != nil {
+		log.Printf("Error getting payee settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve payee settings")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, s)
+}
+
+// UpdatePayeeSettings changes the cooling-off window of payees saved from now on and the
+// new-payee limit, which applies to every payee still in its window
+func UpdatePayeeSettings(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	var req models.PayeeSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.CoolingOffHours < 0 || req.NewPayeeLimit < 0 {
+		respondWithError(w, http.StatusBadRequest, "Settings cannot be negative")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for payee settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update payee settings")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	before, err := payees.GetSettings(tx)
+	if err != nil {
+		log.Printf("Error getting payee settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update payee settings")
+		return
+	}
+	if _, err := tx.Exec("UPDATE payee_settings SET cooling_off_hours = ?, new_payee_limit = ? WHERE settings_id = 1", req.CoolingOffHours, req.NewPayeeLimit); err != nil {
+		log.Printf("Error updating payee settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update payee settings")
+		return
+	}
+	if err := audit.RecordTx(tx, r, audit.Entry{Action: "payee_settings.update", EntityType: "payee_settings", EntityID: "1", Before: before, After: req}); err != nil {
+		log.Printf("Error writing audit log for payee settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update payee settings")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing payee settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update payee settings")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, req)
+}
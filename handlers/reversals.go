@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"banking-app/approvals"
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/db"
+	"banking-app/disputes"
+	"banking-app/eod"
+	"banking-app/fees"
+	"banking-app/ledger"
+	"banking-app/models"
+	"banking-app/outbox"
+
+	"github.com/gorilla/mux"
+)
+
+// ReverseTransaction corrects a posted transaction with a contra entry on the same
+// account. Both legs of a transfer or fee are reversed together, whichever leg is named.
+// A transaction is reversed at most once and a reversal cannot itself be reversed.
+func ReverseTransaction(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can reverse transactions")
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+	var req models.ReverseTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for reversal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to reverse transaction")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	reverseTransaction(w, r, tx, actor, id, req, 0)
+}
+
+// reverseTransaction reverses transaction id inside tx, committing it and writing the
+// response. approved is the approval request being executed, 0 for a new reversal.
+func reverseTransaction(w http.ResponseWriter, r *http.Request, tx *sql.Tx, actor auth.Actor, id int64, req models.ReverseTransactionRequest, approved int64) {
+	if !validReason(w, &req.Reason) {
+		return
+	}
+
+	entry, err := ledger.LockEntry(tx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Transaction not found")
+		} else {
+			log.Printf("Error fetching transaction for reversal: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to reverse transaction")
+		}
+		return
+	}
+	legs := []ledger.Entry{entry}
+	if entry.LinkedID != nil {
+		linked, err := ledger.LockEntry(tx, *entry.LinkedID)
+		if err != nil {
+			log.Printf("Error fetching linked transaction for reversal: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to reverse transaction")
+			return
+		}
+		legs = append(legs, linked)
+	} else if ledger.Unlinked(entry) {
+		respondWithErrorCode(w, http.StatusConflict, "unlinked_leg", fmt.Sprintf("The other leg of transaction %d is not known; correct it with a new transaction", id))
+		return
+	}
+	for _, leg := range legs {
+		if leg.ReversalOf != nil {
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("Transaction %d is a reversal and cannot itself be reversed", leg.TransactionID))
+			return
+		}
+		if leg.ReversedBy != nil {
+			respondWithErrorCode(w, http.StatusConflict, "already_reversed", fmt.Sprintf("Transaction %d was already reversed by transaction %d", leg.TransactionID, *leg.ReversedBy))
+			return
+		}
+		if leg.Type == ledger.TypeDisputeCredit {
+			respondWithError(w, http.StatusConflict, "A dispute credit is reversed by rejecting or withdrawing its dispute")
+			return
+		}
+		if leg.Type == ledger.TypeDirectDebit || leg.Type == ledger.TypeDirectDebitIn {
+			respondWithError(w, http.StatusConflict, "A direct debit is refunded through its collection")
+			return
+		}
+		// Reversing a disputed debit would refund it twice once the dispute is credited
+		disputeID, err := disputes.Unresolved(tx, leg.TransactionID)
+		if err != nil {
+			log.Printf("Error checking disputes of transaction: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to reverse transaction")
+			return
+		}
+		if disputeID != 0 {
+			respondWithErrorCode(w, http.StatusConflict, "disputed", fmt.Sprintf("Transaction %d is under dispute %d", leg.TransactionID, disputeID))
+			return
+		}
+	}
+
+	accounts := make([]models.Account, len(legs))
+	for i, leg := range legs {
+		if accounts[i], err = ledger.LockAccountByID(tx, leg.AccountID); err != nil {
+			log.Printf("Error locking account for reversal: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to reverse transaction")
+			return
+		}
+	}
+	if !actor.IsStaffOf(accounts[0].BranchID) {
+		respondWithError(w, http.StatusForbidden, "Only staff of the account's branch can reverse its transactions")
+		return
+	}
+	for i, a := range accounts {
+		// Term deposits move only through their own lifecycle
+		if a.AccountType == ledger.AccountTerm {
+			respondWithError(w, http.StatusConflict, "Movements of a term deposit cannot be reversed")
+			return
+		}
+		// A correction may move money on a pending or dormant account, but not past a freeze or closure
+		if a.Status == ledger.StatusFrozen || a.Status == ledger.StatusClosed {
+			refuseAccountStatus(w, a)
+			return
+		}
+		if ledger.IsCredit(legs[i].Type) && ledger.Available(a) < legs[i].Amount {
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("Account %s does not hold enough to reverse a credit of %.2f", a.AccountNumber, legs[i].Amount))
+			return
+		}
+	}
+
+	if holdForApproval(w, r, tx, actor, approved, approvals.Pending{Operation: approvals.OpReversal, EntityType: "transaction", EntityID: strconv.FormatInt(id, 10),
+		BranchID: accounts[0].BranchID, Amount: entry.Amount, RouteVars: map[string]string{"id": strconv.FormatInt(id, 10)}, Body: req}) {
+		return
+	}
+
+	reversalIDs, err := ledger.Reverse(tx, legs, "Reversal: "+req.Reason)
+	if err != nil {
+		log.Printf("Error reversing transaction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to reverse transaction")
+		return
+	}
+	// A reversed fee counts as refunded, so it is not refunded a second time
+	for _, leg := range legs {
+		if leg.Type != ledger.TypeFee {
+			continue
+		}
+		_, err := tx.Exec("UPDATE fee_charges SET status = ?, refunded_at = NOW() WHERE transaction_id = ? AND status = ?",
+			fees.StatusRefunded, leg.TransactionID, fees.StatusCharged)
+		if err != nil {
+			log.Printf("Error marking reversed fee refunded: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to reverse transaction")
+			return
+		}
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "transaction.reverse", EntityType: "transaction", EntityID: strconv.FormatInt(id, 10),
+		Before: legs, After: map[string]interface{}{"reversal_transaction_ids": reversalIDs, "reason": req.Reason}})
+	if err != nil {
+		log.Printf("Error writing audit log for reversal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to reverse transaction")
+		return
+	}
+	for i, leg := range legs {
+		err := outbox.Enqueue(tx, outbox.EventReversed, accounts[i].AccountNumber, map[string]interface{}{
+			"account_number":          accounts[i].AccountNumber,
+			"transaction_id":          leg.TransactionID,
+			"reversal_transaction_id": reversalIDs[i],
+			"type":                    leg.Type,
+			"amount":                  leg.Amount,
+			"reason":                  req.Reason,
+		})
+		if err != nil {
+			log.Printf("Error writing reversal event: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to reverse transaction")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing reversal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to reverse transaction")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"transaction_id":           id,
+		"reversal_transaction_ids": reversalIDs,
+		"reason":                   req.Reason,
+	})
+}
+
+// GetAccountStatement lists the transactions booked on an account between ?from= and
+// ?to= (YYYY-MM-DD business dates, at most a year apart) with running balances.
+// ?to= defaults to the business date and ?from= to the first day of its month.
+func GetAccountStatement(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	account, err := ledger.GetAccount(mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error getting account for statement: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve statement")
+		}
+		return
+	}
+	if _, ok := authorizeAccount(w, db.DB, actor, account, false); !ok {
+		return
+	}
+
+	// One transaction gives the balance and the rows from the same snapshot
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for statement: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve statement")
+		return
+	}
+	defer tx.Rollback() // Read only
+
+	to, err := eod.BusinessDate(tx)
+	if err != nil {
+		log.Printf("Error getting business date for statement: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve statement")
+		return
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			respondWithError(w, http.StatusBadRequest, "to must be YYYY-MM-DD")
+			return
+		}
+	}
+	from := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			respondWithError(w, http.StatusBadRequest, "from must be YYYY-MM-DD")
+			return
+		}
+	}
+	if to.Before(from) || to.After(from.AddDate(1, 0, 0)) {
+		respondWithError(w, http.StatusBadRequest, "to must be on or after from and at most a year later")
+		return
+	}
+
+	var balance float64
+	if err := tx.QueryRow("SELECT balance FROM accounts WHERE account_id = ?", account.AccountID).Scan(&balance); err != nil {
+		log.Printf("Error getting balance for statement: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve statement")
+		return
+	}
+	rows, err := tx.Query(`SELECT t.transaction_id, t.account_id, t.type, t.amount, t.transaction_date, t.booking_date, t.value_date, t.description,
+			ca.account_number, t.reversal_of, rv.transaction_id
+		FROM transactions t
+		LEFT JOIN accounts ca ON ca.account_id = t.counterparty_account_id
+		LEFT JOIN transactions rv ON rv.reversal_of = t.transaction_id
+		WHERE t.account_id = ? AND t.booking_date >= ?
+		ORDER BY t.booking_date, t.transaction_id`, account.AccountID, from.Format("2006-01-02"))
+	if err != nil {
+		log.Printf("Error listing transactions for statement: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve statement")
+		return
+	}
+	defer rows.Close()
+
+	statement := models.AccountStatement{AccountNumber: account.AccountNumber, From: from.Format("2006-01-02"), To: to.Format("2006-01-02"),
+		Transactions: []models.StatementLine{}}
+	later := 0.0 // Net movement booked after the period
+	for rows.Next() {
+		var line models.StatementLine
+		t := &line.Transaction
+		err := rows.Scan(&t.TransactionID, &t.AccountID, &t.Type, &t.Amount, &t.TransactionDate, &t.BookingDate, &t.ValueDate, &t.Description,
+			&t.CounterpartyAccountNumber, &t.ReversalOf, &t.ReversedBy)
+		if err != nil {
+			log.Printf("Error scanning statement transaction: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve statement")
+			return
+		}
+		signed := -t.Amount
+		line.Direction = "debit"
+		if ledger.IsCredit(t.Type) {
+			signed = t.Amount
+			line.Direction = "credit"
+		}
+		if t.BookingDate.After(to) {
+			later += signed
+			continue
+		}
+		if signed > 0 {
+			statement.TotalCredits += signed
+		} else {
+			statement.TotalDebits -= signed
+		}
+		if t.ReversalOf != nil {
+			statement.Reversals++
+		}
+		statement.Transactions = append(statement.Transactions, line)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating statement transactions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve statement")
+		return
+	}
+
+	statement.ClosingBalance = ledger.Round(balance - later)
+	statement.OpeningBalance = ledger.Round(statement.ClosingBalance - statement.TotalCredits + statement.TotalDebits)
+	running := statement.OpeningBalance
+	for i := range statement.Transactions {
+		line := &statement.Transactions[i]
+		if line.Direction == "credit" {
+			running += line.Amount
+		} else {
+			running -= line.Amount
+		}
+		line.Balance = ledger.Round(running)
+	}
+	statement.TotalCredits, statement.TotalDebits = ledger.Round(statement.TotalCredits), ledger.Round(statement.TotalDebits)
+	respondWithJSON(w, http.StatusOK, statement)
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+	"banking-app/scheduled"
+
+	"github.com/gorilla/mux"
+)
+
+// scheduleTransfer parks a transfer that has passed its checks until the end-of-day run
+// before its value date
+func scheduleTransfer(w http.ResponseWriter, r *http.Request, tx *sql.Tx, from, to models.Account, amount float64, paymentType string, valueDate time.Time, onSuccess func(*sql.Tx) error) {
+	var requestedBy *int
+	if actor, err := auth.FromRequest(r); err == nil {
+		requestedBy = &actor.UserID
+	}
+
+	id, err := scheduled.Schedule(tx, scheduled.Transfer{From: from, To: to, Amount: amount, PaymentType: paymentType, ValueDate: valueDate,
+		RequestedBy: requestedBy, RequestID: audit.RequestID(r)})
+	if err != nil {
+		log.Printf("Error scheduling transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "account.transfer_scheduled", EntityType: "scheduled_transfer", EntityID: strconv.FormatInt(id, 10),
+		After: map[string]interface{}{"from_account_number": from.AccountNumber, "to_account_number": to.AccountNumber, "amount": amount,
+			"payment_type": paymentType, "value_date": valueDate.Format("2006-01-02")}})
+	if err != nil {
+		log.Printf("Error writing audit log for scheduled transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+
+	if onSuccess != nil {
+		if err := onSuccess(tx); err != nil {
+			log.Printf("Error completing transfer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing scheduled transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to commit transfer transaction")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"message":               "Transfer scheduled for the next business day",
+		"scheduled_transfer_id": id,
+		"value_date":            valueDate.Format("2006-01-02"),
+		"status":                scheduled.StatusScheduled,
+	})
+}
+
+// GetScheduledTransfers lists the scheduled transfers from an account, newest first,
+// optionally filtered with ?status=
+func GetScheduledTransfers(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	account, err := ledger.GetAccount(mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error getting account for scheduled transfers: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve scheduled transfers")
+		}
+		return
+	}
+	if _, ok := authorizeAccount(w, db.DB, actor, account, false); !ok {
+		return
+	}
+
+	query := `SELECT st.scheduled_transfer_id, fa.account_number, ta.account_number, st.amount, st.payment_type, st.value_date, st.status,
+		st.failure_reason, st.requested_by, st.created_at, st.finished_at
+		FROM scheduled_transfers st
+		JOIN accounts fa ON fa.account_id = st.from_account_id
+		JOIN accounts ta ON ta.account_id = st.to_account_id
+		WHERE st.from_account_id = ?`
+	args := []interface{}{account.AccountID}
+	if status := r.URL.Query().Get("status"); status != "" {
+		if status != scheduled.StatusScheduled && status != scheduled.StatusExecuted && status != scheduled.StatusFailed && status != scheduled.StatusCancelled {
+			respondWithError(w, http.StatusBadRequest, "Status must be 'scheduled', 'executed', 'failed' or 'cancelled'")
+			return
+		}
+		query += " AND st.status = ?"
+		args = append(args, status)
+	}
+
+	rows, err := db.DB.Query(query+" ORDER BY st.scheduled_transfer_id DESC LIMIT 100", args...)
+	if err != nil {
+		log.Printf("Error listing scheduled transfers: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve scheduled transfers")
+		return
+	}
+	defer rows.Close()
+
+	transfers := []models.ScheduledTransfer{}
+	for rows.Next() {
+		var st models.ScheduledTransfer
+		if err := rows.Scan(&st.ScheduledTransferID, &st.FromAccountNumber, &st.ToAccountNumber, &st.Amount, &st.PaymentType, &st.ValueDate, &st.Status,
+			&st.FailureReason, &st.RequestedBy, &st.CreatedAt, &st.FinishedAt); err != nil {
+			log.Printf("Error scanning scheduled transfer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve scheduled transfers")
+			return
+		}
+		transfers = append(transfers, st)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating scheduled transfers: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve scheduled transfers")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, transfers)
+}
+
+// CancelScheduledTransfer stops a scheduled transfer before the end-of-day run executes it
+func CancelScheduledTransfer(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid scheduled transfer ID")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for scheduled transfer cancellation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel scheduled transfer")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var fromNumber, status string
+	err = tx.QueryRow(`SELECT fa.account_number, st.status
+		FROM scheduled_transfers st
+		JOIN accounts fa ON fa.account_id = st.from_account_id
+		WHERE st.scheduled_transfer_id = ? FOR UPDATE OF st`, id).Scan(&fromNumber, &status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Scheduled transfer not found")
+		} else {
+			log.Printf("Error fetching scheduled transfer: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to cancel scheduled transfer")
+		}
+		return
+	}
+	from, err := ledger.GetAccount(fromNumber)
+	if err != nil {
+		log.Printf("Error getting source account of scheduled transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel scheduled transfer")
+		return
+	}
+	if _, ok := authorizeAccount(w, tx, actor, from, true); !ok {
+		return
+	}
+	if status != scheduled.StatusScheduled {
+		respondWithError(w, http.StatusConflict, "Scheduled transfer is already "+status)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE scheduled_transfers SET status = ?, finished_at = NOW() WHERE scheduled_transfer_id = ?", scheduled.StatusCancelled, id)
+	if err != nil {
+		log.Printf("Error cancelling scheduled transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel scheduled transfer")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "scheduled_transfer.cancel", EntityType: "scheduled_transfer", EntityID: strconv.Itoa(id),
+		Before: map[string]string{"status": scheduled.StatusScheduled}, After: map[string]string{"status": scheduled.StatusCancelled}})
+	if err != nil {
+		log.Printf("Error writing audit log for scheduled transfer cancellation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel scheduled transfer")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing scheduled transfer cancellation: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel scheduled transfer")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"scheduled_transfer_id": id, "status": scheduled.StatusCancelled})
+}
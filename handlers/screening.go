@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"banking-app/audit"
+	"banking-app/db"
+	"banking-app/models"
+	"banking-app/sanctions"
+
+	"github.com/gorilla/mux"
+)
+
+// refuseSanctioned commits any screening cases opened while checking a money movement
+// and tells the caller the movement cannot go ahead
+func refuseSanctioned(w http.ResponseWriter, tx *sql.Tx, status string) {
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing screening result: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process request")
+		return
+	}
+	if status == sanctions.StatusConfirmed {
+		respondWithErrorCode(w, http.StatusForbidden, "sanctions_blocked", "Request blocked by sanctions screening")
+		return
+	}
+	respondWithErrorCode(w, http.StatusForbidden, "sanctions_review", "Request awaiting sanctions screening review")
+}
+
+// GetScreeningCases lists screening cases, oldest first, filtered with ?status= (default open)
+func GetScreeningCases(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can review screening cases")
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = sanctions.CaseOpen
+	}
+	if status != sanctions.CaseOpen && status != sanctions.CaseCleared && status != sanctions.CaseConfirmed {
+		respondWithError(w, http.StatusBadRequest, "Status must be 'open', 'cleared' or 'confirmed'")
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT case_id, customer_id, entry_id, list_name, screened_name, matched_name, score, pep, trigger_event, status,
+		reviewed_by, review_note, created_at, reviewed_at FROM screening_cases WHERE status = ? ORDER BY created_at, case_id LIMIT 500`, status)
+	if err != nil {
+		log.Printf("Error listing screening cases: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve screening cases")
+		return
+	}
+	defer rows.Close()
+
+	cases := []models.ScreeningCase{}
+	for rows.Next() {
+		var c models.ScreeningCase
+		if err := rows.Scan(&c.CaseID, &c.CustomerID, &c.EntryID, &c.ListName, &c.ScreenedName, &c.MatchedName, &c.Score, &c.PEP, &c.Trigger, &c.Status,
+			&c.ReviewedBy, &c.ReviewNote, &c.CreatedAt, &c.ReviewedAt); err != nil {
+			log.Printf("Error scanning screening case: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve screening cases")
+			return
+		}
+		cases = append(cases, c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating screening cases: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve screening cases")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cases)
+}
+
+// ClearScreeningCase records that a hit is a false positive
+func ClearScreeningCase(w http.ResponseWriter, r *http.Request) {
+	reviewScreeningCase(w, r, sanctions.CaseCleared, "screening_case.clear")
+}
+
+// ConfirmScreeningCase records that a hit is a true match, blocking the customer's money movement
+func ConfirmScreeningCase(w http.ResponseWriter, r *http.Request) {
+	reviewScreeningCase(w, r, sanctions.CaseConfirmed, "screening_case.confirm")
+}
+
+func reviewScreeningCase(w http.ResponseWriter, r *http.Request, status, action string) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsEmployee() {
+		respondWithError(w, http.StatusForbidden, "Only staff can review screening cases")
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid case ID")
+		return
+	}
+	var req models.ReviewScreeningCaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	// The reasoning behind a screening decision must be on record
+	req.Note = strings.TrimSpace(req.Note)
+	if req.Note == "" || len(req.Note) > 255 {
+		respondWithError(w, http.StatusBadRequest, "A note of at most 255 characters is required")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for screening review: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review case")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var customerID int
+	var current string
+	err = tx.QueryRow("SELECT customer_id, status FROM screening_cases WHERE case_id = ? FOR UPDATE", id).Scan(&customerID, &current)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Case not found")
+		} else {
+			log.Printf("Error fetching screening case: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to review case")
+		}
+		return
+	}
+	if current != sanctions.CaseOpen {
+		respondWithError(w, http.StatusConflict, "Case has already been "+current)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE screening_cases SET status = ?, reviewed_by = ?, review_note = ?, reviewed_at = NOW() WHERE case_id = ?",
+		status, actor.UserID, req.Note, id)
+	if err != nil {
+		log.Printf("Error updating screening case: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review case")
+		return
+	}
+	customerStatus, err := sanctions.UpdateStatus(tx, customerID)
+	if err != nil {
+		log.Printf("Error updating customer screening status: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review case")
+		return
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: action, EntityType: "screening_case", EntityID: strconv.Itoa(id),
+		Before: map[string]string{"status": current},
+		After:  map[string]interface{}{"status": status, "note": req.Note, "customer_id": customerID, "customer_screening_status": customerStatus}})
+	if err != nil {
+		log.Printf("Error writing audit log for screening review: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review case")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing screening review: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to review case")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"case_id": id, "status": status, "customer_screening_status": customerStatus})
+}
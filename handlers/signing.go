@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/db"
+	"banking-app/holders"
+	"banking-app/ledger"
+	"banking-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+// Signature decisions stored in transfer_approval_signatures.decision
+const (
+	signaturePending  = "pending"
+	signatureApproved = "approved"
+	signatureRejected = "rejected"
+)
+
+// requestTransferApproval parks a transfer that needs every signer of the source account.
+// The requester's signature is recorded straight away; if nobody else can sign, the
+// transfer goes ahead at once.
+func requestTransferApproval(w http.ResponseWriter, r *http.Request, tx *sql.Tx, actor auth.Actor, from, to models.Account, amount float64, paymentType string) {
+	if !ledger.CanDebit(from) {
+		refuseAccountStatus(w, from)
+		return
+	}
+	if !ledger.CanCredit(to) {
+		refuseAccountStatus(w, to)
+		return
+	}
+	signers, err := holders.Signers(tx, from)
+	if err != nil {
+		log.Printf("Error listing signers for transfer approval: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+	if len(signers) <= 1 {
+		completeTransfer(w, r, tx, from, to, amount, paymentType, instructingCustomer(actor), nil)
+		return
+	}
+
+	requester := *actor.CustomerID
+	result, err := tx.Exec("INSERT INTO transfer_approvals (from_account_id, to_account_id, amount, payment_type, requested_by) VALUES (?, ?, ?, ?, ?)",
+		from.AccountID, to.AccountID, amount, paymentType, requester)
+	if err != nil {
+		log.Printf("Error creating transfer approval: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+	approvalID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for transfer approval: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+	var awaiting []int
+	for _, customerID := range signers {
+		if customerID == requester {
+			_, err = tx.Exec(`INSERT INTO transfer_approval_signatures (approval_id, customer_id, decision, decided_by, decided_at)
+				VALUES (?, ?, ?, ?, NOW())`, approvalID, customerID, signatureApproved, actor.UserID)
+		} else {
+			_, err = tx.Exec("INSERT INTO transfer_approval_signatures (approval_id, customer_id) VALUES (?, ?)", approvalID, customerID)
+			awaiting = append(awaiting, customerID)
+		}
+		if err != nil {
+			log.Printf("Error recording transfer signature: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+			return
+		}
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "transfer_approval.request", EntityType: "transfer_approval", EntityID: strconv.FormatInt(approvalID, 10),
+		After: map[string]interface{}{"from_account_number": from.AccountNumber, "to_account_number": to.AccountNumber, "amount": amount, "awaiting": awaiting}})
+	if err != nil {
+		log.Printf("Error writing audit log for transfer approval: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transfer approval: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to commit transfer transaction")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"message":     "Transfer awaiting approval by the other account holders",
+		"approval_id": approvalID,
+		"status":      "pending",
+		"awaiting":    awaiting,
+	})
+}
+
+// GetTransferApprovals lists the transfer approvals the calling customer signs for,
+// newest first, optionally filtered with ?status=
+func GetTransferApprovals(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if actor.CustomerID == nil {
+		respondWithError(w, http.StatusForbidden, "Only account holders have transfer approvals")
+		return
+	}
+
+	query := `SELECT ta.approval_id, fa.account_number, tacc.account_number, ta.amount, ta.requested_by, ta.status, ta.created_at, ta.decided_at, ta.executed_at
+		FROM transfer_approvals ta
+		JOIN transfer_approval_signatures s ON s.approval_id = ta.approval_id AND s.customer_id = ?
+		JOIN accounts fa ON fa.account_id = ta.from_account_id
+		JOIN accounts tacc ON tacc.account_id = ta.to_account_id`
+	args := []interface{}{*actor.CustomerID}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " WHERE ta.status = ?"
+		args = append(args, status)
+	}
+
+	rows, err := db.DB.Query(query+" ORDER BY ta.approval_id DESC LIMIT 100", args...)
+	if err != nil {
+		log.Printf("Error listing transfer approvals: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve transfer approvals")
+		return
+	}
+	approvals := []models.TransferApproval{}
+	for rows.Next() {
+		var a models.TransferApproval
+		if err := rows.Scan(&a.ApprovalID, &a.FromAccountNumber, &a.ToAccountNumber, &a.Amount, &a.RequestedBy, &a.Status,
+			&a.CreatedAt, &a.DecidedAt, &a.ExecutedAt); err != nil {
+			rows.Close()
+			log.Printf("Error scanning transfer approval: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve transfer approvals")
+			return
+		}
+		approvals = append(approvals, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating transfer approvals: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve transfer approvals")
+		return
+	}
+
+	for i := range approvals {
+		signatures, err := loadTransferSignatures(approvals[i].ApprovalID)
+		if err != nil {
+			log.Printf("Error loading transfer signatures: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve transfer approvals")
+			return
+		}
+		approvals[i].Signatures = signatures
+	}
+	respondWithJSON(w, http.StatusOK, approvals)
+}
+
+func loadTransferSignatures(approvalID int) ([]models.TransferSignature, error) {
+	rows, err := db.DB.Query("SELECT customer_id, decision, decided_at FROM transfer_approval_signatures WHERE approval_id = ? ORDER BY customer_id", approvalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	signatures := []models.TransferSignature{}
+	for rows.Next() {
+		var s models.TransferSignature
+		if err := rows.Scan(&s.CustomerID, &s.Decision, &s.DecidedAt); err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, s)
+	}
+	return signatures, rows.Err()
+}
+
+// ApproveTransferApproval adds the calling holder's signature; the last signature executes the transfer
+func ApproveTransferApproval(w http.ResponseWriter, r *http.Request) {
+	signTransferApproval(w, r, true)
+}
+
+// RejectTransferApproval refuses a transfer on behalf of the calling holder; one refusal cancels it
+func RejectTransferApproval(w http.ResponseWriter, r *http.Request) {
+	signTransferApproval(w, r, false)
+}
+
+func signTransferApproval(w http.ResponseWriter, r *http.Request, approve bool) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if actor.CustomerID == nil {
+		respondWithError(w, http.StatusForbidden, "Only account holders can sign transfers")
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid approval ID")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for transfer signature: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to sign transfer")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var status string
+	if err := tx.QueryRow("SELECT status FROM transfer_approvals WHERE approval_id = ? FOR UPDATE", id).Scan(&status); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Transfer approval not found")
+		} else {
+			log.Printf("Error fetching transfer approval: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to sign transfer")
+		}
+		return
+	}
+	var decision string
+	err = tx.QueryRow("SELECT decision FROM transfer_approval_signatures WHERE approval_id = ? AND customer_id = ? FOR UPDATE", id, *actor.CustomerID).Scan(&decision)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusForbidden, "You are not a signer of this transfer")
+		} else {
+			log.Printf("Error fetching transfer signature: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to sign transfer")
+		}
+		return
+	}
+	if status != "pending" {
+		respondWithError(w, http.StatusConflict, "Transfer approval is already "+status)
+		return
+	}
+	if decision != signaturePending {
+		respondWithError(w, http.StatusConflict, "You have already "+decision+" this transfer")
+		return
+	}
+
+	action, decision, status := "transfer_approval.reject", signatureRejected, "rejected"
+	if approve {
+		action, decision, status = "transfer_approval.approve", signatureApproved, "pending"
+	}
+	_, err = tx.Exec("UPDATE transfer_approval_signatures SET decision = ?, decided_by = ?, decided_at = NOW() WHERE approval_id = ? AND customer_id = ?",
+		decision, actor.UserID, id, *actor.CustomerID)
+	if err != nil {
+		log.Printf("Error recording transfer signature: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to sign transfer")
+		return
+	}
+	if approve {
+		var outstanding int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM transfer_approval_signatures WHERE approval_id = ? AND decision = ?", id, signaturePending).Scan(&outstanding); err != nil {
+			log.Printf("Error counting transfer signatures: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to sign transfer")
+			return
+		}
+		if outstanding == 0 {
+			status = "approved"
+		}
+	}
+	if status != "pending" {
+		if _, err := tx.Exec("UPDATE transfer_approvals SET status = ?, decided_at = NOW() WHERE approval_id = ?", status, id); err != nil {
+			log.Printf("Error updating transfer approval: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to sign transfer")
+			return
+		}
+	}
+
+	err = audit.RecordTx(tx, r, audit.Entry{Action: action, EntityType: "transfer_approval", EntityID: strconv.Itoa(id),
+		After: map[string]interface{}{"customer_id": *actor.CustomerID, "decision": decision, "status": status}})
+	if err != nil {
+		log.Printf("Error writing audit log for transfer signature: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to sign transfer")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transfer signature: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to sign transfer")
+		return
+	}
+
+	// The signature stands even if the transfer itself is then refused; it can be retried
+	if status == "approved" {
+		executeTransferApproval(w, r, id)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"approval_id": id, "status": status})
+}
+
+// ExecuteTransferApproval retries a fully approved transfer whose execution was refused,
+// e.g. for lack of funds at the time of the last signature
+func ExecuteTransferApproval(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if actor.CustomerID == nil {
+		respondWithError(w, http.StatusForbidden, "Only account holders can execute transfers")
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid approval ID")
+		return
+	}
+	var isSigner bool
+	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM transfer_approval_signatures WHERE approval_id = ? AND customer_id = ?)", id, *actor.CustomerID).Scan(&isSigner)
+	if err != nil {
+		log.Printf("Error checking transfer signer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+	if !isSigner {
+		respondWithError(w, http.StatusNotFound, "Transfer approval not found")
+		return
+	}
+	executeTransferApproval(w, r, id)
+}
+
+// executeTransferApproval runs an approved transfer through the normal transfer checks
+func executeTransferApproval(w http.ResponseWriter, r *http.Request, id int) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for approved transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var fromNumber, toNumber, paymentType, status string
+	var amount float64
+	var requestedBy int
+	err = tx.QueryRow(`SELECT fa.account_number, tacc.account_number, ta.amount, ta.payment_type, ta.requested_by, ta.status
+		FROM transfer_approvals ta
+		JOIN accounts fa ON fa.account_id = ta.from_account_id
+		JOIN accounts tacc ON tacc.account_id = ta.to_account_id
+		WHERE ta.approval_id = ? FOR UPDATE OF ta`, id).Scan(&fromNumber, &toNumber, &amount, &paymentType, &requestedBy, &status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Transfer approval not found")
+		} else {
+			log.Printf("Error fetching transfer approval: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		}
+		return
+	}
+	if status != "approved" {
+		respondWithError(w, http.StatusConflict, "Transfer approval is "+status)
+		return
+	}
+
+	from, err := ledger.LockAccount(tx, fromNumber)
+	if err != nil {
+		log.Printf("Error locking source account of approved transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+	to, err := ledger.LockAccount(tx, toNumber)
+	if err != nil {
+		log.Printf("Error locking destination account of approved transfer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process transfer")
+		return
+	}
+	// The holder who asked for the transfer instructs it, whoever signed last
+	completeTransfer(w, r, tx, from, to, amount, paymentType, &requestedBy, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE transfer_approvals SET status = 'executed', executed_at = NOW() WHERE approval_id = ?", id)
+		return err
+	})
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/db"
+	"banking-app/models"
+	"banking-app/teller"
+
+	"github.com/gorilla/mux"
+)
+
+// validCash checks the notes and coins of a cash deposit or withdrawal add up to amount,
+// writing a 400 response if they do not
+func validCash(w http.ResponseWriter, amount float64, cash []models.DenominationCount) bool {
+	total, err := teller.Total(cash)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid cash: "+err.Error())
+		return false
+	}
+	if total != teller.Cents(amount) {
+		respondWithError(w, http.StatusBadRequest, "Cash must add up to the amount")
+		return false
+	}
+	return true
+}
+
+// lockTellerSession locks the open session of the actor for a cash booking
+func lockTellerSession(w http.ResponseWriter, tx *sql.Tx, actor auth.Actor) (models.TellerSession, bool) {
+	if actor.EmployeeID == nil {
+		respondWithError(w, http.StatusForbidden, "Only tellers can book cash")
+		return models.TellerSession{}, false
+	}
+	session, err := teller.LockOpenSession(tx, *actor.EmployeeID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithErrorCode(w, http.StatusConflict, "no_teller_session", "Open a teller session before booking cash")
+		} else {
+			log.Printf("Error locking teller session: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve teller session")
+		}
+		return session, false
+	}
+	return session, true
+}
+
+// bookCash books a validated cash movement against a locked session, writing the
+// response if it fails
+func bookCash(w http.ResponseWriter, tx *sql.Tx, session models.TellerSession, accountID int, transactionID int64, kind string, amount float64, cash []models.DenominationCount) bool {
+	err := teller.Book(tx, session, accountID, transactionID, kind, amount, cash)
+	if err == teller.ErrInsufficientCash {
+		respondWithErrorCode(w, http.StatusConflict, "insufficient_cash", "The drawer does not hold those notes and coins")
+		return false
+	}
+	if err != nil {
+		log.Printf("Error booking cash %s: %v", kind, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to book cash")
+		return false
+	}
+	return true
+}
+
+// OpenTellerSession opens a cash drawer session for the calling employee at their branch
+func OpenTellerSession(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	if actor.EmployeeID == nil || actor.BranchID == nil {
+		respondWithError(w, http.StatusForbidden, "Only employees of a branch can open a teller session")
+		return
+	}
+	var req models.OpenTellerSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if _, err := teller.Total(req.Cash); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid cash: "+err.Error())
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for teller session: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open teller session")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	if _, err := teller.LockOpenSession(tx, *actor.EmployeeID); err == nil {
+		respondWithError(w, http.StatusConflict, "Close your open teller session first")
+		return
+	} else if err != sql.ErrNoRows {
+		log.Printf("Error checking open teller session: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open teller session")
+		return
+	}
+
+	id, err := teller.Open(tx, *actor.EmployeeID, *actor.BranchID, req.Cash)
+	if err != nil {
+		log.Printf("Error opening teller session: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open teller session")
+		return
+	}
+	session, err := teller.LockSession(tx, int(id))
+	if err != nil {
+		log.Printf("Error reading back teller session: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open teller session")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "teller_session.open", EntityType: "teller_session", EntityID: strconv.Itoa(session.SessionID),
+		After: map[string]interface{}{"branch_id": session.BranchID, "employee_id": session.EmployeeID, "opening_total": session.OpeningTotal, "cash": req.Cash}})
+	if err != nil {
+		log.Printf("Error writing audit log for teller session: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open teller session")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing teller session: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open teller session")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, session)
+}
+
+// GetTellerSession returns a session with its drawer and cash movements
+func GetTellerSession(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	var session models.TellerSession
+	if err := teller.Scan(db.DB.QueryRow("SELECT "+teller.Columns+" FROM teller_sessions WHERE session_id = ?", id), &session); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Teller session not found")
+		} else {
+			log.Printf("Error fetching teller session: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve teller session")
+		}
+		return
+	}
+	if !actor.IsStaffOf(session.BranchID) {
+		respondWithError(w, http.StatusForbidden, "Only staff of the branch can view its teller sessions")
+		return
+	}
+
+	session.Drawer, err = teller.Drawer(db.DB, id)
+	if err != nil {
+		log.Printf("Error fetching teller drawer: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve teller session")
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT m.movement_id, a.account_number, m.transaction_id, m.kind, m.amount, m.cash, m.created_at
+		FROM teller_cash_movements m JOIN accounts a ON a.account_id = m.account_id
+		WHERE m.session_id = ? ORDER BY m.movement_id`, id)
+	if err != nil {
+		log.Printf("Error fetching teller cash movements: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve teller session")
+		return
+	}
+	defer rows.Close()
+
+	session.Movements = []models.TellerCashMovement{}
+	for rows.Next() {
+		var m models.TellerCashMovement
+		if err := rows.Scan(&m.MovementID, &m.AccountNumber, &m.TransactionID, &m.Kind, &m.Amount, &m.Cash, &m.CreatedAt); err != nil {
+			log.Printf("Error scanning teller cash movement: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve teller session")
+			return
+		}
+		session.Movements = append(session.Movements, m)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating teller cash movements: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve teller session")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, session)
+}
+
+// CloseTellerSession balances a session against the counted drawer, posting any overage
+// or shortage to the branch. The teller or other staff of the branch may close it.
+func CloseTellerSession(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+	var req models.CloseTellerSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if _, err := teller.Total(req.Cash); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid cash: "+err.Error())
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > 1000 {
+		respondWithError(w, http.StatusBadRequest, "Note must be at most 1000 characters")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for closing teller session: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to close teller session")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	session, err := teller.LockSession(tx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Teller session not found")
+		} else {
+			log.Printf("Error locking teller session: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to close teller session")
+		}
+		return
+	}
+	if !actor.IsStaffOf(session.BranchID) {
+		respondWithError(w, http.StatusForbidden, "Only staff of the branch can close its teller sessions")
+		return
+	}
+	if session.Status != teller.StatusOpen {
+		respondWithError(w, http.StatusConflict, "Teller session is already closed")
+		return
+	}
+
+	balance, err := teller.Close(tx, session, req.Cash, actor.UserID, req.Note)
+	if err != nil {
+		log.Printf("Error closing teller session: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to close teller session")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "teller_session.close", EntityType: "teller_session", EntityID: strconv.Itoa(session.SessionID),
+		Before: map[string]interface{}{"status": session.Status},
+		After: map[string]interface{}{"status": teller.StatusClosed, "expected_total": balance.Expected, "counted_total": balance.Counted,
+			"variance": balance.Variance, "cash": req.Cash, "note": req.Note}})
+	if err != nil {
+		log.Printf("Error writing audit log for closing teller session: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to close teller session")
+		return
+	}
+	session, err = teller.LockSession(tx, id)
+	if err != nil {
+		log.Printf("Error reading back teller session: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to close teller session")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing teller session close: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to close teller session")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, session)
+}
+
+// GetBranchTellerSessions lists the teller sessions of a branch, newest first, filtered
+// with ?status=. Only staff of that branch may see them.
+func GetBranchTellerSessions(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, ok := branchIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsStaffOf(id) {
+		respondWithError(w, http.StatusForbidden, "Only staff of this branch can list its teller sessions")
+		return
+	}
+
+	query := "SELECT " + teller.Columns + " FROM teller_sessions WHERE branch_id = ?"
+	args := []interface{}{id}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY opened_at DESC, session_id DESC LIMIT 500"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		log.Printf("Error listing teller sessions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve teller sessions")
+		return
+	}
+	defer rows.Close()
+
+	sessions := []models.TellerSession{}
+	for rows.Next() {
+		var s models.TellerSession
+		if err := teller.Scan(rows, &s); err != nil {
+			log.Printf("Error scanning teller session: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve teller sessions")
+			return
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating teller sessions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve teller sessions")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+// GetBranchCashPostings lists the cash overages and shortages of a branch, newest first
+func GetBranchCashPostings(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	id, ok := branchIDFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !actor.IsStaffOf(id) {
+		respondWithError(w, http.StatusForbidden, "Only staff of this branch can list its cash postings")
+		return
+	}
+
+	rows, err := db.DB.Query(`SELECT posting_id, branch_id, session_id, type, amount, created_at
+		FROM branch_cash_postings WHERE branch_id = ? ORDER BY created_at DESC, posting_id DESC LIMIT 500`, id)
+	if err != nil {
+		log.Printf("Error listing branch cash postings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve cash postings")
+		return
+	}
+	defer rows.Close()
+
+	postings := []models.BranchCashPosting{}
+	for rows.Next() {
+		var p models.BranchCashPosting
+		if err := rows.Scan(&p.PostingID, &p.BranchID, &p.SessionID, &p.Type, &p.Amount, &p.CreatedAt); err != nil {
+			log.Printf("Error scanning branch cash posting: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve cash postings")
+			return
+		}
+		postings = append(postings, p)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating branch cash postings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve cash postings")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, postings)
+}
@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/db"
+	"banking-app/eod"
+	"banking-app/ledger"
+	"banking-app/limits"
+	"banking-app/models"
+	"banking-app/outbox"
+	"banking-app/termdeposit"
+
+	"github.com/gorilla/mux"
+)
+
+// GetTermDepositRates lists the term deposit rates, shortest term first
+func GetTermDepositRates(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireActor(w, r); !ok {
+		return
+	}
+	rows, err := db.DB.Query("SELECT " + termdeposit.RateColumns + " FROM term_deposit_rates ORDER BY term_months")
+	if err != nil {
+		log.Printf("Error listing term deposit rates: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve term deposit rates")
+		return
+	}
+	defer rows.Close()
+
+	rates := []models.TermDepositRate{}
+	for rows.Next() {
+		var rate models.TermDepositRate
+		if err := termdeposit.ScanRate(rows, &rate); err != nil {
+			log.Printf("Error scanning term deposit rate: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve term deposit rates")
+			return
+		}
+		rates = append(rates, rate)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating term deposit rates: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve term deposit rates")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, rates)
+}
+
+// UpdateTermDepositRate sets the rate offered for a term. Open deposits keep their rate
+// until they roll over.
+func UpdateTermDepositRate(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	termMonths, err := strconv.Atoi(mux.Vars(r)["termMonths"])
+	if err != nil || termMonths < 1 || termMonths > 120 {
+		respondWithError(w, http.StatusBadRequest, "Term must be between 1 and 120 months")
+		return
+	}
+	var req models.UpdateTermDepositRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Rate < 0 || req.Rate > 100 || req.PenaltyRate < 0 || req.PenaltyRate > 100 || req.MinAmount < 0 {
+		respondWithError(w, http.StatusBadRequest, "Rate and penalty rate must be between 0 and 100 and the minimum amount cannot be negative")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for term deposit rate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update term deposit rate")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	before, err := termdeposit.GetRate(tx, termMonths)
+	if err != nil {
+		log.Printf("Error loading term deposit rate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update term deposit rate")
+		return
+	}
+	_, err = tx.Exec(`INSERT INTO term_deposit_rates (term_months, rate, penalty_rate, min_amount, active) VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE rate = VALUES(rate), penalty_rate = VALUES(penalty_rate), min_amount = VALUES(min_amount), active = VALUES(active)`,
+		termMonths, req.Rate, req.PenaltyRate, req.MinAmount, req.Active)
+	if err != nil {
+		log.Printf("Error updating term deposit rate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update term deposit rate")
+		return
+	}
+	after, err := termdeposit.GetRate(tx, termMonths)
+	if err != nil {
+		log.Printf("Error reading back term deposit rate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update term deposit rate")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "term_deposit_rate.update", EntityType: "term_deposit_rate", EntityID: strconv.Itoa(termMonths), Before: before, After: after})
+	if err != nil {
+		log.Printf("Error writing audit log for term deposit rate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update term deposit rate")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing term deposit rate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update term deposit rate")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, after)
+}
+
+// lockPayoutAccount locks the account a term deposit pays out to and checks it belongs to
+// the deposit's customer and can take credits, writing an error response if not
+func lockPayoutAccount(w http.ResponseWriter, tx *sql.Tx, accountNumber string, customerID int) (models.Account, bool) {
+	payout, err := ledger.LockAccount(tx, accountNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Payout account not found")
+		} else {
+			log.Printf("Error fetching payout account: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve payout account")
+		}
+		return payout, false
+	}
+	if payout.CustomerID != customerID {
+		respondWithError(w, http.StatusBadRequest, "Payout account must belong to the same customer")
+		return payout, false
+	}
+	if !ledger.CanCredit(payout) {
+		refuseAccountStatus(w, payout)
+		return payout, false
+	}
+	return payout, true
+}
+
+// OpenTermDeposit opens a term deposit funded from an existing account at the rate now
+// offered for the term
+func OpenTermDeposit(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.OpenTermDepositRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.FundingAccountNumber = strings.TrimSpace(req.FundingAccountNumber)
+	if req.FundingAccountNumber == "" {
+		respondWithError(w, http.StatusBadRequest, "funding_account_number is required")
+		return
+	}
+	if req.Amount <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Amount must be positive")
+		return
+	}
+	if !termdeposit.IsInstruction(req.MaturityInstruction) {
+		respondWithError(w, http.StatusBadRequest, "Maturity instruction must be 'rollover', 'rollover_principal' or 'payout'")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for term deposit: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open term deposit")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	rate, err := termdeposit.GetRate(tx, req.TermMonths)
+	if err != nil {
+		log.Printf("Error loading term deposit rate: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open term deposit")
+		return
+	}
+	if rate == nil || !rate.Active {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("No term deposit is offered for %d months", req.TermMonths))
+		return
+	}
+	if req.Amount < rate.MinAmount {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("The minimum amount for this term is %.2f", rate.MinAmount))
+		return
+	}
+
+	funding, err := ledger.LockAccount(tx, req.FundingAccountNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Funding account not found")
+		} else {
+			log.Printf("Error fetching funding account: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to open term deposit")
+		}
+		return
+	}
+	if _, ok := authorizeAccount(w, tx, actor, funding, true); !ok {
+		return
+	}
+	if !ledger.CanDebit(funding) {
+		refuseAccountStatus(w, funding)
+		return
+	}
+	if ledger.Available(funding) < req.Amount {
+		respondWithError(w, http.StatusBadRequest, "Insufficient funds in funding account")
+		return
+	}
+	violation, err := limits.Check(tx, funding, req.Amount)
+	if err != nil {
+		log.Printf("Error checking limits for term deposit: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open term deposit")
+		return
+	}
+	if violation != nil {
+		respondWithErrorCode(w, http.StatusBadRequest, violation.Code, violation.Message)
+		return
+	}
+
+	payout := funding
+	if req.PayoutAccountNumber != nil && *req.PayoutAccountNumber != funding.AccountNumber {
+		if payout, ok = lockPayoutAccount(w, tx, *req.PayoutAccountNumber, funding.CustomerID); !ok {
+			return
+		}
+	}
+
+	businessDate, err := eod.BusinessDate(tx)
+	if err != nil {
+		log.Printf("Error getting business date for term deposit: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open term deposit")
+		return
+	}
+	account, err := termdeposit.Open(tx, termdeposit.Opening{AccountNumber: GenerateAccountNumber(), Funding: funding, Payout: payout, Amount: req.Amount,
+		Rate: *rate, Instruction: req.MaturityInstruction, StartDate: businessDate, CreatedBy: actor.UserID})
+	if err != nil {
+		log.Printf("Error opening term deposit: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open term deposit")
+		return
+	}
+	deposit, err := termdeposit.Lock(tx, account.AccountID)
+	if err != nil {
+		log.Printf("Error reading back term deposit: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open term deposit")
+		return
+	}
+
+	if err := audit.RecordTx(tx, r, audit.Entry{Action: "term_deposit.open", EntityType: "term_deposit", EntityID: account.AccountNumber, After: deposit}); err != nil {
+		log.Printf("Error writing audit log for term deposit: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open term deposit")
+		return
+	}
+	err = outbox.Enqueue(tx, outbox.EventTransferred, funding.AccountNumber, map[string]interface{}{
+		"from_account_number": funding.AccountNumber,
+		"to_account_number":   account.AccountNumber,
+		"amount":              req.Amount,
+	})
+	if err != nil {
+		log.Printf("Error writing transfer event: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open term deposit")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing term deposit: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to open term deposit")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, deposit)
+}
+
+// GetTermDeposit returns the current term of a term deposit account
+func GetTermDeposit(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	account, err := ledger.GetAccount(mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error getting account for term deposit: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve term deposit")
+		}
+		return
+	}
+	if _, ok := authorizeAccount(w, db.DB, actor, account, false); !ok {
+		return
+	}
+
+	var deposit models.TermDeposit
+	err = termdeposit.Scan(db.DB.QueryRow("SELECT "+termdeposit.Columns+" FROM "+termdeposit.Tables+" WHERE td.account_id = ?", account.AccountID), &deposit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account is not a term deposit")
+		} else {
+			log.Printf("Error getting term deposit: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve term deposit")
+		}
+		return
+	}
+	respondWithJSON(w, http.StatusOK, deposit)
+}
+
+// lockTermDeposit locks the term deposit account in the route and its term, checking the
+// actor may move money from it and that it is still open, writing an error response if not
+func lockTermDeposit(w http.ResponseWriter, r *http.Request, tx *sql.Tx, actor auth.Actor, failure string) (models.Account, models.TermDeposit, bool) {
+	var deposit models.TermDeposit
+	account, err := ledger.LockAccount(tx, mux.Vars(r)["accountNumber"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account not found")
+		} else {
+			log.Printf("Error fetching term deposit account: %v", err)
+			respondWithError(w, http.StatusInternalServerError, failure)
+		}
+		return account, deposit, false
+	}
+	if _, ok := authorizeAccount(w, tx, actor, account, true); !ok {
+		return account, deposit, false
+	}
+	deposit, err = termdeposit.Lock(tx, account.AccountID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Account is not a term deposit")
+		} else {
+			log.Printf("Error fetching term deposit: %v", err)
+			respondWithError(w, http.StatusInternalServerError, failure)
+		}
+		return account, deposit, false
+	}
+	if deposit.Status != termdeposit.StatusOpen {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Term deposit is %s", deposit.Status))
+		return account, deposit, false
+	}
+	return account, deposit, true
+}
+
+// UpdateMaturityInstruction changes what happens to an open term deposit at maturity
+func UpdateMaturityInstruction(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	var req models.UpdateMaturityInstructionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if !termdeposit.IsInstruction(req.MaturityInstruction) {
+		respondWithError(w, http.StatusBadRequest, "Maturity instruction must be 'rollover', 'rollover_principal' or 'payout'")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for maturity instruction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update maturity instruction")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	account, deposit, ok := lockTermDeposit(w, r, tx, actor, "Failed to update maturity instruction")
+	if !ok {
+		return
+	}
+	payoutNumber := deposit.PayoutAccountNumber
+	if req.PayoutAccountNumber != nil {
+		if *req.PayoutAccountNumber == account.AccountNumber {
+			respondWithError(w, http.StatusBadRequest, "Payout account must be a different account")
+			return
+		}
+		payout, ok := lockPayoutAccount(w, tx, *req.PayoutAccountNumber, account.CustomerID)
+		if !ok {
+			return
+		}
+		payoutNumber = payout.AccountNumber
+	}
+
+	_, err = tx.Exec("UPDATE term_deposits SET maturity_instruction = ?, payout_account_id = (SELECT account_id FROM accounts WHERE account_number = ?) WHERE account_id = ?",
+		req.MaturityInstruction, payoutNumber, account.AccountID)
+	if err != nil {
+		log.Printf("Error updating maturity instruction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update maturity instruction")
+		return
+	}
+	updated, err := termdeposit.Lock(tx, account.AccountID)
+	if err != nil {
+		log.Printf("Error reading back term deposit: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update maturity instruction")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "term_deposit.instruction", EntityType: "term_deposit", EntityID: account.AccountNumber,
+		Before: map[string]string{"maturity_instruction": deposit.MaturityInstruction, "payout_account_number": deposit.PayoutAccountNumber},
+		After:  map[string]string{"maturity_instruction": updated.MaturityInstruction, "payout_account_number": updated.PayoutAccountNumber}})
+	if err != nil {
+		log.Printf("Error writing audit log for maturity instruction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update maturity instruction")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing maturity instruction: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update maturity instruction")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// WithdrawTermDeposit breaks a term deposit before maturity. The interest earned so far
+// less the early withdrawal penalty is paid out with the principal to the nominated
+// account, and the term deposit account is closed.
+func WithdrawTermDeposit(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requireActor(w, r)
+	if !ok {
+		return
+	}
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for term deposit withdrawal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to withdraw term deposit")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	account, deposit, ok := lockTermDeposit(w, r, tx, actor, "Failed to withdraw term deposit")
+	if !ok {
+		return
+	}
+	if account.Status != ledger.StatusActive {
+		refuseAccountStatus(w, account)
+		return
+	}
+	businessDate, err := eod.BusinessDate(tx)
+	if err != nil {
+		log.Printf("Error getting business date for term deposit withdrawal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to withdraw term deposit")
+		return
+	}
+	if !businessDate.Before(deposit.MaturityDate) {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Term deposit matures on %s and is settled by the maturity run", deposit.MaturityDate.Format("2006-01-02")))
+		return
+	}
+	payout, ok := lockPayoutAccount(w, tx, deposit.PayoutAccountNumber, account.CustomerID)
+	if !ok {
+		return
+	}
+
+	result, err := termdeposit.Withdraw(tx, account, payout, deposit, businessDate)
+	if err != nil {
+		log.Printf("Error withdrawing term deposit: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to withdraw term deposit")
+		return
+	}
+	if result.Payout > 0 {
+		err = outbox.Enqueue(tx, outbox.EventTransferred, account.AccountNumber, map[string]interface{}{
+			"from_account_number": account.AccountNumber,
+			"to_account_number":   payout.AccountNumber,
+			"amount":              result.Payout,
+		})
+		if err != nil {
+			log.Printf("Error writing transfer event: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to withdraw term deposit")
+			return
+		}
+	}
+
+	extra := map[string]interface{}{"interest": result.Interest, "penalty": result.Penalty, "payout_amount": result.Payout, "payout_account_number": payout.AccountNumber}
+	updated, err := changeAccountStatus(tx, r, actor, account, ledger.StatusClosed, "Early withdrawal of term deposit", "term_deposit.withdraw", extra)
+	if err != nil {
+		log.Printf("Error closing term deposit account: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to withdraw term deposit")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing term deposit withdrawal: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to withdraw term deposit")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"account":               updated,
+		"interest":              result.Interest,
+		"penalty":               result.Penalty,
+		"payout_amount":         result.Payout,
+		"payout_account_number": payout.AccountNumber,
+	})
+}
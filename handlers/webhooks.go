@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"banking-app/audit"
+	"banking-app/db"
+	"banking-app/models"
+	"banking-app/outbox"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateWebhook registers a webhook endpoint. The signing secret is returned only once.
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	var req models.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		respondWithError(w, http.StatusBadRequest, "URL must be an absolute http(s) URL")
+		return
+	}
+	eventTypes := "*"
+	if len(req.EventTypes) > 0 {
+		for _, t := range req.EventTypes {
+			if !outbox.IsEventType(t) {
+				respondWithError(w, http.StatusBadRequest, "Unknown event type "+t)
+				return
+			}
+		}
+		eventTypes = strings.Join(req.EventTypes, ",")
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		log.Printf("Error generating webhook secret: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+	secret := hex.EncodeToString(secretBytes)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for webhook: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	result, err := tx.Exec("INSERT INTO webhook_subscriptions (url, secret, event_types) VALUES (?, ?, ?)", req.URL, secret, eventTypes)
+	if err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+	subscriptionID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting last insert ID for webhook: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get webhook ID")
+		return
+	}
+
+	sub := models.WebhookSubscription{
+		SubscriptionID: int(subscriptionID),
+		URL:            req.URL,
+		EventTypes:     strings.Split(eventTypes, ","),
+		Active:         true,
+		CreatedAt:      time.Now(), // This might be slightly off from DB's timestamp
+	}
+	// The secret is deliberately kept out of the audit log
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "webhook.create", EntityType: "webhook", EntityID: strconv.Itoa(sub.SubscriptionID), After: sub})
+	if err != nil {
+		log.Printf("Error writing audit log for webhook: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing webhook: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+
+	sub.Secret = secret
+	respondWithJSON(w, http.StatusCreated, sub)
+}
+
+// GetWebhooks lists registered webhooks without their secrets
+func GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	rows, err := db.DB.Query("SELECT subscription_id, url, event_types, active, created_at FROM webhook_subscriptions ORDER BY subscription_id")
+	if err != nil {
+		log.Printf("Error listing webhooks: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve webhooks")
+		return
+	}
+	defer rows.Close()
+
+	subs := []models.WebhookSubscription{}
+	for rows.Next() {
+		var s models.WebhookSubscription
+		var eventTypes string
+		if err := rows.Scan(&s.SubscriptionID, &s.URL, &eventTypes, &s.Active, &s.CreatedAt); err != nil {
+			log.Printf("Error scanning webhook: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve webhooks")
+			return
+		}
+		s.EventTypes = strings.Split(eventTypes, ",")
+		subs = append(subs, s)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating webhooks: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve webhooks")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, subs)
+}
+
+// DeleteWebhook deactivates a webhook; its delivery history is kept
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for webhook deletion: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete webhook")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	result, err := tx.Exec("UPDATE webhook_subscriptions SET active = FALSE WHERE subscription_id = ? AND active = TRUE", id)
+	if err != nil {
+		log.Printf("Error deactivating webhook: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete webhook")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "webhook.delete", EntityType: "webhook", EntityID: strconv.Itoa(id),
+		Before: map[string]bool{"active": true}, After: map[string]bool{"active": false}})
+	if err != nil {
+		log.Printf("Error writing audit log for webhook deletion: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete webhook")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing webhook deletion: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete webhook")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Webhook deleted"})
+}
+
+// GetWebhookDeliveries lists deliveries, newest first, optionally filtered with ?status=
+// (e.g. ?status=dead for the dead-letter queue)
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	query := "SELECT delivery_id, event_id, subscription_id, status, attempts, next_attempt_at, last_error, delivered_at FROM webhook_deliveries"
+	var args []interface{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		if status != "pending" && status != "delivered" && status != "dead" {
+			respondWithError(w, http.StatusBadRequest, "Status must be 'pending', 'delivered' or 'dead'")
+			return
+		}
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+
+	rows, err := db.DB.Query(query+" ORDER BY delivery_id DESC LIMIT 500", args...)
+	if err != nil {
+		log.Printf("Error listing webhook deliveries: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve deliveries")
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.DeliveryID, &d.EventID, &d.SubscriptionID, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastError, &d.DeliveredAt); err != nil {
+			log.Printf("Error scanning webhook delivery: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve deliveries")
+			return
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating webhook deliveries: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve deliveries")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, deliveries)
+}
+
+// ReplayWebhookDelivery re-queues a single delivery, typically one from the dead-letter queue
+func ReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid delivery ID")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for webhook delivery replay: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to replay delivery")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	if err := outbox.ReplayDelivery(tx, id); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Delivery not found")
+		} else {
+			log.Printf("Error replaying webhook delivery: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to replay delivery")
+		}
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "webhook.replay_delivery", EntityType: "webhook_delivery", EntityID: strconv.FormatInt(id, 10)})
+	if err != nil {
+		log.Printf("Error writing audit log for webhook delivery replay: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to replay delivery")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing webhook delivery replay: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to replay delivery")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{"delivery_id": id, "status": "pending"})
+}
+
+// ReplayOutboxEvent redelivers an event to every active webhook it matches
+func ReplayOutboxEvent(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid event ID")
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction for outbox event replay: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to replay event")
+		return
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	queued, err := outbox.ReplayEvent(tx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Event not found")
+		} else {
+			log.Printf("Error replaying outbox event: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to replay event")
+		}
+		return
+	}
+	err = audit.RecordTx(tx, r, audit.Entry{Action: "webhook.replay_event", EntityType: "outbox_event", EntityID: strconv.FormatInt(id, 10),
+		After: map[string]int{"deliveries_queued": queued}})
+	if err != nil {
+		log.Printf("Error writing audit log for outbox event replay: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to replay event")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing outbox event replay: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to replay event")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{"event_id": id, "deliveries_queued": queued})
+}
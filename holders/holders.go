@@ -0,0 +1,104 @@
+// Package holders models the customers who hold an account together and the rules for
+// who may sign for it. The primary holder is the account's customer_id; everyone else
+// is stored in account_holders with a secondary role.
+package holders
+
+import (
+	"database/sql"
+	"fmt"
+
+	"banking-app/db"
+	"banking-app/models"
+)
+
+// Holder roles
+const (
+	RolePrimary   = "primary"              // The account's customer; manages the account
+	RoleJoint     = "joint"                // Co-owner with full rights to move money
+	RoleSignatory = "authorized_signatory" // May move money but does not own the account
+	RoleViewOnly  = "view_only"            // May see the account only
+)
+
+// IsSecondaryRole reports whether role can be stored in account_holders
+func IsSecondaryRole(role string) bool {
+	return role == RoleJoint || role == RoleSignatory || role == RoleViewOnly
+}
+
+// CanSign reports whether a holder with role may move money out of the account
+func CanSign(role string) bool {
+	return role == RolePrimary || role == RoleJoint || role == RoleSignatory
+}
+
+// Signing rules stored in account_signing_rules.rule
+const (
+	RuleAnyOne         = "any_one"          // Any signer may move money alone
+	RuleAllMustApprove = "all_must_approve" // Transfers above the threshold need every signer
+)
+
+// Role returns the role of a customer on an account, or "" if they are not a holder
+func Role(q db.Querier, account models.Account, customerID int) (string, error) {
+	if customerID == account.CustomerID {
+		return RolePrimary, nil
+	}
+	var role string
+	err := q.QueryRow("SELECT role FROM account_holders WHERE account_id = ? AND customer_id = ?", account.AccountID, customerID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("loading role of customer %d on account %d: %w", customerID, account.AccountID, err)
+	}
+	return role, nil
+}
+
+// List returns every holder of an account, primary first
+func List(q db.Querier, account models.Account) ([]models.AccountHolder, error) {
+	rows, err := q.Query(`SELECT c.customer_id, c.name, ?, NULL FROM customers c WHERE c.customer_id = ?
+		UNION ALL
+		SELECT c.customer_id, c.name, h.role, h.added_at FROM account_holders h JOIN customers c ON c.customer_id = h.customer_id
+		WHERE h.account_id = ?`, RolePrimary, account.CustomerID, account.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("listing holders of account %d: %w", account.AccountID, err)
+	}
+	defer rows.Close()
+
+	var list []models.AccountHolder
+	for rows.Next() {
+		var h models.AccountHolder
+		if err := rows.Scan(&h.CustomerID, &h.Name, &h.Role, &h.AddedAt); err != nil {
+			return nil, fmt.Errorf("scanning holder of account %d: %w", account.AccountID, err)
+		}
+		list = append(list, h)
+	}
+	return list, rows.Err()
+}
+
+// Signers returns the customers who may sign for an account, primary first
+func Signers(q db.Querier, account models.Account) ([]int, error) {
+	list, err := List(q, account)
+	if err != nil {
+		return nil, err
+	}
+	var signers []int
+	for _, h := range list {
+		if CanSign(h.Role) {
+			signers = append(signers, h.CustomerID)
+		}
+	}
+	return signers, nil
+}
+
+// GetSigningRule returns the signing rule of an account; accounts without one are any-one
+func GetSigningRule(q db.Querier, accountID int) (models.SigningRule, error) {
+	rule := models.SigningRule{Rule: RuleAnyOne}
+	err := q.QueryRow("SELECT rule, threshold FROM account_signing_rules WHERE account_id = ?", accountID).Scan(&rule.Rule, &rule.Threshold)
+	if err != nil && err != sql.ErrNoRows {
+		return rule, fmt.Errorf("loading signing rule of account %d: %w", accountID, err)
+	}
+	return rule, nil
+}
+
+// NeedsAllSigners reports whether a transfer of amount must be approved by every signer
+func NeedsAllSigners(rule models.SigningRule, amount float64) bool {
+	return rule.Rule == RuleAllMustApprove && amount > rule.Threshold
+}
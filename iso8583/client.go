@@ -0,0 +1,135 @@
+package iso8583
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client is a simple acquirer-side connection used to drive the simulator from tests.
+// Requests are sent one at a time and matched to their response by MTI and STAN.
+type Client struct {
+	conn    net.Conn
+	timeout time.Duration
+
+	mu   sync.Mutex
+	stan int
+}
+
+// Dial connects to an ISO 8583 server
+func Dial(addr string) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, timeout: 10 * time.Second}, nil
+}
+
+// Close closes the underlying connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Send transmits a request and waits for its response. A STAN and transmission
+// date/time are filled in when the request does not carry them.
+func (c *Client) Send(req *Message) (*Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := req.Get(FieldSTAN); !ok {
+		c.stan = c.stan%999999 + 1
+		req.Set(FieldSTAN, fmt.Sprintf("%06d", c.stan))
+	}
+	if _, ok := req.Get(FieldTransmissionDateTime); !ok {
+		req.Set(FieldTransmissionDateTime, time.Now().UTC().Format("0102150405"))
+	}
+	if _, ok := req.Get(FieldRRN); !ok && req.MTI != MTIReversalRequest && req.MTI != MTIReversalRepeat {
+		// YDDDhh followed by the STAN, the usual retrieval reference layout
+		now := time.Now().UTC()
+		req.Set(FieldRRN, fmt.Sprintf("%d%03d%02d%s", now.Year()%10, now.YearDay(), now.Hour(), req.Field(FieldSTAN)))
+	}
+
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+	if err := WriteMessage(c.conn, req); err != nil {
+		return nil, err
+	}
+	resp, err := ReadMessage(c.conn)
+	if err != nil {
+		return nil, err
+	}
+	if resp.MTI != responseMTI(req.MTI) || resp.Field(FieldSTAN) != req.Field(FieldSTAN) {
+		return nil, fmt.Errorf("unexpected response %s STAN %s to %s STAN %s",
+			resp.MTI, resp.Field(FieldSTAN), req.MTI, req.Field(FieldSTAN))
+	}
+	return resp, nil
+}
+
+// Authorize sends an 0100 authorization request for amount (in minor units)
+func (c *Client) Authorize(pan, expiry string, amount int64, mcc string) (*Message, error) {
+	return c.Send(cardRequest(MTIAuthorizationRequest, pan, expiry, amount, mcc))
+}
+
+// Purchase sends an 0200 financial request for amount (in minor units)
+func (c *Client) Purchase(pan, expiry string, amount int64, mcc string) (*Message, error) {
+	return c.Send(cardRequest(MTIFinancialRequest, pan, expiry, amount, mcc))
+}
+
+// Reverse sends an 0400 reversal of a previously sent 0100 or 0200 request.
+// Either the original request or the response to it may be passed.
+func (c *Client) Reverse(original *Message) (*Message, error) {
+	mti := original.MTI
+	if len(mti) == 4 && (mti[2]-'0')%2 == 1 {
+		mti = mti[:2] + string(mti[2]-1) + "0"
+	}
+	req := NewMessage(MTIReversalRequest)
+	for _, f := range []int{FieldPAN, FieldProcessingCode, FieldAmount, FieldExpiry, FieldMCC,
+		FieldRRN, FieldTerminalID, FieldMerchantID, FieldCurrencyCode} {
+		if v, ok := original.Get(f); ok {
+			req.Set(f, v)
+		}
+	}
+	req.Set(FieldOriginalData, OriginalData(mti, original.Field(FieldSTAN), original.Field(FieldTransmissionDateTime)))
+	return c.Send(req)
+}
+
+// OriginalData builds field 90 from the original MTI, STAN and transmission date/time
+func OriginalData(mti, stan, transmission string) string {
+	return padDigits(mti, 4) + padDigits(stan, 6) + padDigits(transmission, 10) + strings.Repeat("0", 22)
+}
+
+// ParseOriginalData splits field 90 into the original MTI and STAN
+func ParseOriginalData(v string) (mti, stan string, err error) {
+	if len(v) != 42 {
+		return "", "", fmt.Errorf("original data elements must be 42 digits, got %d", len(v))
+	}
+	return v[:4], v[4:10], nil
+}
+
+func padDigits(s string, n int) string {
+	if len(s) >= n {
+		return s[len(s)-n:]
+	}
+	return strings.Repeat("0", n-len(s)) + s
+}
+
+func cardRequest(mti, pan, expiry string, amount int64, mcc string) *Message {
+	req := NewMessage(mti)
+	req.Set(FieldPAN, pan)
+	req.Set(FieldProcessingCode, "000000")
+	req.Set(FieldAmount, strconv.FormatInt(amount, 10))
+	if expiry != "" {
+		req.Set(FieldExpiry, expiry)
+	}
+	if mcc != "" {
+		req.Set(FieldMCC, mcc)
+	}
+	req.Set(FieldTerminalID, "SIMTERM1")
+	req.Set(FieldMerchantID, "SIMMERCHANT0001")
+	req.Set(FieldCurrencyCode, "840")
+	return req
+}
@@ -0,0 +1,175 @@
+package iso8583
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+// issuer is a minimal in-memory card issuer: it approves requests within the
+// available amount and gives the amount back when the request is reversed
+type issuer struct {
+	mu        sync.Mutex
+	available map[string]int64
+	approved  map[string]int64 // amount approved per original MTI and STAN
+}
+
+func (s *issuer) Handle(req *Message) *Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := req.Response()
+	amount, err := req.Amount()
+	if err != nil {
+		resp.Set(FieldResponseCode, "30")
+		return resp
+	}
+	switch req.MTI {
+	case MTIAuthorizationRequest, MTIFinancialRequest:
+		if amount > s.available[req.Field(FieldPAN)] {
+			resp.Set(FieldResponseCode, "51")
+			return resp
+		}
+		s.available[req.Field(FieldPAN)] -= amount
+		s.approved[req.MTI+req.Field(FieldSTAN)] = amount
+		resp.Set(FieldAuthCode, "123456")
+		resp.Set(FieldResponseCode, "00")
+	case MTIReversalRequest, MTIReversalRepeat:
+		mti, stan, err := ParseOriginalData(req.Field(FieldOriginalData))
+		if err != nil {
+			resp.Set(FieldResponseCode, "30")
+			return resp
+		}
+		original, ok := s.approved[mti+stan]
+		if !ok {
+			resp.Set(FieldResponseCode, "25")
+			return resp
+		}
+		delete(s.approved, mti+stan)
+		s.available[req.Field(FieldPAN)] += original
+		resp.Set(FieldResponseCode, "00")
+	default:
+		resp.Set(FieldResponseCode, "12")
+	}
+	return resp
+}
+
+func (s *issuer) balance(pan string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.available[pan]
+}
+
+func startServer(t *testing.T, h Handler) *Client {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &Server{Handler: h}
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(l) }()
+
+	client, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		srv.Close()
+		if err := <-done; err != ErrServerClosed {
+			t.Errorf("Serve returned %v, want ErrServerClosed", err)
+		}
+	})
+	return client
+}
+
+func TestClientAuthorizeAndReverse(t *testing.T) {
+	const pan = "4111111111111111"
+	iss := &issuer{available: map[string]int64{pan: 10000}, approved: map[string]int64{}}
+	client := startServer(t, iss)
+
+	auth, err := client.Authorize(pan, "2812", 2500, "5411")
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if auth.MTI != MTIAuthorizationResponse {
+		t.Errorf("MTI = %s, want %s", auth.MTI, MTIAuthorizationResponse)
+	}
+	if code := auth.Field(FieldResponseCode); code != "00" {
+		t.Fatalf("response code = %s, want 00", code)
+	}
+	if auth.Field(FieldAuthCode) != "123456" {
+		t.Errorf("auth code = %q, want 123456", auth.Field(FieldAuthCode))
+	}
+	if auth.Field(FieldRRN) == "" {
+		t.Errorf("response does not echo the RRN")
+	}
+	if got := iss.balance(pan); got != 7500 {
+		t.Errorf("available after authorization = %d, want 7500", got)
+	}
+
+	declined, err := client.Authorize(pan, "2812", 9000, "5411")
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if code := declined.Field(FieldResponseCode); code != "51" {
+		t.Errorf("response code over the available amount = %s, want 51", code)
+	}
+	if declined.Field(FieldSTAN) == auth.Field(FieldSTAN) {
+		t.Errorf("STAN %s was reused", auth.Field(FieldSTAN))
+	}
+
+	// Reversing from the response must find the original 0100 request
+	rev, err := client.Reverse(auth)
+	if err != nil {
+		t.Fatalf("Reverse: %v", err)
+	}
+	if rev.MTI != MTIReversalResponse {
+		t.Errorf("MTI = %s, want %s", rev.MTI, MTIReversalResponse)
+	}
+	if code := rev.Field(FieldResponseCode); code != "00" {
+		t.Fatalf("reversal response code = %s, want 00", code)
+	}
+	if got := iss.balance(pan); got != 10000 {
+		t.Errorf("available after reversal = %d, want 10000", got)
+	}
+
+	again, err := client.Reverse(auth)
+	if err != nil {
+		t.Fatalf("Reverse: %v", err)
+	}
+	if code := again.Field(FieldResponseCode); code != "25" {
+		t.Errorf("second reversal response code = %s, want 25", code)
+	}
+}
+
+func TestClientRejectsMismatchedResponse(t *testing.T) {
+	client := startServer(t, HandlerFunc(func(req *Message) *Message {
+		resp := req.Response()
+		resp.Set(FieldSTAN, "999999")
+		resp.Set(FieldResponseCode, "00")
+		return resp
+	}))
+
+	if _, err := client.Purchase("4111111111111111", "", 100, ""); err == nil {
+		t.Errorf("Purchase accepted a response with another STAN")
+	}
+}
+
+func TestOriginalData(t *testing.T) {
+	v := OriginalData(MTIFinancialRequest, "17", "1018093000")
+	if len(v) != 42 {
+		t.Fatalf("len = %d, want 42", len(v))
+	}
+	mti, stan, err := ParseOriginalData(v)
+	if err != nil {
+		t.Fatalf("ParseOriginalData: %v", err)
+	}
+	if mti != MTIFinancialRequest || stan != "000017" {
+		t.Errorf("ParseOriginalData = %s, %s; want %s, 000017", mti, stan, MTIFinancialRequest)
+	}
+	if _, _, err := ParseOriginalData(v[:41]); err == nil {
+		t.Errorf("ParseOriginalData accepted 41 digits")
+	}
+}
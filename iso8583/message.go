@@ -0,0 +1,277 @@
+package iso8583
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Message type indicators supported by the simulator
+const (
+	MTIAuthorizationRequest  = "0100"
+	MTIAuthorizationResponse = "0110"
+	MTIFinancialRequest      = "0200"
+	MTIFinancialResponse     = "0210"
+	MTIReversalRequest       = "0400"
+	MTIReversalRepeat        = "0401"
+	MTIReversalResponse      = "0410"
+)
+
+// Data elements used by the simulator
+const (
+	FieldPAN                  = 2
+	FieldProcessingCode       = 3
+	FieldAmount               = 4
+	FieldTransmissionDateTime = 7
+	FieldSTAN                 = 11
+	FieldLocalTime            = 12
+	FieldLocalDate            = 13
+	FieldExpiry               = 14
+	FieldMCC                  = 18
+	FieldPOSEntryMode         = 22
+	FieldRRN                  = 37
+	FieldAuthCode             = 38
+	FieldResponseCode         = 39
+	FieldTerminalID           = 41
+	FieldMerchantID           = 42
+	FieldCardAcceptorName     = 43
+	FieldCurrencyCode         = 49
+	FieldAdditionalAmounts    = 54
+	FieldOriginalData         = 90
+)
+
+type fieldKind int
+
+const (
+	fixed fieldKind = iota
+	llvar
+	lllvar
+)
+
+// fieldSpec describes how a data element is encoded on the wire
+type fieldSpec struct {
+	kind    fieldKind
+	length  int  // exact length for fixed fields, maximum length for variable ones
+	numeric bool // numeric fields are zero-padded on the left, others space-padded on the right
+}
+
+var specs = map[int]fieldSpec{
+	FieldPAN:                  {llvar, 19, true},
+	FieldProcessingCode:       {fixed, 6, true},
+	FieldAmount:               {fixed, 12, true},
+	FieldTransmissionDateTime: {fixed, 10, true},
+	FieldSTAN:                 {fixed, 6, true},
+	FieldLocalTime:            {fixed, 6, true},
+	FieldLocalDate:            {fixed, 4, true},
+	FieldExpiry:               {fixed, 4, true},
+	FieldMCC:                  {fixed, 4, true},
+	FieldPOSEntryMode:         {fixed, 3, true},
+	FieldRRN:                  {fixed, 12, false},
+	FieldAuthCode:             {fixed, 6, false},
+	FieldResponseCode:         {fixed, 2, false},
+	FieldTerminalID:           {fixed, 8, false},
+	FieldMerchantID:           {fixed, 15, false},
+	FieldCardAcceptorName:     {fixed, 40, false},
+	FieldCurrencyCode:         {fixed, 3, true},
+	FieldAdditionalAmounts:    {lllvar, 120, false},
+	FieldOriginalData:         {fixed, 42, true},
+}
+
+// Message is an ISO 8583 message with ASCII data elements and binary bitmaps
+type Message struct {
+	MTI    string
+	fields map[int]string
+}
+
+// NewMessage creates an empty message with the given message type indicator
+func NewMessage(mti string) *Message {
+	return &Message{MTI: mti, fields: make(map[int]string)}
+}
+
+// Set assigns a data element. Fixed numeric fields are zero-padded and fixed
+// alphanumeric fields are space-padded when the message is packed.
+func (m *Message) Set(field int, value string) {
+	m.fields[field] = value
+}
+
+// Get returns a data element and whether it is present
+func (m *Message) Get(field int) (string, bool) {
+	v, ok := m.fields[field]
+	return v, ok
+}
+
+// Field returns a data element, or an empty string when it is absent
+func (m *Message) Field(field int) string {
+	return m.fields[field]
+}
+
+// Amount returns field 4 parsed as minor currency units
+func (m *Message) Amount() (int64, error) {
+	v, ok := m.fields[FieldAmount]
+	if !ok {
+		return 0, fmt.Errorf("field %d is missing", FieldAmount)
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// Response builds the response skeleton for a request, echoing the data
+// elements the acquirer expects to see again.
+func (m *Message) Response() *Message {
+	resp := NewMessage(responseMTI(m.MTI))
+	for _, f := range []int{FieldPAN, FieldProcessingCode, FieldAmount, FieldTransmissionDateTime,
+		FieldSTAN, FieldLocalTime, FieldLocalDate, FieldRRN, FieldTerminalID, FieldMerchantID,
+		FieldCurrencyCode, FieldOriginalData} {
+		if v, ok := m.fields[f]; ok {
+			resp.fields[f] = v
+		}
+	}
+	return resp
+}
+
+func responseMTI(mti string) string {
+	if len(mti) != 4 {
+		return mti
+	}
+	if mti == MTIReversalRepeat {
+		return MTIReversalResponse
+	}
+	return mti[:2] + string(mti[2]+1) + "0"
+}
+
+// Pack encodes the message: MTI, primary (and if needed secondary) bitmap, then data elements
+func (m *Message) Pack() ([]byte, error) {
+	if len(m.MTI) != 4 || !isDigits(m.MTI) {
+		return nil, fmt.Errorf("invalid MTI %q", m.MTI)
+	}
+
+	numbers := make([]int, 0, len(m.fields))
+	for f := range m.fields {
+		if _, ok := specs[f]; !ok {
+			return nil, fmt.Errorf("field %d is not supported", f)
+		}
+		numbers = append(numbers, f)
+	}
+	sort.Ints(numbers)
+
+	bitmap := make([]byte, 8)
+	if len(numbers) > 0 && numbers[len(numbers)-1] > 64 {
+		bitmap = make([]byte, 16)
+		bitmap[0] |= 0x80
+	}
+	for _, f := range numbers {
+		bitmap[(f-1)/8] |= 0x80 >> uint((f-1)%8)
+	}
+
+	var b strings.Builder
+	b.WriteString(m.MTI)
+	b.Write(bitmap)
+	for _, f := range numbers {
+		encoded, err := encodeField(f, specs[f], m.fields[f])
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(encoded)
+	}
+	return []byte(b.String()), nil
+}
+
+// Unpack decodes a message produced by Pack
+func Unpack(data []byte) (*Message, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("message too short: %d bytes", len(data))
+	}
+	m := NewMessage(string(data[:4]))
+	if !isDigits(m.MTI) {
+		return nil, fmt.Errorf("invalid MTI %q", m.MTI)
+	}
+
+	bitmap := data[4:12]
+	pos := 12
+	if bitmap[0]&0x80 != 0 {
+		if len(data) < 20 {
+			return nil, fmt.Errorf("message too short for secondary bitmap")
+		}
+		bitmap = data[4:20]
+		pos = 20
+	}
+
+	for f := 2; f <= len(bitmap)*8; f++ {
+		if bitmap[(f-1)/8]&(0x80>>uint((f-1)%8)) == 0 {
+			continue
+		}
+		spec, ok := specs[f]
+		if !ok {
+			return nil, fmt.Errorf("field %d is not supported", f)
+		}
+		value, n, err := decodeField(f, spec, data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		m.fields[f] = value
+		pos += n
+	}
+	if pos != len(data) {
+		return nil, fmt.Errorf("%d trailing bytes after last field", len(data)-pos)
+	}
+	return m, nil
+}
+
+func encodeField(f int, spec fieldSpec, value string) (string, error) {
+	if spec.numeric && !isDigits(value) {
+		return "", fmt.Errorf("field %d must be numeric, got %q", f, value)
+	}
+	if len(value) > spec.length {
+		return "", fmt.Errorf("field %d exceeds %d characters", f, spec.length)
+	}
+	switch spec.kind {
+	case llvar:
+		return fmt.Sprintf("%02d%s", len(value), value), nil
+	case lllvar:
+		return fmt.Sprintf("%03d%s", len(value), value), nil
+	}
+	if spec.numeric {
+		return strings.Repeat("0", spec.length-len(value)) + value, nil
+	}
+	return value + strings.Repeat(" ", spec.length-len(value)), nil
+}
+
+func decodeField(f int, spec fieldSpec, data []byte) (string, int, error) {
+	length, prefix := spec.length, 0
+	switch spec.kind {
+	case llvar:
+		prefix = 2
+	case lllvar:
+		prefix = 3
+	}
+	if prefix > 0 {
+		if len(data) < prefix {
+			return "", 0, fmt.Errorf("field %d: truncated length prefix", f)
+		}
+		n, err := strconv.Atoi(string(data[:prefix]))
+		if err != nil || n > spec.length {
+			return "", 0, fmt.Errorf("field %d: invalid length prefix %q", f, data[:prefix])
+		}
+		length = n
+	}
+	if len(data) < prefix+length {
+		return "", 0, fmt.Errorf("field %d: truncated value", f)
+	}
+	value := string(data[prefix : prefix+length])
+	if spec.numeric && !isDigits(value) {
+		return "", 0, fmt.Errorf("field %d must be numeric, got %q", f, value)
+	}
+	if !spec.numeric && spec.kind == fixed {
+		value = strings.TrimRight(value, " ")
+	}
+	return value, prefix + length, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
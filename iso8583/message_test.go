@@ -0,0 +1,169 @@
+package iso8583
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPackUnpackRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		mti    string
+		fields map[int]string
+		want   map[int]string // fields as unpacked, where padding changes them
+	}{
+		{
+			name: "authorization request",
+			mti:  MTIAuthorizationRequest,
+			fields: map[int]string{
+				FieldPAN:            "4111111111111111",
+				FieldProcessingCode: "000000",
+				FieldAmount:         "1250",
+				FieldSTAN:           "42",
+				FieldExpiry:         "2812",
+				FieldMCC:            "5411",
+				FieldTerminalID:     "TERM1",
+				FieldMerchantID:     "SIMMERCHANT0001",
+				FieldCurrencyCode:   "840",
+			},
+			want: map[int]string{
+				FieldAmount: "000000001250",
+				FieldSTAN:   "000042",
+			},
+		},
+		{
+			name: "response with variable length amounts",
+			mti:  MTIAuthorizationResponse,
+			fields: map[int]string{
+				FieldPAN:               "5500000000000004",
+				FieldSTAN:              "000001",
+				FieldAuthCode:          "A1B2C3",
+				FieldResponseCode:      "00",
+				FieldAdditionalAmounts: "0002840C000000010000",
+			},
+		},
+		{
+			name: "reversal with secondary bitmap",
+			mti:  MTIReversalRequest,
+			fields: map[int]string{
+				FieldPAN:          "4111111111111111",
+				FieldAmount:       "000000001250",
+				FieldSTAN:         "000002",
+				FieldRRN:          "629115000001",
+				FieldOriginalData: OriginalData(MTIAuthorizationRequest, "1", "1018093000"),
+			},
+		},
+		{
+			name:   "no data elements",
+			mti:    MTIFinancialRequest,
+			fields: map[int]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMessage(tt.mti)
+			for f, v := range tt.fields {
+				m.Set(f, v)
+			}
+			data, err := m.Pack()
+			if err != nil {
+				t.Fatalf("Pack: %v", err)
+			}
+			got, err := Unpack(data)
+			if err != nil {
+				t.Fatalf("Unpack: %v", err)
+			}
+			if got.MTI != tt.mti {
+				t.Errorf("MTI = %q, want %q", got.MTI, tt.mti)
+			}
+			if len(got.fields) != len(tt.fields) {
+				t.Errorf("unpacked %d fields, want %d", len(got.fields), len(tt.fields))
+			}
+			for f, v := range tt.fields {
+				if w, ok := tt.want[f]; ok {
+					v = w
+				}
+				if g, ok := got.Get(f); !ok || g != v {
+					t.Errorf("field %d = %q (present %v), want %q", f, g, ok, v)
+				}
+			}
+
+			// Packing the unpacked message again must give the same bytes
+			again, err := got.Pack()
+			if err != nil {
+				t.Fatalf("Pack of unpacked message: %v", err)
+			}
+			if !bytes.Equal(again, data) {
+				t.Errorf("repacked message differs:\n got %q\nwant %q", again, data)
+			}
+		})
+	}
+}
+
+func TestPackRejectsInvalidFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		mti   string
+		field int
+		value string
+	}{
+		{"non-numeric MTI", "01A0", FieldSTAN, "1"},
+		{"unsupported field", MTIAuthorizationRequest, 5, "1"},
+		{"non-numeric amount", MTIAuthorizationRequest, FieldAmount, "12.50"},
+		{"fixed field too long", MTIAuthorizationRequest, FieldResponseCode, "000"},
+		{"variable field too long", MTIAuthorizationRequest, FieldPAN, "41111111111111111111"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMessage(tt.mti)
+			m.Set(tt.field, tt.value)
+			if _, err := m.Pack(); err == nil {
+				t.Errorf("Pack succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestUnpackRejectsMalformedMessages(t *testing.T) {
+	m := NewMessage(MTIAuthorizationRequest)
+	m.Set(FieldPAN, "4111111111111111")
+	m.Set(FieldAmount, "1250")
+	valid, err := m.Pack()
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too short", valid[:10]},
+		{"truncated field", valid[:len(valid)-1]},
+		{"trailing bytes", append(append([]byte{}, valid...), '0')},
+		{"non-numeric MTI", append([]byte("X100"), valid[4:]...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Unpack(tt.data); err == nil {
+				t.Errorf("Unpack succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestResponseMTI(t *testing.T) {
+	tests := map[string]string{
+		MTIAuthorizationRequest: MTIAuthorizationResponse,
+		MTIFinancialRequest:     MTIFinancialResponse,
+		MTIReversalRequest:      MTIReversalResponse,
+		MTIReversalRepeat:       MTIReversalResponse,
+	}
+	for req, want := range tests {
+		if got := responseMTI(req); got != want {
+			t.Errorf("responseMTI(%s) = %s, want %s", req, got, want)
+		}
+	}
+}
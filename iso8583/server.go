@@ -0,0 +1,150 @@
+package iso8583
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// ReadMessage reads one message framed by a 2-byte big-endian length header
+func ReadMessage(r io.Reader) (*Message, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint16(header[:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return Unpack(data)
+}
+
+// WriteMessage packs a message and writes it with a 2-byte big-endian length header
+func WriteMessage(w io.Writer, m *Message) error {
+	data, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	if len(data) > 0xFFFF {
+		return fmt.Errorf("message too long: %d bytes", len(data))
+	}
+	frame := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(frame, uint16(len(data)))
+	copy(frame[2:], data)
+	_, err = w.Write(frame)
+	return err
+}
+
+// Handler responds to a single ISO 8583 request
+type Handler interface {
+	Handle(req *Message) *Message
+}
+
+// HandlerFunc adapts an ordinary function to the Handler interface
+type HandlerFunc func(req *Message) *Message
+
+// Handle calls f(req)
+func (f HandlerFunc) Handle(req *Message) *Message {
+	return f(req)
+}
+
+// ErrServerClosed is returned by Serve after Close has been called
+var ErrServerClosed = errors.New("iso8583: server closed")
+
+// Server is a TCP listener that answers ISO 8583 requests one at a time per connection
+type Server struct {
+	Addr    string
+	Handler Handler
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// ListenAndServe listens on s.Addr and serves connections until Close is called
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l and handles each in its own goroutine
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.conns = make(map[net.Conn]struct{})
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the listener and closes all open connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		req, err := ReadMessage(conn)
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if err != io.EOF && !closed {
+				log.Printf("ISO 8583: dropping connection from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		resp := s.Handler.Handle(req)
+		if resp == nil {
+			continue
+		}
+		if err := WriteMessage(conn, resp); err != nil {
+			log.Printf("ISO 8583: error writing %s response to %s: %v", resp.MTI, conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package kyc tracks the identity documents customers submit and whether they have been
+// verified. Customers cannot move money until both an identity document and a proof of
+// address have been approved by an employee.
+package kyc
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"banking-app/blobstore"
+	"banking-app/db"
+)
+
+// Documents holds the uploaded files; main replaces it with the configured store
+var Documents blobstore.Store
+
+// Customer KYC statuses stored in customers.kyc_status
+const (
+	StatusUnverified = "unverified" // Documents missing
+	StatusPending    = "pending"    // Every required document submitted, awaiting review
+	StatusVerified   = "verified"
+	StatusRejected   = "rejected" // A required document was rejected and not yet replaced
+)
+
+// Document types
+const (
+	DocumentID             = "id"
+	DocumentProofOfAddress = "proof_of_address"
+)
+
+// RequiredDocuments must all be approved for a customer to be verified
+var RequiredDocuments = []string{DocumentID, DocumentProofOfAddress}
+
+// Document statuses stored in kyc_documents.status
+const (
+	DocumentPending  = "pending"
+	DocumentApproved = "approved"
+	DocumentRejected = "rejected"
+)
+
+// IsDocumentType reports whether t is a known document type
+func IsDocumentType(t string) bool {
+	for _, d := range RequiredDocuments {
+		if d == t {
+			return true
+		}
+	}
+	return false
+}
+
+// NewStorageKey returns a fresh, unguessable key for a customer's document
+func NewStorageKey(customerID int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating document key: %w", err)
+	}
+	return fmt.Sprintf("kyc/%d/%s", customerID, hex.EncodeToString(b)), nil
+}
+
+// UpdateStatus recomputes a customer's KYC status from the latest document of each
+// required type and stores it
+func UpdateStatus(tx *sql.Tx, customerID int) (string, error) {
+	approved, pending, rejected := 0, 0, 0
+	for _, docType := range RequiredDocuments {
+		var status string
+		err := tx.QueryRow(`SELECT status FROM kyc_documents WHERE customer_id = ? AND document_type = ?
+			ORDER BY document_id DESC LIMIT 1`, customerID, docType).Scan(&status)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("loading %s document of customer %d: %w", docType, customerID, err)
+		}
+		switch status {
+		case DocumentApproved:
+			approved++
+		case DocumentPending:
+			pending++
+		case DocumentRejected:
+			rejected++
+		}
+	}
+
+	status := StatusUnverified
+	switch {
+	case approved == len(RequiredDocuments):
+		status = StatusVerified
+	case rejected > 0:
+		status = StatusRejected
+	case approved+pending == len(RequiredDocuments):
+		status = StatusPending
+	}
+	if _, err := tx.Exec("UPDATE customers SET kyc_status = ? WHERE customer_id = ?", status, customerID); err != nil {
+		return "", fmt.Errorf("updating KYC status: %w", err)
+	}
+	return status, nil
+}
+
+// CustomerStatus returns a customer's stored KYC status
+func CustomerStatus(q db.Querier, customerID int) (string, error) {
+	var status string
+	if err := q.QueryRow("SELECT kyc_status FROM customers WHERE customer_id = ?", customerID).Scan(&status); err != nil {
+		return "", fmt.Errorf("loading KYC status of customer %d: %w", customerID, err)
+	}
+	return status, nil
+}
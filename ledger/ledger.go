@@ -0,0 +1,214 @@
+package ledger
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"banking-app/db"
+	"banking-app/models"
+)
+
+// Transaction types stored in transactions.type
+const (
+	TypeDeposit         = "deposit"
+	TypeWithdrawal      = "withdrawal"
+	TypeTransferIn      = "transfer_in"
+	TypeTransferOut     = "transfer_out"
+	TypeFee             = "fee"
+	TypeInterest        = "interest"
+	TypeFeeIncome       = "fee_income"        // Credit to the fee income account
+	TypeFeeRefund       = "fee_refund"        // A fee given back to the account
+	TypeFeeIncomeRefund = "fee_income_refund" // A refunded fee taken back from the fee income account
+	TypeInterestPaid    = "interest_paid"     // Interest credited to a term deposit
+
+	TypeReversalCredit = "reversal_credit" // Contra entry of a debit
+	TypeReversalDebit  = "reversal_debit"  // Contra entry of a credit
+	TypeDisputeCredit  = "dispute_credit"  // Credit for a disputed debit, provisional until the dispute is upheld
+	TypeDirectDebit    = "direct_debit"    // Collection taken by a creditor under a mandate
+	TypeDirectDebitIn  = "direct_debit_in" // Collection paid into the creditor's account
+)
+
+// IsCredit reports whether a transaction of the given type adds to the account's balance
+func IsCredit(txnType string) bool {
+	switch txnType {
+	case TypeDeposit, TypeTransferIn, TypeFeeIncome, TypeFeeRefund, TypeInterestPaid, TypeReversalCredit, TypeDisputeCredit, TypeDirectDebitIn:
+		return true
+	}
+	return false
+}
+
+// Account types stored in accounts.account_type
+const (
+	AccountSavings = "savings"
+	AccountCurrent = "current"
+	AccountTerm    = "term" // Term deposit: money moves only on opening, at maturity or on early withdrawal
+)
+
+// Post records a transaction row against an account inside the given SQL transaction.
+// The caller is responsible for updating the account balance in the same transaction.
+// The row is booked and value-dated on the current business date.
+func Post(tx *sql.Tx, accountID int, txnType string, amount float64, description string) (int64, error) {
+	return post(tx, accountID, nil, txnType, amount, description, nil)
+}
+
+// post books the row on the current business date; valueDate defaults to it
+func post(tx *sql.Tx, accountID int, counterpartyID *int, txnType string, amount float64, description string, valueDate *time.Time) (int64, error) {
+	result, err := tx.Exec(`INSERT INTO transactions (account_id, counterparty_account_id, type, amount, transaction_date, booking_date, value_date, description)
+		SELECT ?, ?, ?, ?, NOW(), business_date, COALESCE(?, business_date), ? FROM business_date WHERE id = 1`,
+		accountID, counterpartyID, txnType, amount, valueDate, description)
+	if err != nil {
+		return 0, fmt.Errorf("posting %s of %.2f to account %d: %w", txnType, amount, accountID, err)
+	}
+	return result.LastInsertId()
+}
+
+// Transfer moves amount between two accounts locked by the caller: it updates both
+// balances and posts the outgoing and incoming transaction rows, each recording the
+// other account as counterparty. The caller checks funds and limits beforehand.
+func Transfer(tx *sql.Tx, from, to models.Account, amount float64) error {
+	return transfer(tx, from, to, amount, nil)
+}
+
+// TransferValueDated is Transfer for a transfer executed ahead of its value date
+func TransferValueDated(tx *sql.Tx, from, to models.Account, amount float64, valueDate time.Time) error {
+	return transfer(tx, from, to, amount, &valueDate)
+}
+
+func transfer(tx *sql.Tx, from, to models.Account, amount float64, valueDate *time.Time) error {
+	if _, err := tx.Exec("UPDATE accounts SET balance = balance - ? WHERE account_id = ?", amount, from.AccountID); err != nil {
+		return fmt.Errorf("debiting account %d: %w", from.AccountID, err)
+	}
+	if _, err := tx.Exec("UPDATE accounts SET balance = balance + ? WHERE account_id = ?", amount, to.AccountID); err != nil {
+		return fmt.Errorf("crediting account %d: %w", to.AccountID, err)
+	}
+	outID, err := post(tx, from.AccountID, &to.AccountID, TypeTransferOut, amount, "Transfer to "+to.AccountNumber, valueDate)
+	if err != nil {
+		return err
+	}
+	inID, err := post(tx, to.AccountID, &from.AccountID, TypeTransferIn, amount, "Transfer from "+from.AccountNumber, valueDate)
+	if err != nil {
+		return err
+	}
+	return link(tx, outID, inID)
+}
+
+// link records two rows as the legs of one movement, so that they are reversed together
+func link(tx *sql.Tx, a, b int64) error {
+	_, err := tx.Exec("UPDATE transactions SET linked_transaction_id = IF(transaction_id = ?, ?, ?) WHERE transaction_id IN (?, ?)", a, b, a, a, b)
+	if err != nil {
+		return fmt.Errorf("linking transactions %d and %d: %w", a, b, err)
+	}
+	return nil
+}
+
+// Fee debits a fee from an account and credits it to the fee income account, updating
+// both balances and posting a row on each side. It returns the ID of the debit row.
+func Fee(tx *sql.Tx, accountID, incomeAccountID int, amount float64, description string) (int64, error) {
+	return Charge(tx, accountID, incomeAccountID, TypeFee, amount, description)
+}
+
+// Charge is Fee for a charge posted on the account as txnType, such as overdraft interest
+func Charge(tx *sql.Tx, accountID, incomeAccountID int, txnType string, amount float64, description string) (int64, error) {
+	if _, err := tx.Exec("UPDATE accounts SET balance = balance - ? WHERE account_id = ?", amount, accountID); err != nil {
+		return 0, fmt.Errorf("debiting fee from account %d: %w", accountID, err)
+	}
+	if _, err := tx.Exec("UPDATE accounts SET balance = balance + ? WHERE account_id = ?", amount, incomeAccountID); err != nil {
+		return 0, fmt.Errorf("crediting fee income account %d: %w", incomeAccountID, err)
+	}
+	txnID, err := post(tx, accountID, &incomeAccountID, txnType, amount, description, nil)
+	if err != nil {
+		return 0, err
+	}
+	incomeID, err := post(tx, incomeAccountID, &accountID, TypeFeeIncome, amount, description, nil)
+	if err != nil {
+		return 0, err
+	}
+	return txnID, link(tx, txnID, incomeID)
+}
+
+// DirectDebit collects amount from a debtor's account into a creditor's account, both
+// locked by the caller, updating both balances and posting a row on each side. It
+// returns the ID of the debit row. The caller checks the mandate and funds beforehand.
+func DirectDebit(tx *sql.Tx, debtor, creditor models.Account, amount float64, description string) (int64, error) {
+	if _, err := tx.Exec("UPDATE accounts SET balance = balance - ? WHERE account_id = ?", amount, debtor.AccountID); err != nil {
+		return 0, fmt.Errorf("debiting account %d: %w", debtor.AccountID, err)
+	}
+	if _, err := tx.Exec("UPDATE accounts SET balance = balance + ? WHERE account_id = ?", amount, creditor.AccountID); err != nil {
+		return 0, fmt.Errorf("crediting account %d: %w", creditor.AccountID, err)
+	}
+	debitID, err := post(tx, debtor.AccountID, &creditor.AccountID, TypeDirectDebit, amount, description, nil)
+	if err != nil {
+		return 0, err
+	}
+	creditID, err := post(tx, creditor.AccountID, &debtor.AccountID, TypeDirectDebitIn, amount, description, nil)
+	if err != nil {
+		return 0, err
+	}
+	return debitID, link(tx, debitID, creditID)
+}
+
+// RefundFee gives a fee back from the fee income account, posting a row on each side
+func RefundFee(tx *sql.Tx, accountID, incomeAccountID int, amount float64, description string) error {
+	if _, err := tx.Exec("UPDATE accounts SET balance = balance - ? WHERE account_id = ?", amount, incomeAccountID); err != nil {
+		return fmt.Errorf("debiting fee income account %d: %w", incomeAccountID, err)
+	}
+	if _, err := tx.Exec("UPDATE accounts SET balance = balance + ? WHERE account_id = ?", amount, accountID); err != nil {
+		return fmt.Errorf("refunding fee to account %d: %w", accountID, err)
+	}
+	refundID, err := post(tx, accountID, &incomeAccountID, TypeFeeRefund, amount, description, nil)
+	if err != nil {
+		return err
+	}
+	incomeID, err := post(tx, incomeAccountID, &accountID, TypeFeeIncomeRefund, amount, description, nil)
+	if err != nil {
+		return err
+	}
+	return link(tx, refundID, incomeID)
+}
+
+const accountColumns = "account_id, customer_id, account_number, account_type, balance, opened_date, branch_id, overdraft_limit, overdraft_rate, status"
+
+func scanAccount(row *sql.Row) (models.Account, error) {
+	var a models.Account
+	err := row.Scan(&a.AccountID, &a.CustomerID, &a.AccountNumber, &a.AccountType, &a.Balance, &a.OpenedDate, &a.BranchID, &a.OverdraftLimit, &a.OverdraftRate, &a.Status)
+	return a, err
+}
+
+// LockAccount loads an account by number and locks it FOR UPDATE inside tx.
+// It returns sql.ErrNoRows if the account does not exist.
+func LockAccount(tx *sql.Tx, accountNumber string) (models.Account, error) {
+	return scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE account_number = ? FOR UPDATE", accountNumber))
+}
+
+// LockAccountByID is LockAccount for an account known by its ID
+func LockAccountByID(tx *sql.Tx, accountID int) (models.Account, error) {
+	return scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE account_id = ? FOR UPDATE", accountID))
+}
+
+// GetAccount loads an account by number without locking it.
+// It returns sql.ErrNoRows if the account does not exist.
+func GetAccount(accountNumber string) (models.Account, error) {
+	return scanAccount(db.DB.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE account_number = ?", accountNumber))
+}
+
+// GetAccountByID is GetAccount for an account known by its ID
+func GetAccountByID(accountID int) (models.Account, error) {
+	return scanAccount(db.DB.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE account_id = ?", accountID))
+}
+
+// Available is what can be drawn from an account: its balance plus any arranged overdraft
+func Available(a models.Account) float64 {
+	return a.Balance + a.OverdraftLimit
+}
+
+// Round rounds an amount to whole cents
+func Round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// DateOnly truncates a time to midnight UTC of its calendar day
+func DateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
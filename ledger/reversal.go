@@ -0,0 +1,87 @@
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrUnlinkedLeg is returned by Reverse for one leg of a two-sided movement whose other
+// leg is not known, e.g. a row posted before legs were linked that could not be matched
+var ErrUnlinkedLeg = errors.New("the other leg of the transaction is not linked")
+
+// Entry is a posted transaction row as needed to reverse it
+type Entry struct {
+	TransactionID  int64   `json:"transaction_id"`
+	AccountID      int     `json:"account_id"`
+	CounterpartyID *int    `json:"counterparty_account_id"`
+	Type           string  `json:"type"`
+	Amount         float64 `json:"amount"`
+	LinkedID       *int64  `json:"linked_transaction_id"` // The other leg of a transfer or fee
+	ReversalOf     *int64  `json:"reversal_of"`           // Set on contra entries
+	ReversedBy     *int64  `json:"reversed_by"`           // The contra entry, once reversed
+}
+
+// LockEntry loads a posted transaction and locks it FOR UPDATE inside tx.
+// It returns sql.ErrNoRows if the transaction does not exist.
+func LockEntry(tx *sql.Tx, transactionID int64) (Entry, error) {
+	var e Entry
+	err := tx.QueryRow(`SELECT t.transaction_id, t.account_id, t.counterparty_account_id, t.type, t.amount, t.linked_transaction_id, t.reversal_of,
+			(SELECT r.transaction_id FROM transactions r WHERE r.reversal_of = t.transaction_id)
+		FROM transactions t WHERE t.transaction_id = ? FOR UPDATE OF t`, transactionID).Scan(
+		&e.TransactionID, &e.AccountID, &e.CounterpartyID, &e.Type, &e.Amount, &e.LinkedID, &e.ReversalOf, &e.ReversedBy)
+	return e, err
+}
+
+// Reverse posts a contra entry for each leg of a movement locked with LockEntry: the
+// same amount in the other direction on the same account, pointing back at the leg it
+// reverses. It updates the balances and returns the IDs of the contra entries in the
+// order of legs. The caller checks the legs are not reversed yet and that the accounts
+// allow it; a second reversal of a leg is also refused by the database. A leg of a
+// two-sided movement must be given with its linked leg, or ErrUnlinkedLeg is returned.
+func Reverse(tx *sql.Tx, legs []Entry, description string) ([]int64, error) {
+	for _, e := range legs {
+		if Unlinked(e) {
+			return nil, fmt.Errorf("reversing transaction %d: %w", e.TransactionID, ErrUnlinkedLeg)
+		}
+	}
+	ids := make([]int64, 0, len(legs))
+	for _, e := range legs {
+		txnType, delta := TypeReversalCredit, e.Amount
+		if IsCredit(e.Type) {
+			txnType, delta = TypeReversalDebit, -e.Amount
+		}
+		if _, err := tx.Exec("UPDATE accounts SET balance = balance + ? WHERE account_id = ?", delta, e.AccountID); err != nil {
+			return nil, fmt.Errorf("reversing transaction %d on account %d: %w", e.TransactionID, e.AccountID, err)
+		}
+		id, err := post(tx, e.AccountID, e.CounterpartyID, txnType, e.Amount, description, nil)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("UPDATE transactions SET reversal_of = ? WHERE transaction_id = ?", e.TransactionID, id); err != nil {
+			return nil, fmt.Errorf("linking reversal of transaction %d: %w", e.TransactionID, err)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 2 {
+		if err := link(tx, ids[0], ids[1]); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// Unlinked reports whether e is one leg of a two-sided movement without its other leg linked
+func Unlinked(e Entry) bool {
+	return e.LinkedID == nil && (e.CounterpartyID != nil || twoSided(e.Type))
+}
+
+// twoSided reports whether a transaction of the given type is always posted with a leg on
+// another account
+func twoSided(txnType string) bool {
+	switch txnType {
+	case TypeTransferOut, TypeTransferIn, TypeFeeIncome, TypeFeeRefund, TypeFeeIncomeRefund, TypeDirectDebit, TypeDirectDebitIn:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package ledger
+
+import (
+	"fmt"
+
+	"banking-app/models"
+)
+
+// Account statuses stored in accounts.status
+const (
+	StatusPending = "pending" // Opened, awaiting activation; can be funded but not drawn on
+	StatusActive  = "active"
+	StatusFrozen  = "frozen"  // Blocked in both directions, e.g. on a legal order
+	StatusDormant = "dormant" // Long unused; can receive money but must be reactivated to draw on
+	StatusClosed  = "closed"
+)
+
+// CanTransition reports whether an account may move from one status to another.
+// Closed is final, and a frozen account must be unfrozen before anything else.
+func CanTransition(from, to string) bool {
+	switch from {
+	case StatusPending:
+		return to == StatusActive || to == StatusClosed
+	case StatusActive:
+		return to == StatusFrozen || to == StatusDormant || to == StatusClosed
+	case StatusFrozen:
+		return to == StatusActive
+	case StatusDormant:
+		return to == StatusActive || to == StatusFrozen || to == StatusClosed
+	}
+	return false
+}
+
+// CanDebit reports whether money may leave the account. A term deposit takes no ordinary
+// movements whatever its status.
+func CanDebit(a models.Account) bool {
+	return a.Status == StatusActive && a.AccountType != AccountTerm
+}
+
+// CanCredit reports whether money may be paid into the account
+func CanCredit(a models.Account) bool {
+	return (a.Status == StatusActive || a.Status == StatusPending || a.Status == StatusDormant) && a.AccountType != AccountTerm
+}
+
+// Refusal describes why CanDebit or CanCredit refused a movement on the account
+func Refusal(a models.Account) string {
+	if a.AccountType == AccountTerm && a.Status != StatusClosed {
+		return fmt.Sprintf("Account %s is a term deposit", a.AccountNumber)
+	}
+	return fmt.Sprintf("Account %s is %s", a.AccountNumber, a.Status)
+}
@@ -0,0 +1,143 @@
+// Package limits enforces caps on withdrawals and outgoing transfers. Defaults are
+// configured per account type and customer tier; employees can override them per account.
+package limits
+
+import (
+	"database/sql"
+	"fmt"
+
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+)
+
+// Customer tiers stored in customers.tier
+const (
+	TierStandard = "standard"
+	TierPremium  = "premium"
+	TierPrivate  = "private"
+)
+
+// Codes identifying the limit a request would exceed
+const (
+	CodePerTransaction = "per_transaction_limit_exceeded"
+	CodeDailyAmount    = "daily_limit_exceeded"
+	CodeMonthlyAmount  = "monthly_limit_exceeded"
+	CodeDailyCount     = "daily_count_exceeded"
+)
+
+// Violation describes the limit a request would exceed
+type Violation struct {
+	Code    string
+	Message string
+}
+
+// IsTier reports whether s is a known customer tier
+func IsTier(s string) bool {
+	return s == TierStandard || s == TierPremium || s == TierPrivate
+}
+
+// Defaults returns the configured limits for an account type and customer tier.
+// An unconfigured combination has no limits.
+func Defaults(q db.Querier, accountType, tier string) (models.TransactionLimits, error) {
+	l := models.TransactionLimits{AccountType: accountType, CustomerTier: tier}
+	err := q.QueryRow(`SELECT per_transaction, daily_amount, monthly_amount, daily_count FROM transaction_limits
+		WHERE account_type = ? AND customer_tier = ?`, accountType, tier).Scan(&l.PerTransaction, &l.DailyAmount, &l.MonthlyAmount, &l.DailyCount)
+	if err != nil && err != sql.ErrNoRows {
+		return l, fmt.Errorf("loading %s/%s limits: %w", accountType, tier, err)
+	}
+	return l, nil
+}
+
+// Override returns the per-account override, or nil if the account has none
+func Override(q db.Querier, accountID int) (*models.TransactionLimits, error) {
+	var l models.TransactionLimits
+	err := q.QueryRow("SELECT per_transaction, daily_amount, monthly_amount, daily_count FROM account_limit_overrides WHERE account_id = ?",
+		accountID).Scan(&l.PerTransaction, &l.DailyAmount, &l.MonthlyAmount, &l.DailyCount)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading limit override of account %d: %w", accountID, err)
+	}
+	return &l, nil
+}
+
+// Effective returns the limits that apply to an account: the defaults for its type and
+// its customer's tier, with any fields set in the account override replacing them
+func Effective(q db.Querier, account models.Account) (models.TransactionLimits, error) {
+	var tier string
+	if err := q.QueryRow("SELECT tier FROM customers WHERE customer_id = ?", account.CustomerID).Scan(&tier); err != nil {
+		return models.TransactionLimits{}, fmt.Errorf("loading tier of customer %d: %w", account.CustomerID, err)
+	}
+	l, err := Defaults(q, account.AccountType, tier)
+	if err != nil {
+		return l, err
+	}
+	o, err := Override(q, account.AccountID)
+	if err != nil || o == nil {
+		return l, err
+	}
+	if o.PerTransaction != nil {
+		l.PerTransaction = o.PerTransaction
+	}
+	if o.DailyAmount != nil {
+		l.DailyAmount = o.DailyAmount
+	}
+	if o.MonthlyAmount != nil {
+		l.MonthlyAmount = o.MonthlyAmount
+	}
+	if o.DailyCount != nil {
+		l.DailyCount = o.DailyCount
+	}
+	return l, nil
+}
+
+// Usage sums the withdrawals and outgoing transfers booked on an account on the current
+// business date and in its calendar month. Card purchases are posted as withdrawals and
+// count too; fees and interest do not.
+func Usage(q db.Querier, accountID int) (models.LimitUsage, error) {
+	var u models.LimitUsage
+	err := q.QueryRow(`SELECT
+			COALESCE(SUM(CASE WHEN t.booking_date = b.business_date THEN t.amount END), 0),
+			COALESCE(SUM(t.amount), 0),
+			COUNT(CASE WHEN t.booking_date = b.business_date THEN 1 END)
+		FROM transactions t JOIN business_date b ON b.id = 1
+		WHERE t.account_id = ? AND t.type IN (?, ?) AND t.booking_date >= DATE_FORMAT(b.business_date, '%Y-%m-01')`,
+		accountID, ledger.TypeWithdrawal, ledger.TypeTransferOut).Scan(&u.DailyAmount, &u.MonthlyAmount, &u.DailyCount)
+	if err != nil {
+		return u, fmt.Errorf("summing usage of account %d: %w", accountID, err)
+	}
+	return u, nil
+}
+
+// Check evaluates a withdrawal or outgoing transfer of amount against the account's
+// limits. Call it inside the transaction holding the account's FOR UPDATE lock, so
+// concurrent requests cannot both pass against the same history.
+func Check(tx *sql.Tx, account models.Account, amount float64) (*Violation, error) {
+	l, err := Effective(tx, account)
+	if err != nil {
+		return nil, err
+	}
+	if l.PerTransaction != nil && amount > *l.PerTransaction {
+		return &Violation{CodePerTransaction, fmt.Sprintf("Amount exceeds the per-transaction limit of %.2f", *l.PerTransaction)}, nil
+	}
+	if l.DailyAmount == nil && l.MonthlyAmount == nil && l.DailyCount == nil {
+		return nil, nil
+	}
+
+	u, err := Usage(tx, account.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if l.DailyCount != nil && u.DailyCount+1 > *l.DailyCount {
+		return &Violation{CodeDailyCount, fmt.Sprintf("Daily limit of %d withdrawals and transfers reached", *l.DailyCount)}, nil
+	}
+	if l.DailyAmount != nil && u.DailyAmount+amount > *l.DailyAmount {
+		return &Violation{CodeDailyAmount, fmt.Sprintf("Amount exceeds the daily limit of %.2f (%.2f already used today)", *l.DailyAmount, u.DailyAmount)}, nil
+	}
+	if l.MonthlyAmount != nil && u.MonthlyAmount+amount > *l.MonthlyAmount {
+		return &Violation{CodeMonthlyAmount, fmt.Sprintf("Amount exceeds the monthly limit of %.2f (%.2f already used this month)", *l.MonthlyAmount, u.MonthlyAmount)}, nil
+	}
+	return nil, nil
+}
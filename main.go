@@ -6,8 +6,18 @@ import (
 	"net/http"
 	"os"
 
+	"banking-app/audit"
+	"banking-app/auth"
+	"banking-app/blobstore"
+	"banking-app/calendar"
+	"banking-app/cards"
 	"banking-app/db"
+	"banking-app/disputes"
 	"banking-app/handlers"
+	"banking-app/iso8583"
+	"banking-app/kyc"
+	"banking-app/outbox"
+	"banking-app/payees"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors" // Import the cors package
@@ -22,10 +32,48 @@ func main() {
 		log.Fatal("MYSQL_DSN environment variable not set. Please set it to your MySQL connection string.")
 	}
 
+	// There is no real authentication yet: requests name their user in the X-User-ID
+	// header, which any client can forge. Refuse to start unless that is explicitly
+	// accepted, which must only ever be done in development.
+	// Example: AUTH_DEV_TRUST_USER_HEADER="true"
+	if os.Getenv("AUTH_DEV_TRUST_USER_HEADER") != "true" {
+		log.Fatal("No authentication is configured. Set AUTH_DEV_TRUST_USER_HEADER=true to trust the X-User-ID header, for development only.")
+	}
+	auth.TrustUserHeader = true
+	log.Printf("WARNING: trusting the %s header as the caller's identity; this is not authentication and is for development only", auth.UserHeader)
+
 	// Initialize the database connection
 	db.InitDB(dataSourceName)
 	defer db.CloseDB() // Ensure database connection is closed when main exits
 
+	// KYC documents are kept on the local filesystem
+	// Example: KYC_DOCUMENT_DIR="/var/lib/banking-app/kyc"
+	documentDir := os.Getenv("KYC_DOCUMENT_DIR")
+	if documentDir == "" {
+		documentDir = "data/kyc"
+	}
+	documentStore, err := blobstore.NewLocal(documentDir)
+	if err != nil {
+		log.Fatalf("Failed to open KYC document store: %v", err)
+	}
+	kyc.Documents = documentStore
+	disputes.Evidence = documentStore // Evidence keys are prefixed per dispute
+
+	// Payee IBANs naming this bank's code resolve to our own account numbers
+	// Example: IBAN_COUNTRY="GB" IBAN_BANK_CODE="BNKA"
+	if country := os.Getenv("IBAN_COUNTRY"); country != "" {
+		payees.Country = country
+	}
+	if bankCode := os.Getenv("IBAN_BANK_CODE"); bankCode != "" {
+		payees.BankCode = bankCode
+	}
+
+	// Payments are value-dated against this country's holiday calendar
+	// Example: CALENDAR_COUNTRY="GB"
+	if country := os.Getenv("CALENDAR_COUNTRY"); country != "" {
+		calendar.Country = country
+	}
+
 	// Create a new Gorilla Mux router
 	router := mux.NewRouter()
 
@@ -36,25 +84,221 @@ func main() {
 	// Account routes
 	router.HandleFunc("/accounts", handlers.CreateAccount).Methods("POST")
 	router.HandleFunc("/accounts/{accountNumber}", handlers.GetAccountByNumber).Methods("GET")
+	router.HandleFunc("/accounts/{accountNumber}/overdraft", handlers.SetOverdraft).Methods("PUT")
+	router.HandleFunc("/accounts/{accountNumber}/overdraft", handlers.RevokeOverdraft).Methods("DELETE")
+	router.HandleFunc("/accounts/{accountNumber}/limits", handlers.GetAccountLimits).Methods("GET")
+	router.HandleFunc("/accounts/{accountNumber}/limits", handlers.SetAccountLimits).Methods("PUT")
+	router.HandleFunc("/accounts/{accountNumber}/limits", handlers.DeleteAccountLimits).Methods("DELETE")
+	router.HandleFunc("/accounts/{accountNumber}/activate", handlers.ActivateAccount).Methods("POST")
+	router.HandleFunc("/accounts/{accountNumber}/freeze", handlers.FreezeAccount).Methods("POST")
+	router.HandleFunc("/accounts/{accountNumber}/unfreeze", handlers.UnfreezeAccount).Methods("POST")
+	router.HandleFunc("/accounts/{accountNumber}/dormant", handlers.MarkAccountDormant).Methods("POST")
+	router.HandleFunc("/accounts/{accountNumber}/reactivate", handlers.ReactivateAccount).Methods("POST")
+	router.HandleFunc("/accounts/{accountNumber}/close", handlers.CloseAccount).Methods("POST")
+	router.HandleFunc("/accounts/{accountNumber}/status-history", handlers.GetAccountStatusHistory).Methods("GET")
+	router.HandleFunc("/accounts/{accountNumber}/holders", handlers.GetAccountHolders).Methods("GET")
+	router.HandleFunc("/accounts/{accountNumber}/holders", handlers.AddAccountHolder).Methods("POST")
+	router.HandleFunc("/accounts/{accountNumber}/holders/{customerId}", handlers.UpdateAccountHolder).Methods("PUT")
+	router.HandleFunc("/accounts/{accountNumber}/holders/{customerId}", handlers.RemoveAccountHolder).Methods("DELETE")
+	router.HandleFunc("/accounts/{accountNumber}/signing-rule", handlers.GetSigningRule).Methods("GET")
+	router.HandleFunc("/accounts/{accountNumber}/signing-rule", handlers.SetSigningRule).Methods("PUT")
+	router.HandleFunc("/accounts/{accountNumber}/statement", handlers.GetAccountStatement).Methods("GET")
+
+	// Joint account transfer approval routes
+	router.HandleFunc("/transfer-approvals", handlers.GetTransferApprovals).Methods("GET")
+	router.HandleFunc("/transfer-approvals/{id}/approve", handlers.ApproveTransferApproval).Methods("POST")
+	router.HandleFunc("/transfer-approvals/{id}/reject", handlers.RejectTransferApproval).Methods("POST")
+	router.HandleFunc("/transfer-approvals/{id}/execute", handlers.ExecuteTransferApproval).Methods("POST")
+
+	// Maker-checker approval routes
+	router.HandleFunc("/approvals", handlers.GetApprovalRequests).Methods("GET")
+	router.HandleFunc("/approvals/{id}", handlers.GetApprovalRequest).Methods("GET")
+	router.HandleFunc("/approvals/{id}/approve", handlers.ApproveApprovalRequest).Methods("POST")
+	router.HandleFunc("/approvals/{id}/reject", handlers.RejectApprovalRequest).Methods("POST")
+	router.HandleFunc("/approvals/{id}/execute", handlers.ExecuteApprovalRequest).Methods("POST")
+	router.HandleFunc("/approval-thresholds", handlers.GetApprovalThresholds).Methods("GET")
+	router.HandleFunc("/approval-thresholds/{operation}", handlers.UpdateApprovalThreshold).Methods("PUT")
 
 	// Transaction routes
 	router.HandleFunc("/accounts/deposit", handlers.Deposit).Methods("POST")
 	router.HandleFunc("/accounts/withdraw", handlers.Withdraw).Methods("POST")
 	router.HandleFunc("/accounts/transfer", handlers.Transfer).Methods("POST")
+	router.HandleFunc("/transactions/{id}/reverse", handlers.ReverseTransaction).Methods("POST")
+
+	// Limit routes
+	router.HandleFunc("/transaction-limits", handlers.GetTransactionLimits).Methods("GET")
+	router.HandleFunc("/transaction-limits/{accountType}/{tier}", handlers.UpdateTransactionLimits).Methods("PUT")
+	router.HandleFunc("/customers/{id}/tier", handlers.UpdateCustomerTier).Methods("PUT")
+
+	// Fraud screening routes
+	router.HandleFunc("/fraud/pending-transfers", handlers.GetPendingTransfers).Methods("GET")
+	router.HandleFunc("/fraud/pending-transfers/{id}/approve", handlers.ApprovePendingTransfer).Methods("POST")
+	router.HandleFunc("/fraud/pending-transfers/{id}/reject", handlers.RejectPendingTransfer).Methods("POST")
+	router.HandleFunc("/fraud/decisions", handlers.GetFraudDecisions).Methods("GET")
+
+	// Customer routes
+	router.HandleFunc("/customers", handlers.CreateCustomer).Methods("POST")
+	router.HandleFunc("/customers/{id}", handlers.GetCustomer).Methods("GET")
+	router.HandleFunc("/customers/{id}", handlers.UpdateCustomer).Methods("PUT")
+	router.HandleFunc("/customers/{id}/documents", handlers.UploadKYCDocument).Methods("POST")
+	router.HandleFunc("/customers/{id}/documents", handlers.GetKYCDocuments).Methods("GET")
+	router.HandleFunc("/customers/{id}/documents/{documentId}/content", handlers.GetKYCDocumentContent).Methods("GET")
+
+	// Payee routes
+	router.HandleFunc("/customers/{id}/payees", handlers.GetPayees).Methods("GET")
+	router.HandleFunc("/customers/{id}/payees", handlers.CreatePayee).Methods("POST")
+	router.HandleFunc("/customers/{id}/payees/{payeeId}", handlers.UpdatePayee).Methods("PUT")
+	router.HandleFunc("/customers/{id}/payees/{payeeId}", handlers.DeletePayee).Methods("DELETE")
+	router.HandleFunc("/payee-settings", handlers.GetPayeeSettings).Methods("GET")
+	router.HandleFunc("/payee-settings", handlers.UpdatePayeeSettings).Methods("PUT")
+
+	// KYC review routes
+	router.HandleFunc("/kyc/documents", handlers.GetKYCReviewQueue).Methods("GET")
+	router.HandleFunc("/kyc/documents/{id}/approve", handlers.ApproveKYCDocument).Methods("POST")
+	router.HandleFunc("/kyc/documents/{id}/reject", handlers.RejectKYCDocument).Methods("POST")
+
+	// Sanctions screening routes
+	router.HandleFunc("/screening/cases", handlers.GetScreeningCases).Methods("GET")
+	router.HandleFunc("/screening/cases/{id}/clear", handlers.ClearScreeningCase).Methods("POST")
+	router.HandleFunc("/screening/cases/{id}/confirm", handlers.ConfirmScreeningCase).Methods("POST")
+
+	// AML monitoring routes
+	router.HandleFunc("/aml/cases", handlers.GetAMLCases).Methods("GET")
+	router.HandleFunc("/aml/cases/{id}", handlers.GetAMLCase).Methods("GET")
+	router.HandleFunc("/aml/cases/{id}/assign", handlers.AssignAMLCase).Methods("PUT")
+	router.HandleFunc("/aml/cases/{id}/transition", handlers.TransitionAMLCase).Methods("POST")
+	router.HandleFunc("/aml/reports/export", handlers.ExportAMLReports).Methods("GET")
+
+	// Branch routes
+	router.HandleFunc("/branches", handlers.CreateBranch).Methods("POST")
+	router.HandleFunc("/branches", handlers.GetBranches).Methods("GET")
+	router.HandleFunc("/branches/{id}", handlers.GetBranchByID).Methods("GET")
+	router.HandleFunc("/branches/{id}", handlers.UpdateBranch).Methods("PUT")
+	router.HandleFunc("/branches/{id}", handlers.DeleteBranch).Methods("DELETE")
+	router.HandleFunc("/branches/{id}/manager", handlers.AssignBranchManager).Methods("PUT")
+	router.HandleFunc("/branches/{id}/accounts", handlers.GetBranchAccounts).Methods("GET")
+	router.HandleFunc("/branches/{id}/customers", handlers.GetBranchCustomers).Methods("GET")
+
+	// Teller session routes
+	router.HandleFunc("/teller-sessions", handlers.OpenTellerSession).Methods("POST")
+	router.HandleFunc("/teller-sessions/{id}", handlers.GetTellerSession).Methods("GET")
+	router.HandleFunc("/teller-sessions/{id}/close", handlers.CloseTellerSession).Methods("POST")
+	router.HandleFunc("/branches/{id}/teller-sessions", handlers.GetBranchTellerSessions).Methods("GET")
+	router.HandleFunc("/branches/{id}/cash-postings", handlers.GetBranchCashPostings).Methods("GET")
+
+	// Employee routes
+	router.HandleFunc("/employees", handlers.CreateEmployee).Methods("POST")
+	router.HandleFunc("/employees", handlers.GetEmployees).Methods("GET")
+	router.HandleFunc("/employees/{id}", handlers.GetEmployeeByID).Methods("GET")
+	router.HandleFunc("/employees/{id}", handlers.UpdateEmployee).Methods("PUT")
+	router.HandleFunc("/employees/{id}", handlers.DeleteEmployee).Methods("DELETE")
+	router.HandleFunc("/employees/{id}/manager", handlers.AssignEmployeeManager).Methods("PUT")
+	router.HandleFunc("/employees/{id}/branch", handlers.TransferEmployee).Methods("PUT")
+	router.HandleFunc("/employees/{id}/reports", handlers.GetEmployeeReports).Methods("GET")
+
+	// Card control routes
+	router.HandleFunc("/cards/{id}/controls", handlers.GetCardControls).Methods("GET")
+	router.HandleFunc("/cards/{id}/status", handlers.UpdateCardStatus).Methods("PUT")
+	router.HandleFunc("/cards/{id}/limits", handlers.UpdateCardLimits).Methods("PUT")
+	router.HandleFunc("/cards/{id}/mcc-blocks", handlers.AddCardMCCBlock).Methods("POST")
+	router.HandleFunc("/cards/{id}/mcc-blocks/{mcc}", handlers.RemoveCardMCCBlock).Methods("DELETE")
+
+	// Credit card account routes
+	router.HandleFunc("/credit-accounts", handlers.CreateCreditAccount).Methods("POST")
+	router.HandleFunc("/credit-accounts/{id}", handlers.GetCreditAccount).Methods("GET")
+	router.HandleFunc("/credit-accounts/{id}/statements", handlers.GetCreditStatements).Methods("GET")
+	router.HandleFunc("/credit-accounts/{id}/payments", handlers.MakeCreditPayment).Methods("POST")
+
+	// Webhook routes
+	router.HandleFunc("/webhooks", handlers.CreateWebhook).Methods("POST")
+	router.HandleFunc("/webhooks", handlers.GetWebhooks).Methods("GET")
+	router.HandleFunc("/webhooks/{id}", handlers.DeleteWebhook).Methods("DELETE")
+	router.HandleFunc("/webhooks/deliveries", handlers.GetWebhookDeliveries).Methods("GET")
+	router.HandleFunc("/webhooks/deliveries/{id}/replay", handlers.ReplayWebhookDelivery).Methods("POST")
+	router.HandleFunc("/webhooks/events/{id}/replay", handlers.ReplayOutboxEvent).Methods("POST")
+
+	// End-of-day routes
+	router.HandleFunc("/business-date", handlers.GetBusinessDate).Methods("GET")
+	router.HandleFunc("/eod/runs", handlers.StartEODRun).Methods("POST")
+	router.HandleFunc("/eod/runs", handlers.GetEODRuns).Methods("GET")
+	router.HandleFunc("/eod/runs/{date}", handlers.GetEODRun).Methods("GET")
+
+	// Value dating routes
+	router.HandleFunc("/holidays", handlers.GetHolidays).Methods("GET")
+	router.HandleFunc("/cut-off-times", handlers.GetCutOffTimes).Methods("GET")
+	router.HandleFunc("/cut-off-times/{paymentType}", handlers.UpdateCutOffTime).Methods("PUT")
+	router.HandleFunc("/accounts/{accountNumber}/scheduled-transfers", handlers.GetScheduledTransfers).Methods("GET")
+	router.HandleFunc("/scheduled-transfers/{id}/cancel", handlers.CancelScheduledTransfer).Methods("POST")
+
+	// Fee routes
+	router.HandleFunc("/fee-schedules", handlers.GetFeeSchedules).Methods("GET")
+	router.HandleFunc("/fee-schedules/{accountType}/{feeType}", handlers.UpdateFeeSchedule).Methods("PUT")
+	router.HandleFunc("/fee-settings", handlers.GetFeeSettings).Methods("GET")
+	router.HandleFunc("/fee-settings", handlers.UpdateFeeSettings).Methods("PUT")
+	router.HandleFunc("/accounts/{accountNumber}/fee-charges", handlers.GetFeeCharges).Methods("GET")
+	router.HandleFunc("/accounts/{accountNumber}/fee-waivers", handlers.GetFeeWaivers).Methods("GET")
+	router.HandleFunc("/accounts/{accountNumber}/fee-waivers", handlers.CreateFeeWaiver).Methods("POST")
+	router.HandleFunc("/fee-waivers/{id}", handlers.RevokeFeeWaiver).Methods("DELETE")
+
+	// Term deposit routes
+	router.HandleFunc("/term-deposit-rates", handlers.GetTermDepositRates).Methods("GET")
+	router.HandleFunc("/term-deposit-rates/{termMonths}", handlers.UpdateTermDepositRate).Methods("PUT")
+	router.HandleFunc("/term-deposits", handlers.OpenTermDeposit).Methods("POST")
+	router.HandleFunc("/term-deposits/{accountNumber}", handlers.GetTermDeposit).Methods("GET")
+	router.HandleFunc("/term-deposits/{accountNumber}/maturity-instruction", handlers.UpdateMaturityInstruction).Methods("PUT")
+	router.HandleFunc("/term-deposits/{accountNumber}/early-withdrawal", handlers.WithdrawTermDeposit).Methods("POST")
+
+	// Dispute routes
+	router.HandleFunc("/disputes", handlers.CreateDispute).Methods("POST")
+	router.HandleFunc("/disputes", handlers.GetDisputes).Methods("GET")
+	router.HandleFunc("/disputes/{id}", handlers.GetDispute).Methods("GET")
+	router.HandleFunc("/disputes/{id}/assign", handlers.AssignDispute).Methods("PUT")
+	router.HandleFunc("/disputes/{id}/credit", handlers.CreditDispute).Methods("POST")
+	router.HandleFunc("/disputes/{id}/transition", handlers.TransitionDispute).Methods("POST")
+	router.HandleFunc("/disputes/{id}/evidence", handlers.UploadDisputeEvidence).Methods("POST")
+	router.HandleFunc("/disputes/{id}/evidence/{evidenceId}", handlers.GetDisputeEvidenceContent).Methods("GET")
+
+	// Direct debit routes
+	router.HandleFunc("/direct-debit-creditors", handlers.CreateDirectDebitCreditor).Methods("POST")
+	router.HandleFunc("/direct-debit-creditors", handlers.GetDirectDebitCreditors).Methods("GET")
+	router.HandleFunc("/direct-debit-creditors/{id}/status", handlers.UpdateDirectDebitCreditorStatus).Methods("PUT")
+	router.HandleFunc("/direct-debit-mandates", handlers.CreateMandate).Methods("POST")
+	router.HandleFunc("/direct-debit-mandates/{id}", handlers.GetMandate).Methods("GET")
+	router.HandleFunc("/direct-debit-mandates/{id}/revoke", handlers.RevokeMandate).Methods("POST")
+	router.HandleFunc("/direct-debit-mandates/{id}/collections", handlers.CreateCollection).Methods("POST")
+	router.HandleFunc("/direct-debit-mandates/{id}/collections", handlers.GetMandateCollections).Methods("GET")
+	router.HandleFunc("/direct-debit-collections/{id}/cancel", handlers.CancelCollection).Methods("POST")
+	router.HandleFunc("/direct-debit-collections/{id}/refund", handlers.RefundCollection).Methods("POST")
+	router.HandleFunc("/accounts/{accountNumber}/mandates", handlers.GetAccountMandates).Methods("GET")
 
 	// --- CORS Configuration ---
 	// For development, allow all origins. In production, restrict to your frontend's domain.
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"http://localhost:3000"}, // Allow your React app's origin
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Content-Type", "Authorization"},
-		ExposedHeaders: []string{"Content-Length"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", auth.UserHeader, audit.RequestIDHeader},
+		ExposedHeaders: []string{"Content-Length", audit.RequestIDHeader},
 		AllowCredentials: true,
 		Debug: true, // Enable debug logging for CORS issues (optional)
 	})
 
-	// Wrap your router with the CORS middleware
-	handler := c.Handler(router)
+	// Wrap your router with the CORS middleware, and give every request an ID for the audit log
+	handler := c.Handler(audit.WithRequestID(router))
+
+	// Start the ISO 8583 card network simulator if requested
+	// Example: ISO8583_ADDR=":8583"
+	if isoAddr := os.Getenv("ISO8583_ADDR"); isoAddr != "" {
+		isoServer := &iso8583.Server{Addr: isoAddr, Handler: cards.ISOHandler}
+		go func() {
+			fmt.Printf("ISO 8583 simulator listening on %s...\n", isoAddr)
+			log.Fatal(isoServer.ListenAndServe())
+		}()
+	}
+
+	// Deliver account events from the outbox to registered webhooks
+	stopDispatcher := make(chan struct{})
+	defer close(stopDispatcher)
+	go outbox.NewDispatcher().Run(stopDispatcher)
 
 	// Start the HTTP server
 	port := ":8080"
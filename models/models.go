@@ -21,14 +21,17 @@ type Employee struct {
 
 // Customer represents a bank customer
 type Customer struct {
-	CustomerID int       `json:"customer_id"`
-	Name       string    `json:"name"`
-	Email      string    `json:"email"`
-	Phone      string    `json:"phone"`
-	Address    string    `json:"address"`
-	DOB        time.Time `json:"dob"` // Date of Birth
-	NationalID string    `json:"national_id"`
-	CreatedAt  time.Time `json:"created_at"`
+	CustomerID      int       `json:"customer_id"`
+	Name            string    `json:"name"`
+	Email           string    `json:"email"`
+	Phone           string    `json:"phone"`
+	Address         string    `json:"address"`
+	DOB             time.Time `json:"dob"` // Date of Birth
+	NationalID      string    `json:"national_id"`
+	CreatedAt       time.Time `json:"created_at"`
+	Tier            string    `json:"tier"`             // 'standard', 'premium', 'private'
+	ScreeningStatus string    `json:"screening_status"` // 'clear', 'pending', 'confirmed'
+	KYCStatus       string    `json:"kyc_status"`       // 'unverified', 'pending', 'verified', 'rejected'
 }
 
 // User represents a user for login (can be customer, employee, or admin)
@@ -44,23 +47,31 @@ type User struct {
 
 // Account represents a bank account (updated fields)
 type Account struct {
-	AccountID     int       `json:"account_id"`
-	CustomerID    int       `json:"customer_id"`
-	AccountNumber string    `json:"account_number"`
-	AccountType   string    `json:"account_type"` // 'savings', 'current'
-	Balance       float64   `json:"balance"`
-	OpenedDate    time.Time `json:"opened_date"` // Use time.Time for DATE type
-	BranchID      int       `json:"branch_id"`
+	AccountID      int       `json:"account_id"`
+	CustomerID     int       `json:"customer_id"`
+	AccountNumber  string    `json:"account_number"`
+	AccountType    string    `json:"account_type"` // 'savings', 'current', 'term'
+	Balance        float64   `json:"balance"`
+	OpenedDate     time.Time `json:"opened_date"` // Use time.Time for DATE type
+	BranchID       int       `json:"branch_id"`
+	OverdraftLimit float64   `json:"overdraft_limit"` // Arranged overdraft, only for 'current' accounts
+	OverdraftRate  float64   `json:"overdraft_rate"`  // Annual interest rate on overdrawn balances, e.g. 19.9
+	Status         string    `json:"status"`          // 'pending', 'active', 'frozen', 'dormant', 'closed'
 }
 
 // Transaction represents a financial transaction
 type Transaction struct {
-	TransactionID   int       `json:"transaction_id"`
-	AccountID       int       `json:"account_id"`
-	Type            string    `json:"type"` // 'deposit', 'withdrawal', 'transfer_in', 'transfer_out'
-	Amount          float64   `json:"amount"`
-	TransactionDate time.Time `json:"transaction_date"`
-	Description     string    `json:"description"`
+	TransactionID             int       `json:"transaction_id"`
+	AccountID                 int       `json:"account_id"`
+	Type                      string    `json:"type"` // 'deposit', 'withdrawal', 'transfer_in', 'transfer_out', 'fee', 'interest', 'fee_income', 'fee_refund', 'interest_paid', 'fee_income_refund', 'reversal_credit', 'reversal_debit', 'dispute_credit', 'direct_debit', 'direct_debit_in'
+	Amount                    float64   `json:"amount"`
+	TransactionDate           time.Time `json:"transaction_date"`
+	BookingDate               time.Time `json:"booking_date"` // Business date the transaction was posted on
+	ValueDate                 time.Time `json:"value_date"`   // Business date from which the money counts
+	Description               string    `json:"description"`
+	CounterpartyAccountNumber *string   `json:"counterparty_account_number"`
+	ReversalOf                *int      `json:"reversal_of"` // The transaction this one reverses
+	ReversedBy                *int      `json:"reversed_by"` // The reversal of this transaction, if reversed
 }
 
 // Loan represents a loan taken by a customer
@@ -76,13 +87,16 @@ type Loan struct {
 
 // Card represents a bank card
 type Card struct {
-	CardID      int       `json:"card_id"`
-	AccountID   int       `json:"account_id"`
-	CardNumber  string    `json:"card_number"`
-	CardType    string    `json:"card_type"` // 'debit', 'credit'
-	ExpiryDate  time.Time `json:"expiry_date"` // Use time.Time for DATE type
-	CVV         string    `json:"-"` // Exclude CVV from JSON output, store hashed/encrypted
-	CreatedAt   time.Time `json:"created_at"`
+	CardID              int       `json:"card_id"`
+	AccountID           int       `json:"account_id"`
+	CardNumber          string    `json:"card_number"`
+	CardType            string    `json:"card_type"`   // 'debit', 'credit'
+	ExpiryDate          time.Time `json:"expiry_date"` // Use time.Time for DATE type
+	CVV                 string    `json:"-"`           // Exclude CVV from JSON output, store hashed/encrypted
+	CreatedAt           time.Time `json:"created_at"`
+	Status              string    `json:"status"`                // 'active', 'frozen', 'blocked', 'expired'
+	PerTransactionLimit *float64  `json:"per_transaction_limit"` // Nil means no limit
+	DailyLimit          *float64  `json:"daily_limit"`           // Nil means no limit
 }
 
 // --- Request Payloads (Keep existing and add new ones) ---
@@ -106,6 +120,16 @@ type CreateCustomerRequest struct {
 	NationalID string `json:"national_id"`
 }
 
+// UpdateCustomerRequest
+type UpdateCustomerRequest struct {
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	Phone      string `json:"phone"`
+	Address    string `json:"address"`
+	DOB        string `json:"dob"` // Send as string "YYYY-MM-DD"
+	NationalID string `json:"national_id"`
+}
+
 // CreateBranchRequest
 type CreateBranchRequest struct {
 	Name     string `json:"name"`
@@ -113,6 +137,17 @@ type CreateBranchRequest struct {
 	ManagerID *int  `json:"manager_id"` // Optional
 }
 
+// UpdateBranchRequest
+type UpdateBranchRequest struct {
+	Name     string `json:"name"`
+	Location string `json:"location"`
+}
+
+// AssignBranchManagerRequest
+type AssignBranchManagerRequest struct {
+	ManagerID *int `json:"manager_id"` // Null removes the manager
+}
+
 // CreateEmployeeRequest
 type CreateEmployeeRequest struct {
 	Name      string `json:"name"`
@@ -121,6 +156,28 @@ type CreateEmployeeRequest struct {
 	ManagerID *int   `json:"manager_id"` // Optional
 }
 
+// UpdateEmployeeRequest
+type UpdateEmployeeRequest struct {
+	Name     string `json:"name"`
+	Position string `json:"position"`
+}
+
+// AssignManagerRequest
+type AssignManagerRequest struct {
+	ManagerID *int `json:"manager_id"` // Null removes the manager
+}
+
+// TransferEmployeeRequest
+type TransferEmployeeRequest struct {
+	BranchID int `json:"branch_id"`
+}
+
+// ReportingNode is an employee with everyone reporting to them, directly or indirectly
+type ReportingNode struct {
+	Employee
+	Reports []*ReportingNode `json:"reports"`
+}
+
 // CreateAccountRequest (updated)
 type CreateAccountRequest struct {
 	CustomerID    int    `json:"customer_id"`
@@ -129,22 +186,31 @@ type CreateAccountRequest struct {
 	BranchID      int    `json:"branch_id"`
 }
 
+// SetOverdraftRequest grants or changes the arranged overdraft of a current account
+type SetOverdraftRequest struct {
+	Limit        float64  `json:"limit"`
+	InterestRate *float64 `json:"interest_rate"` // Optional, keeps the current rate when omitted
+}
+
 // DepositRequest (remains the same)
 type DepositRequest struct {
-	AccountNumber string  `json:"account_number"`
-	Amount        float64 `json:"amount"`
+	AccountNumber string              `json:"account_number"`
+	Amount        float64             `json:"amount"`
+	Cash          []DenominationCount `json:"cash,omitempty"` // Notes and coins taken in at a teller's drawer
 }
 
 // WithdrawRequest (remains the same)
 type WithdrawRequest struct {
-	AccountNumber string  `json:"account_number"`
-	Amount        float64 `json:"amount"`
+	AccountNumber string              `json:"account_number"`
+	Amount        float64             `json:"amount"`
+	Cash          []DenominationCount `json:"cash,omitempty"` // Notes and coins paid out of a teller's drawer
 }
 
 // TransferRequest (remains the same)
 type TransferRequest struct {
 	FromAccountNumber string  `json:"from_account_number"`
 	ToAccountNumber   string  `json:"to_account_number"`
+	PayeeID           *int    `json:"payee_id,omitempty"` // Pay a saved payee instead of ToAccountNumber
 	Amount            float64 `json:"amount"`
 }
 
@@ -170,3 +236,837 @@ type CreateCardRequest struct {
 	ExpiryDate string `json:"expiry_date"` // Send as string "YYYY-MM-DD"
 	CVV        string `json:"cvv"` // In production, handle securely
 }
+
+// CardAuthorization represents a card network request processed against a card
+type CardAuthorization struct {
+	AuthorizationID int       `json:"authorization_id"`
+	CardID          int       `json:"card_id"`
+	AccountID       int       `json:"account_id"`
+	MTI             string    `json:"mti"` // '0100', '0200'
+	STAN            string    `json:"stan"`
+	RRN             string    `json:"rrn"`
+	Amount          float64   `json:"amount"`
+	MCC             string    `json:"mcc"`
+	MerchantID      string    `json:"merchant_id"`
+	ResponseCode    string    `json:"response_code"`
+	DeclineReason   string    `json:"decline_reason,omitempty"`
+	AuthCode        string    `json:"auth_code"`
+	Status          string    `json:"status"` // 'held', 'captured', 'reversed', 'declined'
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// UpdateCardStatusRequest
+type UpdateCardStatusRequest struct {
+	Status string `json:"status"` // 'active', 'frozen', 'blocked'
+}
+
+// UpdateCardLimitsRequest
+type UpdateCardLimitsRequest struct {
+	PerTransactionLimit *float64 `json:"per_transaction_limit"` // Null removes the limit
+	DailyLimit          *float64 `json:"daily_limit"`           // Null removes the limit
+}
+
+// CardMCCBlockRequest
+type CardMCCBlockRequest struct {
+	MCC string `json:"mcc"` // 4-digit merchant category code
+}
+
+// CreditAccount represents the credit line behind a credit card
+type CreditAccount struct {
+	CreditAccountID   int        `json:"credit_account_id"`
+	CardID            int        `json:"card_id"`
+	CreditLimit       float64    `json:"credit_limit"`
+	BalanceOwed       float64    `json:"balance_owed"`
+	AccruedInterest   float64    `json:"accrued_interest"` // Accrued daily, charged on the next statement
+	PurchaseAPR       float64    `json:"purchase_apr"`     // Annual percentage rate, e.g. 24.99
+	StatementDay      int        `json:"statement_day"`    // Day of month the cycle closes (1-28)
+	GraceDays         int        `json:"grace_days"`       // Days from statement to payment due date
+	MinPaymentPercent float64    `json:"min_payment_percent"`
+	MinPaymentFloor   float64    `json:"min_payment_floor"`
+	LateFee           float64    `json:"late_fee"`
+	Revolving         bool       `json:"revolving"` // True once a statement was not paid in full by its due date
+	LastAccrualDate   *time.Time `json:"last_accrual_date"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// CreditStatement represents one billing cycle of a credit account
+type CreditStatement struct {
+	StatementID     int       `json:"statement_id"`
+	CreditAccountID int       `json:"credit_account_id"`
+	PeriodStart     time.Time `json:"period_start"`
+	PeriodEnd       time.Time `json:"period_end"`
+	OpeningBalance  float64   `json:"opening_balance"`
+	Purchases       float64   `json:"purchases"`
+	Payments        float64   `json:"payments"`
+	Interest        float64   `json:"interest"`
+	Fees            float64   `json:"fees"`
+	ClosingBalance  float64   `json:"closing_balance"`
+	MinimumPayment  float64   `json:"minimum_payment"`
+	DueDate         time.Time `json:"due_date"`
+	PaidAmount      float64   `json:"paid_amount"`
+	Status          string    `json:"status"` // 'issued', 'paid_in_full', 'minimum_paid', 'missed'
+}
+
+// CreditTransaction represents a movement on a credit account
+type CreditTransaction struct {
+	CreditTransactionID int       `json:"credit_transaction_id"`
+	CreditAccountID     int       `json:"credit_account_id"`
+	Type                string    `json:"type"` // 'purchase', 'refund', 'payment', 'interest', 'fee', 'dispute_credit', 'dispute_reversal'
+	Amount              float64   `json:"amount"`
+	Description         string    `json:"description"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// CreateCreditAccountRequest
+type CreateCreditAccountRequest struct {
+	CardID            int     `json:"card_id"`
+	CreditLimit       float64 `json:"credit_limit"`
+	PurchaseAPR       float64 `json:"purchase_apr"`
+	StatementDay      int     `json:"statement_day"`
+	GraceDays         int     `json:"grace_days"`
+	MinPaymentPercent float64 `json:"min_payment_percent"`
+	MinPaymentFloor   float64 `json:"min_payment_floor"`
+	LateFee           float64 `json:"late_fee"`
+}
+
+// CreditPaymentRequest
+type CreditPaymentRequest struct {
+	FromAccountNumber string  `json:"from_account_number"`
+	Amount            float64 `json:"amount"`
+}
+
+// OutboxEvent represents an account event waiting to be delivered to webhooks
+type OutboxEvent struct {
+	EventID      int64      `json:"event_id"`
+	EventType    string     `json:"event_type"` // 'account.deposited', 'account.withdrawn', 'account.transferred'
+	AggregateID  string     `json:"aggregate_id"`
+	Payload      string     `json:"payload"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DispatchedAt *time.Time `json:"dispatched_at"`
+}
+
+// WebhookSubscription represents a registered webhook endpoint
+type WebhookSubscription struct {
+	SubscriptionID int       `json:"subscription_id"`
+	URL            string    `json:"url"`
+	Secret         string    `json:"secret,omitempty"` // Only returned when the subscription is created
+	EventTypes     []string  `json:"event_types"`
+	Active         bool      `json:"active"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// WebhookDelivery represents the delivery of one event to one subscription
+type WebhookDelivery struct {
+	DeliveryID     int64      `json:"delivery_id"`
+	EventID        int64      `json:"event_id"`
+	SubscriptionID int        `json:"subscription_id"`
+	Status         string     `json:"status"` // 'pending', 'delivered', 'dead'
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastError      string     `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// CreateWebhookRequest
+type CreateWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"` // Empty means all events
+}
+
+// TransactionLimits caps withdrawals and outgoing transfers. A nil field means no limit;
+// in an account override it means the default for the account type and tier applies.
+type TransactionLimits struct {
+	AccountType    string   `json:"account_type,omitempty"`
+	CustomerTier   string   `json:"customer_tier,omitempty"`
+	PerTransaction *float64 `json:"per_transaction"`
+	DailyAmount    *float64 `json:"daily_amount"`
+	MonthlyAmount  *float64 `json:"monthly_amount"`
+	DailyCount     *int     `json:"daily_count"`
+}
+
+// LimitUsage is what an account has already drawn against its limits
+type LimitUsage struct {
+	DailyAmount   float64 `json:"daily_amount"`
+	MonthlyAmount float64 `json:"monthly_amount"`
+	DailyCount    int     `json:"daily_count"`
+}
+
+// UpdateCustomerTierRequest
+type UpdateCustomerTierRequest struct {
+	Tier string `json:"tier"`
+}
+
+// FraudDecision is the stored result of screening one withdrawal or transfer
+type FraudDecision struct {
+	DecisionID            int64     `json:"decision_id"`
+	Kind                  string    `json:"kind"` // 'withdrawal', 'transfer'
+	AccountID             int       `json:"account_id"`
+	CounterpartyAccountID *int      `json:"counterparty_account_id"`
+	Amount                float64   `json:"amount"`
+	Decision              string    `json:"decision"` // 'allow', 'review', 'deny'
+	Score                 int       `json:"score"`
+	Outcomes              string    `json:"outcomes"` // JSON array of per-rule outcomes
+	RequestID             string    `json:"request_id"`
+	ReviewOutcome         *string   `json:"review_outcome"` // 'approved', 'rejected'
+	CreatedAt             time.Time `json:"created_at"`
+}
+
+// PendingTransfer is a transfer held for employee review by fraud screening
+type PendingTransfer struct {
+	PendingTransferID int        `json:"pending_transfer_id"`
+	DecisionID        int64      `json:"decision_id"`
+	FromAccountNumber string     `json:"from_account_number"`
+	ToAccountNumber   string     `json:"to_account_number"`
+	Amount            float64    `json:"amount"`
+	Status            string     `json:"status"` // 'pending', 'approved', 'rejected'
+	RequestedBy       *int       `json:"requested_by"`
+	ReviewedBy        *int       `json:"reviewed_by"`
+	ReviewNote        string     `json:"review_note"`
+	CreatedAt         time.Time  `json:"created_at"`
+	ReviewedAt        *time.Time `json:"reviewed_at"`
+}
+
+// ReviewPendingTransferRequest
+type ReviewPendingTransferRequest struct {
+	Note string `json:"note"`
+}
+
+// ScreeningCase is a sanctions or PEP list hit on a customer awaiting or after review
+type ScreeningCase struct {
+	CaseID       int        `json:"case_id"`
+	CustomerID   int        `json:"customer_id"`
+	EntryID      int64      `json:"entry_id"`
+	ListName     string     `json:"list_name"`
+	ScreenedName string     `json:"screened_name"`
+	MatchedName  string     `json:"matched_name"`
+	Score        float64    `json:"score"`
+	PEP          bool       `json:"pep"`
+	Trigger      string     `json:"trigger"` // 'onboarding', 'update', 'transfer', 'rescreen'
+	Status       string     `json:"status"`  // 'open', 'cleared', 'confirmed'
+	ReviewedBy   *int       `json:"reviewed_by"`
+	ReviewNote   string     `json:"review_note"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ReviewedAt   *time.Time `json:"reviewed_at"`
+}
+
+// ReviewScreeningCaseRequest
+type ReviewScreeningCaseRequest struct {
+	Note string `json:"note"`
+}
+
+// AMLCase is a suspicious activity case opened by the AML monitoring scan
+type AMLCase struct {
+	CaseID          int64          `json:"case_id"`
+	Scenario        string         `json:"scenario"` // 'structuring', 'rapid_movement', 'dormant_reactivation'
+	AccountID       int            `json:"account_id"`
+	CustomerID      int            `json:"customer_id"`
+	Amount          float64        `json:"amount"`
+	Evidence        string         `json:"evidence"` // JSON summary and supporting transactions
+	DetectedFor     time.Time      `json:"detected_for"`
+	Status          string         `json:"status"` // 'open', 'investigating', 'escalated', 'filed', 'closed'
+	AssignedTo      *int           `json:"assigned_to"`
+	ReportReference *string        `json:"report_reference"`
+	FiledAt         *time.Time     `json:"filed_at"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	Events          []AMLCaseEvent `json:"events,omitempty"`
+}
+
+// AMLCaseEvent is one step in the history of an AML case
+type AMLCaseEvent struct {
+	EventID     int64     `json:"event_id"`
+	FromStatus  string    `json:"from_status"`
+	ToStatus    string    `json:"to_status"`
+	ActorUserID *int      `json:"actor_user_id"`
+	Note        string    `json:"note"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AssignAMLCaseRequest
+type AssignAMLCaseRequest struct {
+	EmployeeID int `json:"employee_id"`
+}
+
+// TransitionAMLCaseRequest
+type TransitionAMLCaseRequest struct {
+	Status          string `json:"status"`
+	Note            string `json:"note"`
+	ReportReference string `json:"report_reference"` // Required when filing
+}
+
+// KYCDocument is an identity or address document uploaded for a customer
+type KYCDocument struct {
+	DocumentID   int        `json:"document_id"`
+	CustomerID   int        `json:"customer_id"`
+	DocumentType string     `json:"document_type"` // 'id', 'proof_of_address'
+	FileName     string     `json:"file_name"`
+	ContentType  string     `json:"content_type"`
+	SizeBytes    int64      `json:"size_bytes"`
+	SHA256       string     `json:"sha256"`
+	Status       string     `json:"status"` // 'pending', 'approved', 'rejected'
+	UploadedBy   int        `json:"uploaded_by"`
+	ReviewedBy   *int       `json:"reviewed_by"`
+	ReviewNote   string     `json:"review_note"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ReviewedAt   *time.Time `json:"reviewed_at"`
+}
+
+// ReviewKYCDocumentRequest
+type ReviewKYCDocumentRequest struct {
+	Note string `json:"note"`
+}
+
+// AccountStatusEvent records one change of an account's status
+type AccountStatusEvent struct {
+	EventID     int64     `json:"event_id"`
+	FromStatus  string    `json:"from_status"`
+	ToStatus    string    `json:"to_status"`
+	Reason      string    `json:"reason"`
+	ActorUserID *int      `json:"actor_user_id"` // NULL for changes made by a batch process
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ChangeAccountStatusRequest
+type ChangeAccountStatusRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CloseAccountRequest
+type CloseAccountRequest struct {
+	Reason              string `json:"reason"`
+	PayoutAccountNumber string `json:"payout_account_number"` // Receives any remaining balance
+}
+
+// AccountHolder is a customer holding an account, with their role on it
+type AccountHolder struct {
+	CustomerID int        `json:"customer_id"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`     // 'primary', 'joint', 'authorized_signatory', 'view_only'
+	AddedAt    *time.Time `json:"added_at"` // NULL for the primary holder
+}
+
+// AddAccountHolderRequest
+type AddAccountHolderRequest struct {
+	CustomerID int    `json:"customer_id"`
+	Role       string `json:"role"`
+}
+
+// UpdateAccountHolderRequest
+type UpdateAccountHolderRequest struct {
+	Role string `json:"role"` // 'primary' makes the customer primary and the previous primary joint
+}
+
+// SigningRule decides who must approve transfers from a jointly held account
+type SigningRule struct {
+	Rule      string  `json:"rule"`      // 'any_one', 'all_must_approve'
+	Threshold float64 `json:"threshold"` // 'all_must_approve' applies to transfers above it
+}
+
+// TransferApproval is a transfer from a jointly held account waiting for its signers
+type TransferApproval struct {
+	ApprovalID        int                 `json:"approval_id"`
+	FromAccountNumber string              `json:"from_account_number"`
+	ToAccountNumber   string              `json:"to_account_number"`
+	Amount            float64             `json:"amount"`
+	RequestedBy       int                 `json:"requested_by"` // Customer ID
+	Status            string              `json:"status"`       // 'pending', 'approved', 'rejected', 'executed'
+	CreatedAt         time.Time           `json:"created_at"`
+	DecidedAt         *time.Time          `json:"decided_at"`
+	ExecutedAt        *time.Time          `json:"executed_at"`
+	Signatures        []TransferSignature `json:"signatures"`
+}
+
+// TransferSignature is one signer's decision on a transfer approval
+type TransferSignature struct {
+	CustomerID int        `json:"customer_id"`
+	Decision   string     `json:"decision"` // 'pending', 'approved', 'rejected'
+	DecidedAt  *time.Time `json:"decided_at"`
+}
+
+// Payee is a transfer destination saved by a customer
+type Payee struct {
+	PayeeID         int       `json:"payee_id"`
+	CustomerID      int       `json:"customer_id"`
+	Name            string    `json:"name"`
+	AccountNumber   string    `json:"account_number"`
+	IBAN            *string   `json:"iban"`
+	Nickname        string    `json:"nickname"`
+	NameMatch       string    `json:"name_match"` // 'match', 'close_match', 'no_match'
+	CoolingOffUntil time.Time `json:"cooling_off_until"`
+	CreatedBy       *int      `json:"created_by"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// CreatePayeeRequest saves a payee by account number or IBAN
+type CreatePayeeRequest struct {
+	Name           string `json:"name"`
+	AccountNumber  string `json:"account_number"`
+	IBAN           string `json:"iban"`
+	Nickname       string `json:"nickname"`
+	AcceptMismatch bool   `json:"accept_mismatch"` // Save despite a close or failed name match
+}
+
+// UpdatePayeeRequest
+type UpdatePayeeRequest struct {
+	Nickname string `json:"nickname"`
+}
+
+// PayeeSettings configures the cooling-off window of new payees
+type PayeeSettings struct {
+	CoolingOffHours int     `json:"cooling_off_hours"`
+	NewPayeeLimit   float64 `json:"new_payee_limit"` // Total that may be sent to a payee during its cooling-off window
+}
+
+// ApprovalRequest is a high-value staff operation waiting for, or decided by, a second employee
+type ApprovalRequest struct {
+	ApprovalRequestID int64                  `json:"approval_request_id"`
+	Operation         string                 `json:"operation"` // 'transfer', 'overdraft', 'account_closure'
+	EntityType        string                 `json:"entity_type"`
+	EntityID          string                 `json:"entity_id"`
+	BranchID          int                    `json:"branch_id"`
+	Amount            float64                `json:"amount"`
+	Body              string                 `json:"body"`   // JSON request body executed on approval
+	Status            string                 `json:"status"` // 'pending', 'approved', 'rejected', 'executed', 'accepted', 'failed'
+	MakerUserID       int                    `json:"maker_user_id"`
+	CheckerUserID     *int                   `json:"checker_user_id"`
+	DecisionNote      string                 `json:"decision_note"`
+	ResultStatus      *int                   `json:"result_status"` // HTTP status of the execution
+	ResultBody        *string                `json:"result_body"`
+	CreatedAt         time.Time              `json:"created_at"`
+	DecidedAt         *time.Time             `json:"decided_at"`
+	ExecutedAt        *time.Time             `json:"executed_at"`
+	Events            []ApprovalRequestEvent `json:"events,omitempty"`
+}
+
+// ApprovalRequestEvent is one status change of an approval request
+type ApprovalRequestEvent struct {
+	EventID     int64     `json:"event_id"`
+	FromStatus  string    `json:"from_status"`
+	ToStatus    string    `json:"to_status"`
+	ActorUserID *int      `json:"actor_user_id"`
+	Note        string    `json:"note"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// DecideApprovalRequest
+type DecideApprovalRequest struct {
+	Note string `json:"note"` // Required when rejecting
+}
+
+// ApprovalThreshold configures when an operation needs a second employee
+type ApprovalThreshold struct {
+	Operation   string   `json:"operation"`
+	Threshold   *float64 `json:"threshold"`    // Amounts at or above it need approval; null disables approval
+	CheckerRole string   `json:"checker_role"` // 'employee', 'admin'
+}
+
+// DenominationCount is a number of notes or coins of one value
+type DenominationCount struct {
+	Denomination float64 `json:"denomination"`
+	Count        int     `json:"count"`
+}
+
+// TellerSession is a teller's shift at a branch cash drawer
+type TellerSession struct {
+	SessionID     int                  `json:"session_id"`
+	EmployeeID    int                  `json:"employee_id"`
+	BranchID      int                  `json:"branch_id"`
+	Status        string               `json:"status"` // 'open', 'closed'
+	OpeningTotal  float64              `json:"opening_total"`
+	ExpectedTotal *float64             `json:"expected_total"` // Set on close
+	CountedTotal  *float64             `json:"counted_total"`  // Set on close
+	Variance      *float64             `json:"variance"`       // Positive for an overage, negative for a shortage
+	OpenedAt      time.Time            `json:"opened_at"`
+	ClosedAt      *time.Time           `json:"closed_at"`
+	ClosedBy      *int                 `json:"closed_by"`
+	CloseNote     string               `json:"close_note"`
+	Drawer        []DenominationCount  `json:"drawer,omitempty"`
+	Movements     []TellerCashMovement `json:"movements,omitempty"`
+}
+
+// TellerCashMovement is a cash deposit or withdrawal booked against a teller session
+type TellerCashMovement struct {
+	MovementID    int64     `json:"movement_id"`
+	AccountNumber string    `json:"account_number"`
+	TransactionID int64     `json:"transaction_id"`
+	Kind          string    `json:"kind"` // 'deposit', 'withdrawal'
+	Amount        float64   `json:"amount"`
+	Cash          string    `json:"cash"` // JSON array of denomination counts
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// OpenTellerSessionRequest
+type OpenTellerSessionRequest struct {
+	Cash []DenominationCount `json:"cash"` // Counted opening drawer
+}
+
+// CloseTellerSessionRequest
+type CloseTellerSessionRequest struct {
+	Cash []DenominationCount `json:"cash"` // Counted closing drawer
+	Note string              `json:"note"`
+}
+
+// BranchCashPosting is a cash overage or shortage found when balancing a teller's drawer
+type BranchCashPosting struct {
+	PostingID int64     `json:"posting_id"`
+	BranchID  int       `json:"branch_id"`
+	SessionID int       `json:"session_id"`
+	Type      string    `json:"type"`   // 'overage', 'shortage'
+	Amount    float64   `json:"amount"` // Always positive
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EODRun is the end-of-day run that closes a business date
+type EODRun struct {
+	RunID        int          `json:"run_id"`
+	BusinessDate time.Time    `json:"business_date"`
+	Status       string       `json:"status"`     // 'running', 'completed', 'failed'
+	StartedBy    *int         `json:"started_by"` // NULL when started from the command line
+	StartedAt    time.Time    `json:"started_at"` // Of the latest attempt
+	FinishedAt   *time.Time   `json:"finished_at"`
+	Steps        []EODRunStep `json:"steps,omitempty"`
+}
+
+// EODRunStep is one step of an end-of-day run
+type EODRunStep struct {
+	Step       string     `json:"step"`
+	Position   int        `json:"position"`
+	Status     string     `json:"status"` // 'pending', 'running', 'completed', 'failed'
+	Attempts   int        `json:"attempts"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Error      *string    `json:"error"` // Of the latest failed attempt
+}
+
+// ScheduledTransfer is a transfer accepted after its cut-off, waiting for its value date
+type ScheduledTransfer struct {
+	ScheduledTransferID int        `json:"scheduled_transfer_id"`
+	FromAccountNumber   string     `json:"from_account_number"`
+	ToAccountNumber     string     `json:"to_account_number"`
+	Amount              float64    `json:"amount"`
+	PaymentType         string     `json:"payment_type"` // 'transfer', 'payee'
+	ValueDate           time.Time  `json:"value_date"`
+	Status              string     `json:"status"` // 'scheduled', 'executed', 'failed', 'cancelled'
+	FailureReason       *string    `json:"failure_reason"`
+	RequestedBy         *int       `json:"requested_by"`
+	CreatedAt           time.Time  `json:"created_at"`
+	FinishedAt          *time.Time `json:"finished_at"`
+}
+
+// CutOffTime is the time of day after which a payment type is value-dated the next business day
+type CutOffTime struct {
+	PaymentType string    `json:"payment_type"`
+	CutOff      string    `json:"cut_off"` // HH:MM:SS, server local time
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// UpdateCutOffTimeRequest
+type UpdateCutOffTimeRequest struct {
+	CutOff string `json:"cut_off"` // HH:MM or HH:MM:SS
+}
+
+// Holiday is a bank holiday of a country's calendar
+type Holiday struct {
+	Country string    `json:"country"`
+	Date    time.Time `json:"date"`
+	Name    string    `json:"name"`
+}
+
+// FeeSchedule is how much a fee costs on an account type
+type FeeSchedule struct {
+	AccountType  string    `json:"account_type"` // 'savings', 'current'
+	FeeType      string    `json:"fee_type"`     // 'monthly_maintenance', 'withdrawal', 'inter_branch_transfer', 'fx'
+	Amount       float64   `json:"amount"`       // Flat amount per charge
+	Rate         float64   `json:"rate"`         // Percent of the movement's amount
+	FreePerMonth int       `json:"free_per_month"`
+	Active       bool      `json:"active"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// UpdateFeeScheduleRequest
+type UpdateFeeScheduleRequest struct {
+	Amount       float64 `json:"amount"`
+	Rate         float64 `json:"rate"`
+	FreePerMonth int     `json:"free_per_month"`
+	Active       bool    `json:"active"`
+}
+
+// FeeSettings names the account fee income is credited to
+type FeeSettings struct {
+	IncomeAccountNumber *string `json:"income_account_number"`
+}
+
+// FeeWaiver exempts an account from one fee, or from every fee
+type FeeWaiver struct {
+	WaiverID      int        `json:"waiver_id"`
+	AccountNumber string     `json:"account_number"`
+	FeeType       *string    `json:"fee_type"`    // NULL for every fee
+	Reason        string     `json:"reason"`
+	ValidUntil    *time.Time `json:"valid_until"` // Last day covered; NULL for no end
+	CreatedBy     int        `json:"created_by"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RevokedBy     *int       `json:"revoked_by"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+}
+
+// CreateFeeWaiverRequest
+type CreateFeeWaiverRequest struct {
+	FeeType    *string `json:"fee_type"`
+	Reason     string  `json:"reason"`
+	ValidUntil *string `json:"valid_until"` // YYYY-MM-DD
+}
+
+// FeeCharge is a fee posted to an account
+type FeeCharge struct {
+	ChargeID      int64      `json:"charge_id"`
+	FeeType       string     `json:"fee_type"`
+	Amount        float64    `json:"amount"`
+	TransactionID int64      `json:"transaction_id"`
+	Reference     *string    `json:"reference"`
+	Status        string     `json:"status"` // 'charged', 'refunded'
+	CreatedAt     time.Time  `json:"created_at"`
+	RefundedAt    *time.Time `json:"refunded_at"`
+}
+
+// TermDepositRate is the rate offered on term deposits of a given term
+type TermDepositRate struct {
+	TermMonths  int       `json:"term_months"`
+	Rate        float64   `json:"rate"`         // Annual interest rate, e.g. 4.25
+	PenaltyRate float64   `json:"penalty_rate"` // Early withdrawal penalty, percent of principal
+	MinAmount   float64   `json:"min_amount"`
+	Active      bool      `json:"active"` // Offered for new deposits
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// UpdateTermDepositRateRequest
+type UpdateTermDepositRateRequest struct {
+	Rate        float64 `json:"rate"`
+	PenaltyRate float64 `json:"penalty_rate"`
+	MinAmount   float64 `json:"min_amount"`
+	Active      bool    `json:"active"`
+}
+
+// TermDeposit is the current term of a term deposit account
+type TermDeposit struct {
+	AccountNumber        string     `json:"account_number"`
+	FundingAccountNumber string     `json:"funding_account_number"`
+	PayoutAccountNumber  string     `json:"payout_account_number"`
+	Principal            float64    `json:"principal"`
+	Rate                 float64    `json:"rate"`
+	PenaltyRate          float64    `json:"penalty_rate"`
+	TermMonths           int        `json:"term_months"`
+	StartDate            time.Time  `json:"start_date"`
+	MaturityDate         time.Time  `json:"maturity_date"`
+	MaturityInstruction  string     `json:"maturity_instruction"` // 'rollover', 'rollover_principal', 'payout'
+	Status               string     `json:"status"`               // 'open', 'matured', 'withdrawn'
+	Rollovers            int        `json:"rollovers"`
+	CreatedBy            int        `json:"created_by"`
+	CreatedAt            time.Time  `json:"created_at"`
+	ClosedAt             *time.Time `json:"closed_at"`
+}
+
+// OpenTermDepositRequest
+type OpenTermDepositRequest struct {
+	FundingAccountNumber string  `json:"funding_account_number"`
+	Amount               float64 `json:"amount"`
+	TermMonths           int     `json:"term_months"`
+	MaturityInstruction  string  `json:"maturity_instruction"`
+	PayoutAccountNumber  *string `json:"payout_account_number"` // Defaults to the funding account
+}
+
+// UpdateMaturityInstructionRequest
+type UpdateMaturityInstructionRequest struct {
+	MaturityInstruction string  `json:"maturity_instruction"`
+	PayoutAccountNumber *string `json:"payout_account_number"` // Keeps the current one when omitted
+}
+
+// ReverseTransactionRequest
+type ReverseTransactionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// StatementLine is a transaction on an account statement
+type StatementLine struct {
+	Transaction
+	Direction string  `json:"direction"` // 'credit', 'debit'
+	Balance   float64 `json:"balance"`   // Running balance after the transaction
+}
+
+// AccountStatement lists the transactions booked on an account between two business dates
+type AccountStatement struct {
+	AccountNumber  string          `json:"account_number"`
+	From           string          `json:"from"` // YYYY-MM-DD
+	To             string          `json:"to"`
+	OpeningBalance float64         `json:"opening_balance"`
+	ClosingBalance float64         `json:"closing_balance"`
+	TotalCredits   float64         `json:"total_credits"`
+	TotalDebits    float64         `json:"total_debits"`
+	Reversals      int             `json:"reversals"` // Contra entries booked in the period
+	Transactions   []StatementLine `json:"transactions"`
+}
+
+// Dispute is a customer's dispute of a debit on their account or a charge on their credit card
+type Dispute struct {
+	DisputeID           int64             `json:"dispute_id"`
+	TransactionID       *int64            `json:"transaction_id"`      // The disputed debit of a deposit account
+	CardTransactionID   *int64            `json:"card_transaction_id"` // Or the disputed charge on a credit line
+	CreditAccountID     *int              `json:"credit_account_id"`
+	AccountID           int               `json:"account_id"` // The card's account for a card dispute
+	AccountNumber       string            `json:"account_number"`
+	ReasonCode          string            `json:"reason_code"` // 'unauthorized', 'duplicate', 'incorrect_amount', 'not_received', 'not_as_described', 'cancelled_recurring'
+	Amount              float64           `json:"amount"`
+	Description         string            `json:"description"`
+	Status              string            `json:"status"` // 'open', 'investigating', 'awaiting_customer', 'chargeback', 'upheld', 'rejected', 'withdrawn'
+	AssignedTo          *int              `json:"assigned_to"`
+	CreditTransactionID *int64            `json:"credit_transaction_id"` // Provisional until the dispute is upheld; a credit_transactions ID for a card dispute
+	CreditReversalID    *int64            `json:"credit_reversal_id"`    // Set when the dispute was not upheld
+	ChargebackReference *string           `json:"chargeback_reference"`
+	ResolutionNote      string            `json:"resolution_note"`
+	FiledBy             int               `json:"filed_by"`
+	CreatedAt           time.Time         `json:"created_at"`
+	UpdatedAt           time.Time         `json:"updated_at"`
+	ResolvedAt          *time.Time        `json:"resolved_at"`
+	Events              []DisputeEvent    `json:"events,omitempty"`
+	Evidence            []DisputeEvidence `json:"evidence,omitempty"`
+}
+
+// DisputeEvent is one step in the history of a dispute
+type DisputeEvent struct {
+	EventID     int64     `json:"event_id"`
+	FromStatus  string    `json:"from_status"`
+	ToStatus    string    `json:"to_status"`
+	ActorUserID int       `json:"actor_user_id"`
+	Note        string    `json:"note"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// DisputeEvidence is a file attached to a dispute by the customer or staff
+type DisputeEvidence struct {
+	EvidenceID  int64     `json:"evidence_id"`
+	DisputeID   int64     `json:"dispute_id"`
+	Description string    `json:"description"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	SHA256      string    `json:"sha256"`
+	UploadedBy  int       `json:"uploaded_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateDisputeRequest
+type CreateDisputeRequest struct {
+	TransactionID     int64    `json:"transaction_id"`
+	CardTransactionID int64    `json:"card_transaction_id"` // Instead of TransactionID, a charge on a credit card
+	ReasonCode        string   `json:"reason_code"`
+	Amount            *float64 `json:"amount"` // Defaults to the amount of the transaction
+	Description       string   `json:"description"`
+}
+
+// AssignDisputeRequest
+type AssignDisputeRequest struct {
+	EmployeeID int `json:"employee_id"`
+}
+
+// TransitionDisputeRequest
+type TransitionDisputeRequest struct {
+	Status              string `json:"status"`
+	Note                string `json:"note"`
+	ChargebackReference string `json:"chargeback_reference"` // Required when raising a chargeback
+}
+
+// DisputeCreditRequest
+type DisputeCreditRequest struct {
+	Note string `json:"note"`
+}
+
+// DirectDebitCreditor is an organisation allowed to collect direct debits into its account
+type DirectDebitCreditor struct {
+	CreditorID         int       `json:"creditor_id"`
+	Name               string    `json:"name"`
+	CreditorIdentifier string    `json:"creditor_identifier"`
+	AccountNumber      string    `json:"account_number"`
+	Status             string    `json:"status"` // 'active', 'suspended'
+	CreatedBy          int       `json:"created_by"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// DirectDebitMandate is a customer's authorisation for a creditor to collect from an account
+type DirectDebitMandate struct {
+	MandateID             int64      `json:"mandate_id"`
+	CreditorID            int        `json:"creditor_id"`
+	CreditorName          string     `json:"creditor_name"`
+	CreditorIdentifier    string     `json:"creditor_identifier"`
+	CreditorAccountNumber string     `json:"creditor_account_number"`
+	DebtorAccountNumber   string     `json:"debtor_account_number"`
+	Reference             string     `json:"reference"`
+	MaxAmount             float64    `json:"max_amount"`
+	Frequency             string     `json:"frequency"` // 'once', 'weekly', 'monthly', 'quarterly', 'yearly'
+	Status                string     `json:"status"`    // 'active', 'revoked'
+	CreatedBy             int        `json:"created_by"`
+	CreatedAt             time.Time  `json:"created_at"`
+	RevokedBy             *int       `json:"revoked_by"`
+	RevokedAt             *time.Time `json:"revoked_at"`
+	RevocationReason      *string    `json:"revocation_reason"`
+}
+
+// DirectDebitCollection is a payment a creditor requested under a mandate
+type DirectDebitCollection struct {
+	CollectionID        int64      `json:"collection_id"`
+	MandateID           int64      `json:"mandate_id"`
+	Amount              float64    `json:"amount"`
+	DueDate             time.Time  `json:"due_date"`
+	Description         string     `json:"description"`
+	Status              string     `json:"status"` // 'pending', 'collected', 'failed', 'cancelled', 'refunded'
+	FailureReason       *string    `json:"failure_reason"`
+	TransactionID       *int64     `json:"transaction_id"`        // The debit on the customer's account
+	RefundTransactionID *int64     `json:"refund_transaction_id"` // Its reversal, once refunded
+	RequestedBy         int        `json:"requested_by"`
+	CreatedAt           time.Time  `json:"created_at"`
+	FinishedAt          *time.Time `json:"finished_at"`
+	RefundedAt          *time.Time `json:"refunded_at"`
+}
+
+// CreateDirectDebitCreditorRequest
+type CreateDirectDebitCreditorRequest struct {
+	Name               string `json:"name"`
+	CreditorIdentifier string `json:"creditor_identifier"`
+	AccountNumber      string `json:"account_number"`
+}
+
+// UpdateDirectDebitCreditorStatusRequest
+type UpdateDirectDebitCreditorStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// CreateMandateRequest
+type CreateMandateRequest struct {
+	CreditorIdentifier  string  `json:"creditor_identifier"`
+	DebtorAccountNumber string  `json:"debtor_account_number"`
+	Reference           string  `json:"reference"`
+	MaxAmount           float64 `json:"max_amount"`
+	Frequency           string  `json:"frequency"`
+}
+
+// RevokeMandateRequest
+type RevokeMandateRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CreateCollectionRequest
+type CreateCollectionRequest struct {
+	Amount      float64 `json:"amount"`
+	DueDate     string  `json:"due_date"` // YYYY-MM-DD
+	Description string  `json:"description"`
+}
+
+// CancelCollectionRequest
+type CancelCollectionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// RefundCollectionRequest
+type RefundCollectionRequest struct {
+	Reason string `json:"reason"` // Optional; refunds within the window need no reason
+}
@@ -0,0 +1,275 @@
+package outbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"banking-app/db"
+)
+
+// Dispatcher fans new outbox events out to matching webhook subscriptions and
+// delivers them, retrying failures with exponential backoff until MaxAttempts,
+// after which the delivery is dead-lettered
+type Dispatcher struct {
+	Client       *http.Client
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int
+	BaseDelay    time.Duration // Delay before the first retry; doubles on each further attempt
+	MaxDelay     time.Duration
+}
+
+// NewDispatcher returns a dispatcher with production defaults
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		PollInterval: 2 * time.Second,
+		BatchSize:    50,
+		MaxAttempts:  8,
+		BaseDelay:    30 * time.Second,
+		MaxDelay:     6 * time.Hour,
+	}
+}
+
+// Run dispatches until stop is closed
+func (d *Dispatcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.DispatchOnce(); err != nil {
+			log.Printf("Webhook dispatcher: %v", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce fans out new events and attempts every delivery that is due
+func (d *Dispatcher) DispatchOnce() error {
+	if err := d.fanOut(); err != nil {
+		return err
+	}
+	return d.deliverDue()
+}
+
+// fanOut creates one pending delivery per matching active subscription for each new event
+func (d *Dispatcher) fanOut() error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("starting fan-out transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	// SKIP LOCKED lets several dispatchers run side by side without blocking each other
+	rows, err := tx.Query("SELECT event_id, event_type FROM outbox_events WHERE dispatched_at IS NULL ORDER BY event_id LIMIT ? FOR UPDATE SKIP LOCKED", d.BatchSize)
+	if err != nil {
+		return fmt.Errorf("loading new events: %w", err)
+	}
+	type event struct {
+		id        int64
+		eventType string
+	}
+	var events []event
+	for rows.Next() {
+		var e event
+		if err := rows.Scan(&e.id, &e.eventType); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning event: %w", err)
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("loading new events: %w", err)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	subs, err := tx.Query("SELECT subscription_id, event_types FROM webhook_subscriptions WHERE active = TRUE")
+	if err != nil {
+		return fmt.Errorf("loading subscriptions: %w", err)
+	}
+	subscriptions := map[int]string{}
+	for subs.Next() {
+		var id int
+		var types string
+		if err := subs.Scan(&id, &types); err != nil {
+			subs.Close()
+			return fmt.Errorf("scanning subscription: %w", err)
+		}
+		subscriptions[id] = types
+	}
+	subs.Close()
+	if err := subs.Err(); err != nil {
+		return fmt.Errorf("loading subscriptions: %w", err)
+	}
+
+	for _, e := range events {
+		for id, types := range subscriptions {
+			if !Matches(types, e.eventType) {
+				continue
+			}
+			if _, err := tx.Exec("INSERT IGNORE INTO webhook_deliveries (event_id, subscription_id) VALUES (?, ?)", e.id, id); err != nil {
+				return fmt.Errorf("creating delivery of event %d: %w", e.id, err)
+			}
+		}
+		if _, err := tx.Exec("UPDATE outbox_events SET dispatched_at = NOW() WHERE event_id = ?", e.id); err != nil {
+			return fmt.Errorf("marking event %d dispatched: %w", e.id, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Matches reports whether a comma-separated subscription filter covers an event type
+func Matches(filter, eventType string) bool {
+	for _, t := range strings.Split(filter, ",") {
+		if t = strings.TrimSpace(t); t == "*" || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type delivery struct {
+	id        int64
+	attempts  int
+	eventID   int64
+	eventType string
+	payload   string
+	createdAt time.Time
+	url       string
+	secret    string
+}
+
+// deliverDue claims due deliveries and sends them
+func (d *Dispatcher) deliverDue() error {
+	claimed, err := d.claim()
+	if err != nil {
+		return err
+	}
+	for _, dl := range claimed {
+		sendErr := d.send(dl)
+		if err := d.complete(dl, sendErr); err != nil {
+			log.Printf("Webhook dispatcher: recording result of delivery %d: %v", dl.id, err)
+		}
+	}
+	return nil
+}
+
+// claim selects due deliveries and pushes their next attempt into the future,
+// so another dispatcher does not send them while this one is working
+func (d *Dispatcher) claim() ([]delivery, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("starting claim transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	rows, err := tx.Query(`SELECT d.delivery_id, d.attempts, e.event_id, e.event_type, e.payload, e.created_at, s.url, s.secret
+		FROM webhook_deliveries d
+		JOIN outbox_events e ON e.event_id = d.event_id
+		JOIN webhook_subscriptions s ON s.subscription_id = d.subscription_id
+		WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND s.active = TRUE
+		ORDER BY d.next_attempt_at, d.delivery_id LIMIT ? FOR UPDATE OF d SKIP LOCKED`, d.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("loading due deliveries: %w", err)
+	}
+	var claimed []delivery
+	for rows.Next() {
+		var dl delivery
+		if err := rows.Scan(&dl.id, &dl.attempts, &dl.eventID, &dl.eventType, &dl.payload, &dl.createdAt, &dl.url, &dl.secret); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning delivery: %w", err)
+		}
+		claimed = append(claimed, dl)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("loading due deliveries: %w", err)
+	}
+
+	lease := d.Client.Timeout + time.Minute
+	for _, dl := range claimed {
+		if _, err := tx.Exec("UPDATE webhook_deliveries SET next_attempt_at = ? WHERE delivery_id = ?", time.Now().Add(lease), dl.id); err != nil {
+			return nil, fmt.Errorf("claiming delivery %d: %w", dl.id, err)
+		}
+	}
+	return claimed, tx.Commit()
+}
+
+// send posts one delivery; any non-2xx response counts as a failure
+func (d *Dispatcher) send(dl delivery) error {
+	body, err := json.Marshal(envelope{ID: dl.eventID, Type: dl.eventType, CreatedAt: dl.createdAt, Data: json.RawMessage(dl.payload)})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, dl.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, dl.eventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(dl.id, 10))
+	req.Header.Set(SignatureHeader, Sign(dl.secret, time.Now(), body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return nil
+}
+
+// complete records the outcome of an attempt: delivered, retry later, or dead-lettered
+func (d *Dispatcher) complete(dl delivery, sendErr error) error {
+	attempts := dl.attempts + 1
+	if sendErr == nil {
+		_, err := db.DB.Exec("UPDATE webhook_deliveries SET status = 'delivered', attempts = ?, last_error = '', delivered_at = NOW() WHERE delivery_id = ?",
+			attempts, dl.id)
+		return err
+	}
+
+	message := sendErr.Error()
+	if len(message) > 1024 {
+		message = message[:1024]
+	}
+	if attempts >= d.MaxAttempts {
+		log.Printf("Webhook dispatcher: dead-lettering delivery %d after %d attempts: %s", dl.id, attempts, message)
+		_, err := db.DB.Exec("UPDATE webhook_deliveries SET status = 'dead', attempts = ?, last_error = ? WHERE delivery_id = ?",
+			attempts, message, dl.id)
+		return err
+	}
+	_, err := db.DB.Exec("UPDATE webhook_deliveries SET attempts = ?, last_error = ?, next_attempt_at = ? WHERE delivery_id = ?",
+		attempts, message, time.Now().Add(d.backoff(attempts)), dl.id)
+	return err
+}
+
+// backoff is BaseDelay doubled for each failed attempt, capped at MaxDelay,
+// with up to 20% jitter so failing endpoints are not hit in lockstep
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
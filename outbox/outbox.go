@@ -0,0 +1,74 @@
+package outbox
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Account event types
+const (
+	EventDeposited     = "account.deposited"
+	EventWithdrawn     = "account.withdrawn"
+	EventTransferred   = "account.transferred"
+	EventStatusChanged = "account.status_changed"
+	EventReversed      = "account.transaction_reversed"
+	EventDisputed      = "account.dispute_updated"
+
+	EventDirectDebitNotified  = "account.direct_debit_notified" // Pre-notification of a collection
+	EventDirectDebitCollected = "account.direct_debit_collected"
+	EventDirectDebitFailed    = "account.direct_debit_failed"
+	EventDirectDebitRefunded  = "account.direct_debit_refunded"
+)
+
+// IsEventType reports whether t is a known event type
+func IsEventType(t string) bool {
+	return t == EventDeposited || t == EventWithdrawn || t == EventTransferred || t == EventStatusChanged || t == EventReversed || t == EventDisputed ||
+		t == EventDirectDebitNotified || t == EventDirectDebitCollected || t == EventDirectDebitFailed || t == EventDirectDebitRefunded
+}
+
+// Headers sent with every webhook delivery
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// Enqueue writes an event to the outbox inside the caller's SQL transaction,
+// so the event exists if and only if the change it describes is committed
+func Enqueue(tx *sql.Tx, eventType, aggregateID string, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encoding %s event: %w", eventType, err)
+	}
+	_, err = tx.Exec("INSERT INTO outbox_events (event_type, aggregate_id, payload) VALUES (?, ?, ?)", eventType, aggregateID, string(b))
+	if err != nil {
+		return fmt.Errorf("writing %s event to outbox: %w", eventType, err)
+	}
+	return nil
+}
+
+// Sign computes the signature header value for a delivery body:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>" keyed with the secret>".
+// Receivers should recompute it and reject stale timestamps to prevent replays.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// envelope is the JSON body delivered to webhooks
+type envelope struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
@@ -0,0 +1,70 @@
+package outbox
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ReplayDelivery puts a delivery back in the queue with a fresh retry budget,
+// whether it was dead-lettered or already delivered.
+// It runs inside tx and returns sql.ErrNoRows if the delivery does not exist.
+func ReplayDelivery(tx *sql.Tx, deliveryID int64) error {
+	result, err := tx.Exec("UPDATE webhook_deliveries SET status = 'pending', attempts = 0, last_error = '', next_attempt_at = NOW() WHERE delivery_id = ?", deliveryID)
+	if err != nil {
+		return fmt.Errorf("replaying delivery %d: %w", deliveryID, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM webhook_deliveries WHERE delivery_id = ?)", deliveryID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return sql.ErrNoRows
+		}
+	}
+	return nil
+}
+
+// ReplayEvent redelivers an event to every active subscription it matches,
+// including subscriptions registered after the event was first dispatched.
+// It runs inside tx and returns the number of deliveries queued, or sql.ErrNoRows if
+// the event does not exist.
+func ReplayEvent(tx *sql.Tx, eventID int64) (int, error) {
+	var eventType string
+	if err := tx.QueryRow("SELECT event_type FROM outbox_events WHERE event_id = ? FOR UPDATE", eventID).Scan(&eventType); err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query("SELECT subscription_id, event_types FROM webhook_subscriptions WHERE active = TRUE")
+	if err != nil {
+		return 0, fmt.Errorf("loading subscriptions: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		var types string
+		if err := rows.Scan(&id, &types); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scanning subscription: %w", err)
+		}
+		if Matches(types, eventType) {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("loading subscriptions: %w", err)
+	}
+
+	for _, id := range ids {
+		_, err := tx.Exec(`INSERT INTO webhook_deliveries (event_id, subscription_id) VALUES (?, ?)
+			ON DUPLICATE KEY UPDATE status = 'pending', attempts = 0, last_error = '', next_attempt_at = NOW()`, eventID, id)
+		if err != nil {
+			return 0, fmt.Errorf("queueing replay of event %d: %w", eventID, err)
+		}
+	}
+	if _, err := tx.Exec("UPDATE outbox_events SET dispatched_at = COALESCE(dispatched_at, NOW()) WHERE event_id = ?", eventID); err != nil {
+		return 0, fmt.Errorf("marking event %d dispatched: %w", eventID, err)
+	}
+	return len(ids), nil
+}
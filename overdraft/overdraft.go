@@ -0,0 +1,157 @@
+// Package overdraft runs the daily overdraft cycle of current accounts: interest
+// accrual on overdrawn balances for each day since the last run, interest charging on
+// the first run of each month and the fee for going beyond the arranged limit.
+package overdraft
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"banking-app/audit"
+	"banking-app/db"
+	"banking-app/fees"
+	"banking-app/ledger"
+)
+
+// UnarrangedFee is charged at most once per calendar month when an account ends
+// the day overdrawn beyond its arranged limit. It and overdraft interest are credited
+// to the fee income account.
+var UnarrangedFee = 15.00
+
+// process is recorded as the request ID of audit entries written by the cycle
+const process = "overdraft-batch"
+
+type account struct {
+	id       int
+	balance  float64
+	limit    float64
+	rate     float64
+	accrued  float64
+	lastRun  *time.Time
+	feeMonth *time.Time
+}
+
+// RunDaily runs the overdraft cycle for the given business date on every current account
+// that is overdrawn or still has uncharged interest. Each account is processed in its own
+// SQL transaction and the run is idempotent per account and date, so a failed run can
+// simply be repeated.
+func RunDaily(asOf time.Time) error {
+	asOf = ledger.DateOnly(asOf)
+
+	rows, err := db.DB.Query(`SELECT account_id FROM accounts
+		WHERE account_type = 'current' AND (balance < 0 OR overdraft_interest_accrued > 0) ORDER BY account_id`)
+	if err != nil {
+		return fmt.Errorf("listing overdrawn accounts: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning account ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("listing overdrawn accounts: %w", err)
+	}
+
+	failed := 0
+	for _, id := range ids {
+		if err := runAccount(id, asOf); err != nil {
+			log.Printf("Error running overdraft cycle for account %d: %v", id, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("overdraft cycle failed for %d of %d accounts", failed, len(ids))
+	}
+	return nil
+}
+
+func runAccount(accountID int, asOf time.Time) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var a account
+	err = tx.QueryRow(`SELECT account_id, balance, overdraft_limit, overdraft_rate, overdraft_interest_accrued, overdraft_last_run, overdraft_fee_month
+		FROM accounts WHERE account_id = ? FOR UPDATE`, accountID).Scan(&a.id, &a.balance, &a.limit, &a.rate, &a.accrued, &a.lastRun, &a.feeMonth)
+	if err != nil {
+		return err
+	}
+	if a.lastRun != nil && !ledger.DateOnly(*a.lastRun).Before(asOf) {
+		return nil // Already run for this date
+	}
+	before := a.balance
+	month := time.Date(asOf.Year(), asOf.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	// Interest accrued over earlier months is charged on the first run in a new month
+	if a.lastRun != nil && ledger.DateOnly(*a.lastRun).Before(month) {
+		if interest := ledger.Round(a.accrued); interest > 0 {
+			if err := charge(tx, &a, ledger.TypeInterest, interest, "Overdraft interest"); err != nil {
+				return err
+			}
+		}
+		a.accrued = 0
+	}
+
+	// Interest accrues for every day since the last run, so days the batch did not run are not lost
+	days := 1
+	if a.lastRun != nil {
+		days = int(asOf.Sub(ledger.DateOnly(*a.lastRun)).Hours() / 24)
+	}
+	if a.balance < 0 {
+		a.accrued += -a.balance * a.rate / 100 / 365 * float64(days)
+	}
+
+	if a.balance < -a.limit && UnarrangedFee > 0 && (a.feeMonth == nil || ledger.DateOnly(*a.feeMonth).Before(month)) {
+		if err := charge(tx, &a, ledger.TypeFee, UnarrangedFee, "Unarranged overdraft fee"); err != nil {
+			return err
+		}
+		a.feeMonth = &month
+	}
+
+	// An account back in credit with nothing left to charge drops out of the cycle; the
+	// days until it is next overdrawn must not accrue interest then
+	lastRun := &asOf
+	if a.balance >= 0 && a.accrued == 0 {
+		lastRun = nil
+	}
+	_, err = tx.Exec("UPDATE accounts SET overdraft_interest_accrued = ?, overdraft_last_run = ?, overdraft_fee_month = ? WHERE account_id = ?",
+		a.accrued, lastRun, a.feeMonth, a.id)
+	if err != nil {
+		return fmt.Errorf("updating overdraft state: %w", err)
+	}
+
+	if a.balance != before {
+		err = audit.RecordSystemTx(tx, process, audit.Entry{Action: "account.overdraft_charges", EntityType: "account", EntityID: strconv.Itoa(a.id),
+			Before: map[string]float64{"balance": before}, After: map[string]float64{"balance": a.balance}})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// charge debits the account and credits the fee income account, posting a row on each side
+func charge(tx *sql.Tx, a *account, txnType string, amount float64, description string) error {
+	incomeID, err := fees.IncomeAccountID(tx)
+	if err != nil {
+		return err
+	}
+	if incomeID == nil {
+		return fees.ErrNoIncomeAccount
+	}
+	if _, err := ledger.Charge(tx, a.id, *incomeID, txnType, amount, description); err != nil {
+		return err
+	}
+	a.balance = ledger.Round(a.balance - amount)
+	return nil
+}
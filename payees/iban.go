@@ -0,0 +1,68 @@
+package payees
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// The IBANs of this bank's accounts are the country code, check digits, BankCode and the
+// 10-digit account number. main may override both from the environment.
+var (
+	Country  = "GB"
+	BankCode = "BNKA"
+)
+
+// NormalizeIBAN removes spaces and uppercases an IBAN as entered
+func NormalizeIBAN(s string) string {
+	return strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+}
+
+// ValidIBAN checks the shape and mod-97 check digits of a normalized IBAN
+func ValidIBAN(iban string) bool {
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	for i, c := range iban {
+		switch {
+		case i < 2 && (c < 'A' || c > 'Z'):
+			return false
+		case i >= 2 && i < 4 && (c < '0' || c > '9'):
+			return false
+		case (c < 'A' || c > 'Z') && (c < '0' || c > '9'):
+			return false
+		}
+	}
+	return mod97(iban[4:]+iban[:4]) == 1
+}
+
+// mod97 computes the ISO 13616 remainder of s with letters expanded to 10-35
+func mod97(s string) int64 {
+	var digits strings.Builder
+	for _, c := range s {
+		if c >= 'A' && c <= 'Z' {
+			fmt.Fprintf(&digits, "%d", c-'A'+10)
+		} else {
+			digits.WriteRune(c)
+		}
+	}
+	n, _ := new(big.Int).SetString(digits.String(), 10)
+	return new(big.Int).Mod(n, big.NewInt(97)).Int64()
+}
+
+// IBAN returns the IBAN of one of this bank's accounts
+func IBAN(accountNumber string) string {
+	bban := BankCode + accountNumber
+	check := 98 - mod97(bban+Country+"00")
+	return fmt.Sprintf("%s%02d%s", Country, check, bban)
+}
+
+// AccountNumber returns the account number a valid normalized IBAN addresses, or false
+// if it belongs to another bank
+func AccountNumber(iban string) (string, bool) {
+	prefix := Country + iban[2:4] + BankCode
+	if !strings.HasPrefix(iban, prefix) || len(iban) != len(prefix)+10 {
+		return "", false
+	}
+	return iban[len(prefix):], true
+}
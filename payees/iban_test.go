@@ -0,0 +1,53 @@
+package payees
+
+import "testing"
+
+func TestValidIBAN(t *testing.T) {
+	tests := []struct {
+		name string
+		iban string
+		want bool
+	}{
+		{name: "UK", iban: "GB82WEST12345698765432", want: true},
+		{name: "Germany", iban: "DE89370400440532013000", want: true},
+		{name: "Netherlands", iban: "NL91ABNA0417164300", want: true},
+		{name: "Norway, shortest in use", iban: "NO9386011117947", want: true},
+		{name: "entered with spaces", iban: NormalizeIBAN("gb82 west 1234 5698 7654 32"), want: true},
+		{name: "wrong check digits", iban: "GB83WEST12345698765432"},
+		{name: "transposed digits", iban: "GB82WEST12345698765423"},
+		{name: "lowercase", iban: "gb82west12345698765432"},
+		{name: "letters as check digits", iban: "GBXXWEST12345698765432"},
+		{name: "digits as country", iban: "1282WEST12345698765432"},
+		{name: "punctuation", iban: "GB82-WEST-1234-5698-7654"},
+		{name: "too short", iban: "GB82WEST1234"},
+		{name: "too long", iban: "GB82WEST12345698765432123456789012345"},
+		{name: "empty", iban: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidIBAN(tt.iban); got != tt.want {
+				t.Errorf("ValidIBAN(%q) = %v, want %v", tt.iban, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIBANRoundTrip(t *testing.T) {
+	for _, number := range []string{"0000000001", "1234567890", "9999999999"} {
+		iban := IBAN(number)
+		if !ValidIBAN(iban) {
+			t.Errorf("IBAN(%q) = %q, which is not valid", number, iban)
+		}
+		if got, ok := AccountNumber(iban); !ok || got != number {
+			t.Errorf("AccountNumber(%q) = %q, %v, want %q, true", iban, got, ok, number)
+		}
+	}
+}
+
+func TestAccountNumberOtherBank(t *testing.T) {
+	for _, iban := range []string{"GB82WEST12345698765432", "DE89370400440532013000"} {
+		if got, ok := AccountNumber(iban); ok {
+			t.Errorf("AccountNumber(%q) = %q, true, want another bank's IBAN refused", iban, got)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Package payees manages the payees customers save for transfers: confirming the name
+// they enter against the destination account's holders, and capping what may be sent
+// to a payee while it is new.
+package payees
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"banking-app/db"
+	"banking-app/holders"
+	"banking-app/ledger"
+	"banking-app/limits"
+	"banking-app/models"
+	"banking-app/sanctions"
+)
+
+// Confirmation-of-payee results stored in payees.name_match
+const (
+	MatchExact = "match"       // The name matches a holder of the destination account
+	MatchClose = "close_match" // The name is similar to a holder's but not the same
+	MatchNone  = "no_match"
+)
+
+// closeMatchScore is the lowest name similarity reported as a close match
+const closeMatchScore = 0.85
+
+// CodeNewPayeeLimit identifies a transfer over the cooling-off cap of a new payee
+const CodeNewPayeeLimit = "new_payee_limit_exceeded"
+
+// Columns lists the payee columns read by Scan
+const Columns = `payee_id, customer_id, name, account_number, iban, nickname, name_match, cooling_off_until, created_by, created_at`
+
+// Scan reads a payee row selected with Columns
+func Scan(row interface{ Scan(...interface{}) error }, p *models.Payee) error {
+	return row.Scan(&p.PayeeID, &p.CustomerID, &p.Name, &p.AccountNumber, &p.IBAN, &p.Nickname, &p.NameMatch, &p.CoolingOffUntil, &p.CreatedBy, &p.CreatedAt)
+}
+
+// Get loads a payee, returning sql.ErrNoRows if it does not exist
+func Get(q db.Querier, payeeID int) (models.Payee, error) {
+	var p models.Payee
+	err := Scan(q.QueryRow("SELECT "+Columns+" FROM payees WHERE payee_id = ?", payeeID), &p)
+	return p, err
+}
+
+// GetSettings returns the cooling-off window and new-payee limit
+func GetSettings(q db.Querier) (models.PayeeSettings, error) {
+	var s models.PayeeSettings
+	err := q.QueryRow("SELECT cooling_off_hours, new_payee_limit FROM payee_settings WHERE settings_id = 1").Scan(&s.CoolingOffHours, &s.NewPayeeLimit)
+	if err != nil {
+		return s, fmt.Errorf("loading payee settings: %w", err)
+	}
+	return s, nil
+}
+
+// ConfirmName compares the name a customer entered with every holder of the destination
+// account. It returns the result and, for a close match, the holder's name so the customer
+// can see who they are about to pay.
+func ConfirmName(q db.Querier, account models.Account, name string) (result, closest string, err error) {
+	list, err := holders.List(q, account)
+	if err != nil {
+		return "", "", err
+	}
+	entered := sanctions.Normalize(name)
+	best := 0.0
+	for _, h := range list {
+		score := sanctions.Similarity(entered, sanctions.Normalize(h.Name))
+		if score > best {
+			best, closest = score, h.Name
+		}
+	}
+	switch {
+	case best == 1:
+		return MatchExact, "", nil
+	case best >= closeMatchScore:
+		return MatchClose, closest, nil
+	}
+	return MatchNone, "", nil
+}
+
+// SentDuringCoolingOff sums what the payee's customer has transferred to the payee from
+// any account they hold since the payee was saved
+func SentDuringCoolingOff(q db.Querier, p models.Payee, destinationID int) (float64, error) {
+	var sent float64
+	err := q.QueryRow(`SELECT COALESCE(SUM(amount), 0) FROM transactions
+		WHERE type = ? AND counterparty_account_id = ? AND transaction_date >= ?
+		AND account_id IN (SELECT account_id FROM accounts WHERE customer_id = ? UNION SELECT account_id FROM account_holders WHERE customer_id = ?)`,
+		ledger.TypeTransferOut, destinationID, p.CreatedAt, p.CustomerID, p.CustomerID).Scan(&sent)
+	if err != nil {
+		return 0, fmt.Errorf("summing transfers to payee %d: %w", p.PayeeID, err)
+	}
+	return sent, nil
+}
+
+// CheckCoolingOff evaluates a transfer of amount to a payee against the new-payee limit.
+// Payees past their cooling-off window are not limited here. Call it inside the
+// transaction holding the source account's FOR UPDATE lock.
+func CheckCoolingOff(tx *sql.Tx, p models.Payee, destination models.Account, amount float64, now time.Time) (*limits.Violation, error) {
+	if !now.Before(p.CoolingOffUntil) {
+		return nil, nil
+	}
+	s, err := GetSettings(tx)
+	if err != nil {
+		return nil, err
+	}
+	sent, err := SentDuringCoolingOff(tx, p, destination.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if sent+amount > s.NewPayeeLimit {
+		return &limits.Violation{Code: CodeNewPayeeLimit, Message: fmt.Sprintf("Transfers to a new payee are limited to %.2f until %s (%.2f already sent)",
+			s.NewPayeeLimit, p.CoolingOffUntil.Format(time.RFC3339), sent)}, nil
+	}
+	return nil, nil
+}
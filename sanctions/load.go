@@ -0,0 +1,264 @@
+package sanctions
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"banking-app/db"
+)
+
+// Entry is one listed person or organization
+type Entry struct {
+	ExternalID string // Identifier on the source list, e.g. the OFAC ent_num
+	Type       string // 'individual' or 'entity'
+	Name       string
+	Aliases    []string
+	DOB        *time.Time // Full date of birth, when the list gives one
+	BirthYear  int        // Year of birth, also set when only the year is known
+	Program    string     // Sanctions program, or the position held for PEPs
+	PEP        bool       // Politically exposed person rather than a sanctioned party
+}
+
+// ofacNull marks an empty field in OFAC CSV files
+const ofacNull = "-0-"
+
+// remarksDOB finds the first date of birth in OFAC remarks, e.g. "DOB 14 Jun 1951;" or "DOB circa 1960;"
+var remarksDOB = regexp.MustCompile(`DOB (?:circa )?([0-9]{1,2} [A-Za-z]{3} [0-9]{4}|[A-Za-z]{3} [0-9]{4}|[0-9]{4})`)
+
+// LoadOFACCSV reads the OFAC SDN list in its legacy CSV format: sdn.csv with the primary
+// names and, optionally, alt.csv with the aliases
+func LoadOFACCSV(sdn, alt io.Reader) ([]Entry, error) {
+	r := csv.NewReader(sdn)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	var entries []Entry
+	index := map[string]int{}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading SDN file: %w", err)
+		}
+		if len(rec) < 4 || strings.TrimSpace(rec[0]) == "" {
+			continue // Trailing control records
+		}
+		e := Entry{ExternalID: strings.TrimSpace(rec[0]), Name: ofacField(rec[1]), Type: "entity", Program: ofacField(rec[3])}
+		if strings.EqualFold(ofacField(rec[2]), "individual") {
+			e.Type = "individual"
+		}
+		if len(rec) > 11 {
+			if m := remarksDOB.FindStringSubmatch(rec[11]); m != nil {
+				e.DOB, e.BirthYear = parseDOB(m[1])
+			}
+		}
+		index[e.ExternalID] = len(entries)
+		entries = append(entries, e)
+	}
+
+	if alt != nil {
+		r := csv.NewReader(alt)
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		for {
+			rec, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("reading alias file: %w", err)
+			}
+			if len(rec) < 4 {
+				continue
+			}
+			if i, ok := index[strings.TrimSpace(rec[0])]; ok {
+				if name := ofacField(rec[3]); name != "" {
+					entries[i].Aliases = append(entries[i].Aliases, name)
+				}
+			}
+		}
+	}
+	return entries, nil
+}
+
+func ofacField(s string) string {
+	s = strings.TrimSpace(s)
+	if s == ofacNull {
+		return ""
+	}
+	return s
+}
+
+type ofacXMLName struct {
+	FirstName string `xml:"firstName"`
+	LastName  string `xml:"lastName"`
+}
+
+func (n ofacXMLName) full() string {
+	return strings.TrimSpace(n.FirstName + " " + n.LastName)
+}
+
+type ofacXMLList struct {
+	Entries []struct {
+		UID string `xml:"uid"`
+		ofacXMLName
+		Type     string        `xml:"sdnType"`
+		Programs []string      `xml:"programList>program"`
+		Akas     []ofacXMLName `xml:"akaList>aka"`
+		DOBs     []string      `xml:"dateOfBirthList>dateOfBirthItem>dateOfBirth"`
+	} `xml:"sdnEntry"`
+}
+
+// LoadOFACXML reads the OFAC SDN list in its XML format (sdn.xml)
+func LoadOFACXML(r io.Reader) ([]Entry, error) {
+	var list ofacXMLList
+	if err := xml.NewDecoder(r).Decode(&list); err != nil {
+		return nil, fmt.Errorf("reading SDN XML: %w", err)
+	}
+	entries := make([]Entry, 0, len(list.Entries))
+	for _, x := range list.Entries {
+		e := Entry{ExternalID: x.UID, Name: x.full(), Type: "entity", Program: strings.Join(x.Programs, ",")}
+		if strings.EqualFold(x.Type, "individual") {
+			e.Type = "individual"
+		}
+		for _, aka := range x.Akas {
+			if name := aka.full(); name != "" {
+				e.Aliases = append(e.Aliases, name)
+			}
+		}
+		if len(x.DOBs) > 0 {
+			e.DOB, e.BirthYear = parseDOB(x.DOBs[0])
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// LoadCSV reads a list in a simple CSV format with a header row naming the columns
+// id, name, aliases (separated by ';'), dob, type and program. Only name is required.
+// Set pep for lists of politically exposed persons.
+func LoadCSV(in io.Reader, pep bool) ([]Entry, error) {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := col["name"]; !ok {
+		return nil, fmt.Errorf("CSV has no name column")
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := col[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var entries []Entry
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV line %d: %w", line, err)
+		}
+		e := Entry{ExternalID: field(rec, "id"), Name: field(rec, "name"), Type: "individual", Program: field(rec, "program"), PEP: pep}
+		if e.Name == "" {
+			continue
+		}
+		if e.ExternalID == "" {
+			e.ExternalID = strconv.Itoa(line)
+		}
+		if t := strings.ToLower(field(rec, "type")); t == "entity" {
+			e.Type = t
+		}
+		for _, a := range strings.Split(field(rec, "aliases"), ";") {
+			if a = strings.TrimSpace(a); a != "" {
+				e.Aliases = append(e.Aliases, a)
+			}
+		}
+		if dob := field(rec, "dob"); dob != "" {
+			e.DOB, e.BirthYear = parseDOB(dob)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseDOB understands the date formats found on sanctions lists. A date with
+// only a year, or a month and year, yields just the birth year.
+func parseDOB(s string) (*time.Time, int) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02", "02 Jan 2006", "2 Jan 2006", "01/02/2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t, t.Year()
+		}
+	}
+	for _, layout := range []string{"Jan 2006", "2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return nil, t.Year()
+		}
+	}
+	return nil, 0
+}
+
+// Replace swaps the stored entries of a list for a freshly loaded set in one SQL transaction
+func Replace(listName string, entries []Entry) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("starting list load transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	if _, err := tx.Exec("DELETE a FROM sanctions_aliases a JOIN sanctions_entries e ON e.entry_id = a.entry_id WHERE e.list_name = ?", listName); err != nil {
+		return fmt.Errorf("clearing aliases of %s: %w", listName, err)
+	}
+	// Entries referenced by screening cases are kept for the evidence; they are only marked delisted
+	if _, err := tx.Exec("UPDATE sanctions_entries SET active = FALSE WHERE list_name = ?", listName); err != nil {
+		return fmt.Errorf("clearing entries of %s: %w", listName, err)
+	}
+
+	for _, e := range entries {
+		var birthYear *int
+		if e.BirthYear != 0 {
+			birthYear = &e.BirthYear
+		}
+		result, err := tx.Exec(`INSERT INTO sanctions_entries (list_name, external_id, entry_type, name, normalized_name, dob, birth_year, program, pep, active)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, TRUE)
+			ON DUPLICATE KEY UPDATE entry_id = LAST_INSERT_ID(entry_id), entry_type = VALUES(entry_type), name = VALUES(name),
+			normalized_name = VALUES(normalized_name), dob = VALUES(dob), birth_year = VALUES(birth_year), program = VALUES(program),
+			pep = VALUES(pep), active = TRUE`,
+			listName, e.ExternalID, e.Type, e.Name, Normalize(e.Name), e.DOB, birthYear, e.Program, e.PEP)
+		if err != nil {
+			return fmt.Errorf("inserting %s entry %s: %w", listName, e.ExternalID, err)
+		}
+		entryID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, alias := range e.Aliases {
+			if _, err := tx.Exec("INSERT INTO sanctions_aliases (entry_id, name, normalized_name) VALUES (?, ?, ?)", entryID, alias, Normalize(alias)); err != nil {
+				return fmt.Errorf("inserting alias of %s entry %s: %w", listName, e.ExternalID, err)
+			}
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO sanctions_lists (list_name, entry_count, loaded_at) VALUES (?, ?, NOW(6))
+		ON DUPLICATE KEY UPDATE entry_count = VALUES(entry_count), loaded_at = VALUES(loaded_at)`, listName, len(entries))
+	if err != nil {
+		return fmt.Errorf("recording load of %s: %w", listName, err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,93 @@
+package sanctions
+
+import "strings"
+
+// Similarity scores two normalized names between 0 and 1. It takes the better of
+// comparing the whole names and comparing them part by part, so a missing middle
+// name or a slightly different spelling of one part still scores high.
+func Similarity(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	whole := jaroWinkler(a, b)
+
+	ta, tb := strings.Fields(a), strings.Fields(b)
+	if len(ta) > len(tb) {
+		ta, tb = tb, ta
+	}
+	// Every part of the shorter name is matched to its closest part in the longer one.
+	// A one-part name matching one part of a longer name is weak evidence, so the
+	// average is scaled down by how much of the longer name went unmatched.
+	var sum float64
+	for _, x := range ta {
+		best := 0.0
+		for _, y := range tb {
+			if s := jaroWinkler(x, y); s > best {
+				best = s
+			}
+		}
+		sum += best
+	}
+	parts := sum / float64(len(ta))
+	parts *= 1 - 0.1*float64(len(tb)-len(ta))
+
+	if parts > whole {
+		return parts
+	}
+	return whole
+}
+
+// jaroWinkler is the Jaro similarity with Winkler's boost for a common prefix
+func jaroWinkler(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	window := max(len(ra), len(rb))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		lo, hi := max(0, i-window), min(len(rb), i+window+1)
+		for j := lo; j < hi; j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
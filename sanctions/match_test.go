@@ -0,0 +1,57 @@
+package sanctions
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want float64 // Exact score, or -1 where only hit is checked
+		hit  bool
+	}{
+		{name: "identical", a: "Ayman al Zawahiri", b: "AL-ZAWAHIRI, Ayman", want: 1, hit: true},
+		{name: "empty", a: "", b: "john smith", want: 0},
+		{name: "one part of a two-part name scores the threshold", a: "Ali", b: "Ali Hassan", want: 0.90, hit: true},
+		{name: "one part of a three-part name", a: "Ali", b: "Ali Hassan Mohammed", want: -1},
+		{name: "missing part", a: "Ayman Zawahiri", b: "Ayman al Zawahiri", want: 0.90, hit: true},
+		{name: "misspelt part", a: "John Smith", b: "Jon Smith", want: -1, hit: true},
+		{name: "transliteration variant", a: "Владимир Путин", b: "Vladimir Putyn", want: -1, hit: true},
+		{name: "different names", a: "John Smith", b: "Mary Jones", want: -1},
+		{name: "similar single names", a: "Smith", b: "Smyth", want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Similarity(Normalize(tt.a), Normalize(tt.b))
+			if tt.want >= 0 && got != tt.want {
+				t.Errorf("Similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if hit := got >= MatchThreshold; hit != tt.hit {
+				t.Errorf("Similarity(%q, %q) = %v, hit %v, want hit %v", tt.a, tt.b, got, hit, tt.hit)
+			}
+			if rev := Similarity(Normalize(tt.b), Normalize(tt.a)); rev != got {
+				t.Errorf("Similarity is not symmetric for %q and %q: %v and %v", tt.a, tt.b, got, rev)
+			}
+		})
+	}
+}
+
+func TestJaroWinkler(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"martha", "marhta", 0.9611},
+		{"dwayne", "duane", 0.84},
+		{"dixon", "dicksonx", 0.8133},
+		{"abc", "xyz", 0},
+		{"same", "same", 1},
+	}
+	for _, tt := range tests {
+		if got := jaroWinkler(tt.a, tt.b); math.Abs(got-tt.want) > 0.0001 {
+			t.Errorf("jaroWinkler(%q, %q) = %.4f, want %.4f", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
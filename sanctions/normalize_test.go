@@ -0,0 +1,27 @@
+package sanctions
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "list order and punctuation", in: "AL-ZAWAHIRI, Ayman", want: "al ayman zawahiri"},
+		{name: "natural order", in: "Ayman al Zawahiri", want: "al ayman zawahiri"},
+		{name: "cyrillic", in: "Владимир Путин", want: "putin vladimir"},
+		{name: "latin diacritics", in: "José Müller-Lüdenscheidt", want: "jose ludenscheidt muller"},
+		{name: "letters outside the latin-1 range", in: "Łukasz Żółć", want: "lukasz zolc"},
+		{name: "apostrophe and repeated spaces", in: "O'Brien  Seán", want: "brien o sean"},
+		{name: "digits are kept", in: "Smith 2nd", want: "2nd smith"},
+		{name: "blank", in: "  ", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.in); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
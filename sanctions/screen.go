@@ -0,0 +1,273 @@
+// Package sanctions screens customers and transfer counterparties against locally
+// loaded sanctions and PEP lists, and tracks the resulting hits as cases for
+// employees to clear or confirm.
+package sanctions
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"banking-app/db"
+)
+
+// MatchThreshold is the similarity from which a list entry counts as a hit
+var MatchThreshold = 0.90
+
+// Screening statuses stored in customers.screening_status
+const (
+	StatusClear     = "clear"     // No undecided or confirmed hits
+	StatusPending   = "pending"   // At least one open case
+	StatusConfirmed = "confirmed" // At least one confirmed hit; money movement is blocked
+)
+
+// Case statuses stored in screening_cases.status
+const (
+	CaseOpen      = "open"
+	CaseCleared   = "cleared"
+	CaseConfirmed = "confirmed"
+)
+
+// What caused a customer to be screened
+const (
+	TriggerOnboarding = "onboarding"
+	TriggerUpdate     = "update"
+	TriggerTransfer   = "transfer"
+	TriggerRescreen   = "rescreen"
+)
+
+// Hit is a list entry matching a screened name
+type Hit struct {
+	EntryID     int64
+	ListName    string
+	MatchedName string
+	Score       float64
+	PEP         bool
+}
+
+type candidate struct {
+	entryID    int64
+	listName   string
+	name       string
+	normalized string
+	dob        *time.Time
+	birthYear  int
+	pep        bool
+}
+
+// The lists are held in memory and reloaded whenever a list load changes sanctions_lists
+var (
+	cacheMu      sync.Mutex
+	cacheVersion string
+	cache        []candidate
+)
+
+func candidates(q db.Querier) ([]candidate, error) {
+	var version string
+	if err := q.QueryRow("SELECT CONCAT(COALESCE(MAX(loaded_at), ''), '/', COUNT(*)) FROM sanctions_lists").Scan(&version); err != nil {
+		return nil, fmt.Errorf("checking sanctions list version: %w", err)
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if version == cacheVersion {
+		return cache, nil
+	}
+
+	// Primary names and aliases both become candidates of their entry
+	rows, err := q.Query(`SELECT e.entry_id, e.list_name, e.name, e.normalized_name, e.dob, e.birth_year, e.pep
+		FROM sanctions_entries e WHERE e.active = TRUE
+		UNION ALL
+		SELECT e.entry_id, e.list_name, a.name, a.normalized_name, e.dob, e.birth_year, e.pep
+		FROM sanctions_aliases a JOIN sanctions_entries e ON e.entry_id = a.entry_id WHERE e.active = TRUE`)
+	if err != nil {
+		return nil, fmt.Errorf("loading sanctions lists: %w", err)
+	}
+	defer rows.Close()
+
+	var loaded []candidate
+	for rows.Next() {
+		var c candidate
+		var birthYear sql.NullInt64
+		if err := rows.Scan(&c.entryID, &c.listName, &c.name, &c.normalized, &c.dob, &birthYear, &c.pep); err != nil {
+			return nil, fmt.Errorf("scanning sanctions entry: %w", err)
+		}
+		c.birthYear = int(birthYear.Int64)
+		loaded = append(loaded, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("loading sanctions lists: %w", err)
+	}
+	cache, cacheVersion = loaded, version
+	return cache, nil
+}
+
+// Screen returns the list entries matching a name, best first. A known date of birth
+// breaks ties: a matching one raises the score, a different birth year lowers it.
+func Screen(q db.Querier, name string, dob *time.Time) ([]Hit, error) {
+	all, err := candidates(q)
+	if err != nil {
+		return nil, err
+	}
+	normalized := Normalize(name)
+
+	best := map[int64]Hit{}
+	for _, c := range all {
+		score := adjustForDOB(Similarity(normalized, c.normalized), c, dob)
+		if score < MatchThreshold {
+			continue
+		}
+		if h, ok := best[c.entryID]; !ok || score > h.Score {
+			best[c.entryID] = Hit{EntryID: c.entryID, ListName: c.listName, MatchedName: c.name, Score: score, PEP: c.pep}
+		}
+	}
+
+	hits := make([]Hit, 0, len(best))
+	for _, h := range best {
+		hits = append(hits, h)
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	return hits, nil
+}
+
+func adjustForDOB(score float64, c candidate, dob *time.Time) float64 {
+	if dob == nil || dob.IsZero() {
+		return score
+	}
+	switch {
+	case c.dob != nil && c.dob.Year() == dob.Year() && c.dob.YearDay() == dob.YearDay():
+		return min(1, score+0.05)
+	case c.birthYear != 0 && c.birthYear != dob.Year():
+		return score - 0.15
+	}
+	return score
+}
+
+// ScreenCustomer screens a customer, opens a case for every hit not already decided for
+// that customer and returns the customer's resulting screening status
+func ScreenCustomer(tx *sql.Tx, customerID int, name string, dob *time.Time, trigger string) (string, error) {
+	hits, err := Screen(tx, name, dob)
+	if err != nil {
+		return "", err
+	}
+	for _, h := range hits {
+		// One case per customer and entry: a hit cleared once is not raised again
+		_, err := tx.Exec(`INSERT IGNORE INTO screening_cases (customer_id, entry_id, list_name, screened_name, matched_name, score, pep, trigger_event)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, customerID, h.EntryID, h.ListName, name, h.MatchedName, h.Score, h.PEP, trigger)
+		if err != nil {
+			return "", fmt.Errorf("opening screening case: %w", err)
+		}
+	}
+	return UpdateStatus(tx, customerID)
+}
+
+// UpdateStatus recomputes a customer's screening status from their cases
+func UpdateStatus(tx *sql.Tx, customerID int) (string, error) {
+	var confirmed, open bool
+	err := tx.QueryRow(`SELECT COALESCE(MAX(status = 'confirmed'), FALSE), COALESCE(MAX(status = 'open'), FALSE)
+		FROM screening_cases WHERE customer_id = ?`, customerID).Scan(&confirmed, &open)
+	if err != nil {
+		return "", fmt.Errorf("summarizing screening cases: %w", err)
+	}
+	status := StatusClear
+	if confirmed {
+		status = StatusConfirmed
+	} else if open {
+		status = StatusPending
+	}
+	if _, err := tx.Exec("UPDATE customers SET screening_status = ? WHERE customer_id = ?", status, customerID); err != nil {
+		return "", fmt.Errorf("updating screening status: %w", err)
+	}
+	return status, nil
+}
+
+// CustomerStatus returns a customer's stored screening status
+func CustomerStatus(q db.Querier, customerID int) (string, error) {
+	var status string
+	if err := q.QueryRow("SELECT screening_status FROM customers WHERE customer_id = ?", customerID).Scan(&status); err != nil {
+		return "", fmt.Errorf("loading screening status of customer %d: %w", customerID, err)
+	}
+	return status, nil
+}
+
+// ScreenCounterparties checks both sides of a transfer. The destination customer is
+// screened again, since lists may have changed since onboarding; the source customer's
+// stored status is used as is. It returns the worst status of the two.
+func ScreenCounterparties(tx *sql.Tx, fromCustomerID, toCustomerID int) (string, error) {
+	fromStatus, err := CustomerStatus(tx, fromCustomerID)
+	if err != nil {
+		return "", err
+	}
+	if fromStatus == StatusConfirmed || fromCustomerID == toCustomerID {
+		return fromStatus, nil
+	}
+
+	var name string
+	var dob *time.Time
+	if err := tx.QueryRow("SELECT name, dob FROM customers WHERE customer_id = ?", toCustomerID).Scan(&name, &dob); err != nil {
+		return "", fmt.Errorf("loading customer %d for screening: %w", toCustomerID, err)
+	}
+	toStatus, err := ScreenCustomer(tx, toCustomerID, name, dob, TriggerTransfer)
+	if err != nil {
+		return "", err
+	}
+	if toStatus == StatusConfirmed || fromStatus == StatusClear {
+		return toStatus, nil
+	}
+	return fromStatus, nil
+}
+
+// RescreenAll screens every customer again, typically after a list load, each in its
+// own SQL transaction. It returns how many customers are left pending or confirmed.
+func RescreenAll() (int, error) {
+	rows, err := db.DB.Query("SELECT customer_id, name, dob FROM customers ORDER BY customer_id")
+	if err != nil {
+		return 0, fmt.Errorf("listing customers: %w", err)
+	}
+	type customer struct {
+		id   int
+		name string
+		dob  *time.Time
+	}
+	var customers []customer
+	for rows.Next() {
+		var c customer
+		if err := rows.Scan(&c.id, &c.name, &c.dob); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scanning customer: %w", err)
+		}
+		customers = append(customers, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("listing customers: %w", err)
+	}
+
+	flagged := 0
+	for _, c := range customers {
+		status, err := rescreen(c.id, c.name, c.dob)
+		if err != nil {
+			return flagged, fmt.Errorf("screening customer %d: %w", c.id, err)
+		}
+		if status != StatusClear {
+			flagged++
+		}
+	}
+	return flagged, nil
+}
+
+func rescreen(customerID int, name string, dob *time.Time) (string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	status, err := ScreenCustomer(tx, customerID, name, dob, TriggerRescreen)
+	if err != nil {
+		return "", err
+	}
+	return status, tx.Commit()
+}
@@ -0,0 +1,189 @@
+// Package scheduled holds transfers accepted after their cut-off until the end-of-day
+// run executes them ahead of their value date. The transfer checks ran when it was
+// accepted; on execution account status, funds and limits are checked again, as on
+// review of a held transfer, and a transfer that no longer passes fails without moving
+// any money.
+package scheduled
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"banking-app/audit"
+	"banking-app/db"
+	"banking-app/fees"
+	"banking-app/ledger"
+	"banking-app/limits"
+	"banking-app/models"
+	"banking-app/outbox"
+)
+
+// Statuses stored in scheduled_transfers.status
+const (
+	StatusScheduled = "scheduled"
+	StatusExecuted  = "executed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// process is recorded as the request ID of audit entries written on execution
+const process = "scheduled-transfers"
+
+// Transfer is a transfer to be executed on its value date
+type Transfer struct {
+	From        models.Account
+	To          models.Account
+	Amount      float64
+	PaymentType string
+	ValueDate   time.Time
+	RequestedBy *int
+	RequestID   string
+}
+
+// Schedule stores a transfer inside the caller's SQL transaction and returns its ID
+func Schedule(tx *sql.Tx, t Transfer) (int64, error) {
+	result, err := tx.Exec(`INSERT INTO scheduled_transfers (from_account_id, to_account_id, amount, payment_type, value_date, requested_by, request_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, t.From.AccountID, t.To.AccountID, t.Amount, t.PaymentType, t.ValueDate.Format("2006-01-02"), t.RequestedBy, t.RequestID)
+	if err != nil {
+		return 0, fmt.Errorf("scheduling transfer from account %d: %w", t.From.AccountID, err)
+	}
+	return result.LastInsertId()
+}
+
+// Execute runs every scheduled transfer value-dated on or before valueDate. Each runs
+// in its own SQL transaction and is executed at most once, so a failed run can simply
+// be repeated.
+func Execute(valueDate time.Time) error {
+	rows, err := db.DB.Query("SELECT scheduled_transfer_id FROM scheduled_transfers WHERE status = ? AND value_date <= ? ORDER BY value_date, scheduled_transfer_id",
+		StatusScheduled, valueDate.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("listing due scheduled transfers: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning scheduled transfer ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("listing due scheduled transfers: %w", err)
+	}
+
+	failed := 0
+	for _, id := range ids {
+		if err := execute(id); err != nil {
+			log.Printf("Error executing scheduled transfer %d: %v", id, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("executing scheduled transfers failed for %d of %d", failed, len(ids))
+	}
+	return nil
+}
+
+func execute(id int) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	var fromNumber, toNumber, status string
+	var amount float64
+	var valueDate time.Time
+	err = tx.QueryRow(`SELECT fa.account_number, ta.account_number, st.amount, st.value_date, st.status
+		FROM scheduled_transfers st
+		JOIN accounts fa ON fa.account_id = st.from_account_id
+		JOIN accounts ta ON ta.account_id = st.to_account_id
+		WHERE st.scheduled_transfer_id = ? FOR UPDATE OF st`, id).Scan(&fromNumber, &toNumber, &amount, &valueDate, &status)
+	if err != nil {
+		return err
+	}
+	if status != StatusScheduled {
+		return nil // Cancelled since it was listed
+	}
+
+	from, err := ledger.LockAccount(tx, fromNumber)
+	if err != nil {
+		return fmt.Errorf("locking source account: %w", err)
+	}
+	to, err := ledger.LockAccount(tx, toNumber)
+	if err != nil {
+		return fmt.Errorf("locking destination account: %w", err)
+	}
+	entityID := strconv.Itoa(id)
+
+	reason, err := refusal(tx, from, to, amount)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		_, err := tx.Exec("UPDATE scheduled_transfers SET status = ?, failure_reason = ?, finished_at = NOW() WHERE scheduled_transfer_id = ?", StatusFailed, reason, id)
+		if err != nil {
+			return fmt.Errorf("failing scheduled transfer: %w", err)
+		}
+		err = audit.RecordSystemTx(tx, process, audit.Entry{Action: "scheduled_transfer.fail", EntityType: "scheduled_transfer", EntityID: entityID,
+			Before: map[string]string{"status": StatusScheduled}, After: map[string]string{"status": StatusFailed, "reason": reason}})
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if err := ledger.TransferValueDated(tx, from, to, amount, valueDate); err != nil {
+		return err
+	}
+	fee, err := fees.ForTransfer(tx, from, to, amount)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE scheduled_transfers SET status = ?, finished_at = NOW() WHERE scheduled_transfer_id = ?", StatusExecuted, id); err != nil {
+		return fmt.Errorf("completing scheduled transfer: %w", err)
+	}
+	err = audit.RecordSystemTx(tx, process, audit.Entry{Action: "scheduled_transfer.execute", EntityType: "scheduled_transfer", EntityID: entityID,
+		Before: map[string]interface{}{"status": StatusScheduled, "balance": from.Balance, "to_account_number": to.AccountNumber, "to_balance": to.Balance},
+		After: map[string]interface{}{"status": StatusExecuted, "balance": from.Balance - amount - fee, "to_account_number": to.AccountNumber, "to_balance": to.Balance + amount,
+			"amount": amount, "fee": fee, "value_date": valueDate.Format("2006-01-02")}})
+	if err != nil {
+		return err
+	}
+	err = outbox.Enqueue(tx, outbox.EventTransferred, from.AccountNumber, map[string]interface{}{
+		"from_account_number": from.AccountNumber,
+		"to_account_number":   to.AccountNumber,
+		"amount":              amount,
+		"value_date":          valueDate.Format("2006-01-02"),
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// refusal returns why a scheduled transfer can no longer be executed, or "" if it can
+func refusal(tx *sql.Tx, from, to models.Account, amount float64) (string, error) {
+	if !ledger.CanDebit(from) {
+		return ledger.Refusal(from), nil
+	}
+	if !ledger.CanCredit(to) {
+		return ledger.Refusal(to), nil
+	}
+	if ledger.Available(from) < amount {
+		return "Insufficient funds in source account", nil
+	}
+	violation, err := limits.Check(tx, from, amount)
+	if err != nil {
+		return "", err
+	}
+	if violation != nil {
+		return violation.Message, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,246 @@
+// Package teller keeps the cash drawers of branch tellers. A teller opens a session with
+// a counted drawer, cash deposits and withdrawals add and remove notes and coins, and
+// closing the session compares a fresh count with what the bookings say should be there.
+package teller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"banking-app/db"
+	"banking-app/models"
+)
+
+// Session statuses stored in teller_sessions.status
+const (
+	StatusOpen   = "open"
+	StatusClosed = "closed"
+)
+
+// Cash movement kinds stored in teller_cash_movements.kind
+const (
+	KindDeposit    = "deposit"
+	KindWithdrawal = "withdrawal"
+)
+
+// Denominations are the notes and coins a drawer holds, in cents
+var Denominations = []int64{10000, 5000, 2000, 1000, 500, 100, 25, 10, 5, 1}
+
+// ErrInsufficientCash is returned when the drawer lacks the notes or coins to pay out
+var ErrInsufficientCash = errors.New("drawer does not hold the requested denominations")
+
+// Cents converts an amount to whole cents
+func Cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func isDenomination(cents int64) bool {
+	for _, d := range Denominations {
+		if d == cents {
+			return true
+		}
+	}
+	return false
+}
+
+// Total validates a count of notes and coins and returns its value in cents. Each
+// denomination may appear once and counts cannot be negative.
+func Total(cash []models.DenominationCount) (int64, error) {
+	seen := map[int64]bool{}
+	var total int64
+	for _, c := range cash {
+		cents := Cents(c.Denomination)
+		if !isDenomination(cents) {
+			return 0, fmt.Errorf("%.2f is not a denomination", c.Denomination)
+		}
+		if seen[cents] {
+			return 0, fmt.Errorf("denomination %.2f is listed twice", c.Denomination)
+		}
+		if c.Count < 0 {
+			return 0, fmt.Errorf("count of %.2f cannot be negative", c.Denomination)
+		}
+		seen[cents] = true
+		total += cents * int64(c.Count)
+	}
+	return total, nil
+}
+
+// Open starts a session for an employee with the counted opening drawer. The unique key
+// on open sessions refuses a second one for the same employee.
+func Open(tx *sql.Tx, employeeID, branchID int, cash []models.DenominationCount) (int64, error) {
+	total, err := Total(cash)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec("INSERT INTO teller_sessions (employee_id, branch_id, opening_total) VALUES (?, ?, ?)",
+		employeeID, branchID, float64(total)/100)
+	if err != nil {
+		return 0, fmt.Errorf("opening teller session of employee %d: %w", employeeID, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range cash {
+		if c.Count == 0 {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO teller_drawers (session_id, denomination, count) VALUES (?, ?, ?)", id, c.Denomination, c.Count); err != nil {
+			return 0, fmt.Errorf("filling drawer of teller session %d: %w", id, err)
+		}
+	}
+	return id, saveCount(tx, id, "opening", cash)
+}
+
+func saveCount(tx *sql.Tx, sessionID int64, kind string, cash []models.DenominationCount) error {
+	for _, c := range cash {
+		_, err := tx.Exec("INSERT INTO teller_session_counts (session_id, kind, denomination, count) VALUES (?, ?, ?, ?)",
+			sessionID, kind, c.Denomination, c.Count)
+		if err != nil {
+			return fmt.Errorf("saving %s count of teller session %d: %w", kind, sessionID, err)
+		}
+	}
+	return nil
+}
+
+// Columns lists the session columns read by Scan
+const Columns = `session_id, employee_id, branch_id, status, opening_total, expected_total, counted_total, variance,
+	opened_at, closed_at, closed_by, close_note`
+
+// Scan reads a session row selected with Columns
+func Scan(row interface{ Scan(...interface{}) error }, s *models.TellerSession) error {
+	return row.Scan(&s.SessionID, &s.EmployeeID, &s.BranchID, &s.Status, &s.OpeningTotal, &s.ExpectedTotal, &s.CountedTotal, &s.Variance,
+		&s.OpenedAt, &s.ClosedAt, &s.ClosedBy, &s.CloseNote)
+}
+
+// LockOpenSession locks the open session of an employee, returning sql.ErrNoRows if
+// they have none
+func LockOpenSession(tx *sql.Tx, employeeID int) (models.TellerSession, error) {
+	var s models.TellerSession
+	err := Scan(tx.QueryRow("SELECT "+Columns+" FROM teller_sessions WHERE employee_id = ? AND status = ? FOR UPDATE", employeeID, StatusOpen), &s)
+	return s, err
+}
+
+// LockSession locks a session by ID
+func LockSession(tx *sql.Tx, sessionID int) (models.TellerSession, error) {
+	var s models.TellerSession
+	err := Scan(tx.QueryRow("SELECT "+Columns+" FROM teller_sessions WHERE session_id = ? FOR UPDATE", sessionID), &s)
+	return s, err
+}
+
+// Drawer returns the notes and coins in a session's drawer, largest first
+func Drawer(q db.Querier, sessionID int) ([]models.DenominationCount, error) {
+	rows, err := q.Query("SELECT denomination, count FROM teller_drawers WHERE session_id = ? AND count > 0 ORDER BY denomination DESC", sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("loading drawer of teller session %d: %w", sessionID, err)
+	}
+	defer rows.Close()
+
+	drawer := []models.DenominationCount{}
+	for rows.Next() {
+		var c models.DenominationCount
+		if err := rows.Scan(&c.Denomination, &c.Count); err != nil {
+			return nil, fmt.Errorf("scanning drawer of teller session %d: %w", sessionID, err)
+		}
+		drawer = append(drawer, c)
+	}
+	return drawer, rows.Err()
+}
+
+// Book records a cash deposit or withdrawal against a locked open session, adding the
+// cash to the drawer or taking it out. The cash must add up to amount.
+func Book(tx *sql.Tx, session models.TellerSession, accountID int, transactionID int64, kind string, amount float64, cash []models.DenominationCount) error {
+	total, err := Total(cash)
+	if err != nil {
+		return err
+	}
+	if total != Cents(amount) {
+		return fmt.Errorf("cash adds up to %.2f, not %.2f", float64(total)/100, amount)
+	}
+
+	for _, c := range cash {
+		if c.Count == 0 {
+			continue
+		}
+		if kind == KindDeposit {
+			_, err = tx.Exec(`INSERT INTO teller_drawers (session_id, denomination, count) VALUES (?, ?, ?)
+				ON DUPLICATE KEY UPDATE count = count + VALUES(count)`, session.SessionID, c.Denomination, c.Count)
+			if err != nil {
+				return fmt.Errorf("adding cash to drawer of teller session %d: %w", session.SessionID, err)
+			}
+			continue
+		}
+		result, err := tx.Exec("UPDATE teller_drawers SET count = count - ? WHERE session_id = ? AND denomination = ? AND count >= ?",
+			c.Count, session.SessionID, c.Denomination, c.Count)
+		if err != nil {
+			return fmt.Errorf("taking cash from drawer of teller session %d: %w", session.SessionID, err)
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrInsufficientCash
+		}
+	}
+
+	encoded, err := json.Marshal(cash)
+	if err != nil {
+		return fmt.Errorf("encoding cash: %w", err)
+	}
+	_, err = tx.Exec("INSERT INTO teller_cash_movements (session_id, account_id, transaction_id, kind, amount, cash) VALUES (?, ?, ?, ?, ?, ?)",
+		session.SessionID, accountID, transactionID, kind, amount, encoded)
+	if err != nil {
+		return fmt.Errorf("recording cash %s in teller session %d: %w", kind, session.SessionID, err)
+	}
+	return nil
+}
+
+// Balance is the result of closing a session
+type Balance struct {
+	Expected float64
+	Counted  float64
+	Variance float64 // Positive for an overage, negative for a shortage
+}
+
+// Close balances a locked open session against the counted drawer: it saves the count,
+// posts any overage or shortage to the branch and closes the session
+func Close(tx *sql.Tx, session models.TellerSession, cash []models.DenominationCount, closedBy int, note string) (Balance, error) {
+	counted, err := Total(cash)
+	if err != nil {
+		return Balance{}, err
+	}
+	drawer, err := Drawer(tx, session.SessionID)
+	if err != nil {
+		return Balance{}, err
+	}
+	var expected int64
+	for _, c := range drawer {
+		expected += Cents(c.Denomination) * int64(c.Count)
+	}
+	b := Balance{Expected: float64(expected) / 100, Counted: float64(counted) / 100, Variance: float64(counted-expected) / 100}
+
+	if err := saveCount(tx, int64(session.SessionID), "closing", cash); err != nil {
+		return b, err
+	}
+
+	if counted != expected {
+		postingType, amount := "overage", counted-expected
+		if amount < 0 {
+			postingType, amount = "shortage", -amount
+		}
+		_, err := tx.Exec("INSERT INTO branch_cash_postings (branch_id, session_id, type, amount) VALUES (?, ?, ?, ?)",
+			session.BranchID, session.SessionID, postingType, float64(amount)/100)
+		if err != nil {
+			return b, fmt.Errorf("posting %s of teller session %d: %w", postingType, session.SessionID, err)
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE teller_sessions SET status = ?, expected_total = ?, counted_total = ?, variance = ?, closed_at = NOW(), closed_by = ?, close_note = ?
+		WHERE session_id = ?`, StatusClosed, b.Expected, b.Counted, b.Variance, closedBy, note, session.SessionID)
+	if err != nil {
+		return b, fmt.Errorf("closing teller session %d: %w", session.SessionID, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,190 @@
+package termdeposit
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"banking-app/audit"
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+	"banking-app/outbox"
+)
+
+// process is recorded as the request ID of audit entries written by the maturity run
+const process = "term-deposit-batch"
+
+// RunDaily matures every open term deposit whose term ends on or before asOf. Each is
+// processed in its own SQL transaction and only while still open, so a failed run can
+// simply be repeated.
+func RunDaily(asOf time.Time) error {
+	rows, err := db.DB.Query("SELECT account_id FROM term_deposits WHERE status = ? AND maturity_date <= ? ORDER BY maturity_date, account_id",
+		StatusOpen, asOf.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("listing maturing term deposits: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning account ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("listing maturing term deposits: %w", err)
+	}
+
+	failed := 0
+	for _, id := range ids {
+		if err := mature(id, asOf); err != nil {
+			log.Printf("Error maturing term deposit %d: %v", id, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("maturing term deposits failed for %d of %d", failed, len(ids))
+	}
+	return nil
+}
+
+// mature credits the interest of the ending term and carries out the maturity
+// instruction. When the money cannot be paid out, because the deposit is frozen or the
+// nominated account no longer takes credits, everything rolls over instead.
+func mature(accountID int, asOf time.Time) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on error, commit if successful
+
+	d, err := Lock(tx, accountID)
+	if err != nil {
+		return err
+	}
+	if d.Status != StatusOpen || d.MaturityDate.After(asOf) {
+		return nil // Matured or withdrawn since it was listed
+	}
+	account, err := ledger.LockAccount(tx, d.AccountNumber)
+	if err != nil {
+		return fmt.Errorf("locking term deposit account: %w", err)
+	}
+	payout, err := ledger.LockAccount(tx, d.PayoutAccountNumber)
+	if err != nil {
+		return fmt.Errorf("locking payout account: %w", err)
+	}
+
+	interest := Interest(d.Principal, d.Rate, d.StartDate, d.MaturityDate)
+	if interest > 0 {
+		if err := book(tx, account.AccountID, interest, ledger.TypeInterestPaid, "Term deposit interest"); err != nil {
+			return err
+		}
+	}
+	balance := ledger.Round(account.Balance + interest)
+
+	instruction := d.MaturityInstruction
+	after := map[string]interface{}{"interest": interest, "balance": balance}
+	if instruction != InstructionRollover {
+		if account.Status != ledger.StatusActive {
+			instruction, after["rolled_over_because"] = InstructionRollover, ledger.Refusal(account)
+		} else if !ledger.CanCredit(payout) {
+			instruction, after["rolled_over_because"] = InstructionRollover, ledger.Refusal(payout)
+		}
+	}
+	after["instruction"] = instruction
+
+	switch instruction {
+	case InstructionPayout:
+		if err := pay(tx, account, payout, balance); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE term_deposits SET status = ?, closed_at = NOW() WHERE account_id = ?", StatusMatured, accountID); err != nil {
+			return fmt.Errorf("closing term deposit: %w", err)
+		}
+		if err := closeAccount(tx, account, "Term deposit matured and paid out"); err != nil {
+			return err
+		}
+		after["status"], after["paid_out"], after["payout_account_number"] = StatusMatured, balance, payout.AccountNumber
+	case InstructionRolloverPrincipal:
+		if err := pay(tx, account, payout, interest); err != nil {
+			return err
+		}
+		renewed, err := renew(tx, accountID, d, ledger.Round(balance-interest))
+		if err != nil {
+			return err
+		}
+		after["paid_out"], after["payout_account_number"], after["term"] = interest, payout.AccountNumber, renewed
+	default:
+		renewed, err := renew(tx, accountID, d, balance)
+		if err != nil {
+			return err
+		}
+		after["term"] = renewed
+	}
+
+	err = audit.RecordSystemTx(tx, process, audit.Entry{Action: "term_deposit.mature", EntityType: "term_deposit", EntityID: d.AccountNumber,
+		Before: d, After: after})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// pay moves amount from the term deposit to the nominated account
+func pay(tx *sql.Tx, account, payout models.Account, amount float64) error {
+	if amount <= 0 {
+		return nil
+	}
+	if err := ledger.Transfer(tx, account, payout, amount); err != nil {
+		return err
+	}
+	return outbox.Enqueue(tx, outbox.EventTransferred, account.AccountNumber, map[string]interface{}{
+		"from_account_number": account.AccountNumber,
+		"to_account_number":   payout.AccountNumber,
+		"amount":              amount,
+	})
+}
+
+// renew starts the next term on the day the last one ended, at the rate now offered for
+// the term. A term no longer offered keeps its rate.
+func renew(tx *sql.Tx, accountID int, d models.TermDeposit, principal float64) (models.TermDeposit, error) {
+	rate, err := GetRate(tx, d.TermMonths)
+	if err != nil {
+		return d, err
+	}
+	if rate != nil {
+		d.Rate, d.PenaltyRate = rate.Rate, rate.PenaltyRate
+	}
+	d.Principal = principal
+	d.StartDate = d.MaturityDate
+	d.MaturityDate = MaturityDate(d.StartDate, d.TermMonths)
+	d.Rollovers++
+	_, err = tx.Exec("UPDATE term_deposits SET principal = ?, rate = ?, penalty_rate = ?, start_date = ?, maturity_date = ?, rollovers = ? WHERE account_id = ?",
+		d.Principal, d.Rate, d.PenaltyRate, d.StartDate.Format("2006-01-02"), d.MaturityDate.Format("2006-01-02"), d.Rollovers, accountID)
+	if err != nil {
+		return d, fmt.Errorf("rolling over term deposit: %w", err)
+	}
+	return d, nil
+}
+
+// closeAccount closes an emptied term deposit account on behalf of the batch
+func closeAccount(tx *sql.Tx, account models.Account, reason string) error {
+	if _, err := tx.Exec("UPDATE accounts SET status = ?, closed_date = CURDATE() WHERE account_id = ?", ledger.StatusClosed, account.AccountID); err != nil {
+		return fmt.Errorf("closing account %d: %w", account.AccountID, err)
+	}
+	_, err := tx.Exec("INSERT INTO account_status_events (account_id, from_status, to_status, reason, actor_user_id) VALUES (?, ?, ?, ?, NULL)",
+		account.AccountID, account.Status, ledger.StatusClosed, reason)
+	if err != nil {
+		return fmt.Errorf("recording status change of account %d: %w", account.AccountID, err)
+	}
+	return outbox.Enqueue(tx, outbox.EventStatusChanged, account.AccountNumber, map[string]interface{}{
+		"account_number": account.AccountNumber,
+		"from_status":    account.Status,
+		"status":         ledger.StatusClosed,
+		"reason":         reason,
+	})
+}
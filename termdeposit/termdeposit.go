@@ -0,0 +1,199 @@
+// Package termdeposit holds money for a fixed term at a fixed rate. A term deposit is an
+// account of type 'term', funded once from an existing account and closed to ordinary
+// movements. Simple interest is earned over each term at the rate fixed when the term
+// started. At maturity the batch starts a new term, with or without the interest, or pays
+// everything out to the nominated account; breaking the deposit before then pays the
+// interest earned so far less a penalty on the principal.
+package termdeposit
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"banking-app/db"
+	"banking-app/ledger"
+	"banking-app/models"
+)
+
+// Maturity instructions stored in term_deposits.maturity_instruction
+const (
+	InstructionRollover          = "rollover"           // Principal and interest start a new term
+	InstructionRolloverPrincipal = "rollover_principal" // Interest is paid out; the principal starts a new term
+	InstructionPayout            = "payout"             // Everything is paid out and the account closed
+)
+
+// IsInstruction reports whether s is a known maturity instruction
+func IsInstruction(s string) bool {
+	return s == InstructionRollover || s == InstructionRolloverPrincipal || s == InstructionPayout
+}
+
+// Statuses stored in term_deposits.status
+const (
+	StatusOpen      = "open"
+	StatusMatured   = "matured"   // Paid out at maturity
+	StatusWithdrawn = "withdrawn" // Broken before maturity
+)
+
+// RateColumns lists the term deposit rate columns read by ScanRate
+const RateColumns = "term_months, rate, penalty_rate, min_amount, active, updated_at"
+
+// ScanRate reads a term deposit rate row selected with RateColumns
+func ScanRate(row interface{ Scan(...interface{}) error }, r *models.TermDepositRate) error {
+	return row.Scan(&r.TermMonths, &r.Rate, &r.PenaltyRate, &r.MinAmount, &r.Active, &r.UpdatedAt)
+}
+
+// GetRate returns the rate for a term, or nil if the term has never been offered
+func GetRate(q db.Querier, termMonths int) (*models.TermDepositRate, error) {
+	var r models.TermDepositRate
+	err := ScanRate(q.QueryRow("SELECT "+RateColumns+" FROM term_deposit_rates WHERE term_months = ?", termMonths), &r)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading rate for %d month term deposits: %w", termMonths, err)
+	}
+	return &r, nil
+}
+
+// Columns lists the term deposit columns read by Scan, selected from Tables
+const Columns = `a.account_number, fa.account_number, pa.account_number, td.principal, td.rate, td.penalty_rate, td.term_months,
+	td.start_date, td.maturity_date, td.maturity_instruction, td.status, td.rollovers, td.created_by, td.created_at, td.closed_at`
+
+// Tables joins a term deposit to its accounts
+const Tables = `term_deposits td
+	JOIN accounts a ON a.account_id = td.account_id
+	JOIN accounts fa ON fa.account_id = td.funding_account_id
+	JOIN accounts pa ON pa.account_id = td.payout_account_id`
+
+// Scan reads a term deposit row selected with Columns
+func Scan(row interface{ Scan(...interface{}) error }, d *models.TermDeposit) error {
+	return row.Scan(&d.AccountNumber, &d.FundingAccountNumber, &d.PayoutAccountNumber, &d.Principal, &d.Rate, &d.PenaltyRate, &d.TermMonths,
+		&d.StartDate, &d.MaturityDate, &d.MaturityInstruction, &d.Status, &d.Rollovers, &d.CreatedBy, &d.CreatedAt, &d.ClosedAt)
+}
+
+// Lock loads the term deposit of an account and locks its row FOR UPDATE inside tx.
+// It returns sql.ErrNoRows if the account is not a term deposit.
+func Lock(tx *sql.Tx, accountID int) (models.TermDeposit, error) {
+	var d models.TermDeposit
+	err := Scan(tx.QueryRow("SELECT "+Columns+" FROM "+Tables+" WHERE td.account_id = ? FOR UPDATE OF td", accountID), &d)
+	return d, err
+}
+
+// MaturityDate is the day a term of the given months starting on start ends. A term
+// starting on a day its last month does not have ends on that month's last day.
+func MaturityDate(start time.Time, months int) time.Time {
+	d := start.AddDate(0, months, 0)
+	if d.Day() != start.Day() {
+		d = d.AddDate(0, 0, -d.Day())
+	}
+	return d
+}
+
+// Interest is the simple interest earned on principal at an annual rate from one date to
+// another, counting actual days over a 365-day year
+func Interest(principal, rate float64, from, to time.Time) float64 {
+	days := math.Round(ledger.DateOnly(to).Sub(ledger.DateOnly(from)).Hours() / 24)
+	if days <= 0 {
+		return 0
+	}
+	return ledger.Round(principal * rate / 100 * days / 365)
+}
+
+// Opening describes a new term deposit
+type Opening struct {
+	AccountNumber string         // Number for the new account
+	Funding       models.Account // Locked by the caller, who checks it may be debited
+	Payout        models.Account
+	Amount        float64
+	Rate          models.TermDepositRate
+	Instruction   string
+	StartDate     time.Time // Business date the first term starts on
+	CreatedBy     int
+}
+
+// Open creates a term deposit account held by the holders of the funding account and
+// moves the amount into it. It returns the new account, locked.
+func Open(tx *sql.Tx, o Opening) (models.Account, error) {
+	startDate := o.StartDate.Format("2006-01-02")
+	result, err := tx.Exec("INSERT INTO accounts (customer_id, account_number, account_type, balance, opened_date, branch_id, status) VALUES (?, ?, ?, 0, ?, ?, ?)",
+		o.Funding.CustomerID, o.AccountNumber, ledger.AccountTerm, startDate, o.Funding.BranchID, ledger.StatusActive)
+	if err != nil {
+		return models.Account{}, fmt.Errorf("creating term deposit account: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.Account{}, err
+	}
+	_, err = tx.Exec("INSERT INTO account_holders (account_id, customer_id, role) SELECT ?, customer_id, role FROM account_holders WHERE account_id = ?",
+		id, o.Funding.AccountID)
+	if err != nil {
+		return models.Account{}, fmt.Errorf("copying holders to term deposit account %d: %w", id, err)
+	}
+	account, err := ledger.LockAccount(tx, o.AccountNumber)
+	if err != nil {
+		return account, fmt.Errorf("reading back term deposit account %d: %w", id, err)
+	}
+
+	if err := ledger.Transfer(tx, o.Funding, account, o.Amount); err != nil {
+		return account, err
+	}
+	_, err = tx.Exec(`INSERT INTO term_deposits (account_id, funding_account_id, payout_account_id, principal, rate, penalty_rate, term_months,
+		start_date, maturity_date, maturity_instruction, created_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		account.AccountID, o.Funding.AccountID, o.Payout.AccountID, o.Amount, o.Rate.Rate, o.Rate.PenaltyRate, o.Rate.TermMonths,
+		startDate, MaturityDate(o.StartDate, o.Rate.TermMonths).Format("2006-01-02"), o.Instruction, o.CreatedBy)
+	if err != nil {
+		return account, fmt.Errorf("recording term deposit %d: %w", account.AccountID, err)
+	}
+	account.Balance = o.Amount
+	return account, nil
+}
+
+// Withdrawal is the outcome of breaking a term deposit
+type Withdrawal struct {
+	Interest float64 `json:"interest"`
+	Penalty  float64 `json:"penalty"`
+	Payout   float64 `json:"payout"`
+}
+
+// Withdraw breaks an open term deposit before maturity: the interest earned up to asOf
+// is credited, the penalty on the principal debited, and what is left paid out to payout.
+// The penalty is never more than the deposit holds. Both accounts are locked by the
+// caller, who closes the emptied account.
+func Withdraw(tx *sql.Tx, account, payout models.Account, d models.TermDeposit, asOf time.Time) (Withdrawal, error) {
+	w := Withdrawal{Interest: Interest(d.Principal, d.Rate, d.StartDate, asOf), Penalty: ledger.Round(d.Principal * d.PenaltyRate / 100)}
+	if w.Interest > 0 {
+		if err := book(tx, account.AccountID, w.Interest, ledger.TypeInterestPaid, "Term deposit interest"); err != nil {
+			return w, err
+		}
+	}
+	balance := ledger.Round(account.Balance + w.Interest)
+	if w.Penalty > balance {
+		w.Penalty = balance
+	}
+	if w.Penalty > 0 {
+		if err := book(tx, account.AccountID, -w.Penalty, ledger.TypeFee, "Early withdrawal penalty"); err != nil {
+			return w, err
+		}
+	}
+	w.Payout = ledger.Round(balance - w.Penalty)
+	if w.Payout > 0 {
+		if err := ledger.Transfer(tx, account, payout, w.Payout); err != nil {
+			return w, err
+		}
+	}
+	if _, err := tx.Exec("UPDATE term_deposits SET status = ?, closed_at = NOW() WHERE account_id = ?", StatusWithdrawn, account.AccountID); err != nil {
+		return w, fmt.Errorf("closing term deposit %d: %w", account.AccountID, err)
+	}
+	return w, nil
+}
+
+// book changes an account's balance by delta and posts the row recording it
+func book(tx *sql.Tx, accountID int, delta float64, txnType, description string) error {
+	if _, err := tx.Exec("UPDATE accounts SET balance = balance + ? WHERE account_id = ?", delta, accountID); err != nil {
+		return fmt.Errorf("updating balance of account %d: %w", accountID, err)
+	}
+	_, err := ledger.Post(tx, accountID, txnType, math.Abs(delta), description)
+	return err
+}